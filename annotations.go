@@ -0,0 +1,325 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// reviewComment matches reviewer comments that become PDF sticky notes:
+// <!-- comment(alice): needs a second example --> or <!-- comment: ... -->
+var reviewComment = regexp.MustCompile(`(?s)^\s*<!--\s*comment(?:\(([^)]*)\))?:\s*(.*?)\s*-->\s*$`)
+
+// noteSize is the width and height, in points, of a sticky note icon
+const noteSize = 16
+
+// annotation is a PDF annotation that fpdf has no API for (sticky notes,
+// form fields). Annotations are added to the finished PDF by addAnnotations.
+type annotation struct {
+	page       int
+	x, y, w, h float64 // in PDF points; y is the top edge, from the page bottom
+	entries    string  // dictionary entries following /Rect
+	field      bool    // form field, listed in the document's AcroForm
+	// normal appearance streams by state name, e.g. "Yes" and "Off" for checkboxes
+	appearance map[string]string
+}
+
+// annotate records an annotation at the given position on the current page,
+// converting from user units to PDF points.
+func (r *PdfRenderer) annotate(x, y, w, h float64, entries string) *annotation {
+	k := r.Pdf.GetConversionRatio()
+	_, pageHeight := r.pageSize(r.Pdf.PageNo())
+	r.annotations = append(r.annotations, &annotation{
+		page:    r.Pdf.PageNo(),
+		x:       x * k,
+		y:       (pageHeight - y) * k,
+		w:       w * k,
+		h:       h * k,
+		entries: entries,
+	})
+	return r.annotations[len(r.annotations)-1]
+}
+
+// processComment records a reviewer comment as a sticky note at the current
+// position; block comments are placed in the left margin. It reports
+// whether literal was a reviewer comment.
+func (r *PdfRenderer) processComment(literal []byte, block bool) bool {
+	m := reviewComment.FindSubmatch(literal)
+	if m == nil {
+		return false
+	}
+	r.tracer("Comment", fmt.Sprintf("%s: %s", m[1], m[2]))
+	size := noteSize / r.Pdf.GetConversionRatio()
+	x := r.Pdf.GetX()
+	if block {
+		left, _, _, _ := r.Pdf.GetMargins()
+		x = (left - size) / 2
+	}
+	entries := "/Subtype /Text /Contents " + pdfTextString(string(m[2]))
+	if len(m[1]) > 0 {
+		entries += " /T " + pdfTextString(string(m[1]))
+	}
+	r.annotate(x, r.Pdf.GetY(), size, size, entries+" /Name /Comment /C [1 0.85 0.2]")
+	return true
+}
+
+// pdfTextString encodes s as a UTF-16BE PDF hex string
+func pdfTextString(s string) string {
+	var b bytes.Buffer
+	b.WriteString("<FEFF")
+	for _, c := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", c)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+var (
+	startXref = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	trailerRe = regexp.MustCompile(`(?s)trailer\s*<<(.*?)>>\s*startxref\s+\d+\s+%%EOF\s*$`)
+	sizeRe    = regexp.MustCompile(`/Size (\d+)`)
+	rootRe    = regexp.MustCompile(`/Root (\d+) 0 R`)
+	pagesRe   = regexp.MustCompile(`/Pages (\d+) 0 R`)
+	kidsRe    = regexp.MustCompile(`/Kids \[([^\]]*)\]`)
+	refRe     = regexp.MustCompile(`(\d+) 0 R`)
+	infoRe    = regexp.MustCompile(`/Info \d+ 0 R`)
+)
+
+// objectDict returns the dictionary of object num as written by fpdf
+func objectDict(pdf []byte, num int) ([]byte, error) {
+	header := []byte(fmt.Sprintf("\n%d 0 obj\n", num))
+	start := bytes.Index(pdf, header)
+	if start < 0 {
+		return nil, fmt.Errorf("annotations: object %d not found", num)
+	}
+	start += len(header)
+	end := bytes.Index(pdf[start:], []byte("endobj"))
+	if end < 0 {
+		return nil, fmt.Errorf("annotations: object %d not terminated", num)
+	}
+	return append([]byte{}, bytes.TrimSpace(pdf[start:start+end])...), nil
+}
+
+// insertEntries adds entries before the closing >> of a dictionary
+func insertEntries(dict []byte, entries string) []byte {
+	i := bytes.LastIndex(dict, []byte(">>"))
+	head := bytes.TrimRight(dict[:i], " \r\n")
+	return append(head[:len(head):len(head)], append([]byte("\n"+entries+"\n"), dict[i:]...)...)
+}
+
+// pageObjects returns the object numbers of the pages of pdf, in order,
+// from the page tree of the catalog object
+func pageObjects(pdf []byte, catalog int) ([]int, error) {
+	dict, err := objectDict(pdf, catalog)
+	if err != nil {
+		return nil, err
+	}
+	m := pagesRe.FindSubmatch(dict)
+	if m == nil {
+		return nil, fmt.Errorf("annotations: catalog has no pages")
+	}
+	num, _ := strconv.Atoi(string(m[1]))
+	if dict, err = objectDict(pdf, num); err != nil {
+		return nil, err
+	}
+	kids := kidsRe.FindSubmatch(dict)
+	if kids == nil {
+		return nil, fmt.Errorf("annotations: page tree has no kids")
+	}
+	var pages []int
+	for _, ref := range refRe.FindAllSubmatch(kids[1], -1) {
+		n, _ := strconv.Atoi(string(ref[1]))
+		pages = append(pages, n)
+	}
+	return pages, nil
+}
+
+// addAnnotations appends the annotations to the PDF produced by fpdf as an
+// incremental update: new annotation objects plus rewritten page (and, for
+// form fields, catalog) objects that reference them. The entries catalog
+// returns for the page objects, if any, are added to the catalog as well.
+func addAnnotations(pdf []byte, annots []*annotation, catalog func(pages []int) string) ([]byte, error) {
+	xref := startXref.FindSubmatch(pdf)
+	trailer := trailerRe.FindSubmatch(pdf)
+	if xref == nil || trailer == nil {
+		return nil, fmt.Errorf("annotations: unexpected PDF trailer")
+	}
+	if bytes.Contains(trailer[1], []byte("/Encrypt")) {
+		return nil, fmt.Errorf("annotations: cannot annotate an encrypted PDF")
+	}
+	size, _ := strconv.Atoi(string(sizeRe.FindSubmatch(trailer[1])[1]))
+	root := rootRe.FindSubmatch(trailer[1])
+	if root == nil {
+		return nil, fmt.Errorf("annotations: PDF has no catalog")
+	}
+	rootNum, _ := strconv.Atoi(string(root[1]))
+	pageNums, err := pageObjects(pdf, rootNum)
+	if err != nil {
+		return nil, err
+	}
+	catalogEntries := ""
+	if catalog != nil {
+		catalogEntries = catalog(pageNums)
+	}
+	if len(annots) == 0 && catalogEntries == "" {
+		return pdf, nil
+	}
+	for _, a := range annots {
+		if a.page < 1 || a.page > len(pageNums) {
+			return nil, fmt.Errorf("annotations: no page %d", a.page)
+		}
+	}
+
+	out := bytes.NewBuffer(pdf)
+	if !bytes.HasSuffix(pdf, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	offsets := map[int]int{}
+	next := size
+	object := func(num int, body string) {
+		offsets[num] = out.Len()
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", num, body)
+	}
+
+	pageAnnots := map[int][]int{}
+	var pages, fields []int
+	for _, a := range annots {
+		entries := a.entries
+		if len(a.appearance) > 0 {
+			states := make([]string, 0, len(a.appearance))
+			for state := range a.appearance {
+				states = append(states, state)
+			}
+			sort.Strings(states)
+			ap := "/AP <</N <<"
+			for _, state := range states {
+				stream := a.appearance[state]
+				object(next, fmt.Sprintf("<</Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Length %d>>\nstream\n%s\nendstream",
+					a.w, a.h, len(stream), stream))
+				ap += fmt.Sprintf("/%s %d 0 R ", state, next)
+				next++
+			}
+			entries += " " + ap + ">>>>"
+		}
+		object(next, fmt.Sprintf("<</Type /Annot /Rect [%.2f %.2f %.2f %.2f] /P %d 0 R %s>>",
+			a.x, a.y-a.h, a.x+a.w, a.y, pageNums[a.page-1], entries))
+		if pageAnnots[a.page] == nil {
+			pages = append(pages, a.page)
+		}
+		pageAnnots[a.page] = append(pageAnnots[a.page], next)
+		if a.field {
+			fields = append(fields, next)
+		}
+		next++
+	}
+
+	for _, page := range pages {
+		num := pageNums[page-1]
+		dict, err := objectDict(pdf, num)
+		if err != nil {
+			return nil, err
+		}
+		var refs bytes.Buffer
+		for _, a := range pageAnnots[page] {
+			fmt.Fprintf(&refs, "%d 0 R ", a)
+		}
+		if i := bytes.Index(dict, []byte("/Annots [")); i >= 0 {
+			i += len("/Annots [")
+			dict = append(dict[:i:i], append(refs.Bytes(), dict[i:]...)...)
+		} else {
+			dict = insertEntries(dict, "/Annots ["+string(bytes.TrimSpace(refs.Bytes()))+"]")
+		}
+		object(num, string(dict))
+	}
+
+	if len(fields) > 0 {
+		font := next
+		next++
+		object(font, "<</Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding>>")
+		var refs bytes.Buffer
+		for _, f := range fields {
+			fmt.Fprintf(&refs, "%d 0 R ", f)
+		}
+		catalogEntries = strings.TrimSpace(fmt.Sprintf(
+			"/AcroForm <</Fields [%s] /NeedAppearances true /DR <</Font <</Helv %d 0 R>>>> /DA (/Helv 0 Tf 0 g)>>\n%s",
+			bytes.TrimSpace(refs.Bytes()), font, catalogEntries))
+	}
+	if catalogEntries != "" {
+		dict, err := objectDict(pdf, rootNum)
+		if err != nil {
+			return nil, err
+		}
+		object(rootNum, string(insertEntries(dict, catalogEntries)))
+	}
+
+	xrefOffset := out.Len()
+	out.WriteString("xref\n")
+	for num := 0; num < next; num++ {
+		if offset, ok := offsets[num]; ok {
+			fmt.Fprintf(out, "%d 1\n%010d 00000 n \n", num, offset)
+		}
+	}
+	fmt.Fprintf(out, "trailer\n<<\n/Size %d\n%s\n%s\n/Prev %s\n>>\nstartxref\n%d\n%%%%EOF\n",
+		next, root[0], infoRe.Find(trailer[1]), xref[1], xrefOffset)
+	return out.Bytes(), nil
+}
+
+// Output writes the PDF drawn by Run to w, adding the sticky notes, form
+// fields and viewer preferences fpdf can't produce, which r.Pdf.Output
+// leaves out
+func (r *PdfRenderer) Output(w io.Writer) error {
+	if len(r.annotations) == 0 && r.openAt == nil && !r.ViewerPreferences.HideToolbar {
+		return r.Pdf.Output(w)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		return err
+	}
+	pdf, err := addAnnotations(buf.Bytes(), r.annotations, r.viewerCatalog)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pdf)
+	return err
+}
+
+// outputFile writes the PDF to path, see Output
+func (r *PdfRenderer) outputFile(path string) error {
+	if r.Pdf.Err() {
+		return r.Pdf.Error()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Output(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
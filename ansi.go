@@ -0,0 +1,253 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// ansiEscape matches an ANSI escape sequence: a CSI sequence such as the
+// SGR "\x1b[1;31m", or an OSC sequence such as a terminal title
+var ansiEscape = regexp.MustCompile(`\x1b(?:\[([0-9;?]*)([@-~])|\][^\x07\x1b]*(?:\x07|\x1b\\)?)`)
+
+// ansiPalette holds the 16 basic terminal colors, normal then bright,
+// darkened where needed to stay readable on a light page
+var ansiPalette = [16]Color{
+	{0, 0, 0}, {205, 49, 49}, {0, 135, 0}, {175, 135, 0},
+	{0, 95, 215}, {175, 0, 175}, {0, 135, 175}, {128, 128, 128},
+	{102, 102, 102}, {241, 76, 76}, {35, 170, 80}, {200, 160, 0},
+	{59, 142, 234}, {214, 112, 214}, {41, 184, 219}, {160, 160, 160},
+}
+
+// ansiColor returns color n of the 256 color xterm palette
+func ansiColor(n int) Color {
+	switch {
+	case n < 16:
+		return ansiPalette[n]
+	case n < 232:
+		n -= 16
+		level := func(i int) int {
+			if i == 0 {
+				return 0
+			}
+			return 55 + 40*i
+		}
+		return Color{level(n / 36), level(n / 6 % 6), level(n % 6)}
+	default:
+		g := 8 + 10*(n-232)
+		return Color{g, g, g}
+	}
+}
+
+// ansiSpan is a run of text with the same terminal attributes
+type ansiSpan struct {
+	text  string
+	color *Color // nil for the default text color
+	bold  bool
+}
+
+// ansiState is the current terminal text color and weight
+type ansiState struct {
+	color *Color
+	bold  bool
+}
+
+// apply updates the state with the parameters of an SGR sequence
+func (s *ansiState) apply(params string) {
+	if params == "" {
+		params = "0"
+	}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		n, _ := strconv.Atoi(codes[i])
+		switch {
+		case n == 0:
+			*s = ansiState{}
+		case n == 1:
+			s.bold = true
+		case n == 22:
+			s.bold = false
+		case n >= 30 && n <= 37:
+			c := ansiPalette[n-30]
+			s.color = &c
+		case n >= 90 && n <= 97:
+			c := ansiPalette[n-90+8]
+			s.color = &c
+		case n == 39:
+			s.color = nil
+		case n == 38 || n == 48:
+			// extended color: 5;n or 2;r;g;b; backgrounds are not rendered
+			var c Color
+			if i+2 < len(codes) && codes[i+1] == "5" {
+				v, _ := strconv.Atoi(codes[i+2])
+				c = ansiColor(min(max(v, 0), 255))
+				i += 2
+			} else if i+4 < len(codes) && codes[i+1] == "2" {
+				c.Red, _ = strconv.Atoi(codes[i+2])
+				c.Green, _ = strconv.Atoi(codes[i+3])
+				c.Blue, _ = strconv.Atoi(codes[i+4])
+				i += 4
+			} else {
+				i = len(codes)
+				continue
+			}
+			if n == 38 {
+				s.color = &c
+			}
+		}
+	}
+}
+
+// parseANSI splits terminal output into lines of spans, removing the
+// escape sequences. Tabs are expanded to tabWidth, counting only the
+// visible characters.
+func parseANSI(s string, tabWidth int) [][]ansiSpan {
+	var lines [][]ansiSpan
+	var line []ansiSpan
+	var state ansiState
+	col := 0
+	emit := func(text string) {
+		for i, part := range strings.Split(text, "\n") {
+			if i > 0 {
+				lines = append(lines, line)
+				line = nil
+				col = 0
+			}
+			part = strings.ReplaceAll(part, "\r", "")
+			if part == "" {
+				continue
+			}
+			if tabWidth > 0 {
+				var b strings.Builder
+				for _, c := range part {
+					if c == '\t' {
+						n := tabWidth - col%tabWidth
+						b.WriteString(strings.Repeat(" ", n))
+						col += n
+						continue
+					}
+					b.WriteRune(c)
+					col += displayWidth(c)
+				}
+				part = b.String()
+			}
+			line = append(line, ansiSpan{text: part, color: state.color, bold: state.bold})
+		}
+	}
+	for {
+		loc := ansiEscape.FindStringSubmatchIndex(s)
+		if loc == nil {
+			emit(s)
+			break
+		}
+		emit(s[:loc[0]])
+		if loc[4] >= 0 && s[loc[4]:loc[5]] == "m" {
+			state.apply(s[loc[2]:loc[3]])
+		}
+		s = s[loc[1]:]
+	}
+	if line != nil {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// isANSIFence reports whether a fenced block is terminal output to render
+// with its colors: an ansi fence, or a console one containing escapes
+func isANSIFence(node ast.CodeBlock) bool {
+	lang := strings.ToLower(strings.TrimSpace(string(node.Info)))
+	if fields := strings.Fields(lang); len(fields) > 0 {
+		lang = fields[0]
+	}
+	switch lang {
+	case "ansi":
+		return true
+	case "console", "terminal", "shell-session":
+		return strings.Contains(string(node.Literal), "\x1b")
+	}
+	return false
+}
+
+// processANSI renders terminal output in the code style, coloring the text
+// as the ANSI escapes in it say. It reports false if node is not an ANSI
+// fence.
+func (r *PdfRenderer) processANSI(node ast.CodeBlock) bool {
+	if !isANSIFence(node) {
+		return false
+	}
+	lines := parseANSI(sanitizeText(strings.TrimSuffix(string(node.Literal), "\n")), r.TabWidth)
+	style := codeStyle(r.Backtick, string(node.Literal))
+	r.tracer("ANSI", fmt.Sprintf("%d lines", len(lines)))
+	r.cr()
+	lineHeight := r.lineHeight(style)
+	r.keepTogether(float64(len(lines)) * lineHeight)
+	r.beginBlock("Code").started = true
+	defer r.endBlock()
+	width := r.codeWidth(style, 0)
+	clipped, firstClipped := 0, ""
+	defer func() { r.warnClipped(clipped, firstClipped) }()
+	for _, line := range lines {
+		var text strings.Builder
+		for _, span := range line {
+			text.WriteString(span.text)
+		}
+		pieces, clip := r.wrapCode(style, text.String(), width)
+		if clip {
+			if clipped == 0 {
+				firstClipped = text.String()
+			}
+			clipped++
+		}
+		// the spans are cut where the line is wrapped
+		piece, left := 0, len(pieces[0])
+		for _, span := range line {
+			s := style
+			if span.bold {
+				s.Style += "b"
+			}
+			if span.color != nil {
+				s.TextColor = *span.color
+			}
+			r.setStyler(s)
+			t := span.text
+			for len(t) > left && piece < len(pieces) {
+				r.Pdf.Write(lineHeight, t[:left])
+				t = t[left:]
+				if piece++; piece == len(pieces) {
+					break
+				}
+				r.writeWrapMarker(s, lineHeight)
+				r.cr()
+				left = len(pieces[piece])
+			}
+			if piece < len(pieces) {
+				r.Pdf.Write(lineHeight, t)
+				left -= len(t)
+			}
+		}
+		r.cr()
+	}
+	return true
+}
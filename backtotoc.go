@@ -0,0 +1,150 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strings"
+
+	"codeberg.org/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// BackToTOCLabel is the text of the links back to the table of contents,
+// see SetBackToTOC; an arrow pointing up is drawn before it
+var BackToTOCLabel = "Contents"
+
+// BackToTOCPlaces are where SetBackToTOC puts the links back to the table
+// of contents: the footer of every page after it, or the end of every
+// top-level section
+var BackToTOCPlaces = []string{"footer", "sections"}
+
+// SetBackToTOC adds small links back to the table of contents, in the
+// footer or after each top-level section, one of BackToTOCPlaces. The
+// table of contents is the position given by MarkTOC; without one there
+// are no links.
+func SetBackToTOC(where string) RenderOption {
+	return func(r *PdfRenderer) {
+		for _, place := range BackToTOCPlaces {
+			if where == place {
+				r.BackToTOC = where
+				return
+			}
+		}
+		r.logf("Warning: unknown place for the links to the table of contents %q", where)
+	}
+}
+
+// MarkTOC records the current position as that of the table of contents,
+// the target of the SetBackToTOC links; call it before drawing the table
+func (r *PdfRenderer) MarkTOC() {
+	r.tocLink = r.Pdf.AddLink()
+	r.tocPage = r.Pdf.PageNo()
+	r.Pdf.SetLink(r.tocLink, r.Pdf.GetY(), r.tocPage)
+}
+
+// sectionBackToTOC ends the section before a top-level heading with a link
+// back to the table of contents
+func (r *PdfRenderer) sectionBackToTOC(node *ast.Heading) {
+	if r.BackToTOC != "sections" || r.tocPage == 0 || node.Level > r.headingNumbers.base {
+		return
+	}
+	if r.inSection {
+		r.writeBackToTOC()
+	}
+	r.inSection = true
+}
+
+// endBackToTOC adds the links that follow the text: after the last
+// section, or in the footer of the pages after the table of contents
+func (r *PdfRenderer) endBackToTOC() {
+	switch {
+	case r.tocPage == 0:
+		if r.BackToTOC != "" {
+			r.logf("Warning: no table of contents to link back to")
+		}
+	case r.BackToTOC == "sections" && r.inSection:
+		r.writeBackToTOC()
+	case r.BackToTOC == "footer":
+		r.footerBackToTOC()
+	}
+}
+
+// backToTOCStyle is the style of the links back to the table of contents
+func (r *PdfRenderer) backToTOCStyle() Styler {
+	style := r.Link
+	style.Style = strings.ReplaceAll(style.Style, "u", "")
+	style.Size = r.Normal.Size * 0.8
+	return style
+}
+
+// writeBackToTOC writes a link back to the table of contents on a line of
+// its own, at the right margin
+func (r *PdfRenderer) writeBackToTOC() {
+	style := r.backToTOCStyle()
+	r.cr()
+	r.ensureSpace(r.lineHeight(style))
+	r.drawBackToTOC(style, r.Pdf.GetY(), r.lineHeight(style))
+	r.Pdf.Ln(r.lineHeight(style))
+	r.setStyler(r.cs.peek().textStyle)
+}
+
+// footerBackToTOC draws a link back to the table of contents at the bottom
+// of every page after it, below the body text. Drawing state is per page
+// content stream, so the font is set again on each page.
+func (r *PdfRenderer) footerBackToTOC() {
+	style := r.backToTOCStyle()
+	_, breakMargin := r.Pdf.GetAutoPageBreak()
+	lastPage := r.Pdf.PageNo()
+	x, y := r.Pdf.GetXY()
+	r.Pdf.SetAutoPageBreak(false, breakMargin)
+	for page := r.tocPage + 1; page <= r.Pdf.PageCount(); page++ {
+		r.Pdf.SetPage(page)
+		r.setStyler(style)
+		r.Pdf.SetFontSize(style.Size)
+		_, pageHeight := r.pageSize(page)
+		r.drawBackToTOC(style, pageHeight-breakMargin+2+r.pageOffset(page), style.Size)
+	}
+	r.Pdf.SetAutoPageBreak(true, breakMargin)
+	r.Pdf.SetPage(lastPage)
+	r.Pdf.SetXY(x, y)
+	r.setStyler(r.cs.peek().textStyle)
+	r.tracer("BackToTOC", fmt.Sprintf("footer links on pages %d-%d", r.tocPage+1, r.Pdf.PageCount()))
+}
+
+// drawBackToTOC draws an arrow pointing up and BackToTOCLabel, linked to
+// the table of contents, ending at the right margin on a line at y
+func (r *PdfRenderer) drawBackToTOC(style Styler, y, height float64) {
+	r.setStyler(style)
+	w := r.Pdf.GetStringWidth(BackToTOCLabel)
+	arrow := style.Size * 0.5
+	x := r.rightEdge() - w
+	mid := y + height/2
+	r.Pdf.SetFillColor(style.TextColor.Red, style.TextColor.Green, style.TextColor.Blue)
+	r.Pdf.Polygon([]fpdf.PointType{
+		{X: x - arrow*1.4, Y: mid + arrow/2},
+		{X: x - arrow*0.4, Y: mid + arrow/2},
+		{X: x - arrow*0.9, Y: mid - arrow/2},
+	}, "F")
+	r.Pdf.SetFillColor(style.FillColor.Red, style.FillColor.Green, style.FillColor.Blue)
+	r.Pdf.SetXY(x, y)
+	r.Pdf.CellFormat(w, height, BackToTOCLabel, "", 0, "R", false, r.tocLink, "")
+	r.Pdf.Link(x-arrow*1.4, y, arrow*1.4, height, r.tocLink)
+}
@@ -0,0 +1,163 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+)
+
+// quiet zones: the white border around codes, in modules
+const (
+	qrQuietZone      = 2
+	barcodeQuietZone = 10
+)
+
+// drawModules draws the dark modules of a barcode as filled rectangles, so
+// codes stay sharp at any zoom level. Runs of dark modules in a row are
+// merged into one rectangle.
+func (r *PdfRenderer) drawModules(code barcode.Barcode, x, y, w, h float64) {
+	bounds := code.Bounds()
+	mw := w / float64(bounds.Dx())
+	mh := h / float64(bounds.Dy())
+	dark := func(cx, cy int) bool {
+		red, _, _, _ := code.At(cx, cy).RGBA()
+		return red < 0x8000
+	}
+	r.Pdf.SetFillColor(0, 0, 0)
+	for cy := bounds.Min.Y; cy < bounds.Max.Y; cy++ {
+		for cx := bounds.Min.X; cx < bounds.Max.X; cx++ {
+			if !dark(cx, cy) {
+				continue
+			}
+			start := cx
+			for cx+1 < bounds.Max.X && dark(cx+1, cy) {
+				cx++
+			}
+			r.Pdf.Rect(x+float64(start-bounds.Min.X)*mw, y+float64(cy-bounds.Min.Y)*mh,
+				float64(cx-start+1)*mw, mh, "F")
+		}
+	}
+}
+
+// placeCode reserves a w x h box for a code on its own line, honouring
+// align=left|center|right, and returns its position. Codes placed inline
+// start on a new line.
+func (r *PdfRenderer) placeCode(d directive, w, h float64) (float64, float64) {
+	left, _, _, _ := r.Pdf.GetMargins()
+	if r.Pdf.GetX() > left {
+		style := r.cs.peek().textStyle
+		r.Pdf.Ln(r.lineHeight(style))
+	}
+	r.ensureSpace(h)
+	x, y := left, r.Pdf.GetY()
+	switch d.attrs["align"] {
+	case "center":
+		x = left + (r.rightEdge()-left-w)/2
+	case "right":
+		x = r.rightEdge() - w
+	}
+	r.Pdf.SetY(y + h)
+	return x, y
+}
+
+// processQR renders a QR code: {{qr "https://example.com" size=30mm}} or
+// <!-- qr "https://example.com" size=30mm -->
+func (r *PdfRenderer) processQR(d directive) {
+	if len(d.args) == 0 {
+		r.tracer("qr", "missing content")
+		return
+	}
+	code, err := qr.Encode(d.args[0], qr.M, qr.Auto)
+	if err != nil {
+		r.tracer("qr", fmt.Sprintf("%s: %v", d.args[0], err))
+		return
+	}
+	size := r.directiveLength(d, "size", 25*72/25.4/r.Pdf.GetConversionRatio())
+	x, y := r.placeCode(d, size, size)
+	// the white background keeps the code readable on dark themes
+	r.Pdf.SetFillColor(255, 255, 255)
+	r.Pdf.Rect(x, y, size, size, "F")
+	n := float64(code.Bounds().Dx())
+	module := size / (n + 2*qrQuietZone)
+	r.drawModules(code, x+qrQuietZone*module, y+qrQuietZone*module, n*module, n*module)
+	r.tracer("qr", fmt.Sprintf("%s (%.0f)", d.args[0], size))
+}
+
+// encodeBarcode encodes content as a 1D barcode of the given type
+func encodeBarcode(kind, content string) (barcode.Barcode, error) {
+	switch kind {
+	case "code128":
+		return code128.Encode(content)
+	case "ean13", "ean8":
+		// 12 or 7 digits get the check digit appended
+		digits := map[string][]int{"ean13": {12, 13}, "ean8": {7, 8}}[kind]
+		if len(content) != digits[0] && len(content) != digits[1] {
+			return nil, fmt.Errorf("%s needs %d or %d digits", kind, digits[0], digits[1])
+		}
+		return ean.Encode(content)
+	}
+	return nil, fmt.Errorf("unknown barcode type %s (expected code128, ean13 or ean8)", kind)
+}
+
+// processBarcode renders a 1D barcode with its content printed below:
+// {{barcode code128 "ABC-123" width=60mm height=15mm}} or
+// {{barcode ean13 "400638133393"}}; text=false omits the printed content.
+func (r *PdfRenderer) processBarcode(d directive) {
+	if len(d.args) < 2 {
+		r.tracer("barcode", "expected type and content")
+		return
+	}
+	code, err := encodeBarcode(d.args[0], d.args[1])
+	if err != nil {
+		r.tracer("barcode", fmt.Sprintf("%s: %v", d.args[1], err))
+		return
+	}
+	mm := 72 / 25.4 / r.Pdf.GetConversionRatio()
+	w := r.directiveLength(d, "width", 50*mm)
+	h := r.directiveLength(d, "height", 15*mm)
+	style := r.cs.peek().textStyle
+	textHeight := 0.0
+	if d.attrs["text"] != "false" {
+		textHeight = style.Size
+	}
+	x, y := r.placeCode(d, w, h+textHeight)
+
+	n := float64(code.Bounds().Dx())
+	module := w / (n + 2*barcodeQuietZone)
+	r.Pdf.SetFillColor(255, 255, 255)
+	r.Pdf.Rect(x, y, w, h+textHeight, "F")
+	r.drawModules(code, x+barcodeQuietZone*module, y, n*module, h)
+	if textHeight > 0 {
+		// the encoded content includes the computed EAN check digit
+		text := code.Content()
+		r.Pdf.SetFont(r.fontFamily(Styler{Font: style.Font}), "", style.Size*0.8)
+		r.Pdf.SetTextColor(0, 0, 0)
+		r.Pdf.SetXY(x, y+h)
+		r.Pdf.CellFormat(w, textHeight, text, "", 0, "C", false, 0, "")
+		r.Pdf.SetXY(x, y+h+textHeight)
+		r.setStyler(style)
+	}
+	r.tracer("barcode", fmt.Sprintf("%s %s (%.0fx%.0f)", d.args[0], code.Content(), w, h))
+}
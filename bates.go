@@ -0,0 +1,94 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BatesCorners are the corners SetBatesCorner accepts
+var BatesCorners = []string{"bottom-right", "bottom-left", "top-right", "top-left"}
+
+// SetBates stamps every page with a Bates number, prefix followed by a
+// running number from start padded to six digits (ABC001000, ABC001001...),
+// as documents produced in legal proceedings are
+func SetBates(prefix string, start int) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Bates = true
+		r.BatesPrefix = prefix
+		r.BatesStart = start
+	}
+}
+
+// SetBatesCorner sets the corner of the page Bates numbers are stamped in,
+// one of BatesCorners; bottom-right by default
+func SetBatesCorner(corner string) RenderOption {
+	return func(r *PdfRenderer) {
+		if !slices.Contains(BatesCorners, corner) {
+			r.logf("Warning: unknown Bates number corner %q", corner)
+			return
+		}
+		r.BatesCorner = corner
+	}
+}
+
+// batesNumber returns the Bates number of a page, counted from the first
+// page stamped
+func (r *PdfRenderer) batesNumber(page int) string {
+	return fmt.Sprintf("%s%06d", r.BatesPrefix, r.BatesStart+page-1)
+}
+
+// stampBates draws the Bates number of every page in its corner, inside
+// the page margins
+func (r *PdfRenderer) stampBates() {
+	if !r.Bates {
+		return
+	}
+	m := r.currentMargins()
+	style := r.Normal
+	style.Style, style.Size = "b", 0.8*r.Normal.Size
+	height := r.lineHeight(style)
+	page, x, y := r.Pdf.PageNo(), r.Pdf.GetX(), r.Pdf.GetY()
+	r.Pdf.SetAutoPageBreak(false, m.bottom)
+	for p := 1; p <= r.Pdf.PageCount(); p++ {
+		// fonts and colors are per page content stream
+		r.Pdf.SetPage(p)
+		r.setStyler(style)
+		pageWidth, pageHeight := r.pageSize(p)
+		number := r.batesNumber(p)
+		w := r.Pdf.GetStringWidth(number) + 2*r.Pdf.GetCellMargin()
+		cx, cy := pageWidth-m.right-w, pageHeight-(m.bottom+height)/2
+		if strings.HasSuffix(r.BatesCorner, "left") {
+			cx = m.left
+		}
+		if strings.HasPrefix(r.BatesCorner, "top") {
+			cy = (m.top - height) / 2
+		}
+		r.Pdf.SetXY(cx, cy+r.pageOffset(p))
+		r.Pdf.CellFormat(w, height, number, "", 0, "L", false, 0, "")
+	}
+	r.tracer("Bates", fmt.Sprintf("%s to %s", r.batesNumber(1), r.batesNumber(r.Pdf.PageCount())))
+	r.Pdf.SetAutoPageBreak(true, m.bottom)
+	r.Pdf.SetPage(page)
+	r.Pdf.SetXY(x, y)
+	r.setStyler(r.cs.peek().textStyle)
+}
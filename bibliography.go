@@ -0,0 +1,367 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// BibEntry is a single bibliography record
+type BibEntry struct {
+	ID        string
+	Type      string
+	Authors   []string // family names first, e.g. "Smith, John"
+	Year      string
+	Title     string
+	Container string // journal, book or proceedings title
+	Publisher string
+	URL       string
+}
+
+// Bibliography maps citation keys to entries
+type Bibliography map[string]*BibEntry
+
+// ReferencesTitle is the heading of the references section
+var ReferencesTitle = "References"
+
+// citation matches pandoc style citations: [@key], [@key, p. 3], [@a; @b]
+var citation = regexp.MustCompile(`\[(@[\w:.#$%&+?<>~/-]+(?:\s*;\s*@[\w:.#$%&+?<>~/-]+)*)(?:,\s*([^\]]*))?\]`)
+
+// LoadBibliography reads a BibTeX (.bib) or CSL-JSON (.json) file
+func LoadBibliography(path string) (Bibliography, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bib", ".bibtex":
+		return parseBibTeX(string(data))
+	case ".json":
+		return parseCSLJSON(data)
+	}
+	return nil, fmt.Errorf("%s: unsupported bibliography format (expected .bib or .json)", path)
+}
+
+type cslName struct {
+	Family  string `json:"family"`
+	Given   string `json:"given"`
+	Literal string `json:"literal"`
+}
+
+type cslItem struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Title  string    `json:"title"`
+	Author []cslName `json:"author"`
+	Editor []cslName `json:"editor"`
+	Issued struct {
+		DateParts [][]interface{} `json:"date-parts"`
+		Literal   string          `json:"literal"`
+	} `json:"issued"`
+	ContainerTitle string `json:"container-title"`
+	Publisher      string `json:"publisher"`
+	URL            string `json:"URL"`
+}
+
+func parseCSLJSON(data []byte) (Bibliography, error) {
+	var items []cslItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("CSL-JSON: %w", err)
+	}
+	bib := Bibliography{}
+	for _, it := range items {
+		e := &BibEntry{ID: it.ID, Type: it.Type, Title: it.Title,
+			Container: it.ContainerTitle, Publisher: it.Publisher, URL: it.URL}
+		names := it.Author
+		if len(names) == 0 {
+			names = it.Editor
+		}
+		for _, n := range names {
+			switch {
+			case n.Literal != "":
+				e.Authors = append(e.Authors, n.Literal)
+			case n.Given != "":
+				e.Authors = append(e.Authors, n.Family+", "+n.Given)
+			default:
+				e.Authors = append(e.Authors, n.Family)
+			}
+		}
+		if len(it.Issued.DateParts) > 0 && len(it.Issued.DateParts[0]) > 0 {
+			e.Year = fmt.Sprint(it.Issued.DateParts[0][0])
+		} else {
+			e.Year = it.Issued.Literal
+		}
+		bib[e.ID] = e
+	}
+	return bib, nil
+}
+
+// parseBibTeX handles the common subset of BibTeX: @type{key, field = {value}, ...}
+// with braced, quoted or bare values. @comment, @preamble and @string are skipped.
+func parseBibTeX(src string) (Bibliography, error) {
+	bib := Bibliography{}
+	for {
+		at := strings.IndexByte(src, '@')
+		if at < 0 {
+			return bib, nil
+		}
+		src = src[at+1:]
+		open := strings.IndexAny(src, "{(")
+		if open < 0 {
+			return nil, fmt.Errorf("BibTeX: missing '{' after @")
+		}
+		typ := strings.ToLower(strings.TrimSpace(src[:open]))
+		body, rest, err := bibBalanced(src[open:])
+		if err != nil {
+			return nil, err
+		}
+		src = rest
+		if typ == "comment" || typ == "preamble" || typ == "string" {
+			continue
+		}
+		key, fields, _ := strings.Cut(body, ",")
+		e := &BibEntry{ID: strings.TrimSpace(key), Type: typ}
+		for name, value := range bibFields(fields) {
+			switch name {
+			case "author", "editor":
+				if len(e.Authors) == 0 || name == "author" {
+					e.Authors = nil
+					for _, a := range strings.Split(value, " and ") {
+						e.Authors = append(e.Authors, bibName(a))
+					}
+				}
+			case "year":
+				e.Year = value
+			case "title":
+				e.Title = value
+			case "journal", "booktitle":
+				e.Container = value
+			case "publisher", "institution", "school":
+				e.Publisher = value
+			case "url":
+				e.URL = value
+			}
+		}
+		bib[e.ID] = e
+	}
+}
+
+// bibBalanced returns the text between the opening delimiter at s[0] and its
+// matching closing delimiter, and the remainder after it.
+func bibBalanced(s string) (string, string, error) {
+	open, closer := s[0], byte('}')
+	if open == '(' {
+		closer = ')'
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case open:
+			depth++
+		case closer:
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("BibTeX: unbalanced braces")
+}
+
+// bibFields splits "name = {value}, name = "value", name = 2020" pairs
+func bibFields(s string) map[string]string {
+	fields := map[string]string{}
+	for {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return fields
+		}
+		name := strings.ToLower(strings.Trim(strings.TrimSpace(s[:eq]), ","))
+		s = strings.TrimLeft(s[eq+1:], " \t\r\n")
+		var value string
+		switch {
+		case strings.HasPrefix(s, "{"):
+			v, rest, err := bibBalanced(s)
+			if err != nil {
+				return fields
+			}
+			value, s = v, rest
+		case strings.HasPrefix(s, `"`):
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return fields
+			}
+			value, s = s[1:end+1], s[end+2:]
+		default:
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		value = strings.NewReplacer("{", "", "}", "").Replace(value)
+		fields[name] = strings.Join(strings.Fields(value), " ")
+		s = strings.TrimLeft(s, " \t\r\n,")
+	}
+}
+
+// bibName normalizes "John Smith" to "Smith, John"
+func bibName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.Contains(name, ",") {
+		return name
+	}
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[len(parts)-1] + ", " + strings.Join(parts[:len(parts)-1], " ")
+}
+
+// family returns the family name part of "Smith, John"
+func family(author string) string {
+	f, _, _ := strings.Cut(author, ",")
+	return strings.TrimSpace(f)
+}
+
+// inText returns the author-year label used for in-text citations
+func (e *BibEntry) inText() string {
+	var who string
+	switch len(e.Authors) {
+	case 0:
+		who = e.Title
+	case 1:
+		who = family(e.Authors[0])
+	case 2:
+		who = family(e.Authors[0]) + " and " + family(e.Authors[1])
+	default:
+		who = family(e.Authors[0]) + " et al."
+	}
+	if e.Year == "" {
+		return who
+	}
+	return who + " " + e.Year
+}
+
+// reference returns the formatted entry for the references section
+func (e *BibEntry) reference() string {
+	var b strings.Builder
+	switch len(e.Authors) {
+	case 0:
+	case 1:
+		b.WriteString(e.Authors[0])
+	default:
+		b.WriteString(strings.Join(e.Authors[:len(e.Authors)-1], "; "))
+		b.WriteString(" and " + e.Authors[len(e.Authors)-1])
+	}
+	if e.Year != "" {
+		fmt.Fprintf(&b, " (%s).", e.Year)
+	}
+	if e.Title != "" {
+		fmt.Fprintf(&b, " %s.", e.Title)
+	}
+	if e.Container != "" {
+		fmt.Fprintf(&b, " *%s*.", e.Container)
+	}
+	if e.Publisher != "" {
+		fmt.Fprintf(&b, " %s.", e.Publisher)
+	}
+	if e.URL != "" {
+		fmt.Fprintf(&b, " <%s>", e.URL)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// resolveCitations replaces pandoc style citations with author-year labels
+// and records the cited keys for the references section.
+func (r *PdfRenderer) resolveCitations(s string) string {
+	if r.Bibliography == nil {
+		return s
+	}
+	return citation.ReplaceAllStringFunc(s, func(m string) string {
+		sub := citation.FindStringSubmatch(m)
+		if isCrossRef(strings.TrimPrefix(sub[1], "@")) {
+			return m
+		}
+		var labels []string
+		for _, key := range strings.Split(sub[1], ";") {
+			key = strings.TrimPrefix(strings.TrimSpace(key), "@")
+			e, ok := r.Bibliography[key]
+			if !ok {
+				r.tracer("Citation", fmt.Sprintf("unknown key %s", key))
+				labels = append(labels, key+"?")
+				continue
+			}
+			if !r.cited[key] {
+				if r.cited == nil {
+					r.cited = map[string]bool{}
+				}
+				r.cited[key] = true
+			}
+			labels = append(labels, e.inText())
+		}
+		label := strings.Join(labels, "; ")
+		if sub[2] != "" {
+			label += ", " + sub[2]
+		}
+		return "(" + label + ")"
+	})
+}
+
+// renderReferences renders the entries cited in the document, sorted by
+// author and year, after the document body.
+func (r *PdfRenderer) renderReferences() {
+	if len(r.cited) == 0 {
+		return
+	}
+	entries := make([]*BibEntry, 0, len(r.cited))
+	for key := range r.cited {
+		entries = append(entries, r.Bibliography[key])
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].reference(), entries[j].reference()
+		return strings.ToLower(a) < strings.ToLower(b)
+	})
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %s\n\n", ReferencesTitle)
+	for _, e := range entries {
+		fmt.Fprintf(&md, "%s\n\n", e.reference())
+	}
+	doc := markdown.Parse([]byte(md.String()), parser.NewWithExtensions(parser.Autolink))
+	_ = markdown.Render(doc, r)
+}
+
+// SetBibliography sets the bibliography that pandoc style citations
+// ([@key]) are resolved against. Cited entries are listed in a references
+// section at the end of the document.
+func SetBibliography(bib Bibliography) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Bibliography = bib
+	}
+}
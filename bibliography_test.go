@@ -0,0 +1,65 @@
+package mdtopdf
+
+import "testing"
+
+const testBibTeX = `
+@comment{ ignored }
+@article{smith2020,
+  author  = {John Smith and Doe, Jane},
+  title   = {On {Markdown} Rendering},
+  journal = "Journal of Documents",
+  year    = 2020,
+}
+@book{lee2019, author = {Lee, Ann and Bo Chan and Cy Dee}, title = {Typesetting}, year = {2019}}
+`
+
+func TestParseBibTeX(t *testing.T) {
+	bib, err := parseBibTeX(testBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := bib["smith2020"]
+	if !ok {
+		t.Fatalf("entry not found in %v", bib)
+	}
+	if e.Title != "On Markdown Rendering" || e.Year != "2020" || e.Container != "Journal of Documents" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if len(e.Authors) != 2 || e.Authors[0] != "Smith, John" || e.Authors[1] != "Doe, Jane" {
+		t.Fatalf("unexpected authors %q", e.Authors)
+	}
+}
+
+func TestResolveCitations(t *testing.T) {
+	bib, err := parseBibTeX(testBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &PdfRenderer{Bibliography: bib}
+	cases := map[string]string{
+		"See [@smith2020].":                 "See (Smith and Doe 2020).",
+		"See [@lee2019, p. 4].":             "See (Lee et al. 2019, p. 4).",
+		"Both [@smith2020; @lee2019] agree": "Both (Smith and Doe 2020; Lee et al. 2019) agree",
+		"Missing [@nobody].":                "Missing (nobody?).",
+		"Plain [link] text":                 "Plain [link] text",
+	}
+	for in, expected := range cases {
+		if got := r.resolveCitations(in); got != expected {
+			t.Errorf("%q: expected %q got %q", in, expected, got)
+		}
+	}
+	if !r.cited["smith2020"] || !r.cited["lee2019"] || r.cited["nobody"] {
+		t.Fatalf("unexpected cited keys %v", r.cited)
+	}
+}
+
+func TestParseCSLJSON(t *testing.T) {
+	bib, err := parseCSLJSON([]byte(`[{"id":"k1","type":"book","title":"T",
+		"author":[{"family":"Knuth","given":"Donald"}],"issued":{"date-parts":[[1984]]}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bib["k1"].inText(); got != "Knuth 1984" {
+		t.Fatalf("unexpected label %q", got)
+	}
+}
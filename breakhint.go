@@ -0,0 +1,173 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// isBreakHint reports whether node is a <!-- break-hint --> on a line of
+// its own
+func isBreakHint(node ast.Node) bool {
+	html, ok := node.(*ast.HTMLBlock)
+	if !ok {
+		return false
+	}
+	d, ok := parseDirective(html.Literal)
+	return ok && d.name == "break-hint"
+}
+
+// processBreakHint handles a <!-- break-hint -->, a place where a page
+// break is acceptable, e.g. between the groups of steps of a long list: the
+// page is broken there if what follows, up to the next hint, does not fit
+// in the space left but fits on a page. The part ends at the end of the
+// block the hint is in, unless the hint is at the top level; its height is
+// estimated from its text, or given with need=40mm.
+func (r *PdfRenderer) processBreakHint(node ast.Node, d directive) {
+	_, top, _, _ := r.Pdf.GetMargins()
+	if r.Pdf.GetY() <= top+0.5 {
+		return
+	}
+	var need float64
+	if _, ok := d.attrs["need"]; ok {
+		need = r.directiveLength(d, "need", 0)
+	} else {
+		need = r.partHeight(node)
+		r.setStyler(r.cs.peek().textStyle)
+	}
+	left := r.spaceLeft()
+	r.tracer("break-hint", fmt.Sprintf("need %.2f, have %.2f", need, left))
+	if need > left && need <= r.pageContentHeight() {
+		r.addPage()
+	}
+}
+
+// partHeight estimates the height of what follows the break hint node, up
+// to the next hint
+func (r *PdfRenderer) partHeight(node ast.Node) float64 {
+	left, _, _, _ := r.Pdf.GetMargins()
+	width := r.rightEdge() - left
+	total := 0.0
+	for n := node; n.GetParent() != nil; n = n.GetParent() {
+		siblings := n.GetParent().GetChildren()
+		i := 0
+		for i < len(siblings) && siblings[i] != n {
+			i++
+		}
+		h, stop := r.heightUntilHint(siblings[i+1:], width, r.pageContentHeight()-total)
+		total += h
+		if stop || total > r.pageContentHeight() {
+			break
+		}
+		if _, ok := n.GetParent().GetParent().(*ast.Document); ok {
+			// the end of the top-level block the hint is in
+			break
+		}
+	}
+	return total
+}
+
+// heightUntilHint estimates the height of nodes laid out width wide, up to
+// a break hint among them or in them, and reports whether it met one. It
+// gives up once the height passes limit.
+func (r *PdfRenderer) heightUntilHint(nodes []ast.Node, width, limit float64) (float64, bool) {
+	total := 0.0
+	for _, n := range nodes {
+		if isBreakHint(n) {
+			return total, true
+		}
+		if total > limit {
+			return total, false
+		}
+		switch n := n.(type) {
+		case *ast.List:
+			h, stop := r.heightUntilHint(n.Children, width-r.IndentValue, limit-total)
+			total += h
+			if stop {
+				return total, true
+			}
+		case *ast.ListItem, *ast.BlockQuote:
+			h, stop := r.heightUntilHint(n.GetChildren(), width, limit-total)
+			total += h
+			if stop {
+				return total, true
+			}
+		default:
+			total += r.blockHeight(n, width)
+		}
+	}
+	return total, false
+}
+
+// blockHeight estimates the height of a block laid out width wide, from the
+// number of lines of its text
+func (r *PdfRenderer) blockHeight(node ast.Node, width float64) float64 {
+	lines := func(s Styler, text string) float64 {
+		r.setStyler(s)
+		n := 0.0
+		for _, line := range strings.Split(text, "\n") {
+			n += max(1, math.Ceil(r.Pdf.GetStringWidth(displayText(line))/width))
+		}
+		return n * r.lineHeight(s)
+	}
+	switch n := node.(type) {
+	case *ast.Paragraph:
+		// paragraphs of list items are not spaced
+		gap := r.lineHeight(r.Normal)
+		if isListItem(n.Parent) {
+			gap = 0
+		}
+		if img := soleImage(n); img != nil {
+			path := r.localPath(string(img.Destination))
+			if _, err := os.Stat(path); err == nil {
+				if _, info := r.registerImage(path); info != nil && !r.Pdf.Err() {
+					_, h := r.imageSize(info)
+					return h + gap
+				}
+				r.Pdf.ClearError()
+			}
+		}
+		text := strings.ReplaceAll(ExtractTextFromNode(n), "\n", " ")
+		return lines(r.Normal, text) + gap
+	case *ast.Heading:
+		s := *r.styler(fmt.Sprintf("H%d", min(max(n.Level, 1), 6)))
+		return lines(s, ExtractTextFromNode(n)) + r.lineHeight(s)
+	case *ast.CodeBlock:
+		text := strings.TrimSuffix(string(n.Literal), "\n")
+		return lines(r.Code, text) + r.lineHeight(r.Normal)
+	case *ast.Table:
+		rows := 0.0
+		ast.WalkFunc(n, func(node ast.Node, entering bool) ast.WalkStatus {
+			if _, ok := node.(*ast.TableRow); ok && entering {
+				rows++
+			}
+			return ast.GoToNext
+		})
+		return (rows + 1) * r.lineHeight(r.TBody)
+	case *ast.HorizontalRule:
+		return r.lineHeight(r.Normal)
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// calloutMarker starts the first line of an Obsidian callout, as in
+// > [!info]- Custom title; GitHub alerts such as > [!NOTE] are the same
+var calloutMarker = regexp.MustCompile(`^\[!([\w-]+)\]([+-]?)[ \t]*`)
+
+// callouts turns the Obsidian callouts of doc, block quotes starting with
+// [!type], into panels labelled with their title, or with their type
+// without one. A callout folded by default, [!type]-, shows only its label
+// and CollapsedLabel if r.CollapseDetails is set.
+func (r *PdfRenderer) callouts(doc ast.Node) {
+	splitCallouts(doc)
+	var quotes []*ast.BlockQuote
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if q, ok := node.(*ast.BlockQuote); ok && entering {
+			quotes = append(quotes, q)
+		}
+		return ast.GoToNext
+	})
+	// innermost first, so that nested callouts are moved along converted
+	for i := len(quotes) - 1; i >= 0; i-- {
+		q := quotes[i]
+		p, first, m := calloutStart(ast.GetFirstChild(q))
+		if m == nil {
+			continue
+		}
+		kind, folded := string(first.Literal[m[2]:m[3]]), string(first.Literal[m[4]:m[5]]) == "-"
+		first.Literal = first.Literal[m[1]:]
+		title := strings.TrimSpace(calloutTitle(p))
+		if title == "" {
+			title = strings.ToUpper(kind[:1]) + strings.ToLower(kind[1:])
+		}
+		// the label is the argument of a directive comment
+		title = strings.NewReplacer(`"`, "", "--", "-").Replace(title)
+		body := q.Children
+		if len(p.Children) == 0 {
+			body = body[1:]
+		}
+		if folded && r.CollapseDetails {
+			emph := &ast.Emph{}
+			ast.AppendChild(emph, &ast.Text{Leaf: ast.Leaf{Literal: []byte("(" + CollapsedLabel + ")")}})
+			note := &ast.Paragraph{}
+			ast.AppendChild(note, emph)
+			body = []ast.Node{note}
+		}
+		nodes := []ast.Node{&ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte("<!-- panel " + title + " -->")}}}
+		nodes = append(nodes, body...)
+		nodes = append(nodes, &ast.HTMLBlock{Leaf: ast.Leaf{Literal: []byte("<!-- /panel -->")}})
+		r.tracer("Callout", fmt.Sprintf("%s %q, %d blocks", kind, title, len(body)))
+		replaceNode(q, nodes...)
+	}
+}
+
+// calloutStart returns the paragraph node, its first text and the
+// submatches of calloutMarker in it if node starts a callout
+func calloutStart(node ast.Node) (*ast.Paragraph, *ast.Text, []int) {
+	p, ok := node.(*ast.Paragraph)
+	if !ok {
+		return nil, nil, nil
+	}
+	first, ok := ast.GetFirstChild(p).(*ast.Text)
+	if !ok {
+		return nil, nil, nil
+	}
+	return p, first, calloutMarker.FindSubmatchIndex(first.Literal)
+}
+
+// splitCallouts splits the block quotes of doc before each paragraph that
+// starts a callout: the parser merges quotes with only a blank line
+// between them, as consecutive callouts often are
+func splitCallouts(doc ast.Node) {
+	var quotes []*ast.BlockQuote
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if q, ok := node.(*ast.BlockQuote); ok && entering {
+			quotes = append(quotes, q)
+		}
+		return ast.GoToNext
+	})
+	for _, q := range quotes {
+		parts := []ast.Node{q}
+		children := q.Children
+		for i := len(children) - 1; i > 0; i-- {
+			if _, _, m := calloutStart(children[i]); m == nil {
+				continue
+			}
+			rest := &ast.BlockQuote{}
+			rest.SetChildren(append([]ast.Node(nil), children[i:]...))
+			for _, child := range rest.Children {
+				child.SetParent(rest)
+			}
+			children = children[:i]
+			parts = append([]ast.Node{q, rest}, parts[1:]...)
+		}
+		if len(parts) > 1 {
+			q.Children = children
+			replaceNode(q, parts...)
+		}
+	}
+}
+
+// calloutTitle removes the first line of the first paragraph of a callout,
+// after its marker, and returns its text
+func calloutTitle(p *ast.Paragraph) string {
+	var title strings.Builder
+	for len(p.Children) > 0 {
+		child := p.Children[0]
+		if t, ok := child.(*ast.Text); ok {
+			if line, rest, found := strings.Cut(string(t.Literal), "\n"); found {
+				title.WriteString(line)
+				t.Literal = []byte(rest)
+				return title.String()
+			}
+		}
+		switch child.(type) {
+		case *ast.Softbreak, *ast.Hardbreak:
+			p.Children = p.Children[1:]
+			return title.String()
+		}
+		title.WriteString(ExtractTextFromNode(child))
+		p.Children = p.Children[1:]
+	}
+	return title.String()
+}
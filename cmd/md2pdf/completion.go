@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/solworktech/md2pdf/v2"
+	flag "github.com/spf13/pflag"
+)
+
+// shells lists the shells `md2pdf completion` generates scripts for
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// subcommand is a command md2pdf takes as its first argument, in place of
+// an input file, with the actions it takes as its second
+type subcommand struct {
+	name, usage string
+	actions     []string
+}
+
+// subcommands are completed as the first argument; the font `md2pdf fonts
+// preview` takes is completed from the preset fonts
+var subcommands = []subcommand{
+	{"completion", "Generate a shell completion script", shells},
+	{"fonts", "List or preview the preset fonts", []string{"list", "preview"}},
+	{"theme", "Validate or preview a theme file", []string{"validate", "preview"}},
+}
+
+// subcommandNames returns the names of the subcommands
+func subcommandNames() []string {
+	names := make([]string, len(subcommands))
+	for i, c := range subcommands {
+		names[i] = c.name
+	}
+	return names
+}
+
+// fileFlags take a file or directory name
+var fileFlags = map[string]bool{
+	"input":        true,
+	"output":       true,
+	"syntax-files": true,
+	"theme":        true,
+	"code-font":    true,
+	"glossary":     true,
+	"bibliography": true,
+	"diff-base":    true,
+	"log-file":     true,
+	"sort":         true,
+	"config":       true,
+	"dump-config":  true,
+}
+
+// choices matches the list of values in a flag's usage, e.g.
+// "[light | dark | /path/to/custom/theme.json]"
+var choices = regexp.MustCompile(`\[([^\[\]]*\|[^\[\]]*)\]`)
+
+// completionFlag is a flag as described to a completion script
+type completionFlag struct {
+	name, short, usage string
+	takesValue, file   bool
+	values             []string
+}
+
+// completionFlags collects the command line flags, with the values listed
+// in their usage; paths in the list stand for files
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		c := completionFlag{
+			name:       f.Name,
+			short:      f.Shorthand,
+			usage:      strings.SplitN(f.Usage, ";", 2)[0],
+			takesValue: f.Value.Type() != "bool",
+			file:       fileFlags[f.Name],
+		}
+		if m := choices.FindStringSubmatch(f.Usage); m != nil && c.takesValue {
+			for _, v := range strings.Split(m[1], "|") {
+				v = strings.TrimSpace(v)
+				if strings.ContainsAny(v, "/.") || strings.Contains(v, " ") {
+					continue
+				}
+				c.values = append(c.values, v)
+			}
+		}
+		flags = append(flags, c)
+	})
+	return flags
+}
+
+// writeCompletion writes the completion script for shell to w
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		bashCompletion(w, flags)
+	case "zsh":
+		zshCompletion(w, flags)
+	case "fish":
+		fishCompletion(w, flags)
+	case "powershell":
+		powershellCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q (expected %s)", shell, strings.Join(shells, ", "))
+	}
+	return nil
+}
+
+func bashCompletion(w io.Writer, flags []completionFlag) {
+	var names []string
+	fmt.Fprintln(w, "# bash completion for md2pdf; load with: source <(md2pdf completion bash)")
+	fmt.Fprintln(w, "_md2pdf() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	case "$prev" in`)
+	for _, f := range flags {
+		names = append(names, "--"+f.name)
+		pattern := "--" + f.name
+		if f.short != "" {
+			names = append(names, "-"+f.short)
+			pattern += "|-" + f.short
+		}
+		switch {
+		case !f.takesValue:
+		case len(f.values) > 0 && f.file:
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\")); return ;;\n", pattern, strings.Join(f.values, " "))
+		case len(f.values) > 0:
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", pattern, strings.Join(f.values, " "))
+		case f.file:
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", pattern)
+		default:
+			fmt.Fprintf(w, "\t%s) return ;;\n", pattern)
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, `	elif [[ $COMP_CWORD -eq 1 ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(subcommandNames(), " "))
+	for _, c := range subcommands {
+		fmt.Fprintf(w, "\telif [[ $COMP_CWORD -eq 2 && \"$prev\" == %s ]]; then\n", c.name)
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(c.actions, " "))
+	}
+	fmt.Fprintln(w, `	elif [[ $COMP_CWORD -eq 3 && "${COMP_WORDS[1]}" == fonts && "$prev" == preview ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(mdtopdf.PresetFontNames(), " "))
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _md2pdf md2pdf")
+}
+
+// zshQuote escapes s for a single quoted _arguments spec
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func zshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "#compdef md2pdf")
+	fmt.Fprintln(w, "# zsh completion for md2pdf; save as _md2pdf in a directory of $fpath")
+	fmt.Fprintln(w, "_arguments -s \\")
+	for _, f := range flags {
+		action := ""
+		switch {
+		case !f.takesValue:
+		case len(f.values) > 0 && f.file:
+			action = fmt.Sprintf(":%s:_alternative 'values:value:(%s)' 'files:file:_files'", f.name, strings.Join(f.values, " "))
+		case len(f.values) > 0:
+			action = fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+		case f.file:
+			action = fmt.Sprintf(":%s:_files", f.name)
+		default:
+			action = fmt.Sprintf(":%s: ", f.name)
+		}
+		spec := fmt.Sprintf("[%s]%s", zshQuote(f.usage), strings.ReplaceAll(action, "'", `'\''`))
+		if f.short != "" {
+			fmt.Fprintf(w, "\t'(-%s --%s)'{-%s,--%s}'%s' \\\n", f.short, f.name, f.short, f.name, spec)
+		} else {
+			fmt.Fprintf(w, "\t'--%s%s' \\\n", f.name, spec)
+		}
+	}
+	fmt.Fprintf(w, "\t'1: :_alternative \"commands:command:(%s)\" \"files:file:_files\"' \\\n", strings.Join(subcommandNames(), " "))
+	var actions []string
+	for _, c := range subcommands {
+		actions = append(actions, fmt.Sprintf("%s) compadd %s;;", c.name, strings.Join(c.actions, " ")))
+	}
+	fmt.Fprintf(w, "\t'2: :{case $line[1] in %s *) _files;; esac}' \\\n", strings.Join(actions, " "))
+	fmt.Fprintf(w, "\t'3: :{if [[ $line[1] == fonts && $line[2] == preview ]]; then compadd %s; else _files; fi}' \\\n", strings.Join(mdtopdf.PresetFontNames(), " "))
+	fmt.Fprintf(w, "\t'*:file:_files'\n")
+}
+
+func fishCompletion(w io.Writer, flags []completionFlag) {
+	quote := strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace
+	fmt.Fprintln(w, "# fish completion for md2pdf; save as ~/.config/fish/completions/md2pdf.fish")
+	for _, c := range subcommands {
+		fmt.Fprintf(w, "complete -c md2pdf -n '__fish_use_subcommand' -a %s -d '%s'\n", c.name, quote(c.usage))
+		fmt.Fprintf(w, "complete -c md2pdf -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -x -a '%s'\n",
+			c.name, strings.Join(c.actions, " "), strings.Join(c.actions, " "))
+	}
+	fmt.Fprintf(w, "complete -c md2pdf -n '__fish_seen_subcommand_from fonts; and __fish_seen_subcommand_from preview' -x -a '%s'\n", strings.Join(mdtopdf.PresetFontNames(), " "))
+	for _, f := range flags {
+		line := "complete -c md2pdf -l " + f.name
+		if f.short != "" {
+			line += " -s " + f.short
+		}
+		switch {
+		case !f.takesValue:
+		case len(f.values) > 0 && f.file:
+			line += fmt.Sprintf(" -r -F -a '%s'", strings.Join(f.values, " "))
+		case len(f.values) > 0:
+			line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+		case f.file:
+			line += " -r -F"
+		default:
+			line += " -x"
+		}
+		fmt.Fprintf(w, "%s -d '%s'\n", line, quote(f.usage))
+	}
+}
+
+func powershellCompletion(w io.Writer, flags []completionFlag) {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	fmt.Fprintln(w, "# PowerShell completion for md2pdf; load with: md2pdf completion powershell | Out-String | Invoke-Expression")
+	fmt.Fprintln(w, "Register-ArgumentCompleter -Native -CommandName md2pdf -ScriptBlock {")
+	fmt.Fprintln(w, "    param($wordToComplete, $commandAst, $cursorPosition)")
+	fmt.Fprintln(w, "    $flags = [ordered]@{")
+	for _, f := range flags {
+		fmt.Fprintf(w, "        %s = %s\n", quote("--"+f.name), quote(f.usage))
+		if f.short != "" {
+			fmt.Fprintf(w, "        %s = %s\n", quote("-"+f.short), quote(f.usage))
+		}
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $values = @{")
+	for _, f := range flags {
+		if len(f.values) == 0 {
+			continue
+		}
+		var vs []string
+		for _, v := range f.values {
+			vs = append(vs, quote(v))
+		}
+		fmt.Fprintf(w, "        %s = @(%s)\n", quote("--"+f.name), strings.Join(vs, ", "))
+		if f.short != "" {
+			fmt.Fprintf(w, "        %s = @(%s)\n", quote("-"+f.short), strings.Join(vs, ", "))
+		}
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $actions = @{")
+	for _, c := range subcommands {
+		fmt.Fprintf(w, "        %s = @(%s)\n", quote(c.name), quoteAll(c.actions, quote))
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $elements = $commandAst.CommandElements | ForEach-Object { $_.ToString() }")
+	fmt.Fprintln(w, "    $prev = if ($wordToComplete) { $elements[-2] } else { $elements[-1] }")
+	fmt.Fprintln(w, "    $position = if ($wordToComplete) { $elements.Count - 1 } else { $elements.Count }")
+	fmt.Fprintln(w, "    $choices = $null")
+	fmt.Fprintln(w, "    if ($position -eq 1 -and $wordToComplete -notlike '-*') {")
+	fmt.Fprintf(w, "        $choices = @(%s)\n", quoteAll(subcommandNames(), quote))
+	fmt.Fprintln(w, "    } elseif ($position -eq 2 -and $actions.Contains($prev)) {")
+	fmt.Fprintln(w, "        $choices = $actions[$prev]")
+	fmt.Fprintln(w, "    } elseif ($position -eq 3 -and $elements[1] -eq 'fonts' -and $prev -eq 'preview') {")
+	fmt.Fprintf(w, "        $choices = @(%s)\n", quoteAll(mdtopdf.PresetFontNames(), quote))
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if ($choices) {")
+	fmt.Fprintln(w, "        return $choices | Where-Object { $_ -like \"$wordToComplete*\" } |")
+	fmt.Fprintln(w, "            ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if ($values.Contains($prev)) {")
+	fmt.Fprintln(w, "        return $values[$prev] | Where-Object { $_ -like \"$wordToComplete*\" } |")
+	fmt.Fprintln(w, "            ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if ($wordToComplete -like '-*') {")
+	fmt.Fprintln(w, "        return $flags.Keys | Where-Object { $_ -like \"$wordToComplete*\" } |")
+	fmt.Fprintln(w, "            ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterName', $flags[$_]) }")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "}")
+}
+
+// quoteAll quotes each of values and joins them with commas
+func quoteAll(values []string, quote func(string) string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quote(v)
+	}
+	return strings.Join(quoted, ", ")
+}
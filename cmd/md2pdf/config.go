@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+var configFile = flag.String("config", "", "YAML file of option values, e.g. written by --dump-config; options on the command line take precedence")
+var dumpConfig = flag.String("dump-config", "", "Write the options in effect, from the command line, --config, the front matter of the input and the defaults, as YAML to this file (- for stdout)")
+
+// unconfigured are the flags a config file neither lists nor sets: the
+// files of a single run, and those that are not conversion options
+var unconfigured = map[string]bool{
+	"input":       true,
+	"output":      true,
+	"help":        true,
+	"version":     true,
+	"config":      true,
+	"dump-config": true,
+}
+
+// readConfig sets the options of a YAML config file that are not given on
+// the command line, e.g.
+//
+//	theme: dark
+//	generate-toc: true
+//	exclude:
+//	  - drafts/*
+//
+// Values equal to the default are skipped, so that a dumped configuration
+// does not count as options given, e.g. --dialect with --gfm.
+func readConfig(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var config yaml.MapSlice
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for _, item := range config {
+		name := fmt.Sprint(item.Key)
+		f := flag.Lookup(name)
+		if f == nil || unconfigured[name] {
+			return fmt.Errorf("%s: unknown option %q", file, name)
+		}
+		if f.Changed {
+			continue
+		}
+		var values []string
+		switch v := item.Value.(type) {
+		case []interface{}:
+			if f.Value.Type() != "stringArray" {
+				return fmt.Errorf("%s: %s takes a single value", file, name)
+			}
+			for _, s := range v {
+				values = append(values, fmt.Sprint(s))
+			}
+		case nil:
+			values = []string{""}
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		if f.Value.Type() != "stringArray" && values[0] == f.DefValue {
+			continue
+		}
+		for _, v := range values {
+			if err := flag.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", file, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeConfig writes the value of every option as YAML, in the form
+// readConfig takes
+func writeConfig(w io.Writer) error {
+	var config yaml.MapSlice
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if unconfigured[f.Name] || err != nil {
+			return
+		}
+		var value interface{}
+		switch f.Value.Type() {
+		case "bool":
+			value, err = strconv.ParseBool(f.Value.String())
+		case "int":
+			value, err = strconv.Atoi(f.Value.String())
+		case "float64":
+			value, err = strconv.ParseFloat(f.Value.String(), 64)
+		case "stringArray":
+			value, err = flag.CommandLine.GetStringArray(f.Name)
+		default:
+			value = f.Value.String()
+		}
+		config = append(config, yaml.MapItem{Key: f.Name, Value: value})
+	})
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// dumpConfigFile writes the options in effect to file, or to stdout if it
+// is "-". The fields of frontMatter no --define sets are written as
+// defines, as they are template variables of the conversion.
+func dumpConfigFile(file string, frontMatter map[string]string) error {
+	defined := map[string]bool{}
+	for _, d := range *defines {
+		key, _, _ := strings.Cut(d, "=")
+		defined[strings.TrimSpace(key)] = true
+	}
+	for _, key := range slices.Sorted(maps.Keys(frontMatter)) {
+		if !defined[key] {
+			if err := flag.Set("define", key+"="+frontMatter[key]); err != nil {
+				return err
+			}
+		}
+	}
+	if file == "-" {
+		return writeConfig(os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := writeConfig(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
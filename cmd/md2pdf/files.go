@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/solworktech/md2pdf/v2"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v2"
+)
+
+// bookManifest in an input directory lists its chapters in order, see
+// readManifest
+const bookManifest = "book.yaml"
+
+// manifest is the content of a book.yaml file
+type manifest struct {
+	Chapters []string `yaml:"chapters"`
+}
+
+// fileTitle returns the title of the bookmark of a file of a directory
+// input: the title of its front matter, its first heading, or else its
+// name without the extension, made safe for a directive attribute. The
+// headings are those r parses.
+func fileTitle(r *mdtopdf.PdfRenderer, file string, frontMatter map[string]string, content []byte) string {
+	title := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if frontMatter["title"] != "" {
+		title = frontMatter["title"]
+	} else if headings, _ := r.TOCEntries(content); len(headings) > 0 && headings[0].Title != "" {
+		title = headings[0].Title
+	}
+	return titleReplacer.Replace(title)
+}
+
+// titleReplacer makes a title safe for a directive attribute
+var titleReplacer = strings.NewReplacer(`"`, "'", "--", "-", "\n", " ")
+
+// startsWithTitle reports whether content, without its front matter, starts
+// with a level 1 heading of title, whose bookmark then is that of the file;
+// the heading is parsed by r
+func startsWithTitle(r *mdtopdf.PdfRenderer, content []byte, title string) bool {
+	lines := strings.SplitN(strings.TrimLeft(string(content), " \t\r\n"), "\n", 3)
+	// an ATX heading, or a setext heading and its underline
+	for n := 1; n <= min(2, len(lines)); n++ {
+		entries, _ := r.TOCEntries([]byte(strings.Join(lines[:n], "\n")))
+		if len(entries) > 0 {
+			return entries[0].Level == 1 && titleReplacer.Replace(entries[0].Title) == title
+		}
+	}
+	return false
+}
+
+// applyFrontMatter uses the fields of the front matter of the input for
+// what the command line leaves unset: the title and author, and --define
+// variables of the same names
+func applyFrontMatter(frontMatter, vars map[string]string) {
+	for key, value := range frontMatter {
+		if _, ok := vars[key]; !ok {
+			vars[key] = value
+		}
+	}
+	if *title == "" {
+		*title = frontMatter["title"]
+	}
+	if *author == "" {
+		*author = frontMatter["author"]
+	}
+}
+
+// readManifest reads the chapter list of a book.yaml file:
+//
+//	chapters:
+//	  - intro.md
+//	  - guide/setup.md
+func readManifest(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(m.Chapters) == 0 {
+		return nil, fmt.Errorf("%s: no chapters listed", file)
+	}
+	return m.Chapters, nil
+}
+
+// naturalLess orders slash separated paths directory by directory, and
+// names with the numbers in them compared by value, so that "2-setup.md"
+// comes before "10-faq.md"
+func naturalLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := naturalCompare(as[i], bs[i]); c != 0 {
+			return c < 0
+		}
+	}
+	if len(as) != len(bs) {
+		return len(as) < len(bs)
+	}
+	return a < b
+}
+
+// naturalCompare compares runs of digits by value and the rest
+// case-insensitively
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ra, rb := run(a), run(b)
+		a, b = a[len(ra):], b[len(rb):]
+		na, errA := strconv.ParseUint(ra, 10, 64)
+		nb, errB := strconv.ParseUint(rb, 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		default:
+			if c := strings.Compare(strings.ToLower(ra), strings.ToLower(rb)); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(a) - len(b)
+}
+
+// run returns the leading run of digits, or of other characters, of s
+func run(s string) string {
+	digit := unicode.IsDigit(rune(s[0]))
+	for i, c := range s {
+		if unicode.IsDigit(c) != digit {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// ignoreFile in an input directory lists patterns of files and directories
+// to leave out, one per line, as in .gitignore
+const ignoreFile = ".md2pdfignore"
+
+// readPatterns reads the patterns of an ignore or list file: one per line,
+// blank lines and lines starting with # are skipped
+func readPatterns(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// matchPattern reports whether the slash separated path rel, relative to
+// the input directory, matches a glob pattern. A pattern without a slash
+// matches the file or directory name at any depth; one with a slash
+// matches the whole path, and ** in it matches any number of directories.
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// excluded applies exclude patterns in order, as .gitignore does: the last
+// matching one decides, "!pattern" includes again and "pattern/" only
+// matches directories
+func excluded(rel string, isDir bool, patterns []string) bool {
+	out := false
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if strings.HasSuffix(p, "/") && !isDir {
+			continue
+		}
+		if matchPattern(p, rel) {
+			out = !negate
+		}
+	}
+	return out
+}
+
+// glob returns the files under dir with one of validExts, in any case, in
+// lexical order. Files and directories matching the exclude patterns, or
+// those of dir's .md2pdfignore, are left out; if there are include patterns
+// a file must match one of them.
+func glob(dir string, validExts, include, exclude []string) ([]string, error) {
+	ignored, err := readPatterns(filepath.Join(dir, ignoreFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	exclude = append(ignored, exclude...)
+	files := []string{}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded(rel, d.IsDir(), exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !slices.Contains(validExts, strings.ToLower(filepath.Ext(p))) {
+			return nil
+		}
+		if len(include) > 0 && !slices.ContainsFunc(include, func(pattern string) bool { return matchPattern(pattern, rel) }) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+
+	return files, err
+}
+
+// sortFiles orders the files found in dir by --sort: "natural" compares
+// the numbers in the names by value, "name" sorts lexically, "mtime" puts
+// the least recently modified first, and anything else is a list file
+// naming the files to convert in order, relative to dir: a book.yaml
+// manifest, or one path per line
+func sortFiles(dir string, files []string, order string) ([]string, error) {
+	rel := func(f string) string {
+		r, _ := filepath.Rel(dir, f)
+		return filepath.ToSlash(r)
+	}
+	switch order {
+	case "", "natural":
+		sort.SliceStable(files, func(i, j int) bool { return naturalLess(rel(files[i]), rel(files[j])) })
+		return files, nil
+	case "name":
+		sort.SliceStable(files, func(i, j int) bool { return rel(files[i]) < rel(files[j]) })
+		return files, nil
+	case "mtime":
+		mtimes := map[string]int64{}
+		for _, f := range files {
+			info, err := os.Stat(f)
+			if err != nil {
+				return nil, err
+			}
+			mtimes[f] = info.ModTime().UnixNano()
+		}
+		sort.SliceStable(files, func(i, j int) bool { return mtimes[files[i]] < mtimes[files[j]] })
+		return files, nil
+	}
+	var listed []string
+	var err error
+	if ext := strings.ToLower(filepath.Ext(order)); ext == ".yaml" || ext == ".yml" {
+		listed, err = readManifest(order)
+	} else {
+		listed, err = readPatterns(order)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sorted []string
+	for _, name := range listed {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if !slices.Contains(files, p) {
+			return nil, fmt.Errorf("%s: %s is not an input file in %s", order, name, dir)
+		}
+		sorted = append(sorted, p)
+	}
+	return sorted, nil
+}
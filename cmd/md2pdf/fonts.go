@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/solworktech/md2pdf/v2"
+)
+
+// fontScripts returns the names of the scripts the preset font covers
+func fontScripts(font string) []string {
+	scripts, err := mdtopdf.FontCoverage(font)
+	if err != nil {
+		fail(exitFont, err)
+	}
+	var names []string
+	for _, s := range scripts {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// fontSpecimen is the document `md2pdf fonts preview` renders for font: its
+// styles, and a sample line for each of mdtopdf.FontScripts
+func fontSpecimen(font string) []byte {
+	covered := fontScripts(font)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\nRegular, **bold**, *italic* and ***bold italic*** text, and digits 0123456789.\n", font)
+	for _, s := range mdtopdf.FontScripts {
+		fmt.Fprintf(&b, "\n## %s\n\n", s.Name)
+		if slices.Contains(covered, s.Name) {
+			fmt.Fprintf(&b, "%s\n\n**%s**\n", s.Sample, s.Sample)
+		} else {
+			fmt.Fprintf(&b, "*Not covered by %s.*\n", font)
+		}
+	}
+	return []byte(b.String())
+}
+
+// runFonts runs `md2pdf fonts list`, which prints the preset fonts and the
+// scripts they cover, and `md2pdf fonts preview font`, which renders a
+// specimen of the font to --output or <font>-preview.pdf
+func runFonts(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, font := range mdtopdf.PresetFontNames() {
+			fmt.Fprintf(w, "%s\t%s\n", font, strings.Join(fontScripts(font), ", "))
+		}
+		w.Flush()
+	case len(args) == 2 && args[0] == "preview":
+		font := args[1]
+		if err := loadPresetFont(font); err != nil {
+			fail(exitFont, err)
+		}
+		out := *output
+		if out == "" {
+			out = font + "-preview.pdf"
+		}
+		r := mdtopdf.NewPdfRenderer(mdtopdf.PdfRendererParams{
+			Orientation: *orientation,
+			Papersz:     *pageSize,
+			PdfFile:     out,
+			PresetFont:  font,
+			Theme:       mdtopdf.LIGHT,
+			Opts:        []mdtopdf.RenderOption{mdtopdf.SetQuiet(*quiet)},
+		})
+		if err := r.Process(fontSpecimen(font)); err != nil {
+			fail(exitCode(err, exitError), err)
+		}
+	default:
+		fail(exitUsage, errors.New(`unknown fonts command (expected "list" or "preview font")`))
+	}
+}
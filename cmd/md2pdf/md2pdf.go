@@ -1,38 +1,109 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/gomarkdown/markdown/parser"
 	"github.com/solworktech/md2pdf/v2"
 	flag "github.com/spf13/pflag"
-	"golang.org/x/exp/slices"
+	"golang.org/x/text/language"
 )
 
 var input = flag.StringP("input", "i", "", "Input filename, dir consisting of .md|.markdown files or HTTP(s) URL; default is os.Stdin")
+var includes = flag.StringArray("include", nil, "With a directory input, convert only files matching this glob pattern (repeatable)")
+var excludes = flag.StringArray("exclude", nil, "With a directory input, skip files and directories matching this glob pattern (repeatable); see also .md2pdfignore")
+var numbering = flag.String("numbering", "continue", "Heading, figure, table and list numbers of a directory input [continue | per-file]")
+var sortOrder = flag.String("sort", "natural", "Order of the files of a directory input [natural | name | mtime | /path/to/book.yaml | /path/to/list.txt]; a book.yaml in the directory is used by default")
 var output = flag.StringP("output", "o", "", "Output PDF filename; required")
 var pathToSyntaxFiles = flag.StringP("syntax-files", "s", "", "Path to github.com/jessp01/gohighlight/syntax_files")
 var title = flag.String("title", "", "Presentation title")
+var titleFromHeading = flag.Bool("title-from-heading", false, "Without --title, use the first level 1 heading as the title of the PDF metadata and --with-footer")
 var author = flag.String("author", "", "Author's name; used if -footer is passed")
 var fontFamily = flag.String("font-family", "", "System font family [Times | Helvetica | Courier]")
-var presetFont = flag.String("font", "", "Predefined Unicode font [dejavu_sans | dejavu_serif | noto_sans | roboto | eb_garamond | merriweather | source_serif] (default: source_serif)")
+var presetFont = flag.String("font", "", "Predefined Unicode font [dejavu_sans | dejavu_serif | noto_sans | roboto | eb_garamond | merriweather | source_serif | dejavu_sans_mono | go_mono] (default: source_serif)")
+var codeTheme = flag.String("code-theme", "", "Palette of syntax highlighting; okabe-ito and tol-bright are safe for red-green color blindness [default | okabe-ito | tol-bright]")
+var codeFont = flag.String("code-font", "", "Font for code spans and blocks: a monospace preset [dejavu_sans_mono | go_mono] or a .ttf file")
 var themeArg = flag.String("theme", "light", "[light | dark | /path/to/custom/theme.json]")
+var dialect = flag.String("dialect", "default", "Markdown dialect, selecting the parser extensions [default | commonmark | gfm | mmark]")
+var noEmojiShortcodes = flag.Bool("no-emoji-shortcodes", false, "Leave :shortcode: emoji such as :rocket: as they are written instead of rendering the emoji")
+var gfm = flag.Bool("gfm", false, "Parse the input as GitHub does: no hard line breaks, heading anchors, www. and e-mail autolinks (same as --dialect gfm)")
 var noNewPage = flag.Bool("no-new-page", false, "Don't interpret HR (---) as page break")
 var keepNumbering = flag.Bool("keep-numbering", false, "Preserve continuous list numbering across headers (default: reset to 1)")
 var printFooter = flag.Bool("with-footer", false, "Print doc footer (<author>  <title>  <page number>)")
+var numberHeadings = flag.Bool("number-headings", false, "Number headings (1, 1.1, ...); <!-- appendix --> switches to appendix lettering (A, A.1, ...)")
+var bookmarks = flag.Bool("bookmarks", false, "Add a PDF bookmark (outline entry) for every heading")
+var pageLayout = flag.String("page-layout", "", "How the PDF viewer shows the pages; two puts them side by side as in a book [single | continuous | two | two-continuous]")
+var zoom = flag.String("zoom", "", "Initial zoom of the PDF viewer [page | width | actual]")
+var hideToolbar = flag.Bool("hide-toolbar", false, "Ask the PDF viewer to hide its toolbar")
+var openAt = flag.String("open-at", "", "Open the PDF at this page number, #heading-id, or toc (the --generate-toc table of contents)")
+var openBookmarks = flag.Bool("open-bookmarks", false, "Open the PDF with the bookmarks panel shown (implies --bookmarks)")
+var shiftHeadings = flag.Int("shift-headings", 0, "Demote all headings by this many levels (# becomes ## with 1)")
+var maxHeadingLevel = flag.Int("max-heading-level", 0, "Render headings deeper than this level at this level (0 for no limit)")
 var generateTOC = flag.Bool("generate-toc", false, "Auto Generate Table of Contents (TOC)")
+var listNumbering = flag.String("list-numbering", "", "Label format of ordered lists, e.g. a), (1), i. or A.; by default lists keep the . or ) they are written with")
+var sidenotes = flag.Bool("sidenotes", false, "Set [^note] footnotes in the right margin beside their reference; a note stays a footnote if the margin is too narrow or the page too full")
+var lineNumbers = flag.Bool("line-numbers", false, "Number the lines of body text in the left margin, from 1 on every page, as for contracts and affidavits")
+var batesPrefix = flag.String("bates-prefix", "", "Stamp every page with a Bates number: this prefix and a running number, e.g. ABC001000")
+var batesStart = flag.Int("bates-start", 1, "First Bates number; stamps Bates numbers even without --bates-prefix")
+var batesCorner = flag.String("bates-corner", "bottom-right", "Corner of the page the Bates numbers are stamped in [bottom-right | bottom-left | top-right | top-left]")
+var backToTOC = flag.String("back-to-toc", "", "With --generate-toc, add links back to the table of contents in the page footers or after each top-level section [footer | sections]")
+var format = flag.String("format", "pdf", "Output format; png writes an image of each page, OUTPUT-1.png, OUTPUT-2.png, ..., with pdftoppm, mutool or gs, which must be installed [pdf | png]")
+var dpi = flag.Int("dpi", 96, "Resolution of the --format png page images")
 var pageSize = flag.String("page-size", "A4", "[A3 | A4 | A5]")
 var orientation = flag.String("orientation", "portrait", "[portrait | landscape]")
+var keepTogether = flag.Float64("keep-together", 1, "Move code blocks and images shorter than this fraction of a page to the next page instead of splitting them (0 disables)")
+var collapseDetails = flag.Bool("collapse-details", false, "Render only the summary of <details> blocks, marking their content as omitted")
+var tabWidth = flag.Int("tab-width", 4, "Expand tabs in code blocks to this many columns (0 keeps tabs)")
+var codeWrapMarker = flag.String("code-wrap-marker", mdtopdf.DefaultCodeWrapMarker, "Marker drawn where a long code line is wrapped (empty for none)")
+var noCodeWrap = flag.Bool("no-code-wrap", false, "Clip long code lines at the right margin instead of wrapping them, with a warning")
+var contrastCheck = flag.String("contrast", "off", "Check the contrast of the theme's text and code highlighting colors against WCAG AA: warn lists the colors below it, fix darkens or lightens them [off | warn | fix]")
+var imageMaxDPI = flag.Int("image-max-dpi", 0, "Downsample images with more pixels per inch than this at the size they are shown, e.g. 150; 0 keeps all pixels")
+var jpegQuality = flag.Int("jpeg-quality", 0, "Re-encode images without transparency as JPEG of this quality (1-100) where that makes them smaller; 0 keeps their format")
+var memoryLimit = flag.Int("memory-limit", 0, "Limit of the memory taken by images while rendering, in MiB, e.g. 512 for documents with hundreds of images; 0 for none")
+var density = flag.String("density", "", "Scale all font sizes, line spacing and indents of the theme together [compact | normal | relaxed] (default: the theme's)")
+var lineHeight = flag.Float64("line-height", 0, "Put text on a baseline grid with lines this many points apart; 0 uses the spacing of the theme")
+var listIndent = flag.Float64("list-indent", 0, "Indent of nested lists in points; 0 uses the theme's (1.5em by default)")
+var quoteIndent = flag.Float64("quote-indent", 0, "Indent of block quotes in points; 0 indents them like lists")
+var definitionIndent = flag.Float64("definition-indent", 0, "Indent of definition lists in points; 0 indents them like lists")
+var indentScale = flag.Float64("indent-scale", 0, "Scale the indent of each level of nested lists and quotes by this factor, e.g. 0.8 to fit deep lists on small pages; 0 keeps them equal")
+var tableMinFont = flag.Float64("table-min-font", 7, "Smallest font size tables too wide for the page are shrunk to; beyond that cells wrap")
+var cellWrapPrefix = flag.String("cell-wrap-prefix", "", "Text the wrapped lines of table cells continue after, e.g. \"  \" to indent them or \"» \" to mark them")
+var wideTables = flag.String("wide-tables", "shrink", "Lay out tables too wide for the page at --table-min-font by wrapping their cells, by splitting them into stacked tables repeating the first column, or on a landscape page if they fit there and split otherwise [shrink | split | auto]")
+var autoLandscape = flag.Bool("auto-landscape", false, "Put tables and images wider than a portrait page on landscape pages of their own")
+var glossaryFile = flag.String("glossary", "", "Glossary file (one \"TERM: expansion\" per line); the first use of each term is expanded")
+var glossaryAppendix = flag.Bool("glossary-appendix", false, "Render a glossary of all defined abbreviations at the end of the document")
+var bibliography = flag.String("bibliography", "", "BibTeX (.bib) or CSL-JSON (.json) file that [@key] citations are resolved against")
+var defines = flag.StringArray("define", nil, "Set a variable for <!-- if key=value --> conditional content and {{.key}} templates, as key=value (repeatable)")
+var locale = flag.String("locale", "", "Locale of the money, date and number template helpers and of --header-text and --footer-text dates, e.g. de-DE (default: en)")
+var headerText = flag.String("header-text", "", "Text in the top margin of every page, with {page}, {pages}, {date}, {time} and {datetime:2 January 2006}; \"|\" divides it into left, center and right parts")
+var footerText = flag.String("footer-text", "", "Text in the bottom margin of every page, as --header-text")
+var timeZone = flag.String("timezone", "", "Time zone of the --header-text and --footer-text dates, e.g. Europe/Berlin or UTC (default: local)")
+var diffBase = flag.String("diff-base", "", "Previous version of the input; changed blocks get a revision bar in the margin")
+var revisionText = flag.Bool("revision-text", false, "With --diff-base, also render changed blocks in the revision colour")
+var plantUMLServer = flag.String("plantuml-server", "", "Render plantuml fences with this PlantUML server URL instead of the local plantuml command")
+var latexEngine = flag.String("latex-engine", "", "Render latex and tex fences as images with this TeX engine, e.g. pdflatex, xelatex or lualatex; without it they are printed verbatim")
+var diagramCache = flag.Bool("diagram-cache", false, "Cache rendered diagrams in the user cache directory")
+var verifyText = flag.Bool("verify-text", false, "Read the text back from the PDF and fail if characters of the input are missing, e.g. emoji that cannot be drawn")
+var strict = flag.Bool("strict", false, "Fail if internal links or figure and table references have no target in the document, e.g. a mistyped #anchor")
+var warnUnsupported = flag.Bool("warn-unsupported", false, "List the markdown that could not be rendered and was left out, e.g. unknown inline HTML tags")
+var includeOutside = flag.Bool("include-outside", false, "Let <!-- code: path --> include files outside the input directory")
+var wikiLinks = flag.Bool("wiki-links", false, "Resolve the [[#Heading]] wiki links and ![[image]] embeds of a single file; those of a directory, links to its notes included, always are")
+var keepTemp = flag.Bool("keep-temp", false, "Keep the temporary files of the run (downloaded images, converted SVGs) for debugging")
+var quiet = flag.BoolP("quiet", "q", false, "Don't print warnings and notes on stderr; errors are still reported")
+var errorFormat = flag.String("error-format", "text", "Format of error messages on stderr [text | json]")
 var logFile = flag.String("log-file", "", "Path to log file")
 var debug = flag.Bool("debug", false, "Enable debug logging (creates .log file alongside PDF)")
 var help = flag.Bool("help", false, "Show usage message")
@@ -44,6 +115,32 @@ var _, fileName, fileLine, ok = runtime.Caller(0)
 
 var opts []mdtopdf.RenderOption
 
+// Exit codes, one per kind of failure
+const (
+	exitError = 1 // any other failure
+	exitUsage = 2 // invalid command line
+	exitParse = 3 // input or data files that can't be parsed
+	exitIO    = 4 // reading the input or writing the PDF
+	exitFont  = 5 // fonts that can't be loaded
+	exitImage = 6 // images that can't be loaded; the PDF is written without them
+	exitLink  = 7 // internal links without a target, with --strict
+)
+
+// exitKinds names the exit codes in --error-format json
+var exitKinds = map[int]string{
+	exitError: "error",
+	exitUsage: "usage",
+	exitParse: "parse",
+	exitIO:    "io",
+	exitFont:  "font",
+	exitImage: "image",
+	exitLink:  "link",
+}
+
+// footerHeight is the space (in points) reserved at the bottom of each page
+// for the footer printed by --with-footer
+const footerHeight = 20
+
 func processRemoteInputFile(url string) ([]byte, error) {
 	client := &http.Client{
 		Timeout: 30 * time.Second,
@@ -60,39 +157,152 @@ func processRemoteInputFile(url string) ([]byte, error) {
 	return content, rerr
 }
 
-func glob(dir string, validExts []string) ([]string, error) {
-	files := []string{}
-	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if slices.Contains(validExts, filepath.Ext(path)) {
-			files = append(files, path)
-		}
-		return nil
-	})
-
-	return files, err
+// isMarkdownFile reports whether path has a markdown extension
+func isMarkdownFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".md" || ext == ".markdown"
 }
 
-func loadPresetFont(fontName string) error {
-	validFonts := map[string]bool{
-		"dejavu_sans":  true,
-		"dejavu_serif": true,
-		"noto_sans":    true,
-		"roboto":       true,
-		"eb_garamond":  true,
-		"merriweather": true,
-		"source_serif": true,
+// openAtPage returns the ViewerPreferences.OpenAt value of --open-at: toc
+// stands for the first page, which the table of contents is drawn on
+func openAtPage(openAt string) string {
+	if openAt == "toc" {
+		return "1"
 	}
+	return openAt
+}
 
-	if _, exists := validFonts[fontName]; !exists {
-		return fmt.Errorf("unknown preset font: %s (available: dejavu_sans, dejavu_serif, noto_sans, roboto, eb_garamond, merriweather, source_serif)", fontName)
+func loadPresetFont(fontName string) error {
+	if names := mdtopdf.PresetFontNames(); !slices.Contains(names, fontName) {
+		return fmt.Errorf("unknown preset font: %s (available: %s)", fontName, strings.Join(names, ", "))
 	}
-
 	return nil
 }
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	flag.Parse()
+	if *configFile != "" {
+		if err := readConfig(*configFile); err != nil {
+			fail(exitUsage, err)
+		}
+	}
+	if format := *errorFormat; format != "text" && format != "json" {
+		*errorFormat = "text"
+		fail(exitUsage, fmt.Errorf("invalid --error-format %q (expected text or json)", format))
+	}
+	if _, ok := mdtopdf.Dialects[*dialect]; !ok {
+		fail(exitUsage, fmt.Errorf("invalid --dialect %q (expected %s)", *dialect, strings.Join(mdtopdf.DialectNames(), ", ")))
+	}
+	if *numbering != "continue" && *numbering != "per-file" {
+		fail(exitUsage, fmt.Errorf("invalid --numbering %q (expected continue or per-file)", *numbering))
+	}
+	if *format != "pdf" && *format != "png" {
+		fail(exitUsage, fmt.Errorf("invalid --format %q (expected pdf or png)", *format))
+	}
+	if *dpi <= 0 {
+		fail(exitUsage, fmt.Errorf("invalid --dpi %d", *dpi))
+	}
+	for name, v := range map[string]float64{"list-indent": *listIndent, "quote-indent": *quoteIndent, "definition-indent": *definitionIndent} {
+		if v < 0 {
+			fail(exitUsage, fmt.Errorf("invalid --%s %v (expected a width in points, or 0)", name, v))
+		}
+	}
+	if *indentScale < 0 || *indentScale > 1 {
+		fail(exitUsage, fmt.Errorf("invalid --indent-scale %v (expected a factor between 0 and 1)", *indentScale))
+	}
+	if _, err := language.Parse(*locale); *locale != "" && err != nil {
+		fail(exitUsage, fmt.Errorf("invalid --locale %q (expected e.g. en-US or de-DE)", *locale))
+	}
+	if _, err := time.LoadLocation(*timeZone); *timeZone != "" && err != nil {
+		fail(exitUsage, fmt.Errorf("invalid --timezone %q (expected e.g. Europe/Berlin or UTC)", *timeZone))
+	}
+	if *footerText != "" && *printFooter {
+		fail(exitUsage, fmt.Errorf("--footer-text and --with-footer both print a footer"))
+	}
+	if *lineHeight < 0 {
+		fail(exitUsage, fmt.Errorf("invalid --line-height %v (expected a height in points, or 0)", *lineHeight))
+	}
+	if _, ok := mdtopdf.PageLayouts[*pageLayout]; *pageLayout != "" && !ok {
+		fail(exitUsage, fmt.Errorf("invalid --page-layout %q (expected single, continuous, two or two-continuous)", *pageLayout))
+	}
+	if _, ok := mdtopdf.Zooms[*zoom]; *zoom != "" && !ok {
+		fail(exitUsage, fmt.Errorf("invalid --zoom %q (expected page, width or actual)", *zoom))
+	}
+	if *codeTheme != "" && !slices.Contains(mdtopdf.CodeThemes, *codeTheme) {
+		fail(exitUsage, fmt.Errorf("invalid --code-theme %q (expected %s)", *codeTheme, strings.Join(mdtopdf.CodeThemes, ", ")))
+	}
+	if !slices.Contains(mdtopdf.ContrastModes, *contrastCheck) {
+		fail(exitUsage, fmt.Errorf("invalid --contrast %q (expected %s)", *contrastCheck, strings.Join(mdtopdf.ContrastModes, ", ")))
+	}
+	if *imageMaxDPI < 0 {
+		fail(exitUsage, fmt.Errorf("invalid --image-max-dpi %d (expected 0 or more)", *imageMaxDPI))
+	}
+	if *jpegQuality < 0 || *jpegQuality > 100 {
+		fail(exitUsage, fmt.Errorf("invalid --jpeg-quality %d (expected 1-100, or 0 to keep the format)", *jpegQuality))
+	}
+	if *memoryLimit < 0 {
+		fail(exitUsage, fmt.Errorf("invalid --memory-limit %d (expected 0 or more)", *memoryLimit))
+	}
+	if *density != "" && !slices.Contains(mdtopdf.Densities, *density) {
+		fail(exitUsage, fmt.Errorf("invalid --density %q (expected %s)", *density, strings.Join(mdtopdf.Densities, ", ")))
+	}
+	if !slices.Contains(mdtopdf.WideTableModes, *wideTables) {
+		fail(exitUsage, fmt.Errorf("invalid --wide-tables %q (expected %s)", *wideTables, strings.Join(mdtopdf.WideTableModes, ", ")))
+	}
+	if *batesStart < 0 {
+		fail(exitUsage, fmt.Errorf("invalid --bates-start %d (expected 0 or more)", *batesStart))
+	}
+	if !slices.Contains(mdtopdf.BatesCorners, *batesCorner) {
+		fail(exitUsage, fmt.Errorf("invalid --bates-corner %q (expected %s)", *batesCorner, strings.Join(mdtopdf.BatesCorners, ", ")))
+	}
+	if *listNumbering != "" && !mdtopdf.ValidListNumbering(*listNumbering) {
+		fail(exitUsage, fmt.Errorf("invalid --list-numbering %q (expected 1, a, A, i or I followed by . or ), or in parentheses)", *listNumbering))
+	}
+	if *backToTOC != "" {
+		if !slices.Contains(mdtopdf.BackToTOCPlaces, *backToTOC) {
+			fail(exitUsage, fmt.Errorf("invalid --back-to-toc %q (expected footer or sections)", *backToTOC))
+		}
+		if !*generateTOC {
+			fail(exitUsage, fmt.Errorf("--back-to-toc needs --generate-toc"))
+		}
+	}
+	if *openAt == "toc" {
+		if !*generateTOC {
+			fail(exitUsage, fmt.Errorf("--open-at toc needs --generate-toc"))
+		}
+	} else if *openAt != "" && !mdtopdf.ValidOpenAt(*openAt) {
+		fail(exitUsage, fmt.Errorf("invalid --open-at %q (expected a page number, #heading-id or toc)", *openAt))
+	}
+
+	// with nothing to convert, only the configuration is written; else it
+	// is written once the front matter of the input is read
+	if *dumpConfig != "" && *input == "" && *output == "" && flag.NArg() == 0 {
+		if err := dumpConfigFile(*dumpConfig, nil); err != nil {
+			fail(exitIO, err)
+		}
+		return
+	}
+
+	// md2pdf completion bash|zsh|fish|powershell
+	if *input == "" && flag.NArg() == 2 && flag.Arg(0) == "completion" {
+		if err := writeCompletion(os.Stdout, flag.Arg(1)); err != nil {
+			fail(exitUsage, err)
+		}
+		return
+	}
+
+	// md2pdf fonts list|preview font
+	if *input == "" && flag.NArg() > 1 && flag.Arg(0) == "fonts" {
+		runFonts(flag.Args()[1:])
+		return
+	}
+
+	// md2pdf theme validate|preview theme.json
+	if *input == "" && flag.NArg() == 3 && flag.Arg(0) == "theme" {
+		runTheme(flag.Arg(1), flag.Arg(2))
+		return
+	}
 
 	// Support positional arguments: md2pdf input.md [output.pdf]
 	if *input == "" && len(flag.Args()) > 0 {
@@ -112,12 +322,135 @@ func main() {
 		return
 	}
 
+	opts = append(opts, mdtopdf.SetQuiet(*quiet))
 	if *noNewPage {
 		opts = append(opts, mdtopdf.IsHorizontalRuleNewPage(false))
 	} else {
 		opts = append(opts, mdtopdf.IsHorizontalRuleNewPage(true))
 	}
 
+	opts = append(opts, mdtopdf.SetKeepTogetherRatio(*keepTogether))
+	opts = append(opts, mdtopdf.SetTableMinFontSize(*tableMinFont))
+	opts = append(opts, mdtopdf.SetWideTables(*wideTables))
+	opts = append(opts, mdtopdf.SetCellWrapPrefix(*cellWrapPrefix))
+	opts = append(opts, mdtopdf.SetAutoLandscape(*autoLandscape))
+	opts = append(opts, mdtopdf.SetIndents(*listIndent, *quoteIndent, *definitionIndent))
+	if *indentScale > 0 {
+		opts = append(opts, mdtopdf.SetIndentScale(*indentScale))
+	}
+	opts = append(opts, mdtopdf.SetContrastCheck(*contrastCheck))
+	opts = append(opts, mdtopdf.SetImageMaxDPI(*imageMaxDPI), mdtopdf.SetJPEGQuality(*jpegQuality))
+	opts = append(opts, mdtopdf.SetMemoryLimit(int64(*memoryLimit)<<20))
+	if *density != "" {
+		opts = append(opts, mdtopdf.SetDensity(*density))
+	}
+	if *lineHeight > 0 {
+		opts = append(opts, mdtopdf.SetBaseLineHeight(*lineHeight))
+	}
+	opts = append(opts, mdtopdf.SetTabWidth(*tabWidth))
+	opts = append(opts, mdtopdf.SetCodeWrapMarker(*codeWrapMarker))
+	opts = append(opts, mdtopdf.SetClipCode(*noCodeWrap))
+	opts = append(opts, mdtopdf.SetCollapseDetails(*collapseDetails))
+	opts = append(opts, mdtopdf.SetHeadingNumbering(*numberHeadings))
+	opts = append(opts, mdtopdf.SetBookmarks(*bookmarks))
+	opts = append(opts, mdtopdf.SetViewerPreferences(mdtopdf.ViewerPreferences{
+		Layout:        *pageLayout,
+		Zoom:          *zoom,
+		HideToolbar:   *hideToolbar,
+		ShowBookmarks: *openBookmarks,
+		OpenAt:        openAtPage(*openAt),
+	}))
+	if *backToTOC != "" {
+		opts = append(opts, mdtopdf.SetBackToTOC(*backToTOC))
+	}
+	if *listNumbering != "" {
+		opts = append(opts, mdtopdf.SetListNumbering(*listNumbering))
+	}
+	if *gfm && !flag.CommandLine.Changed("dialect") {
+		*dialect = "gfm"
+	}
+	opts = append(opts, mdtopdf.SetDialect(*dialect))
+	opts = append(opts, mdtopdf.SetEmojiShortcodes(!*noEmojiShortcodes))
+	opts = append(opts, mdtopdf.SetSidenotes(*sidenotes))
+	opts = append(opts, mdtopdf.SetLineNumbers(*lineNumbers))
+	if flag.CommandLine.Changed("bates-prefix") || flag.CommandLine.Changed("bates-start") {
+		opts = append(opts, mdtopdf.SetBates(*batesPrefix, *batesStart), mdtopdf.SetBatesCorner(*batesCorner))
+	}
+	opts = append(opts, mdtopdf.SetHeadingShift(*shiftHeadings))
+	opts = append(opts, mdtopdf.SetMaxHeadingLevel(*maxHeadingLevel))
+	opts = append(opts, mdtopdf.SetKeepTemp(*keepTemp))
+	opts = append(opts, mdtopdf.SetIncludeOutside(*includeOutside))
+	opts = append(opts, mdtopdf.SetWikiLinks(*wikiLinks))
+	opts = append(opts, mdtopdf.SetVerifyText(*verifyText))
+	opts = append(opts, mdtopdf.SetWarnUnsupported(*warnUnsupported))
+	if *codeFont != "" {
+		if !strings.EqualFold(filepath.Ext(*codeFont), ".ttf") {
+			if err := loadPresetFont(*codeFont); err != nil {
+				fail(exitFont, fmt.Errorf("invalid --code-font: %v", err))
+			}
+		}
+		opts = append(opts, mdtopdf.SetCodeFont(*codeFont))
+	}
+	if *codeTheme != "" {
+		opts = append(opts, mdtopdf.SetCodeTheme(*codeTheme))
+	}
+	if *plantUMLServer != "" {
+		opts = append(opts, mdtopdf.SetPlantUMLServer(*plantUMLServer))
+	}
+	if *latexEngine != "" {
+		opts = append(opts, mdtopdf.SetLaTeXEngine(*latexEngine))
+	}
+	if *diagramCache {
+		dir, err := mdtopdf.DefaultDiagramCacheDir()
+		if err != nil {
+			fail(exitIO, err)
+		}
+		opts = append(opts, mdtopdf.SetDiagramCacheDir(dir))
+	}
+
+	vars := map[string]string{}
+	for _, d := range *defines {
+		key, value, ok := strings.Cut(d, "=")
+		if !ok {
+			value = "true"
+		}
+		vars[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	opts = append(opts, mdtopdf.SetDefines(vars))
+	opts = append(opts, mdtopdf.SetLocale(*locale))
+	opts = append(opts, mdtopdf.SetHeaderText(*headerText), mdtopdf.SetFooterText(*footerText))
+	if *timeZone != "" {
+		opts = append(opts, mdtopdf.SetTimeZone(*timeZone))
+	}
+
+	if *diffBase != "" {
+		base, err := os.ReadFile(*diffBase)
+		if err != nil {
+			fail(exitIO, err)
+		}
+		opts = append(opts, mdtopdf.SetDiffBase(base, *revisionText))
+	}
+
+	if *bibliography != "" {
+		bib, err := mdtopdf.LoadBibliography(*bibliography)
+		if err != nil {
+			fail(exitCode(err, exitParse), err)
+		}
+		opts = append(opts, mdtopdf.SetBibliography(bib))
+	}
+
+	if *glossaryFile != "" || *glossaryAppendix {
+		var glossary mdtopdf.Glossary
+		if *glossaryFile != "" {
+			g, err := mdtopdf.LoadGlossary(*glossaryFile)
+			if err != nil {
+				fail(exitCode(err, exitParse), err)
+			}
+			glossary = g
+		}
+		opts = append(opts, mdtopdf.SetGlossary(glossary, *glossaryAppendix))
+	}
+
 	if *pathToSyntaxFiles != "" {
 		opts = append(opts, mdtopdf.SetSyntaxHighlightBaseDir(*pathToSyntaxFiles))
 	} else {
@@ -132,50 +465,98 @@ func main() {
 	var content []byte
 	var err error
 	var inputBaseURL string
+	// the front matter of the input, or of the first file of a directory
+	// that has one
+	var frontMatter map[string]string
 	if *input == "" {
 		content, err = io.ReadAll(os.Stdin)
 		if err != nil {
-			log.Fatal(err)
+			fail(exitIO, err)
 		}
 	} else {
 		httpRegex := regexp.MustCompile("^http(s)?://")
 		if httpRegex.Match([]byte(*input)) {
 			content, err = processRemoteInputFile(*input)
 			if err != nil {
-				log.Fatal(err)
+				fail(exitIO, err)
 			}
-			// get the base URL so we can adjust relative links and images
-			inputBaseURL = strings.Replace(filepath.Dir(*input), ":/", "://", 1)
+			// get the base URL so we can adjust relative links and images;
+			// URLs use "/" whatever the OS
+			inputBaseURL = strings.Replace(path.Dir(*input), ":/", "://", 1)
 		} else {
 			fileInfo, err := os.Stat(*input)
 			if err != nil {
-				log.Fatal(err)
+				fail(exitIO, err)
 			}
 
 			if fileInfo.IsDir() {
 				validExts := []string{".md", ".markdown"}
-				files, err := glob(*input, validExts)
+				files, err := glob(*input, validExts, *includes, *excludes)
 				if err != nil {
-					log.Fatal(err)
+					fail(exitIO, err)
+				}
+				order := *sortOrder
+				if manifest := filepath.Join(*input, bookManifest); !flag.CommandLine.Changed("sort") {
+					if _, err := os.Stat(manifest); err == nil {
+						order = manifest
+					}
+				}
+				if files, err = sortFiles(*input, files, order); err != nil {
+					fail(exitIO, err)
 				}
+				opts = append(opts, mdtopdf.SetInputBaseDir(*input))
+				// the headings of the files are read in the dialect of
+				// the document
+				headings := mdtopdf.NewPdfRenderer(mdtopdf.PdfRendererParams{
+					Opts: []mdtopdf.RenderOption{mdtopdf.SetQuiet(true), mdtopdf.SetDialect(*dialect), mdtopdf.SetSidenotes(*sidenotes)},
+				})
 				for i, filePath := range files {
 					fileContents, err := os.ReadFile(filePath)
 					if err != nil {
-						log.Fatal(err)
+						fail(exitIO, err)
+					}
+					fields, fileContents := mdtopdf.SplitFrontMatter(fileContents)
+					if frontMatter == nil {
+						frontMatter = fields
+					}
+					// images are relative to the file they are in, and
+					// links to other files go to their pages
+					content = append(content, "<!-- file "+mdtopdf.QuoteDirectiveValue(filePath)+" -->\n\n"...)
+					content = append(content, "<!-- basedir "+mdtopdf.QuoteDirectiveValue(filepath.Dir(filePath))+" -->\n\n"...)
+					// with --bookmarks, a bookmark per file with those of
+					// its headings below it, unless a level 1 heading of
+					// the same title starts the file and is bookmarked
+					if title := fileTitle(headings, filePath, fields, fileContents); !startsWithTitle(headings, fileContents, title) {
+						content = append(content, "<!-- bookmark title="+mdtopdf.QuoteDirectiveValue(title)+" -->\n\n"...)
+					}
+					if i > 0 && *numbering == "per-file" {
+						content = append(content, "<!-- restartnumbering -->\n\n"...)
 					}
 					content = append(content, fileContents...)
 					if i < len(files)-1 {
-						content = append(content, []byte("---\n")...)
+						// a blank line first, so that the rule is not read
+						// as a setext heading underline
+						content = append(content, []byte("\n\n---\n\n")...)
 					}
 				}
 			} else {
 				content, err = os.ReadFile(*input)
 				if err != nil {
-					log.Fatal(err)
+					fail(exitIO, err)
 				}
+				opts = append(opts, mdtopdf.SetInputBaseDir(filepath.Dir(*input)))
 			}
 		}
 	}
+	if frontMatter == nil {
+		frontMatter, content = mdtopdf.SplitFrontMatter(content)
+	}
+	applyFrontMatter(frontMatter, vars)
+	if *dumpConfig != "" {
+		if err := dumpConfigFile(*dumpConfig, frontMatter); err != nil {
+			fail(exitIO, err)
+		}
+	}
 
 	// Auto-generate output filename if not provided
 	if *output == "" {
@@ -185,7 +566,7 @@ func main() {
 			httpRegex := regexp.MustCompile("^http(s)?://")
 			if httpRegex.Match([]byte(*input)) {
 				// For URLs, use the base filename from URL
-				baseName := filepath.Base(*input)
+				baseName := path.Base(*input)
 				*output = strings.TrimSuffix(baseName, filepath.Ext(baseName)) + ".pdf"
 			} else {
 				fileInfo, err := os.Stat(*input)
@@ -195,10 +576,8 @@ func main() {
 				} else {
 					// For files, replace .md or .markdown extension with .pdf
 					baseName := *input
-					if strings.HasSuffix(baseName, ".md") {
-						*output = strings.TrimSuffix(baseName, ".md") + ".pdf"
-					} else if strings.HasSuffix(baseName, ".markdown") {
-						*output = strings.TrimSuffix(baseName, ".markdown") + ".pdf"
+					if isMarkdownFile(baseName) {
+						*output = strings.TrimSuffix(baseName, filepath.Ext(baseName)) + ".pdf"
 					} else {
 						*output = baseName + ".pdf"
 					}
@@ -221,14 +600,27 @@ func main() {
 	}
 
 	if *presetFont != "" {
-		if *fontFamily != "" {
+		if *fontFamily != "" && !*quiet {
 			log.Printf("Warning: Both --font and --font-family specified. --font takes priority.")
 		}
 
 		err := loadPresetFont(*presetFont)
 		if err != nil {
-			log.Fatalf("Failed to load preset font: %v", err)
+			fail(exitFont, fmt.Errorf("failed to load preset font: %v", err))
+		}
+	}
+
+	// the PDF for --format png is rendered to a temporary file
+	var raster mdtopdf.Rasterizer
+	pdfFile, pngDir := *output, ""
+	if *format == "png" {
+		if raster, err = mdtopdf.FindRasterizer(); err != nil {
+			fail(exitError, err)
+		}
+		if pngDir, err = os.MkdirTemp("", "md2pdf"); err != nil {
+			fail(exitIO, err)
 		}
+		pdfFile = filepath.Join(pngDir, "output.pdf")
 	}
 
 	// Auto-generate log file path for --debug
@@ -238,10 +630,14 @@ func main() {
 		tracerFile = base + ".log"
 	}
 
+	if *title == "" && *titleFromHeading {
+		*title = mdtopdf.DocumentTitle(mdtopdf.ApplyConditions(content, vars))
+	}
+
 	params := mdtopdf.PdfRendererParams{
 		Orientation:     *orientation,
 		Papersz:         *pageSize,
-		PdfFile:         *output,
+		PdfFile:         pdfFile,
 		TracerFile:      tracerFile,
 		Opts:            opts,
 		Theme:           theme,
@@ -250,13 +646,16 @@ func main() {
 		PresetFont:      *presetFont,
 		KeepNumbering:   *keepNumbering,
 	}
+	if *printFooter {
+		params.FooterHeight = footerHeight
+	}
 
 	pf := mdtopdf.NewPdfRenderer(params)
 
 	if *generateTOC == true {
-		headers, err := mdtopdf.GetTOCEntries(content)
+		headers, err := pf.TOCEntries(mdtopdf.ApplyConditions(content, vars))
 		if err != nil {
-			log.Fatal(err)
+			fail(exitParse, err)
 		}
 		headerLinks := make(map[string]*int)
 		for _, header := range headers {
@@ -269,6 +668,7 @@ func main() {
 		}
 
 		pf.SetTOCLinks(headerLinks)
+		pf.MarkTOC()
 		pf.Pdf.SetFont("Arial", "B", 24)
 
 		// Add a table of contents with clickable links
@@ -282,8 +682,13 @@ func main() {
 				pf.Pdf.SetTextColor(100, 149, 237)
 				tr := pf.Pdf.UnicodeTranslatorFromDescriptor("")
 				bulletChar := tr("•")
-				indent := strings.Repeat("  ", header.Level-1)
-				pf.Pdf.WriteLinkID(8, fmt.Sprintf("%s %s %s", indent, bulletChar, header.Title), link)
+				level := mdtopdf.ShiftHeadingLevel(header.Level, *shiftHeadings, *maxHeadingLevel)
+				indent := strings.Repeat("  ", level-1)
+				marker := bulletChar
+				if *numberHeadings && header.Number != "" {
+					marker = header.Number
+				}
+				pf.Pdf.WriteLinkID(8, fmt.Sprintf("%s %s %s", indent, marker, header.Title), link)
 				pf.Pdf.Ln(15)
 			}
 		}
@@ -293,9 +698,14 @@ func main() {
 	if inputBaseURL != "" {
 		pf.InputBaseURL = inputBaseURL
 	}
-	pf.Pdf.SetSubject(*title, true)
+	if subject := frontMatter["subject"]; subject != "" {
+		pf.Pdf.SetSubject(subject, true)
+	} else {
+		pf.Pdf.SetSubject(*title, true)
+	}
 	pf.Pdf.SetTitle(*title, true)
-	pf.Extensions = parser.NoIntraEmphasis | parser.Tables | parser.FencedCode | parser.Autolink | parser.Strikethrough | parser.SpaceHeadings | parser.HeadingIDs | parser.BackslashLineBreak | parser.DefinitionLists | parser.HardLineBreak | parser.OrderedListStart
+	pf.Pdf.SetAuthor(*author, true)
+	pf.Pdf.SetKeywords(frontMatter["keywords"], true)
 
 	if *printFooter {
 		pf.Pdf.SetFooterFunc(func() {
@@ -322,14 +732,81 @@ func main() {
 	}
 
 	err = pf.Process(content)
+	if err == nil && *format == "png" {
+		err = writePageImages(raster, pdfFile, strings.TrimSuffix(*output, filepath.Ext(*output)))
+	}
+	os.RemoveAll(pngDir)
+	if err != nil {
+		fail(exitCode(err, exitError), err)
+	}
+	// the PDF was written without them
+	if err := pf.ImageError(); err != nil {
+		fail(exitImage, err)
+	}
+	if err := pf.LinkError(); err != nil && *strict {
+		fail(exitLink, err)
+	}
+	if err := pf.TextError(); err != nil {
+		fail(exitError, err)
+	}
+}
+
+// writePageImages rasterizes the pages of pdf to prefix-1.png,
+// prefix-2.png, ...
+func writePageImages(raster mdtopdf.Rasterizer, pdf, prefix string) error {
+	pages, err := raster.Rasterize(pdf, *dpi)
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
+		return err
+	}
+	for i, page := range pages {
+		if err := os.WriteFile(fmt.Sprintf("%s-%d.png", prefix, i+1), page, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitCode returns the exit code for the kind of err, or def if it is not
+// known
+func exitCode(err error, def int) int {
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, mdtopdf.ErrParse):
+		return exitParse
+	case errors.Is(err, mdtopdf.ErrFont):
+		return exitFont
+	case errors.Is(err, mdtopdf.ErrImage):
+		return exitImage
+	case errors.Is(err, mdtopdf.ErrIO), errors.As(err, &pathErr):
+		return exitIO
+	}
+	return def
+}
+
+// fail reports err on stderr, as text or, with --error-format json, as a
+// JSON object with the message, kind and exit code, and exits with code
+func fail(code int, err error) {
+	if *errorFormat == "json" {
+		json.NewEncoder(os.Stderr).Encode(struct {
+			Error string `json:"error"`
+			Kind  string `json:"kind"`
+			Code  int    `json:"code"`
+		}{err.Error(), exitKinds[code], code})
+	} else {
+		log.Output(2, "error: "+err.Error())
 	}
+	os.Exit(code)
 }
 
 func usage(msg string) {
 	fmt.Println(msg + "\n")
 	fmt.Printf("Usage: %s (%s) [options]\n", filepath.Base(fileName), version)
+	fmt.Printf("       %s completion bash|zsh|fish|powershell\n", filepath.Base(fileName))
+	fmt.Printf("       %s theme validate|preview theme.json [-o preview.pdf]\n", filepath.Base(fileName))
+	fmt.Printf("       %s fonts list|preview font [-o preview.pdf]\n", filepath.Base(fileName))
 	flag.PrintDefaults()
+	if msg != "" {
+		os.Exit(exitUsage)
+	}
 	os.Exit(0)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solworktech/md2pdf/v2"
+)
+
+// specimen is the document `md2pdf theme preview` renders, with every
+// style of a theme
+//
+//go:embed specimen.md
+var specimen []byte
+
+// validateTheme fails with exitParse, listing the problems, if the custom
+// theme file is not valid
+func validateTheme(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fail(exitIO, err)
+	}
+	problems, err := mdtopdf.ValidateTheme(data)
+	if err != nil {
+		fail(exitParse, fmt.Errorf("%s: %w", file, err))
+	}
+	if len(problems) > 0 {
+		fail(exitParse, fmt.Errorf("%s:\n%s", file, strings.Join(problems, "\n")))
+	}
+	// too little contrast makes the text hard to read, but not the theme
+	// invalid
+	problems, _ = mdtopdf.ThemeContrast(data)
+	for _, problem := range problems {
+		if !*quiet {
+			log.Printf("Warning: %s: %s", file, problem)
+		}
+	}
+}
+
+// runTheme runs `md2pdf theme validate|preview theme.json`: validate
+// checks the theme, preview also renders the specimen document with it, to
+// --output or <theme>-preview.pdf
+func runTheme(command, file string) {
+	switch command {
+	case "validate":
+		validateTheme(file)
+		fmt.Printf("%s: ok\n", file)
+	case "preview":
+		validateTheme(file)
+		out := *output
+		if out == "" {
+			out = strings.TrimSuffix(file, filepath.Ext(file)) + "-preview.pdf"
+		}
+		r := mdtopdf.NewPdfRenderer(mdtopdf.PdfRendererParams{
+			Orientation:     *orientation,
+			Papersz:         *pageSize,
+			PdfFile:         out,
+			Theme:           mdtopdf.CUSTOM,
+			CustomThemeFile: file,
+			Opts:            []mdtopdf.RenderOption{mdtopdf.SetQuiet(*quiet), mdtopdf.SetContrastCheck(*contrastCheck)},
+		})
+		if err := r.Process(specimen); err != nil {
+			fail(exitCode(err, exitError), err)
+		}
+	default:
+		fail(exitUsage, errors.New(`unknown theme command (expected "validate" or "preview")`))
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// codeLanguages maps file extensions (and some file names) to the language
+// of the code block an included file becomes, named after the syntax files
+var codeLanguages = map[string]string{
+	".go": "go", ".py": "python3", ".js": "javascript", ".mjs": "javascript",
+	".ts": "typescript", ".rb": "ruby", ".rs": "rust", ".c": "c", ".h": "c",
+	".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".java": "java", ".scala": "scala", ".swift": "swift", ".lua": "lua",
+	".php": "php", ".pl": "perl", ".hs": "haskell", ".ml": "ocaml",
+	".sh": "sh", ".bash": "sh", ".zsh": "zsh", ".fish": "fish",
+	".sql": "sql", ".yaml": "yaml", ".yml": "yaml", ".json": "json",
+	".toml": "toml", ".ini": "ini", ".xml": "xml", ".html": "html",
+	".htm": "html", ".css": "css", ".md": "markdown", ".tex": "tex",
+	".diff": "diff", ".patch": "diff", ".csv": "csv", ".tsv": "tsv",
+	"makefile": "makefile", "dockerfile": "dockerfile",
+}
+
+// snippetMarker matches the [docs:start:name] and [docs:end:name] comments
+// that delimit a snippet in a source file, in any comment syntax
+var snippetMarker = regexp.MustCompile(`\[docs:(start|end):([\w.-]+)\]`)
+
+// snippet returns the lines between the start and end markers of the named
+// snippet; the lines of other snippets' markers inside it are dropped
+func snippet(lines []string, name string) ([]string, error) {
+	var out []string
+	in, found := false, false
+	for _, l := range lines {
+		m := snippetMarker.FindStringSubmatch(l)
+		switch {
+		case m == nil:
+			if in {
+				out = append(out, l)
+			}
+		case m[2] != name:
+		case m[1] == "start":
+			in, found = true, true
+		case !in:
+			return nil, fmt.Errorf("snippet %q ends before it starts", name)
+		default:
+			return out, nil
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no snippet %q", name)
+	}
+	return nil, fmt.Errorf("snippet %q has no end marker", name)
+}
+
+// codeLanguage infers the language of a source file from its name
+func codeLanguage(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	if lang, ok := codeLanguages[base]; ok {
+		return lang
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if lang, ok := codeLanguages[ext]; ok {
+		return lang
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// parseLineRange parses a lines= attribute: "10-42", "10-", "-42" or "10",
+// counted from 1; 0 stands for an open end
+func parseLineRange(s string) (from, to int, err error) {
+	a, b, isRange := strings.Cut(s, "-")
+	num := func(v string) (int, error) {
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid line range %q", s)
+		}
+		return n, nil
+	}
+	if from, err = num(a); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return from, from, nil
+	}
+	if to, err = num(b); err != nil {
+		return 0, 0, err
+	}
+	if to != 0 && to < from {
+		return 0, 0, fmt.Errorf("invalid line range %q", s)
+	}
+	return from, to, nil
+}
+
+// dedent removes the leading whitespace all non-blank lines share
+func dedent(lines []string) []string {
+	prefix := ""
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = strings.TrimPrefix(l, prefix)
+		if strings.TrimSpace(out[i]) == "" {
+			out[i] = ""
+		}
+	}
+	return out
+}
+
+// insideDir tells whether path is dir or a file or directory below it,
+// following symbolic links
+func insideDir(path, dir string) bool {
+	abs := func(p string) string {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			p = resolved
+		}
+		p, _ = filepath.Abs(p)
+		return p
+	}
+	rel, err := filepath.Rel(abs(dir), abs(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// includeCode reads the code block a <!-- code: path --> directive stands
+// for, with relative paths resolved against baseDir; unless root is empty,
+// the file must be inside it. The snippet= attribute
+// selects a snippet between [docs:start:name] and [docs:end:name] markers,
+// lines= a range of lines (of the snippet, if given); marker lines are
+// left out. lang= overrides the language inferred from the file name and
+// dedent=false keeps the common indentation.
+func includeCode(d directive, baseDir, root string) (*ast.CodeBlock, error) {
+	if len(d.args) == 0 {
+		return nil, fmt.Errorf("no file given")
+	}
+	path := localPathIn(d.args[0], baseDir)
+	if root != "" && !insideDir(path, root) {
+		return nil, fmt.Errorf("%s is outside the input directory %s", path, root)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	if name, ok := d.attrs["snippet"]; ok {
+		if lines, err = snippet(lines, name); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		lines = slices.DeleteFunc(lines, snippetMarker.MatchString)
+	}
+	if v, ok := d.attrs["lines"]; ok {
+		from, to, err := parseLineRange(v)
+		if err != nil {
+			return nil, err
+		}
+		if from == 0 {
+			from = 1
+		}
+		if to == 0 || to > len(lines) {
+			to = len(lines)
+		}
+		if from > len(lines) {
+			return nil, fmt.Errorf("%s has %d lines, range %q starts after them", path, len(lines), v)
+		}
+		lines = lines[from-1 : to]
+	}
+	if d.attrs["dedent"] != "false" {
+		lines = dedent(lines)
+	}
+	lang := codeLanguage(path)
+	if v, ok := d.attrs["lang"]; ok {
+		lang = v
+	}
+	return &ast.CodeBlock{
+		IsFenced: true,
+		Info:     []byte(lang),
+		Leaf:     ast.Leaf{Literal: []byte(strings.Join(lines, "\n") + "\n")},
+	}, nil
+}
+
+// codeIncludes replaces <!-- code: path --> directives with code blocks of
+// the files they name, so that listings don't drift from the real sources.
+// Paths are relative to InputBaseDir, or to the directory of the latest
+// <!-- basedir --> directive, and files outside InputBaseDir (the working
+// directory if it is not set) are refused unless IncludeOutside is set. A
+// file that can't be read is reported and the directive is left, rendering
+// nothing.
+func (r *PdfRenderer) codeIncludes(doc ast.Node) {
+	var blocks []*ast.HTMLBlock
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if b, ok := node.(*ast.HTMLBlock); ok && entering {
+			blocks = append(blocks, b)
+		}
+		return ast.GoToNext
+	})
+	baseDir, root := r.InputBaseDir, r.InputBaseDir
+	switch {
+	case r.IncludeOutside:
+		root = ""
+	case root == "":
+		root = "."
+	}
+	for _, b := range blocks {
+		d, ok := parseDirective(b.Literal)
+		switch {
+		case !ok:
+		case d.name == "basedir" && len(d.args) > 0:
+			baseDir = d.args[0]
+		case d.name == "code":
+			cb, err := includeCode(d, baseDir, root)
+			if err != nil {
+				r.logf("Warning: code include %v: %v", d.args, err)
+				continue
+			}
+			r.tracer("Code include", fmt.Sprintf("%v: %d bytes of %s", d.args, len(cb.Literal), cb.Info))
+			replaceNode(b, cb)
+		}
+	}
+}
+
+// SetIncludeOutside lets <!-- code: path --> directives include files
+// outside the input directory, such as absolute paths or ../ ones, which
+// are refused by default so that a document cannot pull in any file the
+// converting user can read
+func SetIncludeOutside(allow bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.IncludeOutside = allow
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import "slices"
+
+// CodeThemes are the syntax highlighting palettes of SetCodeTheme.
+// "okabe-ito" and "tol-bright" keep the groups apart for readers with
+// red-green color blindness (deuteranopia and protanopia).
+var CodeThemes = []string{"default", "okabe-ito", "tol-bright"}
+
+// highlightColors are the text colors of the syntax highlighting groups of
+// code blocks; code of other groups is in the color of the code style
+var highlightColors = codePalette(
+	Color{42, 170, 138},  // statements: green
+	Color{137, 207, 240}, // identifiers: light blue
+	Color{255, 80, 80},   // preprocessor, special: red
+	Color{0, 136, 163},   // constants: cyan
+	Color{255, 0, 255},   // strings: magenta
+	Color{255, 165, 0},   // types, operators: orange
+	Color{82, 204, 0},    // comments: green
+)
+
+// codeThemes are the palettes of CodeThemes
+var codeThemes = map[string]map[string]Color{
+	"default": highlightColors,
+	// the palette of Okabe and Ito, "Color Universal Design"
+	"okabe-ito": codePalette(
+		Color{0, 114, 178},   // statements: blue
+		Color{86, 180, 233},  // identifiers: sky blue
+		Color{213, 94, 0},    // preprocessor, special: vermillion
+		Color{0, 158, 115},   // constants: bluish green
+		Color{204, 121, 167}, // strings: reddish purple
+		Color{230, 159, 0},   // types, operators: orange
+		Color{128, 128, 128}, // comments: grey
+	),
+	// Paul Tol's bright qualitative scheme
+	"tol-bright": codePalette(
+		Color{68, 119, 170},  // blue
+		Color{102, 204, 238}, // cyan
+		Color{238, 102, 119}, // red
+		Color{34, 136, 51},   // green
+		Color{170, 51, 119},  // purple
+		Color{204, 187, 68},  // yellow
+		Color{187, 187, 187}, // grey
+	),
+}
+
+// codePalette returns the colors of the groups of highlightColors from the
+// color of each kind of token
+func codePalette(statement, identifier, special, constant, str, typ, comment Color) map[string]Color {
+	return map[string]Color{
+		"statement":            statement,
+		"green":                statement,
+		"identifier":           identifier,
+		"blue":                 identifier,
+		"preproc":              special,
+		"special":              special,
+		"type.keyword":         special,
+		"red":                  special,
+		"constant":             constant,
+		"constant.number":      constant,
+		"constant.bool":        constant,
+		"symbol.brackets":      constant,
+		"identifier.var":       constant,
+		"cyan":                 constant,
+		"constant.specialChar": str,
+		"constant.string.url":  str,
+		"constant.string":      str,
+		"magenta":              str,
+		"type":                 typ,
+		"symbol.operator":      typ,
+		"symbol.tag.extended":  typ,
+		"yellow":               typ,
+		"comment":              comment,
+		"high.green":           comment,
+	}
+}
+
+// SetCodeTheme sets the palette of syntax highlighting, one of CodeThemes.
+// An unknown palette is ignored with a warning.
+func SetCodeTheme(name string) RenderOption {
+	return func(r *PdfRenderer) {
+		if !slices.Contains(CodeThemes, name) {
+			r.logf("Warning: unknown code theme %q", name)
+			return
+		}
+		r.CodeTheme = name
+	}
+}
+
+// codeThemeColors returns the highlighting colors of the code theme
+func (r *PdfRenderer) codeThemeColors() map[string]Color {
+	if colors, ok := codeThemes[r.CodeTheme]; ok {
+		return colors
+	}
+	return highlightColors
+}
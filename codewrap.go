@@ -0,0 +1,162 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// DefaultCodeWrapMarker is drawn at the right margin where a code line is
+// wrapped, see SetCodeWrapMarker
+const DefaultCodeWrapMarker = "↩"
+
+// wrapMarkerColor is the color of the code wrap marker
+var wrapMarkerColor = Color{128, 128, 128}
+
+// SetCodeWrapMarker sets the marker drawn at the right margin of a code line
+// that is wrapped onto the next one, such as "↩" (the default) or "⏎"; ""
+// wraps the lines without a marker.
+func SetCodeWrapMarker(marker string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.CodeWrapMarker = marker
+	}
+}
+
+// SetClipCode clips code lines that are wider than the page at the right
+// margin, rather than wrapping them, and logs a warning for each block
+// that was clipped.
+func SetClipCode(clip bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.ClipCode = clip
+	}
+}
+
+// wrapMarkerStyle is s as the wrap marker is drawn in: the core fonts and
+// most presets lack the arrows, so boxDrawingFont is used unless the code
+// font is a TTF file chosen by the user
+func (r *PdfRenderer) wrapMarkerStyle(s Styler) Styler {
+	if !strings.EqualFold(filepath.Ext(s.Font), ".ttf") {
+		s.Font = boxDrawingFont
+	}
+	s.Style = ""
+	s.TextColor = wrapMarkerColor
+	return s
+}
+
+// wrapMarkerWidth is the width taken by the wrap marker at the right
+// margin; s is the current style, which is restored
+func (r *PdfRenderer) wrapMarkerWidth(s Styler) float64 {
+	if r.CodeWrapMarker == "" || r.ClipCode {
+		return 0
+	}
+	r.setStyler(r.wrapMarkerStyle(s))
+	w := r.Pdf.GetStringWidth(r.CodeWrapMarker) + 2*r.Pdf.GetCellMargin()
+	r.setStyler(s)
+	return w
+}
+
+// writeWrapMarker draws the wrap marker at the right margin of the current
+// line, h high, and restores the style s
+func (r *PdfRenderer) writeWrapMarker(s Styler, h float64) {
+	if r.CodeWrapMarker == "" {
+		return
+	}
+	w := r.wrapMarkerWidth(s)
+	r.setStyler(r.wrapMarkerStyle(s))
+	r.Pdf.SetX(r.rightEdge() - w)
+	r.Pdf.CellFormat(w, h, r.CodeWrapMarker, "", 0, "C", false, 0, "")
+	r.setStyler(s)
+}
+
+// codeWidth is the width code lines starting at the current position can
+// take, with the given padding on either side, leaving room for the wrap
+// marker
+func (r *PdfRenderer) codeWidth(s Styler, padding float64) float64 {
+	return r.availableWidth() - 2*padding - r.wrapMarkerWidth(s)
+}
+
+// displayWidth is the number of terminal columns c takes: two for the wide
+// characters of East Asian scripts and emoji, none for combining marks,
+// variation selectors and joiners, one otherwise
+func displayWidth(c rune) int {
+	if zeroWidth(c) {
+		return 0
+	}
+	switch width.LookupRune(c).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// zeroWidth tells whether c is drawn over or joined to the character before
+// it, so that a line is not broken before it
+func zeroWidth(c rune) bool {
+	return unicode.In(c, unicode.Mn, unicode.Me, unicode.Variation_Selector) || c == '\u200d'
+}
+
+// wrapCode splits a code line that is wider than width, measured in the
+// style s, into pieces that fit; the break may fall inside a word, as
+// breaking at spaces would not show where the line really ends, but not
+// inside a character with its combining marks or an emoji sequence. With
+// ClipCode only the first piece is returned and clipped is set.
+func (r *PdfRenderer) wrapCode(s Styler, line string, width float64) (pieces []string, clipped bool) {
+	r.setStyler(s)
+	if r.Pdf.GetStringWidth(line) <= width {
+		return []string{line}, false
+	}
+	start, w := 0, 0.0
+	// the current character with its marks, where the line may break
+	cluster, clusterW := 0, 0.0
+	joined := false // the previous character is a zero width joiner
+	for i, c := range line {
+		cw := r.Pdf.GetStringWidth(string(c))
+		if !zeroWidth(c) && !joined {
+			cluster, clusterW = i, 0
+		}
+		joined = c == '\u200d'
+		if w+cw > width && cluster > start {
+			pieces = append(pieces, line[start:cluster])
+			if r.ClipCode {
+				return pieces, true
+			}
+			start, w = cluster, clusterW
+		}
+		w += cw
+		clusterW += cw
+	}
+	return append(pieces, line[start:]), false
+}
+
+// warnClipped logs a warning for a code block of which n lines were clipped
+func (r *PdfRenderer) warnClipped(n int, first string) {
+	if n == 0 {
+		return
+	}
+	if utf8.RuneCountInString(first) > 40 {
+		first = string([]rune(first)[:40]) + "..."
+	}
+	r.logf("Warning: %d code line(s) clipped at the right margin, starting with %q", n, strings.TrimSpace(first))
+}
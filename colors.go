@@ -1,6 +1,8 @@
 package mdtopdf
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"strconv"
 	"strings"
@@ -132,6 +134,7 @@ var colornames = map[string]Color{
 	"plum":                 {221, 160, 221},
 	"powderblue":           {176, 224, 230},
 	"purple":               {128, 0, 128},
+	"rebeccapurple":        {102, 51, 153},
 	"red":                  {255, 0, 0},
 	"rosybrown":            {188, 143, 143},
 	"royalblue":            {65, 105, 225},
@@ -162,44 +165,134 @@ var colornames = map[string]Color{
 	"yellowgreen":          {154, 205, 50},
 }
 
-// Colorlookup returns a RGB triple corresponding to the named color, "rgb(r,g,b)" or "#rrggbb" string.
-// On error, return black.
+// Colorlookup returns a RGB triple corresponding to the named color, "rgb(r,g,b)",
+// "rgba(r,g,b,a)", "#rgb", "#rrggbb" or "hsv(h,s,v)" string; rgba colors are
+// tinted over white. On error, return black.
 func Colorlookup(s string) Color {
-	color, ok := colornames[s]
-	if ok {
-		return Color{color.Red, color.Green, color.Blue}
+	color, alpha, err := parseColor(s)
+	if err != nil {
+		return Color{0, 0, 0}
 	}
-	var red, green, blue int
-	ls := len(s)
-	// rgb(r, g, b)
-	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") && ls > 5 {
-		v := colorNumbers(s)
-		if len(v) == 3 {
-			red, _ = strconv.Atoi(v[0])
-			green, _ = strconv.Atoi(v[1])
-			blue, _ = strconv.Atoi(v[2])
+	return tint(color, alpha, Color{255, 255, 255})
+}
+
+// parseColor parses a color as Colorlookup does, returning its opacity
+// (1 unless given by rgba) apart
+func parseColor(s string) (Color, float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if color, ok := colornames[s]; ok {
+		return color, 1, nil
+	}
+	invalid := fmt.Errorf("invalid color %q", s)
+	var v []string
+	switch {
+	case strings.HasPrefix(s, "#"):
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 6 || err != nil {
+			return Color{}, 0, invalid
+		}
+		return Color{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}, 1, nil
+	case strings.HasPrefix(s, "rgba(") && strings.HasSuffix(s, ")"):
+		v = strings.Split(strings.NewReplacer(" ", "", "\t", "").Replace(s[5:len(s)-1]), ",")
+	case strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")"), strings.HasPrefix(s, "hsv(") && strings.HasSuffix(s, ")"):
+		v = colorNumbers(s)
+	default:
+		return Color{}, 0, invalid
+	}
+	if len(v) != 3 && !(len(v) == 4 && strings.HasPrefix(s, "rgba(")) {
+		return Color{}, 0, invalid
+	}
+	var f [4]float64
+	for i, n := range v {
+		x, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return Color{}, 0, invalid
+		}
+		f[i] = x
+	}
+	if strings.HasPrefix(s, "hsv(") {
+		red, green, blue := hsv2rgb(f[0], f[1], f[2])
+		return Color{red, green, blue}, 1, nil
+	}
+	alpha := 1.0
+	if len(v) == 4 {
+		alpha = f[3]
+		if alpha < 0 || alpha > 1 {
+			return Color{}, 0, invalid
 		}
-		return Color{red, green, blue}
 	}
-	// #rrggbb
-	if strings.HasPrefix(s, "#") && ls == 7 {
-		r, _ := strconv.ParseInt(s[1:3], 16, 32)
-		g, _ := strconv.ParseInt(s[3:5], 16, 32)
-		b, _ := strconv.ParseInt(s[5:7], 16, 32)
-		return Color{int(r), int(g), int(b)}
+	return Color{int(f[0]), int(f[1]), int(f[2])}, alpha, nil
+}
+
+// tint returns color at opacity alpha over background, as PDF text and
+// fills are opaque
+func tint(color Color, alpha float64, background Color) Color {
+	mix := func(c, b int) int { return int(math.Round(alpha*float64(c) + (1-alpha)*float64(b))) }
+	return Color{mix(color.Red, background.Red), mix(color.Green, background.Green), mix(color.Blue, background.Blue)}
+}
+
+// UnmarshalJSON reads a color of a theme as {"Red": r, "Green": g, "Blue":
+// b} or as a string Colorlookup takes, e.g. "#1a2b3c" or "rebeccapurple".
+// rgba() colors are tinted over white here; see blendThemeColors.
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		type rgb Color // without this method
+		return json.Unmarshal(data, (*rgb)(c))
+	}
+	color, alpha, err := parseColor(s)
+	if err != nil {
+		return err
+	}
+	*c = tint(color, alpha, Color{255, 255, 255})
+	return nil
+}
+
+// blendThemeColors rewrites the rgba() colors of theme JSON data as the
+// opaque colors they show over the theme's BackgroundColor, or white if it
+// has none
+func blendThemeColors(data []byte) ([]byte, error) {
+	if !strings.Contains(strings.ToLower(string(data)), "rgba(") {
+		return data, nil
+	}
+	var theme map[string]any
+	if err := json.Unmarshal(data, &theme); err != nil {
+		return nil, err
+	}
+	background := Color{255, 255, 255}
+	for key, value := range theme {
+		if strings.EqualFold(key, "BackgroundColor") {
+			raw, _ := json.Marshal(value)
+			if err := json.Unmarshal(raw, &background); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
 	}
-	// hsv(hue, saturation, value)
-	if strings.HasPrefix(s, "hsv(") && strings.HasSuffix(s, ")") && ls > 5 {
-		v := colorNumbers(s)
-		if len(v) == 3 {
-			hue, _ := strconv.ParseFloat(v[0], 64)
-			sat, _ := strconv.ParseFloat(v[1], 64)
-			value, _ := strconv.ParseFloat(v[2], 64)
-			red, green, blue = hsv2rgb(hue, sat, value)
+	var blend func(v any) any
+	blend = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if color, alpha, err := parseColor(v); err == nil && alpha < 1 {
+				c := tint(color, alpha, background)
+				return fmt.Sprintf("rgb(%d, %d, %d)", c.Red, c.Green, c.Blue)
+			}
+		case map[string]any:
+			for key, value := range v {
+				v[key] = blend(value)
+			}
+		case []any:
+			for i, value := range v {
+				v[i] = blend(value)
+			}
 		}
-		return Color{red, green, blue}
+		return v
 	}
-	return Color{0, 0, 0}
+	blend(theme)
+	return json.Marshal(theme)
 }
 
 // colorNumbers returns a list of numbers from a comma separated list,
@@ -0,0 +1,161 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strings"
+)
+
+// conditionSyntax matches the <!-- if ... -->, <!-- else --> and
+// <!-- endif --> comments of conditional content, or a code span to skip
+var conditionSyntax = regexp.MustCompile("`+[^`]*`+|<!--\\s*(if|else|endif)\\b\\s*(.*?)\\s*-->")
+
+// condition is an if, else or endif branch being applied
+type condition struct {
+	outer bool // whether the content around the block is included
+	taken bool // whether a branch of the block was included
+}
+
+// evalCondition evaluates the test of an <!-- if --> comment against the
+// defined variables: "key=value" (several values separated by commas
+// match any of them), "key!=value", "key" (defined and not false) and
+// "!key"
+func evalCondition(test string, defines map[string]string) bool {
+	if key, values, ok := strings.Cut(test, "!="); ok {
+		return !matchesDefine(defines, key, values)
+	}
+	if key, values, ok := strings.Cut(test, "="); ok {
+		return matchesDefine(defines, key, values)
+	}
+	if key, ok := strings.CutPrefix(test, "!"); ok {
+		return !isDefined(defines, key)
+	}
+	return isDefined(defines, test)
+}
+
+func matchesDefine(defines map[string]string, key, values string) bool {
+	value, ok := defines[strings.TrimSpace(key)]
+	if !ok {
+		return false
+	}
+	for _, v := range strings.Split(values, ",") {
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(v), `"'`), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDefined(defines map[string]string, key string) bool {
+	value, ok := defines[strings.TrimSpace(key)]
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "", "false", "no", "0":
+		return false
+	}
+	return true
+}
+
+// ApplyConditions keeps or drops the conditional content of markdown
+// source according to the defined variables:
+//
+//	<!-- if audience=internal -->
+//	...
+//	<!-- else -->
+//	...
+//	<!-- endif -->
+//
+// Blocks may be nested and the comments may also be used inline. Lines
+// holding only a condition are removed, as are the lines of dropped
+// fenced code blocks; conditions inside code are left alone.
+func ApplyConditions(content []byte, defines map[string]string) []byte {
+	if !conditionSyntax.Match(content) {
+		return content
+	}
+	var stack []condition
+	included := true
+	var out []string
+	fence := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" || strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			switch {
+			case fence == "":
+				fence = trimmed[:3]
+			case strings.HasPrefix(trimmed, fence):
+				fence = ""
+			}
+			if included {
+				out = append(out, line)
+			}
+			continue
+		}
+		var b strings.Builder
+		last, directives := 0, 0
+		for _, m := range conditionSyntax.FindAllStringSubmatchIndex(line, -1) {
+			if m[2] < 0 {
+				continue // code span
+			}
+			if included {
+				b.WriteString(line[last:m[0]])
+			}
+			last = m[1]
+			directives++
+			switch test := line[m[4]:m[5]]; line[m[2]:m[3]] {
+			case "if":
+				ok := evalCondition(test, defines)
+				stack = append(stack, condition{outer: included, taken: ok})
+				included = included && ok
+			case "else":
+				if len(stack) > 0 {
+					c := &stack[len(stack)-1]
+					included = c.outer && !c.taken
+					c.taken = true
+				}
+			case "endif":
+				if len(stack) > 0 {
+					included = stack[len(stack)-1].outer
+					stack = stack[:len(stack)-1]
+				}
+			}
+		}
+		if included {
+			b.WriteString(line[last:])
+		}
+		if directives > 0 && strings.TrimSpace(b.String()) == "" {
+			continue
+		}
+		if directives > 0 || included {
+			out = append(out, b.String())
+		}
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// SetDefines sets the variables that <!-- if --> conditions test, e.g.
+// {"audience": "internal"}
+func SetDefines(defines map[string]string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Defines = defines
+	}
+}
@@ -19,6 +19,12 @@
 
 package mdtopdf
 
+import (
+	"regexp"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
 type listType int
 
 const (
@@ -36,6 +42,26 @@ var curdatacell int
 var fill = false
 var incell = false
 
+// tableCell is a table cell waiting to be drawn with the rest of its row
+type tableCell struct {
+	lines    []string
+	width    float64
+	height   float64 // line height
+	style    Styler
+	header   bool
+	redacted bool // drawn as black bars, see redactions
+}
+
+// lineBreakTag is a <br> in a table cell, which starts a new line
+var lineBreakTag = regexp.MustCompile(`(?i)^<br\s*/?>$`)
+
+// rowcells holds the cells of the table row being rendered
+var rowcells []tableCell
+
+// rowSpanMarker as the content of a table cell continues the cell above,
+// as in MultiMarkdown; it is rendered empty
+const rowSpanMarker = "^^"
+
 func (n listType) String() string {
 	switch n {
 	case notlist:
@@ -54,22 +80,29 @@ type containerState struct {
 	textStyle         Styler
 	leftMargin        float64
 	contentLeftMargin float64
+	indent            float64 // added to the left margin by a list or block quote, see blockIndent
 	firstParagraph    bool
 
 	// populated if node type is a list
 	listkind             listType
 	itemNumber           int // last emitted number for ordered lists or count for unordered
 	orderedCounterBackup int
+	labels               map[ast.Node]string // label of each item, see listLabels
+	labelWidth           float64             // width of the widest label
 
 	// populated if node type is a link
 	destination string
 
+	// populated if node type is a heading with {.class} attributes
+	classes []string
+
 	// populated if table cell
 	isHeader bool
 
 	// populated if table cell (apply styles first)
 	cellInnerString      string
 	cellInnerStringStyle *Styler
+	cellRedacted         bool
 }
 
 type states struct {
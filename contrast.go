@@ -0,0 +1,263 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	highlight "github.com/jessp01/gohighlight"
+)
+
+// ContrastModes are the modes of SetContrastCheck
+var ContrastModes = []string{"off", "warn", "fix"}
+
+// Minimum contrast ratios of text, as in WCAG 2 level AA; large text is at
+// least 18pt, or 14pt in bold
+const (
+	minContrast      = 4.5
+	minLargeContrast = 3
+)
+
+// SetContrastCheck checks the contrast of the text colors of the theme on
+// their backgrounds, including the syntax highlighting colors of code,
+// against WCAG level AA (4.5:1, or 3:1 for large text) when the document
+// is rendered: "warn" lists the colors below it, "fix" darkens or
+// lightens them until they meet it, and "off", the default, does neither.
+// An unknown mode is ignored with a warning.
+func SetContrastCheck(mode string) RenderOption {
+	return func(r *PdfRenderer) {
+		if !slices.Contains(ContrastModes, mode) {
+			r.logf("Warning: unknown contrast check %q", mode)
+			return
+		}
+		r.ContrastCheck = mode
+	}
+}
+
+// ContrastRatio returns the WCAG contrast ratio of two colors, from 1 for
+// the same luminance to 21 for black on white
+func ContrastRatio(a, b Color) float64 {
+	la, lb := luminance(a), luminance(b)
+	return (max(la, lb) + 0.05) / (min(la, lb) + 0.05)
+}
+
+// luminance returns the relative luminance of c, as defined by WCAG
+func luminance(c Color) float64 {
+	channel := func(v int) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.Red) + 0.7152*channel(c.Green) + 0.0722*channel(c.Blue)
+}
+
+// requiredContrast returns the minimum contrast ratio of text in style s
+func requiredContrast(s Styler) float64 {
+	if s.Size >= 18 || s.Size >= 14 && strings.ContainsRune(strings.ToLower(s.Style), 'b') {
+		return minLargeContrast
+	}
+	return minContrast
+}
+
+// readableColor returns c darkened or lightened, whichever gains more
+// contrast on bg, just enough to have a contrast ratio of at least ratio,
+// or as far as it goes
+func readableColor(c, bg Color, ratio float64) Color {
+	black, white := Color{0, 0, 0}, Color{255, 255, 255}
+	target := black
+	if ContrastRatio(white, bg) > ContrastRatio(black, bg) {
+		target = white
+	}
+	fixed := c
+	for step := 1; step <= 20 && ContrastRatio(fixed, bg) < ratio; step++ {
+		fixed = tint(c, 1-float64(step)/20, target)
+	}
+	return fixed
+}
+
+// contrastColor is a text color of the theme with its background
+type contrastColor struct {
+	name  string
+	text  *Color
+	bg    Color
+	ratio float64 // required
+}
+
+// contrastColors returns the text colors of elements of the theme with
+// their backgrounds: inline code and unhighlighted code blocks are filled,
+// other text is on the page background
+func (r *PdfRenderer) contrastColors(elements []string) []contrastColor {
+	var checks []contrastColor
+	for _, name := range elements {
+		s := r.styler(name)
+		bg := r.BackgroundColor
+		if name == "Backtick" || name == "Code" {
+			bg = s.FillColor
+		}
+		checks = append(checks, contrastColor{name, &s.TextColor, bg, requiredContrast(*s)})
+	}
+	return checks
+}
+
+// codeColor is a syntax highlighting color with the groups that have it
+type codeColor struct {
+	groups []string
+	color  Color
+}
+
+// codeColorList returns the distinct colors of the highlighting groups of
+// colors, in order of their first group
+func codeColorList(colors map[string]Color) []codeColor {
+	groups := make([]string, 0, len(colors))
+	for group := range colors {
+		groups = append(groups, group)
+	}
+	slices.Sort(groups)
+	var list []codeColor
+	for _, group := range groups {
+		i := slices.IndexFunc(list, func(c codeColor) bool { return c.color == colors[group] })
+		if i < 0 {
+			list = append(list, codeColor{color: colors[group]})
+			i = len(list) - 1
+		}
+		list[i].groups = append(list[i].groups, group)
+	}
+	return list
+}
+
+// contrast returns the check of the highlighting color, which is drawn on
+// the page background
+func (c *codeColor) contrast(r *PdfRenderer) contrastColor {
+	return contrastColor{"code " + strings.Join(c.groups, ", "), &c.color, r.BackgroundColor, requiredContrast(r.Normal)}
+}
+
+// problem describes a color with too little contrast, or returns ""
+func (c contrastColor) problem() string {
+	ratio := ContrastRatio(*c.text, c.bg)
+	if ratio >= c.ratio {
+		return ""
+	}
+	return fmt.Sprintf("%s: contrast of %s on %s is %.1f:1, below %g:1",
+		c.name, hexColor(*c.text), hexColor(c.bg), ratio, c.ratio)
+}
+
+// hexColor writes c as #rrggbb
+func hexColor(c Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.Red, c.Green, c.Blue)
+}
+
+// checkContrast warns of, or fixes, the text colors of the theme with too
+// little contrast, see SetContrastCheck. The highlighting colors of the
+// code theme are copied for the run.
+func (r *PdfRenderer) checkContrast() {
+	r.codeColors = map[string]Color{}
+	for group, c := range r.codeThemeColors() {
+		r.codeColors[group] = c
+	}
+	if r.ContrastCheck != "warn" && r.ContrastCheck != "fix" {
+		return
+	}
+	for _, c := range r.contrastColors(ThemeElements) {
+		r.fixContrast(c)
+	}
+	for _, c := range codeColorList(r.codeColors) {
+		r.fixContrast(c.contrast(r))
+		for _, group := range c.groups {
+			r.codeColors[group] = c.color
+		}
+	}
+	if len(r.cs.stack) > 0 {
+		r.cs.stack[0].textStyle = r.Normal
+	}
+}
+
+// ThemeContrast checks the contrast of the text colors of a custom theme
+// file, as passed to SetCustomTheme, and of the syntax highlighting colors
+// on its background, against WCAG level AA as SetContrastCheck does. It
+// returns the colors below it, or an error wrapping ErrParse if data is
+// not a JSON object.
+func ThemeContrast(data []byte) ([]string, error) {
+	var theme map[string]json.RawMessage
+	var r PdfRenderer
+	data, err := blendThemeColors(data)
+	if err == nil {
+		err = json.Unmarshal(data, &theme)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	var elements []string
+	for _, element := range ThemeElements {
+		if _, ok := lookupKey(theme, element); ok {
+			elements = append(elements, element)
+		}
+	}
+	checks := r.contrastColors(elements)
+	for _, c := range codeColorList(r.codeThemeColors()) {
+		checks = append(checks, c.contrast(&r))
+	}
+	var problems []string
+	for _, c := range checks {
+		if problem := c.problem(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	return problems, nil
+}
+
+// groupColors returns the colors of the syntax highlighting groups
+// known to the highlighter, checked for contrast if it is a run
+func (r *PdfRenderer) groupColors() map[highlight.Group]Color {
+	colors := r.codeColors
+	if colors == nil {
+		colors = r.codeThemeColors()
+	}
+	groups := map[highlight.Group]Color{}
+	for name, c := range colors {
+		if group, ok := highlight.Groups[name]; ok {
+			groups[group] = c
+		}
+	}
+	return groups
+}
+
+// fixContrast warns of c if its contrast is too low, and in "fix" mode
+// changes it to have enough
+func (r *PdfRenderer) fixContrast(c contrastColor) {
+	problem := c.problem()
+	if problem == "" {
+		return
+	}
+	if r.ContrastCheck == "fix" {
+		*c.text = readableColor(*c.text, c.bg, c.ratio)
+		r.tracer("Contrast", fmt.Sprintf("%s; using %s", problem, hexColor(*c.text)))
+		return
+	}
+	r.logf("Warning: %s", problem)
+}
@@ -0,0 +1,243 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// FigureLabel and TableLabel prefix the numbers of captioned figures and
+// tables, and the text that cross-references to them resolve to.
+var (
+	FigureLabel = "Figure"
+	TableLabel  = "Table"
+)
+
+// crossRef is a numbered figure or table that can be referenced
+type crossRef struct {
+	label string // e.g. "Figure 3"
+	link  int    // fpdf internal link, set when the target is rendered
+}
+
+// figureID matches the pandoc-crossref attribute following an image:
+// ![Caption](arch.png){#fig:arch}
+var figureID = regexp.MustCompile(`^\s*\{#(fig:[\w.:-]+)\}`)
+
+// tableCaption matches a pandoc table caption paragraph placed directly
+// before or after a table: "Table: Results {#tbl:results}" or ": Results"
+var tableCaption = regexp.MustCompile(`^(?:Table)?:\s+`)
+var tableID = regexp.MustCompile(`\s*\{#(tbl:[\w.:-]+)\}\s*$`)
+
+// crossRefUse matches references: [@fig:arch], [see @tbl:results] or a
+// bare @fig:arch
+var crossRefUse = regexp.MustCompile(`\[([^\[\]@]*?)@((?:fig|tbl):[\w.:-]*[\w-])\]|@((?:fig|tbl):[\w.:-]*[\w-])`)
+
+// numberCrossRefs assigns numbers to labelled figures and captioned tables
+// in document order, so that references (including forward ones) resolve
+// to the right number. Captions are rewritten to carry the number.
+func (r *PdfRenderer) numberCrossRefs(doc ast.Node) {
+	r.crossRefs = map[string]*crossRef{}
+	r.crossRefTargets = map[ast.Node]int{}
+	r.headingAnchors = map[string]int{}
+	figures, tables := 0, 0
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.HTMLBlock:
+			if d, ok := parseDirective(n.Literal); ok && d.name == "restartnumbering" {
+				figures, tables = 0, 0
+			}
+		case *ast.Heading:
+			// headings with an {#id} are targets of [text](#id) links
+			if n.HeadingID != "" {
+				r.headingAnchors[n.HeadingID] = r.Pdf.AddLink()
+			}
+		case *ast.Image:
+			next, ok := ast.GetNextNode(n).(*ast.Text)
+			if !ok {
+				return ast.GoToNext
+			}
+			m := figureID.FindSubmatchIndex(next.Literal)
+			if m == nil {
+				return ast.GoToNext
+			}
+			figures++
+			id := string(next.Literal[m[2]:m[3]])
+			next.Literal = next.Literal[m[1]:]
+			ref := &crossRef{label: fmt.Sprintf("%s %d", FigureLabel, figures), link: r.Pdf.AddLink()}
+			r.crossRefs[id] = ref
+			r.crossRefTargets[n] = ref.link
+			if alt := firstText(n); alt != nil {
+				alt.Literal = append([]byte(ref.label+": "), alt.Literal...)
+			}
+		case *ast.CaptionFigure:
+			// mmark figures: a table or figure with a caption; quotes
+			// carry an attribution instead
+			caption, ok := ast.GetLastChild(n).(*ast.Caption)
+			if !ok || firstText(caption) == nil {
+				return ast.GoToNext
+			}
+			first := firstText(caption)
+			var label string
+			switch n.Children[0].(type) {
+			case *ast.BlockQuote:
+				return ast.GoToNext
+			case *ast.Table:
+				tables++
+				label = fmt.Sprintf("%s %d", TableLabel, tables)
+			default:
+				figures++
+				label = fmt.Sprintf("%s %d", FigureLabel, figures)
+			}
+			ref := &crossRef{label: label, link: r.Pdf.AddLink()}
+			first.Literal = append([]byte(label+": "), first.Literal...)
+			// "Figure: Caption {#fig:id}"
+			if n.HeadingID != "" {
+				r.crossRefs[n.HeadingID] = ref
+			}
+			r.crossRefTargets[n] = ref.link
+		case *ast.Table:
+			if _, ok := n.Parent.(*ast.CaptionFigure); ok {
+				return ast.GoToNext
+			}
+			caption := tableCaptionFor(n)
+			if caption == nil {
+				return ast.GoToNext
+			}
+			tables++
+			ref := &crossRef{label: fmt.Sprintf("%s %d", TableLabel, tables), link: r.Pdf.AddLink()}
+			first := firstText(caption)
+			first.Literal = append([]byte(ref.label+": "), tableCaption.ReplaceAll(first.Literal, nil)...)
+			if last := lastText(caption); last != nil {
+				if m := tableID.FindSubmatchIndex(last.Literal); m != nil {
+					r.crossRefs[string(last.Literal[m[2]:m[3]])] = ref
+					last.Literal = last.Literal[:m[0]]
+				}
+			}
+			r.crossRefTargets[caption] = ref.link
+		}
+		return ast.GoToNext
+	})
+}
+
+// tableCaptionFor returns the caption paragraph adjacent to a table, if any
+func tableCaptionFor(table *ast.Table) *ast.Paragraph {
+	for _, sibling := range []ast.Node{ast.GetNextNode(table), ast.GetPrevNode(table)} {
+		p, ok := sibling.(*ast.Paragraph)
+		if !ok {
+			continue
+		}
+		if t := firstText(p); t != nil && tableCaption.Match(t.Literal) {
+			return p
+		}
+	}
+	return nil
+}
+
+func firstText(node ast.Node) *ast.Text {
+	var text *ast.Text
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if t, ok := n.(*ast.Text); ok && entering {
+			text = t
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return text
+}
+
+func lastText(node ast.Node) *ast.Text {
+	var text *ast.Text
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if t, ok := n.(*ast.Text); ok && entering {
+			text = t
+		}
+		return ast.GoToNext
+	})
+	return text
+}
+
+// setCrossRefTarget points the link of a numbered figure or table at the
+// current position
+func (r *PdfRenderer) setCrossRefTarget(node ast.Node) {
+	if link, ok := r.crossRefTargets[node]; ok {
+		r.setLink(link)
+	}
+}
+
+// isCrossRef reports whether a citation key refers to a figure or table
+func isCrossRef(key string) bool {
+	return strings.HasPrefix(key, "fig:") || strings.HasPrefix(key, "tbl:")
+}
+
+// resolveCrossRefs replaces references with their labels, without links.
+// Used where text is not written directly, e.g. in table cells.
+func (r *PdfRenderer) resolveCrossRefs(s string) string {
+	return crossRefUse.ReplaceAllStringFunc(s, func(m string) string {
+		sub := crossRefUse.FindStringSubmatch(m)
+		return sub[1] + r.crossRefLabel(sub[2]+sub[3])
+	})
+}
+
+func (r *PdfRenderer) crossRefLabel(key string) string {
+	if ref, ok := r.crossRefs[key]; ok {
+		return ref.label
+	}
+	r.tracer("CrossRef", fmt.Sprintf("unknown reference %s", key))
+	if isCrossRef(key) {
+		r.brokenLink("@" + key)
+	} else {
+		r.brokenLink("#" + key)
+	}
+	return "??" + key
+}
+
+// writeCrossRefs writes s, turning figure and table references into links
+// to the referenced element.
+func (r *PdfRenderer) writeCrossRefs(style Styler, s string) {
+	last := 0
+	for _, m := range crossRefUse.FindAllStringSubmatchIndex(s, -1) {
+		r.write(style, s[last:m[0]])
+		last = m[1]
+		var key string
+		if m[4] >= 0 {
+			r.write(style, s[m[2]:m[3]])
+			key = s[m[4]:m[5]]
+		} else {
+			key = s[m[6]:m[7]]
+		}
+		ref, ok := r.crossRefs[key]
+		if !ok {
+			r.write(style, r.crossRefLabel(key))
+			continue
+		}
+		r.Pdf.SetTextColor(r.Link.TextColor.Red, r.Link.TextColor.Green, r.Link.TextColor.Blue)
+		r.useLink("@"+key, ref.link)
+		r.Pdf.WriteLinkID(r.lineHeight(style), ref.label, ref.link)
+		r.setStyler(style)
+	}
+	r.write(style, s[last:])
+}
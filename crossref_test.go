@@ -0,0 +1,63 @@
+package mdtopdf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+func TestNumberCrossRefs(t *testing.T) {
+	src := "See @tbl:res and [see @fig:arch].\n\n" +
+		"![Architecture](arch.png){#fig:arch}\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\nTable: Results {#tbl:res}\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(parser.Tables))
+	r.numberCrossRefs(doc)
+
+	if got := r.resolveCrossRefs("See @tbl:res and [see @fig:arch]."); got != "See Table 1 and see Figure 1." {
+		t.Fatalf("unexpected resolution %q", got)
+	}
+	if got := r.resolveCrossRefs("[@fig:missing]"); got != "??fig:missing" {
+		t.Fatalf("unexpected resolution of unknown reference %q", got)
+	}
+	if got := ExtractTextFromNode(doc); !containsAll(got, "Figure 1: Architecture", "Table 1: Results") {
+		t.Fatalf("captions not numbered: %q", got)
+	}
+	if len(r.crossRefTargets) != 2 {
+		t.Fatalf("expected 2 link targets, got %d", len(r.crossRefTargets))
+	}
+}
+
+func TestRestartNumbering(t *testing.T) {
+	src := "# One\n\n## One.1\n\n![A](a.png){#fig:a}\n\n![B](b.png){#fig:b}\n\n" +
+		"<!-- restartnumbering -->\n\n# Two\n\n![C](c.png){#fig:c}\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(parser.CommonExtensions))
+	r.numberCrossRefs(doc)
+	if got := r.resolveCrossRefs("@fig:b, @fig:c"); got != "Figure 2, Figure 1" {
+		t.Fatalf("figure numbers not restarted: %q", got)
+	}
+
+	entries, err := GetTOCEntries([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []string
+	for _, e := range entries {
+		numbers = append(numbers, e.Number)
+	}
+	if got := strings.Join(numbers, " "); got != "1 1.1 1" {
+		t.Fatalf("heading numbers not restarted: %q", got)
+	}
+}
+
+func containsAll(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
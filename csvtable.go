@@ -0,0 +1,155 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// csvOptions are the settings of a ```csv or ```tsv fence, given in its
+// info string: ```csv header=false delimiter=;
+type csvOptions struct {
+	header    bool
+	delimiter rune
+}
+
+func parseCSVInfo(info string) (csvOptions, bool) {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return csvOptions{}, false
+	}
+	opts := csvOptions{header: true}
+	switch strings.ToLower(fields[0]) {
+	case "csv":
+		opts.delimiter = ','
+	case "tsv":
+		opts.delimiter = '\t'
+	default:
+		return csvOptions{}, false
+	}
+	for _, f := range fields[1:] {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "header":
+			opts.header = v != "false" && v != "no"
+		case "delimiter":
+			if v == `\t` || v == "tab" {
+				opts.delimiter = '\t'
+			} else if v != "" {
+				opts.delimiter = []rune(v)[0]
+			}
+		}
+	}
+	return opts, true
+}
+
+// csvTable parses CSV data into a table node; short rows are padded so that
+// every row has the same number of cells.
+func csvTable(data string, opts csvOptions) (*ast.Table, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma = opts.delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no rows")
+	}
+	columns := 0
+	for _, rec := range records {
+		columns = max(columns, len(rec))
+	}
+
+	row := func(rec []string, header bool) *ast.TableRow {
+		tr := &ast.TableRow{}
+		for i := 0; i < columns; i++ {
+			cell := &ast.TableCell{IsHeader: header}
+			text := ""
+			if i < len(rec) {
+				text = rec[i]
+			}
+			ast.AppendChild(cell, &ast.Text{Leaf: ast.Leaf{Literal: []byte(text)}})
+			ast.AppendChild(tr, cell)
+		}
+		return tr
+	}
+
+	table := &ast.Table{}
+	if opts.header {
+		head := &ast.TableHeader{}
+		ast.AppendChild(head, row(records[0], true))
+		ast.AppendChild(table, head)
+		records = records[1:]
+	}
+	body := &ast.TableBody{}
+	for _, rec := range records {
+		ast.AppendChild(body, row(rec, false))
+	}
+	ast.AppendChild(table, body)
+	return table, nil
+}
+
+// replaceNode puts replacements in the place of node in the tree
+func replaceNode(node ast.Node, replacements ...ast.Node) {
+	parent := node.GetParent()
+	children := parent.GetChildren()
+	for i, child := range children {
+		if child == node {
+			for _, n := range replacements {
+				n.SetParent(parent)
+			}
+			children = append(children[:i:i], append(replacements, children[i+1:]...)...)
+			parent.SetChildren(children)
+			return
+		}
+	}
+}
+
+// csvTables replaces ```csv and ```tsv fenced code blocks with tables, so
+// they get the normal table styling. Blocks that fail to parse are left as
+// code.
+func (r *PdfRenderer) csvTables(doc ast.Node) {
+	var blocks []*ast.CodeBlock
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if cb, ok := node.(*ast.CodeBlock); ok && entering && cb.IsFenced {
+			blocks = append(blocks, cb)
+		}
+		return ast.GoToNext
+	})
+	for _, cb := range blocks {
+		opts, ok := parseCSVInfo(string(cb.Info))
+		if !ok {
+			continue
+		}
+		table, err := csvTable(string(cb.Literal), opts)
+		if err != nil {
+			r.tracer("CSV", fmt.Sprintf("leaving block as code: %v", err))
+			continue
+		}
+		replaceNode(cb, table)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// detailsBlock matches a <details> HTML block and its optional <summary>
+var detailsBlock = regexp.MustCompile(`(?is)^\s*<details[^>]*>\s*(?:<summary[^>]*>(.*?)</summary>)?(.*)</details>\s*$`)
+
+var (
+	detailsOpen   = regexp.MustCompile(`(?i)<details\b`)
+	detailsClose  = regexp.MustCompile(`(?i)</details\s*>`)
+	detailsMarker = regexp.MustCompile(`^<!-- details (\d+) -->\s*$`)
+)
+
+// htmlTag matches an HTML tag, removed from summaries
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// CollapsedLabel is printed below the summary of a <details> block whose
+// content is left out, see SetCollapseDetails
+var CollapsedLabel = "collapsed content omitted"
+
+// detailsSummary is the summary line of a <details> block
+type detailsSummary struct {
+	ast.Leaf
+	collapsed bool
+}
+
+// extractDetails replaces the <details> blocks of content, up to their
+// matching </details>, with numbered marker comments before parsing: the
+// markdown parser ends an HTML block at the first closing tag, which breaks
+// nested blocks. It returns the new content and the blocks by number.
+// Fenced code blocks are skipped.
+func extractDetails(content []byte) ([]byte, []string) {
+	lines := strings.Split(string(content), "\n")
+	var out, blocks []string
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out = append(out, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			out = append(out, line)
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(trimmed), "<details") {
+			out = append(out, line)
+			continue
+		}
+		depth, end := 0, -1
+		for j := i; j < len(lines) && end < 0; j++ {
+			depth += len(detailsOpen.FindAllString(lines[j], -1)) - len(detailsClose.FindAllString(lines[j], -1))
+			if depth <= 0 {
+				end = j
+			}
+		}
+		if end < 0 {
+			// never closed: leave it to the parser as HTML
+			out = append(out, line)
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		blocks = append(blocks, strings.Join(lines[i:end+1], "\n"))
+		out = append(out, "", fmt.Sprintf("%s<!-- details %d -->", indent, len(blocks)-1), "")
+		i = end
+	}
+	return []byte(strings.Join(out, "\n")), blocks
+}
+
+// detailsBlocks replaces the markers left by extractDetails with the
+// summary of the block, rendered as a small heading, followed by its
+// content parsed as markdown, or by CollapsedLabel if r.CollapseDetails is
+// set.
+func (r *PdfRenderer) detailsBlocks(doc ast.Node, blocks []string) {
+	var markers []ast.Node
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.HTMLBlock:
+			if entering && detailsMarker.Match(n.Literal) {
+				markers = append(markers, n)
+			}
+		case *ast.Paragraph:
+			// an indented marker, e.g. in a list, is parsed as inline HTML
+			if entering && markerSpan(n) != nil {
+				markers = append(markers, n)
+				return ast.SkipChildren
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, b := range markers {
+		literal := b.AsLeaf()
+		if p, ok := b.(*ast.Paragraph); ok {
+			literal = markerSpan(p).AsLeaf()
+		}
+		n, _ := strconv.Atoi(string(detailsMarker.FindSubmatch(literal.Literal)[1]))
+		if n >= len(blocks) {
+			continue
+		}
+		m := detailsBlock.FindStringSubmatch(blocks[n])
+		if m == nil {
+			continue
+		}
+		summary := strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(m[1], "")))
+		if summary == "" {
+			summary = "Details"
+		}
+		nodes := []ast.Node{&detailsSummary{Leaf: ast.Leaf{Literal: []byte(summary)}, collapsed: r.CollapseDetails}}
+		if !r.CollapseDetails {
+			src, inner := extractDetails([]byte(m[2]))
+			body := markdown.Parse(src, parser.NewWithExtensions(r.Extensions))
+			r.detailsBlocks(body, inner)
+			nodes = append(nodes, body.GetChildren()...)
+		}
+		r.tracer("Details", fmt.Sprintf("%q, %d blocks", summary, len(nodes)-1))
+		replaceNode(b, nodes...)
+	}
+}
+
+// markerSpan returns the details marker of a paragraph holding only that
+// and empty text, or nil
+func markerSpan(p *ast.Paragraph) *ast.HTMLSpan {
+	var span *ast.HTMLSpan
+	for _, child := range p.Children {
+		switch c := child.(type) {
+		case *ast.HTMLSpan:
+			if span != nil || !detailsMarker.Match(c.Literal) {
+				return nil
+			}
+			span = c
+		case *ast.Text:
+			if strings.TrimSpace(string(c.Literal)) != "" {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return span
+}
+
+// processDetailsSummary renders the summary of a <details> block
+func (r *PdfRenderer) processDetailsSummary(node *detailsSummary) {
+	r.cr()
+	r.setStyler(r.H6)
+	r.write(r.H6, sanitizeText(string(node.Literal)))
+	r.cr()
+	if node.collapsed {
+		style := r.Normal
+		style.Style += "i"
+		r.setStyler(style)
+		r.write(style, "("+CollapsedLabel+")")
+		r.cr()
+	}
+}
+
+// SetCollapseDetails renders only the summary of <details> blocks, with
+// CollapsedLabel in place of their content
+func SetCollapseDetails(value bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.CollapseDetails = value
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"codeberg.org/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// DiagramCommands maps fence languages to external commands that read the
+// diagram source on stdin and write a PNG image to stdout. Fences whose
+// command is not installed are rendered as code.
+var DiagramCommands = map[string][]string{
+	"dot":      {"dot", "-Tpng", "-Gdpi=144"},
+	"graphviz": {"dot", "-Tpng", "-Gdpi=144"},
+	"plantuml": {"plantuml", "-tpng", "-pipe", "-Sdpi=144"},
+	"puml":     {"plantuml", "-tpng", "-pipe", "-Sdpi=144"},
+}
+
+// diagramDPI is the resolution diagram commands render at
+const diagramDPI = 144
+
+// diagramTimeout bounds the time an external diagram command may take, and
+// those typesetting LaTeX and converting HEIF images
+var diagramTimeout = 30 * time.Second
+
+// runDiagramCommand runs the diagram command for lang on src and returns the PNG
+func runDiagramCommand(lang string, src []byte) ([]byte, error) {
+	command := DiagramCommands[lang]
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(src)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// plantUMLAlphabet is the base64 variant used in PlantUML server URLs
+const plantUMLAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+// plantUMLEncode deflates and encodes diagram source for a PlantUML server URL
+func plantUMLEncode(src []byte) string {
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	w.Write(src)
+	w.Close()
+	data := deflated.Bytes()
+	var out strings.Builder
+	for i := 0; i < len(data); i += 3 {
+		var b [3]byte
+		copy(b[:], data[i:])
+		out.WriteByte(plantUMLAlphabet[b[0]>>2])
+		out.WriteByte(plantUMLAlphabet[(b[0]&0x3)<<4|b[1]>>4])
+		out.WriteByte(plantUMLAlphabet[(b[1]&0xF)<<2|b[2]>>6])
+		out.WriteByte(plantUMLAlphabet[b[2]&0x3F])
+	}
+	return out.String()
+}
+
+// fetchPlantUML renders a diagram with a PlantUML server
+func fetchPlantUML(server string, src []byte) ([]byte, error) {
+	client := &http.Client{Timeout: diagramTimeout}
+	resp, err := client.Get(strings.TrimSuffix(server, "/") + "/png/" + plantUMLEncode(src))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("PlantUML server: HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// renderDiagram returns the PNG for a diagram, from the cache if it was
+// rendered before, otherwise from the PlantUML server (for PlantUML, if one
+// is configured) or the external command.
+func (r *PdfRenderer) renderDiagram(lang string, src []byte) ([]byte, error) {
+	command := DiagramCommands[lang]
+	if r.PlantUMLServer != "" && command[0] == "plantuml" {
+		return r.cachedImage(r.PlantUMLServer, src, func() ([]byte, error) {
+			return fetchPlantUML(r.PlantUMLServer, src)
+		})
+	}
+	return r.cachedImage(strings.Join(command, " "), src, func() ([]byte, error) {
+		return runDiagramCommand(lang, src)
+	})
+}
+
+// cachedImage returns the PNG that render makes of src, from the diagram
+// cache if it was rendered before by the renderer named key
+func (r *PdfRenderer) cachedImage(key string, src []byte, render func() ([]byte, error)) ([]byte, error) {
+	var cached string
+	if r.DiagramCacheDir != "" {
+		cached = filepath.Join(r.DiagramCacheDir, fmt.Sprintf("%x.png", sha1.Sum(append([]byte(key+"\n"), src...))))
+		if png, err := os.ReadFile(cached); err == nil {
+			r.tracer("Diagram", "using cached "+cached)
+			return png, nil
+		}
+	}
+	png, err := render()
+	if err != nil {
+		return nil, err
+	}
+	if cached != "" {
+		if err := os.MkdirAll(r.DiagramCacheDir, 0o755); err == nil {
+			err = os.WriteFile(cached, png, 0o644)
+		}
+		if err != nil {
+			r.tracer("Diagram", fmt.Sprintf("not cached: %v", err))
+		}
+	}
+	return png, nil
+}
+
+// processDiagram renders a diagram fence (e.g. ```dot) as an image. It
+// reports false if the block is not a diagram or could not be rendered, in
+// which case it is output as code.
+func (r *PdfRenderer) processDiagram(node ast.CodeBlock) bool {
+	lang := strings.ToLower(strings.TrimSpace(string(node.Info)))
+	if fields := strings.Fields(lang); len(fields) > 0 {
+		lang = fields[0]
+	}
+	if _, ok := DiagramCommands[lang]; !ok {
+		return false
+	}
+	png, err := r.renderDiagram(lang, node.Literal)
+	if err != nil {
+		r.logf("Warning: %s block printed as code: %v", lang, err)
+		return false
+	}
+	if err := r.drawPNG("diagram", png, node.Literal); err != nil {
+		r.logf("Warning: %s block printed as code: invalid output: %v", lang, err)
+		return false
+	}
+	r.tracer("Diagram", fmt.Sprintf("%s (%d bytes)", lang, len(png)))
+	return true
+}
+
+// drawPNG draws a PNG rendered at diagramDPI from src as a block image,
+// unless it is not a valid image
+func (r *PdfRenderer) drawPNG(kind string, png, src []byte) error {
+	return r.drawImage(fmt.Sprintf("%s-%x", kind, sha1.Sum(src)), png, diagramDPI)
+}
+
+// drawImage registers a PNG image under name, at dpi, and draws it as a
+// block image
+func (r *PdfRenderer) drawImage(name string, png []byte, dpi float64) error {
+	info := r.Pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "png"}, bytes.NewReader(png))
+	if info == nil || r.Pdf.Err() {
+		err := r.Pdf.Error()
+		r.Pdf.ClearError()
+		if err == nil {
+			err = errors.New("not a PNG image")
+		}
+		return err
+	}
+	info.SetDpi(dpi)
+	r.cr()
+	r.placeImage(name, info)
+	return nil
+}
+
+// placeImage draws a registered image at the current position, scaled down
+// to fit the content width, keeping it on one page where possible.
+func (r *PdfRenderer) placeImage(name string, info *fpdf.ImageInfoType) {
+	w, h := r.imageSize(info)
+	r.keepTogether(h)
+	left, _, _, _ := r.Pdf.GetMargins()
+	r.Pdf.ImageOptions(name, -1, -1, w, h, true, fpdf.ImageOptions{ImageType: "png"}, 0, "")
+	r.Pdf.SetX(left)
+}
+
+// imageSize returns the size of a registered image scaled down to the
+// width left of the right margin and to the height of a page, both taken
+// from the page as it is laid out
+func (r *PdfRenderer) imageSize(info *fpdf.ImageInfoType) (w, h float64) {
+	return r.fitSize(info.Extent())
+}
+
+// fitSize scales a w x h image down as imageSize does
+func (r *PdfRenderer) fitSize(w, h float64) (float64, float64) {
+	if avail := r.availableWidth(); w > avail && avail > 0 {
+		w, h = avail, h*avail/w
+	}
+	if h > r.pageContentHeight() {
+		w, h = w*r.pageContentHeight()/h, r.pageContentHeight()
+	}
+	return w, h
+}
+
+// SetPlantUMLServer renders plantuml fences with a PlantUML server, e.g.
+// https://www.plantuml.com/plantuml, instead of the local plantuml command
+func SetPlantUMLServer(url string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.PlantUMLServer = url
+	}
+}
+
+// SetDiagramCacheDir sets the directory rendered diagrams are cached in,
+// e.g. DefaultDiagramCacheDir(); diagrams are not cached by default
+func SetDiagramCacheDir(dir string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.DiagramCacheDir = dir
+	}
+}
+
+// DefaultDiagramCacheDir returns the md2pdf/diagrams directory in the user
+// cache directory, e.g. ~/.cache/md2pdf/diagrams
+func DefaultDiagramCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "md2pdf", "diagrams"), nil
+}
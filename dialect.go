@@ -0,0 +1,87 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"sort"
+
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// DefaultExtensions are the parser extensions used unless
+// PdfRendererParams.Extensions or a dialect sets others
+const DefaultExtensions = parser.NoIntraEmphasis | parser.Tables | parser.FencedCode |
+	parser.Autolink | parser.Strikethrough | parser.SpaceHeadings | parser.HeadingIDs |
+	parser.BackslashLineBreak | parser.DefinitionLists | parser.HardLineBreak |
+	parser.OrderedListStart
+
+// CommonMarkExtensions keep to the CommonMark spec: no tables,
+// strikethrough, bare URL links or other syntax it lacks
+const CommonMarkExtensions = parser.NoIntraEmphasis | parser.FencedCode |
+	parser.SpaceHeadings | parser.BackslashLineBreak | parser.OrderedListStart
+
+// MmarkExtensions parse the Mmark syntax (https://mmark.miek.nl) on top of
+// the common extensions: block attributes, document divisions, asides and
+// the like
+const MmarkExtensions = parser.CommonExtensions | parser.Attributes |
+	parser.Mmark | parser.AutoHeadingIDs | parser.OrderedListStart
+
+// Dialects are the markdown dialects SetDialect and the --dialect flag
+// accept, with their parser extensions
+var Dialects = map[string]parser.Extensions{
+	"default":    DefaultExtensions,
+	"commonmark": CommonMarkExtensions,
+	"gfm":        GFMExtensions,
+	"mmark":      MmarkExtensions,
+}
+
+// DialectNames lists the names of Dialects in order
+func DialectNames() []string {
+	names := make([]string, 0, len(Dialects))
+	for name := range Dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDialect parses the markdown as the named dialect, one of Dialects; "gfm"
+// also turns on the GitHub autolinks, see SetGFM. An unknown name is
+// ignored with a warning.
+func SetDialect(name string) RenderOption {
+	return func(r *PdfRenderer) {
+		ext, ok := Dialects[name]
+		if !ok {
+			r.logf("Warning: unknown markdown dialect %q", name)
+			return
+		}
+		r.Extensions = ext
+		r.GFM = name == "gfm"
+	}
+}
+
+// SetExtensions parses the markdown with exactly the given parser
+// extensions, parser.NoExtensions included, which
+// PdfRendererParams.Extensions takes for DefaultExtensions
+func SetExtensions(extensions parser.Extensions) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Extensions = extensions
+	}
+}
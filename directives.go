@@ -0,0 +1,252 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// directive is a processing instruction written as an HTML comment on a
+// line of its own or inline, e.g. <!-- appendix --> or <!-- margins left=20 -->.
+// Bare words are collected in args, key=value pairs in attrs.
+type directive struct {
+	name  string
+	args  []string
+	attrs map[string]string
+}
+
+// knownDirectives lists the names handled by processDirective. Comments
+// that don't start with one of these are treated as ordinary HTML.
+var knownDirectives = map[string]bool{
+	"appendix":         true,
+	"field":            true,
+	"qr":               true,
+	"barcode":          true,
+	"basedir":          true,
+	"code":             true,
+	"restartnumbering": true,
+	"bookmark":         true,
+	"file":             true,
+	"break-hint":       true,
+	"list":             true,
+	"margins":          true,
+	"/margins":         true,
+	"panel":            true,
+	"/panel":           true,
+	"place":            true,
+	"/place":           true,
+}
+
+// shortcode matches {{name args}} shortcodes, and code spans so that
+// shortcodes inside them are left alone
+var shortcode = regexp.MustCompile("`+[^`]*`+|\\{\\{\\s*(\\w+)([^{}]*)\\}\\}")
+
+// shortcodes are the directives that can also be written as {{name args}}
+var shortcodes = map[string]bool{"qr": true, "barcode": true}
+
+// expandShortcodes rewrites {{qr args}} and {{barcode args}} shortcodes as
+// directive comments before parsing, so that their arguments (e.g. URLs) are
+// not turned into markdown. Code blocks and code spans are skipped.
+func expandShortcodes(content []byte) []byte {
+	return mapProseLines(content, func(line string) string {
+		return shortcode.ReplaceAllStringFunc(line, func(m string) string {
+			sub := shortcode.FindStringSubmatch(m)
+			if !shortcodes[sub[1]] {
+				return m
+			}
+			return "<!-- " + sub[1] + sub[2] + " -->"
+		})
+	})
+}
+
+// mapLines applies fn to each line of markdown source outside fenced code
+// blocks, for rewrites done before parsing
+func mapLines(content []byte, fn func(line string) string) []byte {
+	lines := strings.Split(string(content), "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		lines[i] = fn(line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// parseLength converts a length such as "30mm", "1.5in", "2cm" or "40pt"
+// (the default unit) to points
+func parseLength(s string) (float64, error) {
+	units := map[string]float64{"mm": 72 / 25.4, "cm": 72 / 2.54, "in": 72, "pt": 1, "px": 0.75}
+	factor := 1.0
+	for unit, f := range units {
+		if strings.HasSuffix(s, unit) {
+			s, factor = strings.TrimSuffix(s, unit), f
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid length %q", s)
+	}
+	return v * factor, nil
+}
+
+// directiveLength returns a length attribute in document units, or def
+// (also in document units) if it is unset or invalid
+func (r *PdfRenderer) directiveLength(d directive, attr string, def float64) float64 {
+	v, ok := d.attrs[attr]
+	if !ok {
+		return def
+	}
+	pt, err := parseLength(v)
+	if err != nil {
+		r.tracer(d.name, fmt.Sprintf("%s: %v", attr, err))
+		return def
+	}
+	return pt / r.Pdf.GetConversionRatio()
+}
+
+// parseDirective parses an HTML comment as a directive
+func parseDirective(literal []byte) (directive, bool) {
+	s := strings.TrimSpace(string(literal))
+	if !strings.HasPrefix(s, "<!--") || !strings.HasSuffix(s, "-->") {
+		return directive{}, false
+	}
+	fields := splitDirectiveFields(strings.TrimSpace(s[4 : len(s)-3]))
+	if len(fields) == 0 {
+		return directive{}, false
+	}
+	// <!-- code: file --> reads better with a colon
+	name := strings.TrimSuffix(fields[0], ":")
+	if !knownDirectives[name] {
+		return directive{}, false
+	}
+	d := directive{name: name, attrs: map[string]string{}}
+	for _, f := range fields[1:] {
+		// a quoted argument, such as a path, may hold an equals sign
+		if k, v, ok := strings.Cut(f, "="); ok && attrName.MatchString(k) {
+			d.attrs[k] = directiveValue(v)
+		} else {
+			d.args = append(d.args, directiveValue(f))
+		}
+	}
+	return d, true
+}
+
+// attrName matches the name of a directive attribute
+var attrName = regexp.MustCompile(`^[\w-]+$`)
+
+// directiveValue unquotes a directive argument or attribute value; quoted
+// values are HTML escaped, see QuoteDirectiveValue
+func directiveValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return html.UnescapeString(s[1 : len(s)-1])
+	}
+	return strings.Trim(s, `"`)
+}
+
+// QuoteDirectiveValue quotes s, such as a path or a title, to be written as
+// an argument or attribute value of a directive comment; quotes and the end
+// of the comment in s are HTML escaped.
+func QuoteDirectiveValue(s string) string {
+	return `"` + html.EscapeString(s) + `"`
+}
+
+// splitDirectiveFields splits on spaces, keeping double quoted runs together
+func splitDirectiveFields(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	quoted := false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			cur.WriteRune(c)
+		case (c == ' ' || c == '\t' || c == '\n') && !quoted:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+// processDirective applies a directive found in the document
+func (r *PdfRenderer) processDirective(d directive) {
+	r.tracer("Directive", fmt.Sprintf("%s %v %v", d.name, d.args, d.attrs))
+	switch d.name {
+	case "appendix":
+		r.headingNumbers.startAppendix()
+	case "field":
+		r.processField(d)
+	case "qr":
+		r.processQR(d)
+	case "barcode":
+		r.processBarcode(d)
+	case "basedir":
+		if len(d.args) > 0 {
+			r.InputBaseDir = d.args[0]
+		}
+	case "restartnumbering":
+		r.headingNumbers.restart()
+		r.orderedListCounter = 0
+	case "bookmark":
+		r.partBookmark(d)
+	case "file":
+		r.startFile(d)
+	case "break-hint":
+		// see processBreakHint
+		r.tracer("break-hint", "not on a line of its own, ignored")
+	case "list":
+		if len(d.args) > 0 {
+			r.nextListNumbering = d.args[0]
+		}
+	case "margins":
+		r.pushMargins(d)
+	case "/margins":
+		r.popMargins()
+	case "panel":
+		r.openPanel(d)
+	case "/panel":
+		r.closePanel()
+	case "place":
+		r.openPlacement(d)
+	case "/place":
+		r.closePlacement()
+	}
+}
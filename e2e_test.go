@@ -2,26 +2,60 @@ package mdtopdf_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// binaryPath is the md2pdf binary built by md2pdfBinary; Windows only runs
+// it with the .exe extension
+var binaryPath = "./bin/md2pdf"
+
+var (
+	buildOnce sync.Once
+	buildErr  error
+)
+
+// md2pdfBinary builds the md2pdf binary once for all the e2e tests, so that
+// any of them can be run on its own, and returns its path
+func md2pdfBinary(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		if out, err := exec.Command("go", "build", "-o", binaryPath, "./cmd/md2pdf").CombinedOutput(); err != nil {
+			buildErr = fmt.Errorf("%v\n%s", err, out)
+		}
+	})
+	if buildErr != nil {
+		t.Fatalf("Failed to build binary: %v", buildErr)
+	}
+	return binaryPath
+}
+
+func init() {
+	if runtime.GOOS == "windows" {
+		binaryPath += ".exe"
+	}
+}
+
 // containsPDFMarker checks if the given bytes contain the PDF magic marker
 func containsPDFMarker(data []byte) bool {
 	return bytes.Contains(data, []byte("%PDF"))
 }
 
 func TestE2EConversions(t *testing.T) {
-	// Build the binary first
-	buildCmd := exec.Command("go", "build", "-o", "bin/md2pdf", "./cmd/md2pdf")
-	if err := buildCmd.Run(); err != nil {
-		t.Fatalf("Failed to build binary: %v", err)
-	}
-
-	binary := "./bin/md2pdf"
+	binary := md2pdfBinary(t)
 	if _, err := os.Stat(binary); err != nil {
 		t.Fatalf("Binary not found after build: %v", err)
 	}
@@ -154,7 +188,7 @@ func TestE2EConversions(t *testing.T) {
 }
 
 func TestE2EDirectoryConversion(t *testing.T) {
-	binary := "./bin/md2pdf"
+	binary := md2pdfBinary(t)
 
 	// Create temp directory with multiple MD files
 	tempDir, err := os.MkdirTemp("", "md2pdf-e2e-*")
@@ -206,22 +240,189 @@ func TestE2EDirectoryConversion(t *testing.T) {
 	t.Logf("✓ Combined directory to PDF (%d bytes)", info.Size())
 }
 
+// TestE2EDirectoryImages converts a directory with nested files, names
+// with spaces, equals signs and non-ASCII characters and upper case
+// extensions, whose images are relative to the file they are in
+func TestE2EDirectoryImages(t *testing.T) {
+	dir := t.TempDir()
+	writePNG := func(path string, c color.Color) {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for x := 0; x < 8; x++ {
+			for y := 0; y < 8; y++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePNG(filepath.Join(dir, "img", "red dot.png"), color.RGBA{255, 0, 0, 255})
+	writePNG(filepath.Join(dir, "chapter two=2", "img", "blue.png"), color.RGBA{0, 0, 255, 255})
+	files := map[string]string{
+		"01 Résumé.MD":                    "# One\n\n![red](img/red%20dot.png)\n",
+		"chapter two=2/02-intro.markdown": "# Two\n\n![blue](./img/blue.png)",
+		"notes.txt":                       "not markdown",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(dir, "out.pdf")
+	cmd := exec.Command(md2pdfBinary(t), "-i", dir, "-o", output)
+	cmd.Dir = "."
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Directory conversion failed: %v\n%s", err, out)
+	}
+	pdf, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("PDF not created: %v", err)
+	}
+	if n := bytes.Count(pdf, []byte("/Subtype /Image")); n != 2 {
+		t.Fatalf("expected the 2 relative images in the PDF, found %d", n)
+	}
+}
+
+func TestE2EDirectoryFiltering(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"README.md":           "# Readme",
+		"intro.md":            "# Intro",
+		"guide/one.md":        "# One",
+		"guide/two.md":        "# Two",
+		"drafts/wip.md":       "# Draft",
+		"node_modules/x/x.md": "# Module",
+		".md2pdfignore":       "# dependencies\nnode_modules/\n",
+		"order/chapters.txt":  "guide/two.md\nintro.md\n",
+		"order/unknown.txt":   "drafts/wip.md\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages := regexp.MustCompile(`/Type /Page\b[^s]`)
+	tests := []struct {
+		args  []string
+		pages int
+	}{
+		{nil, 5},
+		{[]string{"--exclude", "README.md", "--exclude", "drafts/"}, 3},
+		{[]string{"--include", "guide/**"}, 2},
+		{[]string{"--sort", "mtime"}, 5},
+		{[]string{"--sort", filepath.Join(dir, "order", "chapters.txt")}, 2},
+		{[]string{"--sort", filepath.Join(dir, "order", "unknown.txt"), "--exclude", "drafts"}, -1},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(t.TempDir(), "out.pdf")
+		cmd := exec.Command(md2pdfBinary(t), append([]string{"-i", dir, "-o", output}, tt.args...)...)
+		out, err := cmd.CombinedOutput()
+		if tt.pages < 0 {
+			if err == nil {
+				t.Errorf("%v: expected an error", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: conversion failed: %v\n%s", tt.args, err, out)
+		}
+		pdf, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("PDF not created: %v", err)
+		}
+		if n := len(pages.FindAll(pdf, -1)); n != tt.pages {
+			t.Errorf("%v: expected %d pages, got %d", tt.args, tt.pages, n)
+		}
+	}
+}
+
+// TestE2EDirectoryOrder checks the order of the chapters, read from the
+// bookmarks of the PDF
+func TestE2EDirectoryOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"10-faq", "2-setup", "1-intro", "appendix/1-a"} {
+		path := filepath.Join(dir, filepath.FromSlash(name)+".md")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# "+filepath.Base(name)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// UTF-16 titles, after the byte order mark
+	titles := regexp.MustCompile(`/Title \([^)]{2}([^)]+)\)`)
+	order := func(args ...string) string {
+		output := filepath.Join(t.TempDir(), "out.pdf")
+		cmd := exec.Command(md2pdfBinary(t), append([]string{"-i", dir, "-o", output, "--bookmarks"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: conversion failed: %v\n%s", args, err, out)
+		}
+		pdf, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("PDF not created: %v", err)
+		}
+		var names []string
+		for _, m := range titles.FindAllSubmatch(pdf, -1) {
+			names = append(names, string(bytes.ReplaceAll(m[1], []byte{0}, nil)))
+		}
+		return strings.Join(names, " ")
+	}
+
+	if got, want := order(), "1-intro 2-setup 10-faq 1-a"; got != want {
+		t.Errorf("natural order %q, want %q", got, want)
+	}
+	if got, want := order("--sort", "name"), "1-intro 10-faq 2-setup 1-a"; got != want {
+		t.Errorf("name order %q, want %q", got, want)
+	}
+	manifest := "chapters:\n  - appendix/1-a.md\n  - 10-faq.md\n"
+	if err := os.WriteFile(filepath.Join(dir, "book.yaml"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(), "1-a 10-faq"; got != want {
+		t.Errorf("book.yaml order %q, want %q", got, want)
+	}
+	if got, want := order("--sort", "natural"), "1-intro 2-setup 10-faq 1-a"; got != want {
+		t.Errorf("--sort natural with a book.yaml: order %q, want %q", got, want)
+	}
+
+	output := filepath.Join(t.TempDir(), "out.pdf")
+	if out, err := exec.Command(md2pdfBinary(t), "-i", dir, "-o", output).CombinedOutput(); err != nil {
+		t.Fatalf("conversion failed: %v\n%s", err, out)
+	}
+	if pdf, err := os.ReadFile(output); err != nil || bytes.Contains(pdf, []byte("/Outlines")) {
+		t.Errorf("bookmarks added without --bookmarks: %v", err)
+	}
+}
+
 func TestE2EErrorHandling(t *testing.T) {
-	binary := "./bin/md2pdf"
+	binary := md2pdfBinary(t)
 
 	testCases := []struct {
-		name      string
-		args      []string
+		name       string
+		args       []string
 		shouldFail bool
 	}{
 		{
-			name:      "Non-existent input file",
-			args:      []string{"-i", "non-existent-file.md", "-o", "output.pdf"},
+			name:       "Non-existent input file",
+			args:       []string{"-i", "non-existent-file.md", "-o", "output.pdf"},
 			shouldFail: true,
 		},
 		{
-			name:      "Invalid theme",
-			args:      []string{"-i", "tests/md2pdf_test.md", "-o", "output.pdf", "--theme", "invalid"},
+			name:       "Invalid theme",
+			args:       []string{"-i", "tests/md2pdf_test.md", "-o", "output.pdf", "--theme", "invalid"},
 			shouldFail: false, // Should use light theme as fallback
 		},
 	}
@@ -242,3 +443,192 @@ func TestE2EErrorHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestE2EExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "doc.md")
+	if err := os.WriteFile(doc, []byte("# Doc\n\n![missing](missing.png)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		args []string
+		code int
+		kind string
+	}{
+		{"Missing input", []string{"-i", filepath.Join(dir, "none.md")}, 4, "io"},
+		{"Unknown font", []string{"-i", doc, "--font", "bogus"}, 5, "font"},
+		{"Missing image", []string{"-i", doc}, 6, "image"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append(tc.args, "-o", filepath.Join(dir, "out.pdf"), "--error-format", "json")
+			cmd := exec.Command(md2pdfBinary(t), args...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != tc.code {
+				t.Fatalf("expected exit code %d, got %v", tc.code, err)
+			}
+			var report struct {
+				Error string `json:"error"`
+				Kind  string `json:"kind"`
+				Code  int    `json:"code"`
+			}
+			// warnings, such as the missing image's, come before the report
+			lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &report); err != nil {
+				t.Fatalf("stderr is not a JSON error: %q", stderr.String())
+			}
+			if report.Kind != tc.kind || report.Code != tc.code || report.Error == "" {
+				t.Fatalf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+func TestE2ETheme(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"Normal": {"Font": "Arial", "Size": 0}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(md2pdfBinary(t), "theme", "validate", "custom_themes/dark_theme.json").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "ok") {
+		t.Fatalf("validating the dark theme: %v\n%s", err, out)
+	}
+	out, err = exec.Command(md2pdfBinary(t), "theme", "validate", bad).CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 ||
+		!strings.Contains(string(out), "Normal.Size") || !strings.Contains(string(out), "H1: missing") {
+		t.Fatalf("expected exit code 3 and the problems of %s, got %v\n%s", bad, err, out)
+	}
+	preview := filepath.Join(dir, "preview.pdf")
+	if out, err := exec.Command(md2pdfBinary(t), "theme", "preview", "custom_themes/light_theme.json", "-o", preview).CombinedOutput(); err != nil {
+		t.Fatalf("previewing the light theme: %v\n%s", err, out)
+	}
+	if info, err := os.Stat(preview); err != nil || info.Size() == 0 {
+		t.Fatalf("no preview written: %v", err)
+	}
+}
+
+func TestE2EFonts(t *testing.T) {
+	out, err := exec.Command(md2pdfBinary(t), "fonts", "list").CombinedOutput()
+	if err != nil || !regexp.MustCompile(`(?m)^dejavu_sans +Latin, Cyrillic, Greek$`).Match(out) {
+		t.Fatalf("fonts list: %v\n%s", err, out)
+	}
+	preview := filepath.Join(t.TempDir(), "preview.pdf")
+	if out, err := exec.Command(md2pdfBinary(t), "fonts", "preview", "roboto", "-o", preview).CombinedOutput(); err != nil {
+		t.Fatalf("fonts preview: %v\n%s", err, out)
+	}
+	if info, err := os.Stat(preview); err != nil || info.Size() == 0 {
+		t.Fatalf("no preview written: %v", err)
+	}
+	err = exec.Command(md2pdfBinary(t), "fonts", "preview", "bogus").Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 5 {
+		t.Fatalf("expected exit code 5 for an unknown font, got %v", err)
+	}
+}
+
+func TestE2EConfig(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.yaml"), filepath.Join(dir, "second.yaml")
+	if out, err := exec.Command(md2pdfBinary(t), "--dump-config", first, "--theme", "dark", "--exclude", "drafts/*", "--table-min-font", "6.5").CombinedOutput(); err != nil {
+		t.Fatalf("dumping the config: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"theme: dark\n", "exclude:\n- drafts/*\n", "table-min-font: 6.5\n", "generate-toc: false\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("no %q in the dumped config:\n%s", want, data)
+		}
+	}
+	if out, err := exec.Command(md2pdfBinary(t), "--config", first, "--dump-config", second).CombinedOutput(); err != nil {
+		t.Fatalf("reading the config: %v\n%s", err, out)
+	}
+	if again, err := os.ReadFile(second); err != nil || !bytes.Equal(again, data) {
+		t.Errorf("config read back differs: %v\n%s", err, again)
+	}
+	out, err := exec.Command(md2pdfBinary(t), "--config", first, "--theme", "light", "--dump-config", "-").CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "theme: light\n") {
+		t.Errorf("the command line does not take precedence: %v\n%s", err, out)
+	}
+	input := filepath.Join(dir, "doc.md")
+	if err := os.WriteFile(input, []byte("---\ntitle: Notes\nversion: 2\nstatus: draft\n---\n# {{.version}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(md2pdfBinary(t), "-i", input, "-o", filepath.Join(dir, "doc.pdf"), "--define", "status=final", "--dump-config", second).CombinedOutput(); err != nil {
+		t.Fatalf("dumping the config of a conversion: %v\n%s", err, out)
+	}
+	data, err = os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"title: Notes\n", "define:\n- status=final\n- title=Notes\n- version=2\n"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("no %q in the config dumped with front matter:\n%s", want, data)
+		}
+	}
+	invalid := filepath.Join(dir, "invalid.yaml")
+	err = exec.Command(md2pdfBinary(t), "--dump-config", invalid, "--open-at", "toc").Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2 for an invalid option, got %v", err)
+	}
+	if _, err := os.Stat(invalid); err == nil {
+		t.Error("the config was dumped despite an invalid option")
+	}
+	if err := os.WriteFile(first, []byte("bogus: 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err = exec.Command(md2pdfBinary(t), "--config", first, "-i", "testdata/Markdown Documentation - Basics.text", "-o", filepath.Join(dir, "out.pdf")).Run()
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2 for an unknown option, got %v", err)
+	}
+}
+
+func TestE2EPNG(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rasterizer is a shell script")
+	}
+	// a stand-in for pdftoppm -png -r DPI FILE.pdf PREFIX, which writes a
+	// zero padded image per page and, here, the arguments into each
+	bin := t.TempDir()
+	script := "#!/bin/sh\ntest -s \"$4\" || exit 1\nfor n in 01 02; do echo \"$@\" > \"$5-$n.png\"; done\n"
+	if err := os.WriteFile(filepath.Join(bin, "pdftoppm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "doc.md")
+	if err := os.WriteFile(input, []byte("# One\n\n---\n\n# Two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(md2pdfBinary(t), "-i", input, "--format", "png", "--dpi", "150", "--font-family", "Helvetica")
+	cmd.Env = append(os.Environ(), "PATH="+bin)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("--format png: %v\n%s", err, out)
+	}
+	for _, name := range []string{"doc-1.png", "doc-2.png"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "-png -r 150 ") {
+			t.Errorf("%s: rasterizer called with %q", name, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "doc.pdf")); err == nil {
+		t.Error("--format png also wrote doc.pdf")
+	}
+
+	cmd = exec.Command(md2pdfBinary(t), "-i", input, "--format", "png")
+	cmd.Env = append(os.Environ(), "PATH="+t.TempDir())
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("expected exit code 1 without a rasterizer, got %v", err)
+	}
+}
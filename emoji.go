@@ -0,0 +1,79 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/kyokomi/emoji/v2"
+)
+
+// SetEmojiShortcodes turns GitHub style :shortcode: emoji, e.g. :rocket: or
+// :+1:, into the Unicode emoji of the gemoji table, which are then rendered
+// like emoji written literally. It is on by default; unknown shortcodes, and
+// those of emoji the font of the text has no glyph for, are left as they are.
+func SetEmojiShortcodes(expand bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.EmojiShortcodes = expand
+	}
+}
+
+// emojiShortcode matches a :shortcode: in text
+var emojiShortcode = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// variationSelectors ask for the emoji or text presentation of the character
+// before them; the fonts have no glyph for them
+var variationSelectors = strings.NewReplacer("\ufe0f", "", "\ufe0e", "")
+
+// expandEmoji returns s with the known emoji shortcodes replaced, when
+// drawable has every character of the emoji
+func expandEmoji(s string, drawable func(rune) bool) string {
+	codes := emoji.CodeMap()
+	return emojiShortcode.ReplaceAllStringFunc(s, func(code string) string {
+		e, ok := codes[code]
+		if !ok {
+			return code
+		}
+		e = variationSelectors.Replace(e)
+		if strings.ContainsFunc(e, func(c rune) bool { return !drawable(c) }) {
+			return code
+		}
+		return e
+	})
+}
+
+// emojiShortcodes expands the emoji shortcodes in the text of doc that
+// drawable has the characters for, see fontGlyphs; code and link
+// destinations are left alone.
+func emojiShortcodes(doc ast.Node, drawable func(rune) bool) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.CodeBlock, *ast.Code:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering && emojiShortcode.Match(n.Literal) {
+				n.Literal = []byte(expandEmoji(string(n.Literal), drawable))
+			}
+		}
+		return ast.GoToNext
+	})
+}
@@ -0,0 +1,57 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors returned by Process, to be tested with errors.Is, e.g. to
+// choose an exit code
+var (
+	ErrParse = errors.New("parse error")
+	ErrIO    = errors.New("I/O error")
+	ErrFont  = errors.New("font error")
+	ErrImage = errors.New("image error")
+	ErrLink  = errors.New("broken link")
+	// ErrReused is returned by Process called again on a renderer that
+	// has written its PDF
+	ErrReused = errors.New("renderer already used")
+)
+
+// imageFailed records an image that could not be loaded; the document is
+// rendered without it, see ImageError
+func (r *PdfRenderer) imageFailed(dest string, err error) {
+	r.logf("Warning: image %s: %v", dest, err)
+	r.imageErrors = append(r.imageErrors, fmt.Errorf("%s: %v", dest, err))
+}
+
+// ImageError sums up the images of the last run that could not be loaded,
+// wrapping ErrImage, or returns nil if all were
+func (r *PdfRenderer) ImageError() error {
+	switch len(r.imageErrors) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: %v", ErrImage, r.imageErrors[0])
+	}
+	return fmt.Errorf("%w: %d images could not be loaded, first %v", ErrImage, len(r.imageErrors), r.imageErrors[0])
+}
@@ -0,0 +1,357 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// pdfObject is an indirect object of a PDF file, with its stream decoded
+type pdfObject struct {
+	dict   string
+	stream []byte
+}
+
+var (
+	objectStart = regexp.MustCompile(`(?m)^(\d+) 0 obj\s*`)
+	streamStart = regexp.MustCompile(`stream\r?\n`)
+	lengthEntry = regexp.MustCompile(`/Length (\d+)`)
+	fontEntries = regexp.MustCompile(`(?s)/Font\s*<<(.*?)>>`)
+	fontEntry   = regexp.MustCompile(`/(\S+)\s+(\d+) 0 R`)
+	pageKids    = regexp.MustCompile(`(?s)/Type /Pages.*?/Kids \[([^\]]*)\]`)
+	reference   = regexp.MustCompile(`(\d+) 0 R`)
+	contents    = regexp.MustCompile(`/Contents (\d+) 0 R`)
+)
+
+// ExtractText returns the text shown on each page of a PDF file written by
+// this package, ignoring layout: the strings are given in the order they
+// are drawn, one per line. Strings in UTF-8 (Type0) fonts are decoded from
+// UTF-16, those in core fonts as the UTF-8 they were written in. It is not
+// a general PDF text extractor.
+func ExtractText(pdf []byte) ([]string, error) {
+	objects, err := parseObjects(pdf)
+	if err != nil {
+		return nil, err
+	}
+	// fonts by resource name, true for UTF-8 fonts
+	unicodeFonts := map[string]bool{}
+	for _, o := range objects {
+		for _, m := range fontEntries.FindAllStringSubmatch(o.dict, -1) {
+			for _, f := range fontEntry.FindAllStringSubmatch(m[1], -1) {
+				n, _ := strconv.Atoi(f[2])
+				unicodeFonts[f[1]] = strings.Contains(objects[n].dict, "/Subtype /Type0")
+			}
+		}
+	}
+	var pages []string
+	for _, o := range objects {
+		m := pageKids.FindStringSubmatch(o.dict)
+		if m == nil {
+			continue
+		}
+		for _, kid := range reference.FindAllStringSubmatch(m[1], -1) {
+			n, _ := strconv.Atoi(kid[1])
+			var text []string
+			for _, c := range contents.FindAllStringSubmatch(objects[n].dict, -1) {
+				cn, _ := strconv.Atoi(c[1])
+				text = append(text, showText(objects[cn].stream, unicodeFonts)...)
+			}
+			pages = append(pages, strings.Join(text, "\n"))
+		}
+	}
+	if pages == nil {
+		return nil, fmt.Errorf("%w: no pages found in the PDF", ErrParse)
+	}
+	return pages, nil
+}
+
+// parseObjects reads the objects of pdf, inflating Flate encoded streams
+func parseObjects(pdf []byte) (map[int]pdfObject, error) {
+	objects := map[int]pdfObject{}
+	pos := 0
+	for {
+		loc := objectStart.FindSubmatchIndex(pdf[pos:])
+		if loc == nil {
+			return objects, nil
+		}
+		n, _ := strconv.Atoi(string(pdf[pos+loc[2] : pos+loc[3]]))
+		pos += loc[1]
+		end := bytes.Index(pdf[pos:], []byte("endobj"))
+		if end < 0 {
+			return nil, fmt.Errorf("%w: object %d has no end", ErrParse, n)
+		}
+		var o pdfObject
+		s := streamStart.FindIndex(pdf[pos:])
+		if s == nil || s[0] > end {
+			o.dict = string(pdf[pos : pos+end])
+			pos += end
+		} else {
+			// the stream may contain "endobj", its length is known
+			o.dict = string(pdf[pos : pos+s[0]])
+			m := lengthEntry.FindStringSubmatch(o.dict)
+			if m == nil {
+				return nil, fmt.Errorf("%w: stream of object %d has no length", ErrParse, n)
+			}
+			length, _ := strconv.Atoi(m[1])
+			start := pos + s[1]
+			if start+length > len(pdf) {
+				return nil, fmt.Errorf("%w: stream of object %d is truncated", ErrParse, n)
+			}
+			o.stream = pdf[start : start+length]
+			if strings.Contains(o.dict, "/FlateDecode") {
+				zr, err := zlib.NewReader(bytes.NewReader(o.stream))
+				if err != nil {
+					return nil, fmt.Errorf("%w: stream of object %d: %v", ErrParse, n, err)
+				}
+				if o.stream, err = io.ReadAll(zr); err != nil {
+					return nil, fmt.Errorf("%w: stream of object %d: %v", ErrParse, n, err)
+				}
+			}
+			pos = start + length
+		}
+		objects[n] = o
+	}
+}
+
+// showText returns the strings drawn by the text operators of a content
+// stream, decoded for the font they are shown in
+func showText(content []byte, unicodeFonts map[string]bool) []string {
+	var text []string
+	var operands []any
+	unicode := false
+	decode := func(s []byte) string {
+		if unicode {
+			units := make([]uint16, len(s)/2)
+			for i := range units {
+				units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+			}
+			return string(utf16.Decode(units))
+		}
+		if utf8.Valid(s) {
+			return string(s)
+		}
+		runes := make([]rune, len(s))
+		for i, b := range s {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	lex := contentLexer{data: content}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return text
+		}
+		op, isOp := tok.(pdfOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) == 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					unicode = unicodeFonts[string(name)]
+				}
+			}
+		case "Tj", "'", "\"":
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].([]byte); ok {
+					text = append(text, decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				if a, ok := operands[len(operands)-1].([]any); ok {
+					var b strings.Builder
+					for _, e := range a {
+						if s, ok := e.([]byte); ok {
+							b.WriteString(decode(s))
+						}
+					}
+					text = append(text, b.String())
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// tokens of a content stream: strings are []byte, arrays []any, numbers
+// and keywords other than operators are ignored
+type (
+	pdfName     string
+	pdfOperator string
+)
+
+// contentLexer splits a PDF content stream into tokens
+type contentLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isPDFSpace(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00", c) >= 0
+}
+
+// next returns the next token; numbers are returned as float64
+func (l *contentLexer) next() (any, bool) {
+	for l.pos < len(l.data) && isPDFSpace(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literal(), true
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		// dictionaries only appear in inline images and marked content,
+		// which this package does not write
+		l.pos += 2
+		return pdfOperator("<<"), true
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			end = len(l.data) - l.pos
+		}
+		hex := bytes.Map(func(r rune) rune {
+			if isPDFSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, l.data[l.pos+1:l.pos+end])
+		l.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		s := make([]byte, len(hex)/2)
+		for i := range s {
+			v, _ := strconv.ParseUint(string(hex[2*i:2*i+2]), 16, 8)
+			s[i] = byte(v)
+		}
+		return s, true
+	case c == '[':
+		l.pos++
+		var a []any
+		for {
+			tok, ok := l.next()
+			if !ok || tok == pdfOperator("]") {
+				return a, true
+			}
+			a = append(a, tok)
+		}
+	case c == ']':
+		l.pos++
+		return pdfOperator("]"), true
+	case c == '/':
+		start := l.pos + 1
+		l.pos++
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(l.data[start:l.pos]), true
+	case c == '%':
+		for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+			l.pos++
+		}
+		return l.next()
+	}
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	return pdfOperator(word), true
+}
+
+// literal reads a (string), with its escapes and balanced parentheses
+func (l *contentLexer) literal() []byte {
+	var s []byte
+	depth := 0
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return s
+			}
+			depth--
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a line continuation
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+)
+
+// Factory makes renderers from the same parameters, one for each document,
+// as a server rendering many documents needs: a renderer writes a single
+// PDF (see ErrReused). The custom theme file is read and checked, and the
+// preset font looked up, once, by NewFactory, rather than by each
+// renderer's Process.
+type Factory struct {
+	params PdfRendererParams
+}
+
+// NewFactory returns a Factory of renderers with params, or an error
+// wrapping ErrIO or ErrParse for a custom theme file that cannot be read or
+// loaded, or ErrFont for an unknown preset font
+func NewFactory(params PdfRendererParams) (*Factory, error) {
+	if _, ok := presetFonts[params.PresetFont]; params.PresetFont != "" && !ok {
+		return nil, fmt.Errorf("%w: unknown preset font %q", ErrFont, params.PresetFont)
+	}
+	if params.Theme == CUSTOM && params.CustomThemeFile != "" {
+		data, err := os.ReadFile(params.CustomThemeFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIO, err)
+		}
+		if err := new(PdfRenderer).loadTheme(data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrParse, params.CustomThemeFile, err)
+		}
+		params.themeJSON = data
+	}
+	return &Factory{params: params}, nil
+}
+
+// New returns a renderer writing pdfFile, which Process may be called on
+// once; options are applied after those of the factory's parameters
+func (f *Factory) New(pdfFile string, opts ...RenderOption) *PdfRenderer {
+	params := f.params
+	params.PdfFile = pdfFile
+	params.Opts = append(params.Opts[:len(params.Opts):len(params.Opts)], opts...)
+	return NewPdfRenderer(params)
+}
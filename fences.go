@@ -0,0 +1,93 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// FenceHandler renders a fenced code block of the language it is registered
+// for. info is the whole info string, e.g. "chart width=50%", and body the
+// content of the block. It draws on r.Pdf at the current position, leaving
+// it below what it drew, e.g. with DrawPNG; if it returns an error, the
+// block is printed as code instead, with a warning.
+type FenceHandler func(info string, body []byte, r *PdfRenderer) error
+
+var (
+	fenceHandlersMu sync.RWMutex
+	fenceHandlers   = map[string]FenceHandler{}
+)
+
+// RegisterFenceHandler makes fences of language lang, e.g. ```chart,
+// render with handler in all renderers, before the built-in diagram, latex
+// and ansi fences; languages are matched without regard to case. A nil
+// handler removes the one registered for lang.
+func RegisterFenceHandler(lang string, handler FenceHandler) {
+	fenceHandlersMu.Lock()
+	defer fenceHandlersMu.Unlock()
+	lang = strings.ToLower(lang)
+	if handler == nil {
+		delete(fenceHandlers, lang)
+		return
+	}
+	fenceHandlers[lang] = handler
+}
+
+// fenceHandler returns the handler registered for the language of info
+func fenceHandler(info string) (FenceHandler, bool) {
+	fields := strings.Fields(strings.ToLower(info))
+	if len(fields) == 0 {
+		return nil, false
+	}
+	fenceHandlersMu.RLock()
+	defer fenceHandlersMu.RUnlock()
+	handler, ok := fenceHandlers[fields[0]]
+	return handler, ok
+}
+
+// processFence renders a fence with its registered handler. It reports
+// false if there is none or it failed, in which case the block is output
+// as code.
+func (r *PdfRenderer) processFence(node ast.CodeBlock) bool {
+	info := strings.TrimSpace(string(node.Info))
+	handler, ok := fenceHandler(info)
+	if !ok {
+		return false
+	}
+	if err := handler(info, node.Literal, r); err != nil {
+		r.logf("Warning: %s block printed as code: %v", strings.Fields(info)[0], err)
+		return false
+	}
+	r.tracer("Fence", fmt.Sprintf("%s (%d bytes)", strings.Fields(info)[0], len(node.Literal)))
+	r.setStyler(r.cs.peek().textStyle)
+	return true
+}
+
+// DrawPNG draws a PNG image as a block at the current position, scaled down
+// to the width of the text, dpi pixels to the inch, for fence handlers
+func (r *PdfRenderer) DrawPNG(png []byte, dpi float64) error {
+	name := fmt.Sprintf("fence-%x", sha1.Sum(png))
+	return r.drawImage(name, png, dpi)
+}
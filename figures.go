@@ -0,0 +1,292 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"codeberg.org/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// imageAttrs matches the attribute block following an image, as in pandoc:
+// ![Logo](logo.png){width=30% float=right}
+var imageAttrs = regexp.MustCompile(`^\{((?:\s*(?:[#.][\w.:-]+|[\w-]+=[^\s{}]+))+)\s*\}`)
+
+// parseImageAttributes moves the attribute blocks following images to the
+// images. A {#fig:id} among them is left in the text for numberCrossRefs.
+//
+//	width=40% or width=5cm  the width of the image, in percent of the text
+//	                        width or as a length
+//	align=left|center|right aligns an image on its own line
+//	float=left|right        puts an image on its own line at that side, with
+//	                        the paragraphs that follow beside it
+func parseImageAttributes(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		img, ok := node.(*ast.Image)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		next, ok := ast.GetNextNode(img).(*ast.Text)
+		if !ok {
+			return ast.SkipChildren
+		}
+		m := imageAttrs.FindSubmatchIndex(next.Literal)
+		if m == nil || !bytes.Contains(next.Literal[m[2]:m[3]], []byte("=")) {
+			return ast.SkipChildren
+		}
+		if img.Attribute == nil {
+			img.Attribute = &ast.Attribute{}
+		}
+		var id string
+		for _, attr := range strings.Fields(string(next.Literal[m[2]:m[3]])) {
+			switch attr[0] {
+			case '#':
+				id = attr
+			case '.':
+				img.Attribute.Classes = append(img.Attribute.Classes, []byte(attr[1:]))
+			default:
+				key, value, _ := strings.Cut(attr, "=")
+				if img.Attribute.Attrs == nil {
+					img.Attribute.Attrs = map[string][]byte{}
+				}
+				img.Attribute.Attrs[key] = []byte(strings.Trim(value, `"'`))
+			}
+		}
+		rest := next.Literal[m[1]:]
+		if id != "" {
+			rest = append([]byte("{"+id+"}"), rest...)
+		}
+		next.Literal = rest
+		return ast.SkipChildren
+	})
+}
+
+// imageAttr returns an attribute given to an image, see parseImageAttributes
+func imageAttr(img *ast.Image, key string) string {
+	if img.Attribute == nil {
+		return ""
+	}
+	return string(img.Attribute.Attrs[key])
+}
+
+// soleImage returns the image of a paragraph made of just an image, or nil
+func soleImage(p *ast.Paragraph) *ast.Image {
+	var img *ast.Image
+	for _, c := range p.Children {
+		switch c := c.(type) {
+		case *ast.Image:
+			if img != nil {
+				return nil
+			}
+			img = c
+		case *ast.Text:
+			if strings.TrimSpace(string(c.Literal)) != "" {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return img
+}
+
+// figureSize returns the size an image is shown at: that of its width=
+// attribute, if any, scaled down as imageSize does
+func (r *PdfRenderer) figureSize(img *ast.Image, info *fpdf.ImageInfoType) (w, h float64) {
+	width := imageAttr(img, "width")
+	if width == "" {
+		return r.imageSize(info)
+	}
+	left, _, _, _ := r.Pdf.GetMargins()
+	if pct, ok := strings.CutSuffix(width, "%"); ok {
+		v, err := strconv.ParseFloat(pct, 64)
+		if err != nil || v <= 0 {
+			r.logf("Warning: image %s: invalid width %q", img.Destination, width)
+			return r.imageSize(info)
+		}
+		w = (r.rightEdge() - left) * v / 100
+	} else {
+		pt, err := parseLength(width)
+		if err != nil {
+			r.logf("Warning: image %s: invalid width %q", img.Destination, width)
+			return r.imageSize(info)
+		}
+		w = pt / r.Pdf.GetConversionRatio()
+	}
+	ew, eh := info.Extent()
+	h = eh * w / ew
+	if avail := r.availableWidth(); w > avail && avail > 0 {
+		w, h = avail, h*avail/w
+	}
+	if h > r.pageContentHeight() {
+		w, h = w*r.pageContentHeight()/h, r.pageContentHeight()
+	}
+	return w, h
+}
+
+// alignedX returns the x of an image w wide on its own line, as set by its
+// align= attribute, or -1 to leave it at the current position
+func (r *PdfRenderer) alignedX(img *ast.Image, w float64) float64 {
+	p, ok := img.Parent.(*ast.Paragraph)
+	if !ok || soleImage(p) != img {
+		return -1
+	}
+	left, _, _, _ := r.Pdf.GetMargins()
+	switch align := imageAttr(img, "align"); align {
+	case "center":
+		return left + (r.rightEdge()-left-w)/2
+	case "right":
+		return r.rightEdge() - w
+	case "", "left":
+	default:
+		r.logf("Warning: image %s: unknown align %q (expected left, center or right)", img.Destination, align)
+	}
+	return -1
+}
+
+// imageFloat is an image floated with float=left|right, that the text
+// flows beside until it reaches its bottom
+type imageFloat struct {
+	paragraph   *ast.Paragraph
+	page        int
+	bottom      float64
+	left, right float64 // margins to restore
+}
+
+// floatGap is the space between a floated image and the text beside it, in
+// ems
+const floatGap = 1.0
+
+// startFloat draws the image of paragraph p at the side set by its float=
+// attribute and narrows the text beside it, and reports whether it did. A
+// paragraph in a list or a block quote, an image that leaves less than a
+// third of the text width or one that cannot be loaded is laid out as any
+// other (processImage reports the latter).
+func (r *PdfRenderer) startFloat(p *ast.Paragraph) bool {
+	img := soleImage(p)
+	if img == nil {
+		return false
+	}
+	side := imageAttr(img, "float")
+	if side == "" {
+		return false
+	}
+	if side != "left" && side != "right" {
+		r.logf("Warning: image %s: unknown float %q (expected left or right)", img.Destination, side)
+		return false
+	}
+	if _, ok := p.Parent.(*ast.Document); !ok {
+		r.tracer("Float", fmt.Sprintf("%s not at the top level, not floated", img.Destination))
+		return false
+	}
+	path, err := r.imageFile(img)
+	if err != nil {
+		return false
+	}
+	name, info := r.registerImage(path)
+	if info == nil || r.Pdf.Err() {
+		r.Pdf.ClearError()
+		return false
+	}
+	r.endFloat(true)
+	w, h := r.figureSize(img, info)
+	left, _, right, _ := r.Pdf.GetMargins()
+	textWidth := r.rightEdge() - left
+	gap := floatGap * r.em
+	if textWidth-w-gap < textWidth/3 {
+		r.tracer("Float", fmt.Sprintf("%s too wide to float", img.Destination))
+		return false
+	}
+	r.resetListCounter()
+	r.cr()
+	r.ensureSpace(h)
+	x, y := left, r.Pdf.GetY()
+	if side == "right" {
+		x = r.rightEdge() - w
+	}
+	r.setCrossRefTarget(img)
+	r.Pdf.ImageOptions(name, x, y, w, h, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+	bottom := y + h
+	if caption := strings.TrimSpace(ExtractTextFromNode(img)); caption != "" {
+		style := r.cs.peek().textStyle
+		r.setStyler(style)
+		r.Pdf.SetXY(x, bottom)
+		r.Pdf.MultiCell(w, r.lineHeight(style), displayText(caption), "", "L", false)
+		bottom = r.Pdf.GetY()
+	}
+	r.float = &imageFloat{paragraph: p, page: r.Pdf.PageNo(), bottom: bottom, left: left, right: right}
+	if side == "right" {
+		r.Pdf.SetRightMargin(right + w + gap)
+	} else {
+		r.Pdf.SetLeftMargin(left + w + gap)
+	}
+	r.Pdf.SetY(y)
+	r.Pdf.SetAcceptPageBreakFunc(func() bool {
+		r.endFloat(false)
+		auto, _ := r.Pdf.GetAutoPageBreak()
+		return auto
+	})
+	r.tracer("Float", fmt.Sprintf("%s %.2f wide at the %s", img.Destination, w, side))
+	return true
+}
+
+// floated reports whether paragraph p is the image floated last
+func (r *PdfRenderer) floated(p *ast.Paragraph) bool {
+	return r.float != nil && r.float.paragraph == p
+}
+
+// clearFloat ends the floated image once the text is past it, or before a
+// block other than a paragraph, which starts below it
+func (r *PdfRenderer) clearFloat(node ast.Node) {
+	if r.float == nil {
+		return
+	}
+	if r.Pdf.PageNo() != r.float.page || r.Pdf.GetY() >= r.float.bottom {
+		r.endFloat(false)
+		return
+	}
+	if _, ok := node.GetParent().(*ast.Document); !ok {
+		return
+	}
+	if _, ok := node.(*ast.Paragraph); !ok {
+		r.endFloat(true)
+	}
+}
+
+// endFloat restores the margins narrowed for a floated image, going below
+// the image if below is set
+func (r *PdfRenderer) endFloat(below bool) {
+	f := r.float
+	if f == nil {
+		return
+	}
+	r.float = nil
+	r.Pdf.SetLeftMargin(f.left)
+	r.Pdf.SetRightMargin(f.right)
+	if below && r.Pdf.PageNo() == f.page && r.Pdf.GetY() < f.bottom {
+		r.Pdf.SetY(f.bottom)
+	}
+	r.Pdf.SetX(f.left)
+}
@@ -0,0 +1,181 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// dedupeSuffix matches the -1, -2, ... the parser appends to repeated
+// heading IDs
+var dedupeSuffix = regexp.MustCompile(`-\d+$`)
+
+// fileAnchorKey is the key of fileAnchors for the heading id of file, or
+// for the start of file if id is empty
+func fileAnchorKey(file, id string) string {
+	return filepath.Clean(file) + "#" + id
+}
+
+// githubSlug makes the ID GitHub gives a heading title: lowercase, with
+// hyphens for spaces and without punctuation
+func githubSlug(title string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case c == ' ':
+			b.WriteRune('-')
+		case c == '-' || c == '_' || unicode.IsLetter(c) || unicode.IsNumber(c):
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// collectFileLinks maps the headings of the files of a merged document,
+// each started by a <!-- file "path" --> directive, to their IDs, so that a
+// link such as [setup](install.md#setup) in another of the files goes to
+// the heading instead of out of the PDF. A heading is found by the ID it
+// has in its own file, as given by the parser or {#id}, or else as GitHub
+// makes it; headings without an ID get one to be linked to. Must be called
+// before numberCrossRefs, which makes the links.
+func (r *PdfRenderer) collectFileLinks(doc ast.Node) {
+	r.fileAnchors = map[string]string{}
+	r.fileStarts = map[string]int{}
+	taken := map[string]bool{}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if h, ok := node.(*ast.Heading); ok && entering && h.HeadingID != "" {
+			taken[h.HeadingID] = true
+		}
+		return ast.GoToNext
+	})
+	var file string
+	start := false // the next block starts file
+	seen := map[string]bool{}
+	var own map[string]int
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering || node.GetParent() == nil {
+			return ast.GoToNext
+		}
+		if n, ok := node.(*ast.HTMLBlock); ok {
+			if d, ok := parseDirective(n.Literal); ok {
+				if d.name == "file" && len(d.args) > 0 {
+					file, start = d.args[0], true
+					own = map[string]int{}
+				}
+				return ast.GoToNext
+			}
+		}
+		h, ok := node.(*ast.Heading)
+		if !ok || file == "" {
+			if _, top := node.GetParent().(*ast.Document); top && start {
+				start = false
+				r.fileStarts[filepath.Clean(file)] = r.Pdf.AddLink()
+			}
+			if h != nil {
+				seen[h.HeadingID] = true
+			}
+			return ast.GoToNext
+		}
+		var ids []string
+		if id := h.HeadingID; id != "" {
+			if m := dedupeSuffix.FindStringIndex(id); m != nil && seen[id[:m[0]]] {
+				id = id[:m[0]]
+			}
+			ids = append(ids, id)
+		}
+		if slug := githubSlug(ExtractTextFromNode(h)); slug != "" {
+			ids = append(ids, slug)
+		}
+		if h.HeadingID == "" && len(ids) > 0 {
+			id := ids[0]
+			for k := 1; taken[id]; k++ {
+				id = ids[0] + "-" + strconv.Itoa(k)
+			}
+			h.HeadingID = id
+			taken[id] = true
+		}
+		seen[h.HeadingID] = true
+		if start {
+			start = false
+			r.fileAnchors[fileAnchorKey(file, "")] = h.HeadingID
+		}
+		for _, id := range ids {
+			if k := own[id]; k > 0 {
+				own[id]++
+				id += "-" + strconv.Itoa(k)
+			} else {
+				own[id]++
+			}
+			if _, ok := r.fileAnchors[fileAnchorKey(file, id)]; !ok {
+				r.fileAnchors[fileAnchorKey(file, id)] = h.HeadingID
+			}
+		}
+		return ast.GoToNext
+	})
+}
+
+// startFile sets the file the following content comes from, for
+// <!-- file "path" -->, and the target of links to it
+func (r *PdfRenderer) startFile(d directive) {
+	if len(d.args) == 0 {
+		return
+	}
+	r.currentFile = d.args[0]
+	// the bookmarks of the file are top level until a bookmark directive
+	r.bookmarkDepth = 0
+	if link, ok := r.fileStarts[filepath.Clean(r.currentFile)]; ok {
+		r.setLink(link)
+	}
+}
+
+// fileLink returns the link to the heading, or the start, of another file
+// of the document that a relative link such as install.md#setup points to.
+// It reports whether the file is one of the document, with a link of 0 if
+// the heading is not in it.
+func (r *PdfRenderer) fileLink(dest string) (int, bool) {
+	if r.currentFile == "" || strings.HasPrefix(dest, "#") || strings.Contains(dest, ":") {
+		return 0, false
+	}
+	file, id, _ := strings.Cut(dest, "#")
+	if p, err := url.PathUnescape(file); err == nil {
+		file = p
+	}
+	if file == "" || filepath.IsAbs(file) {
+		return 0, false
+	}
+	file = filepath.Join(filepath.Dir(r.currentFile), filepath.FromSlash(file))
+	if heading, ok := r.fileAnchors[fileAnchorKey(file, id)]; ok {
+		link, ok := r.headingAnchors[heading]
+		return link, ok
+	}
+	link, ok := r.fileStarts[filepath.Clean(file)]
+	_, heading := r.fileAnchors[fileAnchorKey(file, "")]
+	if id != "" && (ok || heading) {
+		return 0, true
+	}
+	return link, ok
+}
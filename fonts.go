@@ -0,0 +1,346 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// presetFont is one of the Unicode font families embedded in the package
+type presetFont struct {
+	dir      string
+	name     string
+	regular  string
+	bold     string
+	italic   string
+	boldItal string
+}
+
+// presetFonts are the embedded fonts by preset name, see PdfRendererParams.PresetFont
+var presetFonts = map[string]presetFont{
+	"dejavu_sans": {
+		dir:      "resources/fonts/dejavu_sans",
+		name:     "DejaVuSans",
+		regular:  "DejaVuSans.ttf",
+		bold:     "DejaVuSans-Bold.ttf",
+		italic:   "DejaVuSans-Oblique.ttf",
+		boldItal: "DejaVuSans-BoldOblique.ttf",
+	},
+	"dejavu_serif": {
+		dir:      "resources/fonts/dejavu_serif",
+		name:     "DejaVuSerif",
+		regular:  "DejaVuSerif.ttf",
+		bold:     "DejaVuSerif-Bold.ttf",
+		italic:   "DejaVuSerif-Italic.ttf",
+		boldItal: "DejaVuSerif-BoldItalic.ttf",
+	},
+	"noto_sans": {
+		dir:      "resources/fonts/noto_sans",
+		name:     "NotoSans",
+		regular:  "NotoSans-Regular.ttf",
+		bold:     "NotoSans-Bold.ttf",
+		italic:   "NotoSans-Italic.ttf",
+		boldItal: "NotoSans-BoldItalic.ttf",
+	},
+	"roboto": {
+		dir:      "resources/fonts/roboto",
+		name:     "Roboto",
+		regular:  "Roboto-Regular.ttf",
+		bold:     "Roboto-Bold.ttf",
+		italic:   "Roboto-Italic.ttf",
+		boldItal: "Roboto-BoldItalic.ttf",
+	},
+	"eb_garamond": {
+		dir:      "resources/fonts/eb_garamond",
+		name:     "EBGaramond",
+		regular:  "EBGaramond-Regular.ttf",
+		bold:     "EBGaramond-Bold.ttf",
+		italic:   "EBGaramond-Italic.ttf",
+		boldItal: "EBGaramond-BoldItalic.ttf",
+	},
+	"merriweather": {
+		dir:      "resources/fonts/merriweather",
+		name:     "Merriweather",
+		regular:  "Merriweather-Regular.ttf",
+		bold:     "Merriweather-Bold.ttf",
+		italic:   "Merriweather-Italic.ttf",
+		boldItal: "Merriweather-BoldItalic.ttf",
+	},
+	"dejavu_sans_mono": {
+		dir:      "resources/fonts/dejavu_sans_mono",
+		name:     "DejaVuSansMono",
+		regular:  "DejaVuSansMono.ttf",
+		bold:     "DejaVuSansMono-Bold.ttf",
+		italic:   "DejaVuSansMono.ttf",
+		boldItal: "DejaVuSansMono-Bold.ttf",
+	},
+	"go_mono": {
+		dir:      "resources/fonts/go_mono",
+		name:     "GoMono",
+		regular:  "Go-Mono.ttf",
+		bold:     "Go-Mono-Bold.ttf",
+		italic:   "Go-Mono-Italic.ttf",
+		boldItal: "Go-Mono-Bold-Italic.ttf",
+	},
+	"source_serif": {
+		dir:      "resources/fonts/source_serif",
+		name:     "SourceSerif4",
+		regular:  "SourceSerif4-Regular.ttf",
+		bold:     "SourceSerif4-Bold.ttf",
+		italic:   "SourceSerif4-It.ttf",
+		boldItal: "SourceSerif4-BoldIt.ttf",
+	},
+}
+
+// file returns the path of the embedded file for a font style ("", "B",
+// "I" or "BI")
+func (p presetFont) file(style string) string {
+	name := p.regular
+	switch style {
+	case "B":
+		name = p.bold
+	case "I":
+		name = p.italic
+	case "BI":
+		name = p.boldItal
+	}
+	return filepath.Join(p.dir, name)
+}
+
+// fontStyle converts a Styler style such as "bu" to the style of the font
+// file it needs ("B"); underlining is drawn, not a separate font
+func fontStyle(style string) string {
+	style = strings.ToUpper(style)
+	key := ""
+	if strings.Contains(style, "B") {
+		key += "B"
+	}
+	if strings.Contains(style, "I") {
+		key += "I"
+	}
+	return key
+}
+
+// fontVariants are the file name suffixes tried for the bold and italic
+// variants of a TTF font given by path, e.g. Mono-Regular.ttf -> Mono-Bold.ttf
+var fontVariants = map[string][]string{
+	"":   {""},
+	"B":  {"-Bold"},
+	"I":  {"-Italic", "-Oblique"},
+	"BI": {"-BoldItalic", "-BoldOblique"},
+}
+
+// loadTTF reads the file for a style of the TTF font at path. Variants
+// that don't exist fall back to the regular file.
+func loadTTF(path, style string) ([]byte, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(path, filepath.Ext(path)), "-Regular")
+	for _, suffix := range fontVariants[style] {
+		if data, err := os.ReadFile(base + suffix + filepath.Ext(path)); err == nil {
+			return data, nil
+		}
+	}
+	return os.ReadFile(path)
+}
+
+// fontFamily returns the family to set for s. Besides the core fonts and
+// fonts added to Pdf, a Styler's Font can name a preset font ("roboto") or
+// a TTF file ("fonts/Inter.ttf"); these are loaded the first time a style
+// of them is used, so that each element of a theme can have its own font.
+func (r *PdfRenderer) fontFamily(s Styler) string {
+	preset, isPreset := presetFonts[s.Font]
+	isFile := strings.EqualFold(filepath.Ext(s.Font), ".ttf")
+	if !isPreset && !isFile {
+		return s.Font
+	}
+	family := preset.name
+	if isFile {
+		family = strings.TrimSuffix(filepath.Base(s.Font), filepath.Ext(s.Font))
+		family = strings.TrimSuffix(family, "-Regular")
+	}
+	style := fontStyle(s.Style)
+	key := family + style
+	if r.loadedFonts == nil {
+		r.loadedFonts = map[string]bool{}
+	}
+	if loaded, tried := r.loadedFonts[key]; tried {
+		if !loaded {
+			return r.DefaultFont
+		}
+		return family
+	}
+	var err error
+	if isPreset {
+		err = loadFontSafely(r.Pdf, family, style, preset.file(style))
+	} else {
+		var data []byte
+		if data, err = loadTTF(s.Font, style); err == nil {
+			r.Pdf.AddUTF8FontFromBytes(family, style, data)
+		}
+	}
+	r.loadedFonts[key] = err == nil
+	if err != nil {
+		r.logf("Warning: font %s: %v; using %s", s.Font, err, r.DefaultFont)
+		return r.DefaultFont
+	}
+	return family
+}
+
+// SetCodeFont sets the font of code spans and code blocks, highlighted or
+// not: a preset such as "dejavu_sans_mono" or "go_mono", or a TTF file
+func SetCodeFont(font string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.CodeFont = font
+		r.Backtick.Font = font
+		r.Code.Font = font
+	}
+}
+
+// boxDrawingFont is used for code containing box-drawing characters, such
+// as tree output, when the code font lacks them; its glyphs all have the
+// same width, so that the lines stay aligned
+const boxDrawingFont = "dejavu_sans_mono"
+
+// hasBoxDrawing reports whether s contains box-drawing or block characters
+func hasBoxDrawing(s string) bool {
+	return strings.IndexFunc(s, func(c rune) bool {
+		return c >= 0x2500 && c <= 0x259F
+	}) >= 0
+}
+
+// codeStyle returns s, switched to boxDrawingFont if text has box-drawing
+// characters. The core fonts, Go Mono and the proportional presets lack
+// them or some of them; a TTF file chosen by the user is trusted.
+func codeStyle(s Styler, text string) Styler {
+	if hasBoxDrawing(text) && !strings.EqualFold(filepath.Ext(s.Font), ".ttf") {
+		s.Font = boxDrawingFont
+	}
+	return s
+}
+
+// FontScript is a writing system, with a line of sample text in it
+type FontScript struct {
+	Name, Sample string
+}
+
+// FontScripts are the writing systems the coverage of the preset fonts is
+// reported for, see FontCoverage
+var FontScripts = []FontScript{
+	{"Latin", "The quick brown fox jumps over the lazy dog: àéîõü ß ç ñ ø å"},
+	{"Cyrillic", "Съешь же ещё этих мягких французских булок, да выпей чаю"},
+	{"Greek", "Ξεσκεπάζω την ψυχοφθόρα βδελυγμία"},
+	{"CJK", "我能吞下玻璃而不伤身体。私はガラスを食べられます。"},
+}
+
+// PresetFontNames returns the names of the preset fonts, sorted
+func PresetFontNames() []string {
+	names := make([]string, 0, len(presetFonts))
+	for name := range presetFonts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// FontCoverage returns the FontScripts whose sample the regular style of
+// the preset font has a glyph for every letter of
+func FontCoverage(preset string) ([]FontScript, error) {
+	p, ok := presetFonts[preset]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown preset font %q", ErrFont, preset)
+	}
+	data, err := fontFS.ReadFile(p.file(""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFont, err)
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrFont, preset, err)
+	}
+	var b sfnt.Buffer
+	covered := func(sample string) bool {
+		for _, c := range sample {
+			if unicode.IsSpace(c) || unicode.IsPunct(c) {
+				continue
+			}
+			if i, err := f.GlyphIndex(&b, c); err != nil || i == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	var scripts []FontScript
+	for _, s := range FontScripts {
+		if covered(s.Sample) {
+			scripts = append(scripts, s)
+		}
+	}
+	return scripts, nil
+}
+
+// fontGlyphs returns whether the regular style of a font, as named by a
+// Styler or by the family of a preset font, has a glyph for a character.
+// fpdf draws no character beyond the Basic Multilingual Plane, and the core
+// fonts have none but those of their code page, so these are never drawn.
+func fontGlyphs(font string) func(rune) bool {
+	var f *sfnt.Font
+	var b sfnt.Buffer
+	loaded := false
+	return func(c rune) bool {
+		if !loaded {
+			// only read once a character is asked for
+			f, loaded = parseFont(font), true
+		}
+		if f == nil || c > 0xFFFF {
+			return false
+		}
+		i, err := f.GlyphIndex(&b, c)
+		return err == nil && i != 0
+	}
+}
+
+// parseFont parses the regular style of a preset font or TTF file, or
+// returns nil for the core fonts and fonts that cannot be read
+func parseFont(font string) *sfnt.Font {
+	var data []byte
+	var err error
+	for key, p := range presetFonts {
+		if font == key || font == p.name {
+			data, err = fontFS.ReadFile(p.file(""))
+		}
+	}
+	if strings.EqualFold(filepath.Ext(font), ".ttf") {
+		data, err = loadTTF(font, "")
+	}
+	if err != nil || data == nil {
+		return nil
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil
+	}
+	return f
+}
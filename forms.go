@@ -0,0 +1,151 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fieldBorder is the grey of the box drawn around form fields, so that
+// they remain visible when the form is printed
+var fieldBorder = Color{Red: 160, Green: 160, Blue: 160}
+
+// fieldLines returns the number of lines of a text field, 1 unless set
+// with lines=N
+func (r *PdfRenderer) fieldLines(d directive) float64 {
+	v, ok := d.attrs["lines"]
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		r.tracer("Field", fmt.Sprintf("invalid lines=%q", v))
+		return 1
+	}
+	return float64(n)
+}
+
+// processField renders a fillable AcroForm field:
+//
+//	<!-- field text name=email width=200 value="you@example.com" lines=1 -->
+//	<!-- field checkbox name=agree checked=true -->
+//	<!-- field dropdown name=colour options="Red,Green,Blue" -->
+//	<!-- field signature name=sign -->
+//
+// An optional label="..." is written before the field. Fields on a line of
+// their own start a new line; inline fields flow with the text.
+func (r *PdfRenderer) processField(d directive) {
+	if len(d.args) == 0 {
+		r.tracer("Field", "missing field type")
+		return
+	}
+	kind := d.args[0]
+	r.fieldCount++
+	name := d.attrs["name"]
+	if name == "" {
+		name = fmt.Sprintf("field%d", r.fieldCount)
+	}
+	style := r.cs.peek().textStyle
+	lh := r.lineHeight(style)
+
+	var w, h float64
+	var entries string
+	switch kind {
+	case "text":
+		lines := r.fieldLines(d)
+		w, h = r.directiveLength(d, "width", 200), r.directiveLength(d, "height", lh*lines)
+		entries = "/FT /Tx /DA (/Helv 0 Tf 0 g)"
+		if lines > 1 {
+			entries += " /Ff 4096" // multiline
+		}
+		if v, ok := d.attrs["value"]; ok {
+			entries += " /V " + pdfTextString(v)
+		}
+	case "checkbox":
+		w = r.directiveLength(d, "width", style.Size)
+		h = r.directiveLength(d, "height", w)
+		state := "/Off"
+		if d.attrs["checked"] == "true" {
+			state = "/Yes"
+		}
+		entries = fmt.Sprintf("/FT /Btn /V %s /AS %s", state, state)
+	case "dropdown":
+		w, h = r.directiveLength(d, "width", 120), r.directiveLength(d, "height", lh)
+		var opts []string
+		for _, o := range strings.Split(d.attrs["options"], ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				opts = append(opts, pdfTextString(o))
+			}
+		}
+		entries = "/FT /Ch /Ff 131072 /DA (/Helv 0 Tf 0 g) /Opt [" + strings.Join(opts, " ") + "]"
+		if len(opts) > 0 {
+			entries += " /V " + opts[0]
+		}
+	case "signature":
+		w, h = r.directiveLength(d, "width", 200), r.directiveLength(d, "height", 3*lh)
+		entries = "/FT /Sig"
+	default:
+		r.tracer("Field", fmt.Sprintf("unknown field type %s", kind))
+		return
+	}
+	r.tracer("Field", fmt.Sprintf("%s %s (%.0fx%.0f)", kind, name, w, h))
+
+	left, _, _, _ := r.Pdf.GetMargins()
+	block := r.Pdf.GetX() <= left
+	if label, ok := d.attrs["label"]; ok {
+		r.setStyler(style)
+		r.write(style, label+" ")
+	}
+	if w > r.availableWidth() {
+		r.Pdf.Ln(lh)
+	}
+	if block {
+		r.ensureSpace(h)
+	}
+	x, y := r.Pdf.GetXY()
+	if !block && h < lh {
+		// centre small fields, e.g. checkboxes, on the text line
+		y += (lh - h) / 2
+	}
+
+	r.Pdf.SetDrawColor(fieldBorder.Red, fieldBorder.Green, fieldBorder.Blue)
+	r.Pdf.SetLineWidth(0.5)
+	r.Pdf.Rect(x, y, w, h, "D")
+	r.Pdf.SetLineWidth(1)
+	r.Pdf.SetDrawColor(0, 0, 0)
+
+	a := r.annotate(x, y, w, h, fmt.Sprintf("/Subtype /Widget /F 4 /T %s %s", pdfTextString(name), entries))
+	a.field = true
+	if kind == "checkbox" {
+		a.appearance = map[string]string{
+			"Yes": fmt.Sprintf("q 0 g 1 w %.2f %.2f m %.2f %.2f l %.2f %.2f l S Q",
+				a.w*0.2, a.h*0.55, a.w*0.4, a.h*0.25, a.w*0.8, a.h*0.8),
+			"Off": "",
+		}
+	}
+
+	if block {
+		r.Pdf.SetY(y + h)
+	} else {
+		r.Pdf.SetX(x + w + style.Size/4)
+	}
+}
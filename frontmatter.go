@@ -0,0 +1,148 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// tomlField is a key = value line of TOML front matter
+var tomlField = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*(.*)$`)
+
+// SplitFrontMatter separates a YAML (between --- lines) or TOML (between
+// +++ lines) front matter block at the start of content from the markdown
+// that follows it. The fields with a scalar value, or a list of them
+// (joined with ", "), are returned; nested tables are left out. Content
+// without front matter is returned as is, with no fields.
+func SplitFrontMatter(content []byte) (map[string]string, []byte) {
+	src := bytes.TrimPrefix(content, []byte("\ufeff"))
+	var delim string
+	switch {
+	case bytes.HasPrefix(src, []byte("---\n")), bytes.HasPrefix(src, []byte("---\r\n")):
+		delim = "---"
+	case bytes.HasPrefix(src, []byte("+++\n")), bytes.HasPrefix(src, []byte("+++\r\n")):
+		delim = "+++"
+	default:
+		return nil, content
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r\n")
+		if line != delim && (delim != "---" || line != "...") {
+			continue
+		}
+		block := strings.Join(lines[1:i], "")
+		var fields map[string]string
+		var ok bool
+		if delim == "---" {
+			fields, ok = yamlFields(block)
+		} else {
+			fields, ok = tomlFields(block)
+		}
+		if !ok {
+			// a thematic break, not front matter
+			return nil, content
+		}
+		return fields, []byte(strings.Join(lines[i+1:], ""))
+	}
+	return nil, content
+}
+
+// yamlFields returns the fields of YAML front matter; it is not front
+// matter unless it is a mapping
+func yamlFields(block string) (map[string]string, bool) {
+	var data yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(block), &data); err != nil {
+		return nil, false
+	}
+	if len(data) == 0 && strings.TrimSpace(block) != "" {
+		return nil, false
+	}
+	fields := map[string]string{}
+	for _, item := range data {
+		switch v := item.Value.(type) {
+		case yaml.MapSlice:
+		case []interface{}:
+			var values []string
+			for _, s := range v {
+				values = append(values, fmt.Sprint(s))
+			}
+			fields[fmt.Sprint(item.Key)] = strings.Join(values, ", ")
+		case nil:
+			fields[fmt.Sprint(item.Key)] = ""
+		default:
+			fields[fmt.Sprint(item.Key)] = fmt.Sprint(v)
+		}
+	}
+	return fields, true
+}
+
+// tomlFields returns the top-level key = value fields of TOML front
+// matter, with strings, numbers, booleans and arrays of them as values
+func tomlFields(block string) (map[string]string, bool) {
+	fields := map[string]string{}
+	for _, line := range strings.Split(block, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "["):
+			// a table: its keys are not top-level fields
+			return fields, true
+		}
+		m := tomlField.FindStringSubmatch(line)
+		if m == nil {
+			return nil, false
+		}
+		value := m[2]
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			var values []string
+			for _, s := range strings.Split(value[1:len(value)-1], ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					values = append(values, tomlValue(s))
+				}
+			}
+			fields[m[1]] = strings.Join(values, ", ")
+		} else {
+			fields[m[1]] = tomlValue(value)
+		}
+	}
+	return fields, true
+}
+
+// tomlValue returns a TOML scalar without its quotes and trailing comment
+func tomlValue(s string) string {
+	for _, q := range []string{`"`, `'`} {
+		if strings.HasPrefix(s, q) {
+			if end := strings.Index(s[1:], q); end >= 0 {
+				return s[1 : end+1]
+			}
+		}
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
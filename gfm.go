@@ -0,0 +1,114 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// GFMExtensions are the parser extensions matching GitHub's rendering of
+// markdown files: no hard line breaks, definition lists or {#id} headings,
+// but heading anchors. See SetGFM.
+const GFMExtensions = parser.NoIntraEmphasis | parser.Tables | parser.FencedCode |
+	parser.Autolink | parser.Strikethrough | parser.SpaceHeadings |
+	parser.BackslashLineBreak | parser.AutoHeadingIDs | parser.OrderedListStart
+
+// SetGFM parses the markdown as GitHub does: with GFMExtensions instead of
+// Extensions, and www. addresses and e-mail addresses turned into links
+// like the URLs the Autolink extension finds.
+func SetGFM(gfm bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.GFM = gfm
+	}
+}
+
+// extendedAutolink matches the www. and e-mail autolinks of GFM; trailing
+// punctuation is trimmed by trimAutolink
+var extendedAutolink = regexp.MustCompile(`www\.[\w-]+(?:\.[\w-]+)*[^\s<]*|[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+
+// trimAutolink removes the trailing punctuation GitHub leaves out of an
+// autolink, and closing parentheses without an opening one in the link
+func trimAutolink(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte("?!.,:*_~'\"", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, ")") > strings.Count(link, "("):
+			link = link[:len(link)-1]
+		default:
+			return link
+		}
+	}
+	return link
+}
+
+// gfmAutolinks turns the www. and e-mail addresses in the text of doc into
+// links, as GitHub does; they may follow the start of the text, a space or
+// one of *_~( and are left alone in links and code.
+func gfmAutolinks(doc ast.Node) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Link, *ast.Image, *ast.CodeBlock, *ast.Code:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering && extendedAutolink.Match(n.Literal) {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, t := range texts {
+		var nodes []ast.Node
+		s, start := string(t.Literal), 0
+		for _, m := range extendedAutolink.FindAllStringIndex(s, -1) {
+			if m[0] > 0 && !strings.ContainsRune(" \t\n*_~(", rune(s[m[0]-1])) {
+				continue
+			}
+			link := trimAutolink(s[m[0]:m[1]])
+			if link == "" || strings.HasSuffix(link, "-") {
+				continue
+			}
+			dest := "http://" + link
+			if strings.Contains(link, "@") && !strings.HasPrefix(link, "www.") {
+				dest = "mailto:" + link
+			}
+			if m[0] > start {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:m[0]])}})
+			}
+			a := &ast.Link{Destination: []byte(dest)}
+			ast.AppendChild(a, &ast.Text{Leaf: ast.Leaf{Literal: []byte(link)}})
+			nodes = append(nodes, a)
+			start = m[0] + len(link)
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		if start < len(s) {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:])}})
+		}
+		replaceNode(t, nodes...)
+	}
+}
@@ -0,0 +1,229 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// Glossary maps abbreviations to their expansions, e.g. "HTTP" to
+// "Hypertext Transfer Protocol".
+type Glossary map[string]string
+
+// GlossaryTitle is the heading of the glossary appendix
+var GlossaryTitle = "Glossary"
+
+// abbrDefinition matches PHP Markdown Extra style abbreviation definitions:
+// *[HTTP]: Hypertext Transfer Protocol
+var abbrDefinition = regexp.MustCompile(`^\*\[([^\]]+)\]:\s*(.+?)\s*$`)
+
+// LoadGlossary reads a glossary file. Each non-empty line holds one entry in
+// the form "TERM: expansion"; lines starting with # are comments. Markdown
+// abbreviation definitions (*[TERM]: expansion) are accepted as well.
+func LoadGlossary(path string) (Glossary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g := Glossary{}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := abbrDefinition.FindStringSubmatch(line); m != nil {
+			g[m[1]] = m[2]
+			continue
+		}
+		term, expansion, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(term) == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"TERM: expansion\"", path, lineNo)
+		}
+		g[strings.TrimSpace(term)] = strings.TrimSpace(expansion)
+	}
+	return g, scanner.Err()
+}
+
+// extractAbbreviations removes abbreviation definition lines from the
+// markdown source, outside code blocks, and returns them as a Glossary;
+// those of redacted regions are dropped.
+func extractAbbreviations(content []byte) ([]byte, Glossary) {
+	g := Glossary{}
+	// a definition line is marked, then dropped
+	const removed = "\x00"
+	content = mapRedactedLines(content, func(line string, redacted bool) string {
+		if m := abbrDefinition.FindStringSubmatch(line); m != nil {
+			if !redacted {
+				g[m[1]] = m[2]
+			}
+			return removed
+		}
+		return line
+	})
+	lines := bytes.Split(content, []byte("\n"))
+	kept := lines[:0]
+	for _, line := range lines {
+		if string(line) != removed {
+			kept = append(kept, line)
+		}
+	}
+	return bytes.Join(kept, []byte("\n")), g
+}
+
+// abbrTag matches an HTML abbreviation, <abbr title="...">TERM</abbr>, or
+// a code span to skip
+var abbrTag = regexp.MustCompile("`+[^`]*`+|(?i)<abbr\\s+title\\s*=\\s*(?:\"([^\"]*)\"|'([^']*)')\\s*>(.*?)</abbr\\s*>")
+
+// extractAbbrTags replaces <abbr title="expansion">TERM</abbr> tags with
+// their term and returns the terms as a Glossary, so that the expansion,
+// which a browser shows on hover, is printed on first use. Code blocks and
+// code spans are skipped, and the expansions of redacted regions dropped.
+func extractAbbrTags(content []byte) ([]byte, Glossary) {
+	g := Glossary{}
+	content = mapRedactedLines(content, func(line string, redacted bool) string {
+		return abbrTag.ReplaceAllStringFunc(line, func(m string) string {
+			sub := abbrTag.FindStringSubmatch(m)
+			if sub[3] == "" {
+				return m
+			}
+			term := strings.TrimSpace(sub[3])
+			if expansion := html.UnescapeString(sub[1] + sub[2]); expansion != "" && !redacted {
+				if _, defined := g[term]; !defined {
+					g[term] = expansion
+				}
+			}
+			return sub[3]
+		})
+	})
+	return content, g
+}
+
+// terms returns the glossary terms, longest first, so that "HTTPS" is
+// matched before "HTTP".
+func (g Glossary) terms() []string {
+	terms := make([]string, 0, len(g))
+	for t := range g {
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if len(terms[i]) != len(terms[j]) {
+			return len(terms[i]) > len(terms[j])
+		}
+		return terms[i] < terms[j]
+	})
+	return terms
+}
+
+// expandAbbreviations expands the first use of each glossary term in s as
+// "TERM (expansion)". Later uses are left alone.
+func (r *PdfRenderer) expandAbbreviations(s string) string {
+	if len(r.Glossary) == 0 {
+		return s
+	}
+	if r.glossaryUsed == nil {
+		r.glossaryUsed = map[string]bool{}
+	}
+	// find the first use of each term in the original text, so that terms
+	// appearing inside an inserted expansion are not expanded again
+	type use struct {
+		start, end int
+		term       string
+	}
+	var uses []use
+	for _, term := range r.Glossary.terms() {
+		if r.glossaryUsed[term] {
+			continue
+		}
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(term) + `\b`)
+		for _, loc := range re.FindAllStringIndex(s, -1) {
+			overlaps := false
+			for _, u := range uses {
+				if loc[0] < u.end && u.start < loc[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				uses = append(uses, use{loc[0], loc[1], term})
+				break
+			}
+		}
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].end > uses[j].end })
+	for _, u := range uses {
+		r.glossaryUsed[u.term] = true
+		r.tracer("Glossary", fmt.Sprintf("expanding first use of %s", u.term))
+		s = s[:u.end] + " (" + r.Glossary[u.term] + ")" + s[u.end:]
+	}
+	return s
+}
+
+// renderGlossary renders the glossary appendix as a two column table after
+// the document body.
+func (r *PdfRenderer) renderGlossary() {
+	if len(r.Glossary) == 0 {
+		return
+	}
+	// no expansions inside the glossary itself
+	if r.glossaryUsed == nil {
+		r.glossaryUsed = map[string]bool{}
+	}
+	for term := range r.Glossary {
+		r.glossaryUsed[term] = true
+	}
+	terms := make([]string, 0, len(r.Glossary))
+	for t := range r.Glossary {
+		terms = append(terms, t)
+	}
+	sort.Strings(terms)
+
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %s\n\n| Term | Definition |\n|------|------------|\n", GlossaryTitle)
+	for _, t := range terms {
+		fmt.Fprintf(&md, "| %s | %s |\n", t, r.Glossary[t])
+	}
+	doc := markdown.Parse([]byte(md.String()), parser.NewWithExtensions(parser.Tables))
+	setColumnWidths(doc, r)
+	_ = markdown.Render(doc, r)
+}
+
+// SetGlossary sets the abbreviations expanded on first use. If appendix is
+// true a glossary table is rendered at the end of the document.
+func SetGlossary(g Glossary, appendix bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Glossary = g
+		r.GlossaryAppendix = appendix
+	}
+}
@@ -4,19 +4,18 @@ go 1.23.0
 
 require (
 	codeberg.org/go-pdf/fpdf v0.11.1
+	github.com/boombuler/barcode v1.0.1
 	github.com/gabriel-vasile/mimetype v1.4.8
 	github.com/gomarkdown/markdown v0.0.0-20250311123330-531bef5e742b
 	github.com/jessp01/gohighlight v0.21.2
-	github.com/mitchellh/go-wordwrap v1.0.1
+	github.com/kyokomi/emoji/v2 v2.2.13
+	github.com/spf13/pflag v1.0.10
 	github.com/srwiley/oksvg v0.0.0-20221011165216-be6e8873101c
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
 	golang.org/x/exp v0.0.0-20240707233637-46b078467d37
+	golang.org/x/image v0.15.0
+	golang.org/x/text v0.23.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
-require (
-	github.com/spf13/pflag v1.0.10 // indirect
-	golang.org/x/image v0.15.0 // indirect
-	golang.org/x/net v0.38.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
-)
+require golang.org/x/net v0.38.0 // indirect
@@ -0,0 +1,126 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// HEIFConverter is an external command that converts a HEIC or HEIF image,
+// as taken by iPhones and macOS screenshots, to a PNG file
+type HEIFConverter struct {
+	Command string
+	Args    func(src, dst string) []string
+}
+
+// HEIFConverters are the commands HEIC and HEIF images are converted with,
+// in order of preference
+var HEIFConverters = []HEIFConverter{
+	{"heif-convert", func(src, dst string) []string {
+		return []string{src, dst}
+	}},
+	{"magick", func(src, dst string) []string {
+		return []string{src + "[0]", dst}
+	}},
+	{"sips", func(src, dst string) []string {
+		return []string{"-s", "format", "png", src, "--out", dst}
+	}},
+}
+
+// ErrNoHEIFConverter is returned for HEIC and HEIF images when none of the
+// HEIFConverters is installed
+var ErrNoHEIFConverter = errors.New("no HEIF converter installed")
+
+// FindHEIFConverter returns the first of the HEIFConverters that is
+// installed
+func FindHEIFConverter() (HEIFConverter, error) {
+	var names []string
+	for _, c := range HEIFConverters {
+		if _, err := exec.LookPath(c.Command); err == nil {
+			return c, nil
+		}
+		names = append(names, c.Command)
+	}
+	return HEIFConverter{}, fmt.Errorf("%w (need one of %s)", ErrNoHEIFConverter, strings.Join(names, ", "))
+}
+
+// isHEIF reports whether the file at path is a HEIC or HEIF image
+func isHEIF(path string) bool {
+	mtype, err := mimetype.DetectFile(path)
+	if err != nil {
+		return false
+	}
+	for _, t := range []string{"image/heic", "image/heic-sequence", "image/heif", "image/heif-sequence"} {
+		if mtype.Is(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// heifImage returns path, or for a HEIC or HEIF image a PNG conversion of
+// its first picture in the temporary directory of the run
+func (r *PdfRenderer) heifImage(path string) (string, error) {
+	if converted, ok := r.heifFiles[path]; ok {
+		return converted, nil
+	}
+	if !isHEIF(path) {
+		return path, nil
+	}
+	c, err := FindHEIFConverter()
+	if err != nil {
+		return path, err
+	}
+	dir, err := r.workDir()
+	if err != nil {
+		return path, err
+	}
+	f, err := os.CreateTemp(dir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+"-*.png")
+	if err != nil {
+		return path, err
+	}
+	f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.Command, c.Args(path, f.Name())...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return path, fmt.Errorf("%s: %v: %s", c.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	if info, err := os.Stat(f.Name()); err != nil || info.Size() == 0 {
+		return path, fmt.Errorf("%s wrote no image", c.Command)
+	}
+	r.tracer("Image", fmt.Sprintf("%s converted with %s to %s", path, c.Command, f.Name()))
+	if r.heifFiles == nil {
+		r.heifFiles = map[string]string{}
+	}
+	r.heifFiles[path] = f.Name()
+	return f.Name(), nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// iconFont has the symbols icons are drawn with; the other presets and the
+// core fonts lack most of them
+const iconFont = "dejavu_sans"
+
+// faIcons maps Font Awesome icon names, with the aliases of its versions 4
+// to 6, to the symbols of iconFont they are drawn as
+var faIcons = map[string]rune{
+	"check":                '✓',
+	"check-square":         '☑',
+	"square-check":         '☑',
+	"square-o":             '☐',
+	"square":               '■',
+	"xmark":                '✕',
+	"times":                '✕',
+	"close":                '✕',
+	"circle-xmark":         '⊗',
+	"times-circle":         '⊗',
+	"ban":                  '⊘',
+	"plus":                 '+',
+	"minus":                '−',
+	"info":                 'ℹ',
+	"circle-info":          'ℹ',
+	"info-circle":          'ℹ',
+	"triangle-exclamation": '⚠',
+	"exclamation-triangle": '⚠',
+	"warning":              '⚠',
+	"star":                 '★',
+	"star-o":               '☆',
+	"heart":                '♥',
+	"envelope":             '✉',
+	"phone":                '☎',
+	"gear":                 '⚙',
+	"cog":                  '⚙',
+	"flag":                 '⚑',
+	"house":                '⌂',
+	"home":                 '⌂',
+	"pen":                  '✎',
+	"pencil":               '✎',
+	"scissors":             '✂',
+	"cut":                  '✂',
+	"bolt":                 '⚡',
+	"flash":                '⚡',
+	"sun":                  '☀',
+	"cloud":                '☁',
+	"moon":                 '☾',
+	"snowflake":            '❄',
+	"umbrella":             '☂',
+	"mug-hot":              '☕',
+	"coffee":               '☕',
+	"music":                '♫',
+	"plane":                '✈',
+	"anchor":               '⚓',
+	"recycle":              '♻',
+	"clock":                '◷',
+	"arrow-right":          '→',
+	"arrow-left":           '←',
+	"arrow-up":             '↑',
+	"arrow-down":           '↓',
+	"chevron-right":        '❯',
+	"chevron-left":         '❮',
+	"angle-right":          '›',
+	"angle-left":           '‹',
+	"caret-right":          '▸',
+	"caret-left":           '◂',
+	"caret-up":             '▴',
+	"caret-down":           '▾',
+	"play":                 '▶',
+	"circle":               '●',
+	"circle-o":             '○',
+	"circle-half-stroke":   '◐',
+	"asterisk":             '✱',
+	"hand-point-right":     '☞',
+	"hand-point-left":      '☜',
+	"infinity":             '∞',
+	"copyright":            '©',
+	"registered":           '®',
+	"trademark":            '™',
+	"euro-sign":            '€',
+	"sterling-sign":        '£',
+	"yen-sign":             '¥',
+}
+
+// iconShortcode matches a :fa-name: icon shortcode in text
+var iconShortcode = regexp.MustCompile(`:fa-([a-z0-9-]+):`)
+
+// iconTag matches an <i> tag with classes, as in
+// <i class="fa-solid fa-check"></i>, possibly with its closing tag
+var iconTag = regexp.MustCompile(`(?i)^<i\s[^>]*\bclass\s*=\s*["']([^"']*)["'][^>]*>(?:</i>)?$`)
+
+// iconShortcodes replaces the :fa-name: shortcodes of known icons in the
+// text of doc with <i class="fa fa-name"> tags, which are drawn as icons;
+// code is left alone.
+func iconShortcodes(doc ast.Node) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.CodeBlock, *ast.Code:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering && iconShortcode.Match(n.Literal) {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, t := range texts {
+		var nodes []ast.Node
+		s, start := string(t.Literal), 0
+		for _, m := range iconShortcode.FindAllStringSubmatchIndex(s, -1) {
+			name := s[m[2]:m[3]]
+			if _, ok := faIcons[name]; !ok {
+				continue
+			}
+			if m[0] > start {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:m[0]])}})
+			}
+			tag := fmt.Sprintf(`<i class="fa fa-%s"></i>`, name)
+			nodes = append(nodes, &ast.HTMLSpan{Leaf: ast.Leaf{Literal: []byte(tag)}})
+			start = m[1]
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		if start < len(s) {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:])}})
+		}
+		replaceNode(t, nodes...)
+	}
+}
+
+// iconSymbol returns the symbol of the icon named by the Font Awesome
+// classes of tag. ok is false if tag is not such an icon; the name is ""
+// if the icon is unknown.
+func iconSymbol(tag []byte) (symbol rune, name string, ok bool) {
+	m := iconTag.FindSubmatch(tag)
+	if m == nil {
+		return 0, "", false
+	}
+	for _, class := range strings.Fields(string(m[1])) {
+		name, isIcon := strings.CutPrefix(class, "fa-")
+		ok = ok || isIcon || class == "fa"
+		if symbol, known := faIcons[name]; isIcon && known {
+			return symbol, name, true
+		}
+	}
+	return 0, "", ok
+}
+
+// processIcon draws the icon of an <i class="fa-..."> tag in the current
+// text style, in iconFont. It reports whether literal was such a tag.
+func (r *PdfRenderer) processIcon(literal []byte) bool {
+	symbol, name, ok := iconSymbol(literal)
+	if !ok {
+		return false
+	}
+	if name == "" {
+		r.logf("Warning: unknown icon %s", literal)
+		return true
+	}
+	r.tracer("Icon", name)
+	if incell {
+		r.cs.peek().cellInnerString += string(symbol)
+		return true
+	}
+	s := r.cs.peek().textStyle
+	icon := s
+	icon.Font = iconFont
+	icon.Style = strings.ReplaceAll(icon.Style, "u", "")
+	r.setStyler(icon)
+	r.write(icon, string(symbol))
+	r.setStyler(s)
+	return true
+}
@@ -0,0 +1,223 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoded for downsampling
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"codeberg.org/go-pdf/fpdf"
+	"golang.org/x/image/draw"
+)
+
+// SetImageMaxDPI downsamples images that would be embedded at more than
+// dpi pixels per inch at the size they are shown, e.g. screenshots of a
+// large screen scaled down to the page width; 0, the default, keeps all
+// pixels
+func SetImageMaxDPI(dpi int) RenderOption {
+	return func(r *PdfRenderer) {
+		r.ImageMaxDPI = dpi
+	}
+}
+
+// SetJPEGQuality re-encodes images without transparency as JPEG of quality
+// 1-100 where that makes them smaller; 0, the default, embeds images in
+// their own format. An out of range quality is ignored with a warning.
+func SetJPEGQuality(quality int) RenderOption {
+	return func(r *PdfRenderer) {
+		if quality < 0 || quality > 100 {
+			r.logf("Warning: JPEG quality %d is not in 1-100", quality)
+			return
+		}
+		r.JPEGQuality = quality
+	}
+}
+
+// compressedImage is an image file as embedded, see compressImage
+type compressedImage struct {
+	path string
+	dpi  float64 // that keeps the size of the original, or 0 to read it
+}
+
+// registerImage registers the image file at path, converted from HEIC,
+// downsampled and re-encoded as set with SetImageMaxDPI, SetJPEGQuality
+// and SetMemoryLimit, and returns the name it is registered under
+func (r *PdfRenderer) registerImage(path string) (string, *fpdf.ImageInfoType) {
+	path, err := r.heifImage(path)
+	if err != nil {
+		r.Pdf.SetError(err)
+		return path, nil
+	}
+	c := r.compressImage(path)
+	if err := r.reserveImage(c.path); err != nil {
+		r.Pdf.SetError(err)
+		return c.path, nil
+	}
+	info := r.Pdf.RegisterImageOptions(c.path, fpdf.ImageOptions{ReadDpi: true})
+	if info != nil && c.dpi > 0 {
+		info.SetDpi(c.dpi)
+	}
+	return c.path, info
+}
+
+// compressImage returns the file to embed for the image at path: a
+// smaller copy in the temporary directory of the run, if downsampling or
+// re-encoding it gives one or it does not fit in memory as it is, or else
+// path itself
+func (r *PdfRenderer) compressImage(path string) compressedImage {
+	if r.ImageMaxDPI <= 0 && r.JPEGQuality <= 0 && r.MemoryLimit <= 0 {
+		return compressedImage{path: path}
+	}
+	if c, ok := r.compressed[path]; ok {
+		return c
+	}
+	if r.compressed == nil {
+		r.compressed = map[string]compressedImage{}
+	}
+	c, err := r.recodeImage(path)
+	if err != nil {
+		r.tracer("Image", fmt.Sprintf("%s embedded as it is: %v", path, err))
+		c = compressedImage{path: path}
+	}
+	r.compressed[path] = c
+	return c
+}
+
+// recodeImage downsamples the image at path to ImageMaxDPI at the size it
+// is shown, and to fit in MemoryLimit, and encodes it as JPEG of
+// JPEGQuality, if it is opaque, or else as PNG. The result is kept if it
+// is smaller than the file, or the file does not fit in memory.
+func (r *PdfRenderer) recodeImage(path string) (compressedImage, error) {
+	keep := compressedImage{path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return keep, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return keep, err
+	}
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return keep, err
+	}
+	fits := r.fitsMemory(embedSize(stat.Size(), config, format))
+	if fits && r.ImageMaxDPI <= 0 && r.JPEGQuality <= 0 {
+		return keep, nil
+	}
+	// the size the image has in the PDF, at the resolution fpdf reads
+	dpi := 72.0
+	var p *pngReader
+	if format == "png" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return keep, err
+		}
+		if p, err = readPNGHeader(f); err != nil {
+			return keep, err
+		}
+		dpi = p.dpi
+	}
+	natural := float64(config.Width) * 72 / dpi
+	shown, _ := r.fitSize(natural, natural*float64(config.Height)/float64(config.Width))
+	width := config.Width
+	if r.ImageMaxDPI > 0 {
+		width = min(width, int(math.Ceil(shown/72*float64(r.ImageMaxDPI))))
+	}
+	fitted := false
+	if !fits {
+		// the downsampled pixels, and those fpdf decodes to embed them
+		fit := int(math.Sqrt(float64(r.memoryLeft()) / 8 * float64(config.Width) / float64(config.Height)))
+		if fitted = fit < width; fitted {
+			width = fit
+		}
+	}
+	if width < 1 {
+		return keep, errors.New("its pixels do not fit in the memory limit")
+	}
+	height := max(1, int(math.Round(float64(config.Height)*float64(width)/float64(config.Width))))
+	var img image.Image
+	switch {
+	case r.fitsMemory(stat.Size() + decodedSize(config.Width, config.Height)):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return keep, err
+		}
+		if img, _, err = image.Decode(bufio.NewReader(f)); err != nil {
+			return keep, err
+		}
+		if width < config.Width {
+			dst := image.NewRGBA(image.Rect(0, 0, width, height))
+			draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+			img = dst
+		}
+	case p != nil && width < config.Width:
+		// too large to decode at once, so downsampled as it is read
+		if img, err = p.scale(width, height); err != nil {
+			return keep, err
+		}
+	default:
+		return keep, errors.New("its pixels do not fit in the memory limit")
+	}
+	scaled := img.Bounds().Dx() < config.Width
+	var buf bytes.Buffer
+	ext := ".png"
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() && r.JPEGQuality > 0 {
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: r.JPEGQuality})
+	} else if scaled {
+		err = png.Encode(&buf, img)
+	} else {
+		return keep, nil
+	}
+	if err != nil || fits && int64(buf.Len()) >= stat.Size() {
+		return keep, err
+	}
+	dir, err := r.workDir()
+	if err != nil {
+		return keep, err
+	}
+	out, err := os.CreateTemp(dir, "*"+ext)
+	if err != nil {
+		return keep, err
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		out.Close()
+		return keep, err
+	}
+	if err := out.Close(); err != nil {
+		return keep, err
+	}
+	if fitted {
+		r.logf("Warning: image %s downsampled to %dx%d pixels to fit the memory limit", path, width, height)
+	}
+	r.tracer("Image", fmt.Sprintf("%s: %dx%d, %d bytes, embedded as %s: %dx%d, %d bytes", filepath.Base(path),
+		config.Width, config.Height, stat.Size(), filepath.Base(out.Name()), width, height, buf.Len()))
+	return compressedImage{out.Name(), float64(width) * 72 / natural}, nil
+}
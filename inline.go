@@ -0,0 +1,146 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// inlineTag matches an inline HTML tag such as <kbd> or </kbd>
+var inlineTag = regexp.MustCompile(`(?i)^<(/?)([a-z]+)[^>]*>$`)
+
+// markSyntax matches ==highlighted text==, or a code span to skip
+var markSyntax = regexp.MustCompile("`+[^`]*`+|==([^=\\s](?:[^=]*[^=\\s])?)==")
+
+// expandMarks rewrites ==text== as <mark>text</mark> before parsing.
+// Code blocks and code spans are skipped.
+func expandMarks(content []byte) []byte {
+	return mapProseLines(content, func(line string) string {
+		return markSyntax.ReplaceAllStringFunc(line, func(m string) string {
+			if strings.HasPrefix(m, "`") {
+				return m
+			}
+			return "<mark>" + m[2:len(m)-2] + "</mark>"
+		})
+	})
+}
+
+// processInlineTag tracks the inline HTML elements that style the text
+// they enclose. It reports whether literal was such a tag.
+func (r *PdfRenderer) processInlineTag(literal []byte) bool {
+	m := inlineTag.FindSubmatch(literal)
+	if m == nil {
+		return false
+	}
+	open := len(m[1]) == 0
+	switch strings.ToLower(string(m[2])) {
+	case "kbd":
+		r.kbd = open
+	case "mark":
+		r.mark = open
+	default:
+		return false
+	}
+	r.tracer("InlineTag", string(literal))
+	return true
+}
+
+// writeKey draws s as a key cap: a small bordered box, as for
+// <kbd>Ctrl</kbd>
+func (r *PdfRenderer) writeKey(s Styler, key string) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return
+	}
+	lineHeight := r.lineHeight(s)
+	s.Style = strings.ReplaceAll(s.Style, "u", "")
+	s.Size *= 0.85
+	r.setStyler(s)
+	pad := s.Size * 0.35
+	w := r.Pdf.GetStringWidth(key) + 2*pad
+	h := s.Size + pad
+	if w > r.availableWidth() {
+		r.cr()
+	}
+	x, y := r.Pdf.GetXY()
+	top := y + (lineHeight-h)/2
+	dr, dg, db := r.Pdf.GetDrawColor()
+	lw := r.Pdf.GetLineWidth()
+	r.Pdf.SetDrawColor(150, 150, 150)
+	r.Pdf.SetFillColor(245, 245, 245)
+	r.Pdf.SetLineWidth(0.6)
+	r.Pdf.RoundedRect(x+0.5, top, w, h, 2, "1234", "FD")
+	r.Pdf.SetDrawColor(dr, dg, db)
+	r.Pdf.SetLineWidth(lw)
+	r.Pdf.SetXY(x+0.5, top)
+	r.Pdf.CellFormat(w, h, key, "", 0, "C", false, 0, "")
+	r.Pdf.SetXY(x+w+1, y)
+	r.tracer("Key", fmt.Sprintf("%q at %.2f,%.2f", key, x, top))
+}
+
+// writeMarked writes s on a MarkColor background, as for <mark>. The text
+// is written in pieces that fit the rest of the line, so that the
+// background follows it when it wraps.
+func (r *PdfRenderer) writeMarked(s Styler, text string) {
+	lineHeight := r.lineHeight(s)
+	s.FillColor = r.MarkColor
+	r.setStyler(s)
+	// no cell margin, so that the text lines up with the text around it
+	margin := r.Pdf.GetCellMargin()
+	r.Pdf.SetCellMargin(0)
+	defer r.Pdf.SetCellMargin(margin)
+	r.writePieces(text, func(part string) {
+		r.Pdf.CellFormat(r.Pdf.GetStringWidth(part), lineHeight, part, "", 0, "L", true, 0, "")
+	})
+}
+
+// writePieces splits text at spaces into pieces that fit the rest of the
+// line, starting new lines as needed, and passes them to write, which
+// must advance the position by the width of the piece
+func (r *PdfRenderer) writePieces(text string, write func(part string)) {
+	for text != "" {
+		avail := r.availableWidth()
+		n := len(text)
+		for r.Pdf.GetStringWidth(text[:n]) > avail {
+			i := strings.LastIndex(strings.TrimRight(text[:n], " "), " ")
+			if i <= 0 {
+				n = 0
+				break
+			}
+			n = i + 1
+		}
+		if n == 0 {
+			left, _, _, _ := r.Pdf.GetMargins()
+			if r.Pdf.GetX() > left {
+				r.cr()
+				continue
+			}
+			// a word longer than the line
+			n = len(text)
+			if i := strings.Index(text, " "); i > 0 {
+				n = i + 1
+			}
+		}
+		write(text[:n])
+		text = text[n:]
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"codeberg.org/go-pdf/fpdf"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// SetAutoLandscape puts a table or image wider than the text of a portrait
+// page on a landscape page of its own, with the blocks that follow on
+// portrait pages again; consecutive wide blocks share landscape pages.
+// Landscape documents, and blocks in panels or placed regions, are left as
+// they are.
+func SetAutoLandscape(auto bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.AutoLandscape = auto
+	}
+}
+
+// portraitDocument reports whether the pages are portrait unless turned
+func (r *PdfRenderer) portraitDocument() bool {
+	return !strings.HasPrefix(strings.ToLower(r.orientation), "l")
+}
+
+// pageSize returns the size of page. fpdf's GetPageSize is that of the page
+// added last, which differs from earlier ones once pages have been turned.
+func (r *PdfRenderer) pageSize(page int) (float64, float64) {
+	if !r.turned {
+		return r.Pdf.GetPageSize()
+	}
+	w, h, _ := r.Pdf.PageSize(page)
+	return w, h
+}
+
+// pageOffset returns what to add to a y on page when drawing on it after
+// SetPage: fpdf places everything by the height of the page added last
+func (r *PdfRenderer) pageOffset(page int) float64 {
+	if !r.turned {
+		return 0
+	}
+	_, h := r.Pdf.GetPageSize()
+	_, pageHeight := r.pageSize(page)
+	return h - pageHeight
+}
+
+// addPage starts a new page turned like the current one; fpdf's AddPage
+// starts a page of the document's orientation
+func (r *PdfRenderer) addPage() {
+	w, h := r.Pdf.GetPageSize()
+	if !r.turned || w < h {
+		r.Pdf.AddPage()
+		return
+	}
+	r.Pdf.AddPageFormat("L", fpdf.SizeType{Wd: h, Ht: w})
+}
+
+// landscapeWidth returns the width of the text on a landscape page
+func (r *PdfRenderer) landscapeWidth() float64 {
+	w, h := r.Pdf.GetPageSize()
+	left, _, right, _ := r.Pdf.GetMargins()
+	return max(w, h) - left - right
+}
+
+// turnPages is called when entering a block of the document: with
+// AutoLandscape a wide block starts a landscape page, unless one is already
+// current, and the next block that is not wide a portrait page
+func (r *PdfRenderer) turnPages(node ast.Node) {
+	if !r.AutoLandscape && r.landscapeTables == nil || !r.portraitDocument() || len(r.panels) > 0 || len(r.placements) > 0 {
+		return
+	}
+	if _, ok := node.GetParent().(*ast.Document); !ok {
+		return
+	}
+	w, h := r.Pdf.GetPageSize()
+	landscape := w > h
+	if r.wideBlock(node) == landscape {
+		return
+	}
+	size := fpdf.SizeType{Wd: min(w, h), Ht: max(w, h)}
+	if landscape {
+		r.Pdf.AddPageFormat("P", size)
+		r.tracer("AutoLandscape", fmt.Sprintf("portrait again on page %d", r.Pdf.PageNo()))
+		return
+	}
+	r.Pdf.AddPageFormat("L", size)
+	r.turned = true
+	r.tracer("AutoLandscape", fmt.Sprintf("%T on landscape page %d", node, r.Pdf.PageNo()))
+}
+
+// wideBlock reports whether node is a table, or a paragraph of just a local
+// image, wider than the text of a portrait page, or a table that
+// splitWideTables put on a landscape page
+func (r *PdfRenderer) wideBlock(node ast.Node) bool {
+	if table, ok := node.(*ast.Table); ok && r.landscapeTables[table] {
+		return true
+	}
+	if !r.AutoLandscape {
+		return false
+	}
+	w, h := r.Pdf.GetPageSize()
+	left, _, right, _ := r.Pdf.GetMargins()
+	avail := min(w, h) - left - right
+	switch node := node.(type) {
+	case *ast.Table:
+		total := 0.0
+		for _, w := range r.ColumnWidths[node] {
+			total += w
+		}
+		return total > avail
+	case *ast.Paragraph:
+		img := soleImage(node)
+		if img == nil {
+			return false
+		}
+		path := r.localPath(string(img.Destination))
+		if _, err := os.Stat(path); err != nil || strings.HasSuffix(strings.ToLower(path), ".svg") {
+			return false
+		}
+		// processImage reports images that cannot be loaded
+		_, info := r.registerImage(path)
+		if info == nil || r.Pdf.Err() {
+			r.Pdf.ClearError()
+			return false
+		}
+		width, _ := info.Extent()
+		return width > avail
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// latexLanguages are the fence languages of raw LaTeX blocks
+var latexLanguages = map[string]bool{"latex": true, "tex": true}
+
+// latexPreamble wraps a LaTeX fragment into a document of its own, cropped
+// to the content
+const latexPreamble = `\documentclass[varwidth,border=1pt]{standalone}
+\usepackage{amsmath,amssymb}
+\begin{document}
+`
+
+// SetLaTeXEngine renders ```latex (or ```tex) fences with a TeX engine
+// that writes PDF, e.g. pdflatex, xelatex or lualatex, as images. Without
+// an engine the blocks are printed verbatim, with a warning.
+func SetLaTeXEngine(engine string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.LaTeXEngine = engine
+	}
+}
+
+// processLaTeX renders a raw LaTeX fence as an image. It reports false if
+// the block is not LaTeX or could not be rendered, in which case it is
+// output as code.
+func (r *PdfRenderer) processLaTeX(node ast.CodeBlock) bool {
+	lang := strings.ToLower(strings.TrimSpace(string(node.Info)))
+	if fields := strings.Fields(lang); len(fields) > 0 {
+		lang = fields[0]
+	}
+	if !latexLanguages[lang] {
+		return false
+	}
+	if r.LaTeXEngine == "" {
+		r.logf("Warning: LaTeX block printed verbatim: no LaTeX engine configured")
+		return false
+	}
+	png, err := r.cachedImage(r.LaTeXEngine, node.Literal, func() ([]byte, error) {
+		return r.runLaTeX(node.Literal)
+	})
+	if err == nil {
+		err = r.drawPNG("latex", png, node.Literal)
+	}
+	if err != nil {
+		r.logf("Warning: LaTeX block printed verbatim: %v", err)
+		return false
+	}
+	r.tracer("LaTeX", fmt.Sprintf("%d bytes", len(png)))
+	return true
+}
+
+// runLaTeX typesets src, a fragment or a whole document, with the LaTeX
+// engine in the temporary directory of the run and returns its first page
+// as a PNG
+func (r *PdfRenderer) runLaTeX(src []byte) ([]byte, error) {
+	if _, err := exec.LookPath(r.LaTeXEngine); err != nil {
+		return nil, err
+	}
+	rz, err := FindRasterizer()
+	if err != nil {
+		return nil, err
+	}
+	work, err := r.workDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(work, "latex-*")
+	if err != nil {
+		return nil, err
+	}
+	doc := string(src)
+	if !strings.Contains(doc, `\documentclass`) {
+		doc = latexPreamble + doc + "\n\\end{document}\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, "block.tex"), []byte(doc), 0o644); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.LaTeXEngine, "-interaction=nonstopmode", "-halt-on-error", "-no-shell-escape", "block.tex")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", r.LaTeXEngine, err, latexError(stdout.String()))
+	}
+	pages, err := rz.Rasterize(filepath.Join(dir, "block.pdf"), diagramDPI)
+	if err != nil {
+		return nil, err
+	}
+	return pages[0], nil
+}
+
+// latexError returns the first error message of a TeX log, which starts
+// with "!"
+func latexError(log string) string {
+	for _, line := range strings.Split(log, "\n") {
+		if strings.HasPrefix(line, "!") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "!"))
+		}
+	}
+	return "no PDF written"
+}
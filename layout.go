@@ -0,0 +1,479 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// reserveZones grows the top margin and the auto page break margin so that
+// body content never enters the area drawn by the header and footer funcs.
+// Must be called before the first page is added.
+func (r *PdfRenderer) reserveZones(header, footer float64) {
+	r.headerHeight = header
+	r.footerHeight = footer
+	left, top, right, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	r.Pdf.SetMargins(left, top+header, right)
+	r.Pdf.SetAutoPageBreak(true, bottom+footer)
+}
+
+// rightEdge returns the x of the right margin, on the page as it is laid
+// out: in landscape, or after SetMargins, lines get longer
+func (r *PdfRenderer) rightEdge() float64 {
+	pageWidth, _ := r.pageSize(r.Pdf.PageNo())
+	_, _, right, _ := r.Pdf.GetMargins()
+	return pageWidth - right
+}
+
+// availableWidth returns the width between the current position and the
+// right margin
+func (r *PdfRenderer) availableWidth() float64 {
+	return r.rightEdge() - r.Pdf.GetX()
+}
+
+// margins are the page margins, bottom being the auto page break margin
+type margins struct {
+	left, top, right, bottom float64
+}
+
+// currentMargins returns the margins in effect
+func (r *PdfRenderer) currentMargins() margins {
+	left, top, right, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	return margins{left, top, right, bottom}
+}
+
+// setMargins makes m the margins of the text that follows; a new top
+// margin applies from the next page
+func (r *PdfRenderer) setMargins(m margins) {
+	r.Pdf.SetMargins(m.left, m.top, m.right)
+	r.Pdf.SetAutoPageBreak(true, m.bottom)
+	s := r.cs.peek()
+	s.leftMargin, s.contentLeftMargin = m.left, m.left
+	r.Pdf.SetX(m.left)
+}
+
+// pushMargins starts a region with the margins set by the left=, right=,
+// top= and bottom= attributes of a <!-- margins --> directive, e.g. a wide
+// table with left=10mm right=10mm; the others are kept. The header and
+// footer zones stay reserved. <!-- /margins --> ends the region.
+func (r *PdfRenderer) pushMargins(d directive) {
+	m := r.currentMargins()
+	r.savedMargins = append(r.savedMargins, m)
+	m.left = r.directiveLength(d, "left", m.left)
+	m.right = r.directiveLength(d, "right", m.right)
+	if _, ok := d.attrs["top"]; ok {
+		m.top = r.directiveLength(d, "top", m.top-r.headerHeight) + r.headerHeight
+	}
+	if _, ok := d.attrs["bottom"]; ok {
+		m.bottom = r.directiveLength(d, "bottom", m.bottom-r.footerHeight) + r.footerHeight
+	}
+	r.setMargins(m)
+	r.tracer("Margins", fmt.Sprintf("%+v", m))
+}
+
+// popMargins restores the margins from before the innermost open
+// <!-- margins --> region
+func (r *PdfRenderer) popMargins() {
+	if len(r.savedMargins) == 0 {
+		r.logf("Warning: <!-- /margins --> without <!-- margins -->")
+		return
+	}
+	m := r.savedMargins[len(r.savedMargins)-1]
+	r.savedMargins = r.savedMargins[:len(r.savedMargins)-1]
+	r.setMargins(m)
+	r.tracer("Margins", fmt.Sprintf("restored %+v", m))
+}
+
+// SetIndents sets the indents, in points, of lists, block quotes (and
+// mmark asides) and definition lists; 0 leaves one as it is. Block quotes
+// and definition lists are indented like lists unless set. They can also
+// be set with the IndentValue, BlockquoteIndent and DefinitionIndent keys
+// of a theme.
+func SetIndents(list, blockquote, definition float64) RenderOption {
+	return func(r *PdfRenderer) {
+		if list > 0 {
+			r.IndentValue = list
+		}
+		if blockquote > 0 {
+			r.BlockquoteIndent = blockquote
+		}
+		if definition > 0 {
+			r.DefinitionIndent = definition
+		}
+	}
+}
+
+// SetIndentScale makes each level of nesting scale the indents of the
+// lists and block quotes it contains by scale, e.g. 0.8, so that deeply
+// nested lists still fit narrow pages; 0 or 1 indents all levels alike
+func SetIndentScale(scale float64) RenderOption {
+	return func(r *PdfRenderer) {
+		r.IndentScale = scale
+	}
+}
+
+// blockIndent returns the indent of a list of kind, or of a block quote
+// for notlist, opened at the current nesting depth
+func (r *PdfRenderer) blockIndent(kind listType) float64 {
+	indent := r.IndentValue
+	switch {
+	case kind == notlist && r.BlockquoteIndent > 0:
+		indent = r.BlockquoteIndent
+	case kind == definition && r.DefinitionIndent > 0:
+		indent = r.DefinitionIndent
+	}
+	if r.IndentScale > 0 && r.IndentScale != 1 {
+		for _, s := range r.cs.stack {
+			if s.indent > 0 {
+				indent *= r.IndentScale
+			}
+		}
+	}
+	return indent
+}
+
+// spaceLeft returns the vertical space between the current position and the
+// page break trigger (which includes the reserved footer zone).
+func (r *PdfRenderer) spaceLeft() float64 {
+	_, pageh := r.Pdf.GetPageSize()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	return pageh - bottom - r.Pdf.GetY()
+}
+
+// ensureSpace starts a new page if a block of height h would otherwise run
+// into the reserved footer zone. It reports whether a page break was made.
+func (r *PdfRenderer) ensureSpace(h float64) bool {
+	if h <= r.spaceLeft() {
+		return false
+	}
+	r.tracer("ensureSpace", fmt.Sprintf("need %.2f, have %.2f: page break", h, r.spaceLeft()))
+	r.addPage()
+	return true
+}
+
+// pageContentHeight returns the usable height of a page between the top
+// margin and the page break trigger.
+func (r *PdfRenderer) pageContentHeight() float64 {
+	_, pageh := r.Pdf.GetPageSize()
+	_, top, _, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	return pageh - top - bottom
+}
+
+// keepTogether moves a block of height h to the next page when it would
+// otherwise be split at the current position. Blocks taller than
+// KeepTogetherRatio of the usable page height are left to split normally.
+func (r *PdfRenderer) keepTogether(h float64) bool {
+	if r.KeepTogetherRatio <= 0 || h <= r.spaceLeft() {
+		return false
+	}
+	if h > r.KeepTogetherRatio*r.pageContentHeight() {
+		r.tracer("keepTogether", fmt.Sprintf("block of %.2f exceeds threshold, splitting", h))
+		return false
+	}
+	return r.ensureSpace(h)
+}
+
+// SetKeepTogetherRatio sets the largest block (as a fraction of the usable
+// page height) that is moved to a new page rather than split across pages.
+// Code blocks and images are affected; 0 disables keep-together entirely.
+func SetKeepTogetherRatio(ratio float64) RenderOption {
+	return func(r *PdfRenderer) {
+		r.KeepTogetherRatio = ratio
+	}
+}
+
+// ContinuedLabel is printed at the top of a page when a table or code block
+// is split across pages
+var ContinuedLabel = "continued"
+
+// splitBlock identifies a table or code listing that is being rendered, so
+// that a page break in the middle of it can be marked on the next page.
+type splitBlock struct {
+	id      int
+	kind    string
+	started bool     // set once some of the block is on the page
+	header  []string // table header cells to re-emit after a page break
+	widths  []float64
+}
+
+// beginBlock opens a new splittable block of the given kind
+func (r *PdfRenderer) beginBlock(kind string) *splitBlock {
+	r.blockCount++
+	r.openBlock = &splitBlock{id: r.blockCount, kind: kind}
+	r.tracer("beginBlock", fmt.Sprintf("%s #%d", kind, r.blockCount))
+	return r.openBlock
+}
+
+// endBlock closes the currently open splittable block
+func (r *PdfRenderer) endBlock() {
+	if r.openBlock != nil {
+		r.tracer("endBlock", fmt.Sprintf("%s #%d", r.openBlock.kind, r.openBlock.id))
+	}
+	r.openBlock = nil
+}
+
+// continueBlock is called from the page header func. If a block was split
+// by the page break it prints a "(continued)" marker and, for tables,
+// repeats the header row.
+func (r *PdfRenderer) continueBlock() {
+	b := r.openBlock
+	if b == nil || !b.started {
+		return
+	}
+	r.tracer("continueBlock", fmt.Sprintf("%s #%d continued on page %d", b.kind, b.id, r.Pdf.PageNo()))
+	s := r.Normal
+	s.Style = "i"
+	s.Size -= 2
+	r.setStyler(s)
+	r.Pdf.SetTextColor(128, 128, 128)
+	r.Pdf.CellFormat(0, r.lineHeight(s), "("+ContinuedLabel+")", "", 1, "L", false, 0, "")
+	if len(b.header) == 0 {
+		return
+	}
+	r.setStyler(r.THeader)
+	h := r.lineHeight(r.THeader)
+	for i, c := range b.header {
+		if i < len(b.widths) {
+			r.Pdf.CellFormat(b.widths[i], h, c, "B", 0, "L", false, 0, "")
+		}
+	}
+	r.Pdf.Ln(h)
+}
+
+// fitTable makes a table that is wider than the space left of the right
+// margin fit: fonts and columns are scaled down together, but the body font
+// not below TableMinFontSize. If that is not enough the columns are narrowed
+// further, so that cell text wraps, and a warning is logged. The table
+// styles are restored by restoreTableStyles.
+func (r *PdfRenderer) fitTable(widths []float64) []float64 {
+	total := 0.0
+	for _, w := range widths {
+		total += w
+	}
+	avail := r.availableWidth()
+	if total <= avail || total == 0 || r.TBody.Size == 0 {
+		return widths
+	}
+	scale := avail / total
+	if r.TBody.Size*scale < r.TableMinFontSize {
+		scale = min(1, r.TableMinFontSize/r.TBody.Size)
+	}
+	r.tableStyles = &[2]Styler{r.THeader, r.TBody}
+	for _, s := range []*Styler{&r.THeader, &r.TBody} {
+		s.Size *= scale
+		s.Spacing *= scale
+	}
+	fitted := make([]float64, len(widths))
+	for i, w := range widths {
+		fitted[i] = w * scale
+	}
+	if total*scale > avail+0.01 {
+		r.logf("warning: table is %.0f%% too wide for the page at the minimum font size %.1f; wrapping cells",
+			(total*scale/avail-1)*100, r.TableMinFontSize)
+		for i := range fitted {
+			fitted[i] *= avail / (total * scale)
+		}
+	}
+	r.tracer("fitTable", fmt.Sprintf("width %.1f > %.1f: font scaled by %.2f", total, avail, scale))
+	return fitted
+}
+
+// restoreTableStyles undoes the font scaling of fitTable
+func (r *PdfRenderer) restoreTableStyles() {
+	if r.tableStyles != nil {
+		r.THeader, r.TBody = r.tableStyles[0], r.tableStyles[1]
+		r.tableStyles = nil
+	}
+}
+
+// SetTableMinFontSize sets the smallest font size (in points) tables that
+// are too wide for the page are shrunk to
+func SetTableMinFontSize(size float64) RenderOption {
+	return func(r *PdfRenderer) {
+		r.TableMinFontSize = size
+	}
+}
+
+// WideTableModes are the ways SetWideTables handles tables too wide for the
+// page at the minimum font size
+var WideTableModes = []string{"shrink", "split", "auto"}
+
+// SetWideTables sets how tables that are too wide for the page even at the
+// minimum font size are laid out: "shrink" (the default) narrows their
+// columns further so that cell text wraps, "split" stacks tables of as many
+// columns as fit at their full size, each repeating the first (key) column,
+// and "auto" turns the table on a landscape page of its own if it fits
+// there, or else splits it with a warning. An unknown mode is ignored with
+// a warning.
+func SetWideTables(mode string) RenderOption {
+	return func(r *PdfRenderer) {
+		if !slices.Contains(WideTableModes, mode) {
+			r.logf("Warning: unknown wide table mode %q", mode)
+			return
+		}
+		r.WideTables = mode
+	}
+}
+
+// SetCellWrapPrefix sets the text wrapped lines of table cells continue
+// after, e.g. "  " to indent them slightly or "» " to mark them, so that a
+// wrapped cell is told apart from cells of several lines in dense tables
+func SetCellWrapPrefix(prefix string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.CellWrapPrefix = prefix
+	}
+}
+
+// splitWideTables replaces each table of doc that is too wide for the page
+// at TableMinFontSize by tables of the columns that fit, each starting with
+// the first column, when WideTables is "split". When it is "auto", a table
+// that fits on a landscape page is put on one instead, see turnPages.
+func (r *PdfRenderer) splitWideTables(doc ast.Node) {
+	if r.WideTables != "split" && r.WideTables != "auto" || r.TBody.Size == 0 {
+		return
+	}
+	pageWidth, _ := r.Pdf.GetPageSize()
+	left, _, right, _ := r.Pdf.GetMargins()
+	avail := pageWidth - left - right
+	if r.AutoLandscape {
+		avail = r.landscapeWidth()
+	}
+	scale := min(1, r.TableMinFontSize/r.TBody.Size)
+	turn := r.WideTables == "auto" && r.portraitDocument() && !r.AutoLandscape
+	var tables []*ast.Table
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if table, ok := node.(*ast.Table); ok && entering {
+			tables = append(tables, table)
+		}
+		return ast.GoToNext
+	})
+	for _, table := range tables {
+		widths := r.ColumnWidths[table]
+		total := 0.0
+		for _, w := range widths {
+			total += w
+		}
+		if total*scale <= avail {
+			continue
+		}
+		if turn && total*scale <= r.landscapeWidth() {
+			if r.landscapeTables == nil {
+				r.landscapeTables = map[*ast.Table]bool{}
+			}
+			r.landscapeTables[table] = true
+			r.tracer("splitWideTables", fmt.Sprintf("%d columns %.1f wide on a landscape page", len(widths), total))
+			continue
+		}
+		if len(widths) < 3 {
+			continue
+		}
+		groups := columnGroups(widths, avail)
+		if r.WideTables == "auto" {
+			r.logf("Warning: table of %d columns too wide for the page; split into %d tables", len(widths), len(groups))
+		}
+		parts := make([]ast.Node, len(groups))
+		for i, cols := range groups {
+			part := tableColumns(table, cols)
+			if i == 0 {
+				part.Attribute = table.Attribute
+			}
+			for _, c := range cols {
+				r.ColumnWidths[part] = append(r.ColumnWidths[part], widths[c])
+			}
+			if r.revised[table] {
+				r.revised[part] = true
+			}
+			part.Parent = table.Parent
+			parts[i] = part
+		}
+		siblings := table.Parent.GetChildren()
+		i := slices.Index(siblings, ast.Node(table))
+		table.Parent.SetChildren(slices.Concat(siblings[:i], parts, siblings[i+1:]))
+		r.tracer("splitWideTables", fmt.Sprintf("%d columns %.1f wide split into %d tables", len(widths), total, len(parts)))
+	}
+}
+
+// columnGroups splits the columns after the first into groups that fit
+// avail next to it; a column too wide for that is a group of its own
+func columnGroups(widths []float64, avail float64) [][]int {
+	var groups [][]int
+	group, width := []int{0}, widths[0]
+	for c := 1; c < len(widths); c++ {
+		if len(group) > 1 && width+widths[c] > avail {
+			groups = append(groups, group)
+			group, width = []int{0}, widths[0]
+		}
+		group = append(group, c)
+		width += widths[c]
+	}
+	return append(groups, group)
+}
+
+// tableColumns returns a table of the columns cols of table. Its cells are
+// copies sharing their content with those of table; a cell spanning columns
+// spans those of cols.
+func tableColumns(table *ast.Table, cols []int) *ast.Table {
+	part := &ast.Table{}
+	for _, section := range table.Children {
+		var s ast.Node = &ast.TableBody{}
+		switch section.(type) {
+		case *ast.TableHeader:
+			s = &ast.TableHeader{}
+		case *ast.TableFooter:
+			s = &ast.TableFooter{}
+		}
+		for _, row := range section.GetChildren() {
+			newRow := &ast.TableRow{}
+			col := 0
+			for _, child := range row.GetChildren() {
+				cell, ok := child.(*ast.TableCell)
+				if !ok {
+					continue
+				}
+				span := max(cell.ColSpan, 1)
+				n := 0
+				for _, c := range cols {
+					if c >= col && c < col+span {
+						n++
+					}
+				}
+				col += span
+				if n == 0 {
+					continue
+				}
+				c := *cell
+				c.Parent = nil // or AppendChild takes it out of table
+				if c.ColSpan > 0 {
+					c.ColSpan = n
+				}
+				ast.AppendChild(newRow, &c)
+			}
+			ast.AppendChild(s, newRow)
+		}
+		ast.AppendChild(part, s)
+	}
+	return part
+}
@@ -0,0 +1,121 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SetLineNumbers numbers the lines of body text in the left margin, from 1
+// on every page, as contracts and affidavits need. Code blocks and tables
+// are not numbered.
+func SetLineNumbers(number bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.LineNumbers = number
+	}
+}
+
+// textLine is a line of body text to number
+type textLine struct {
+	y, height float64
+	margin    float64 // left margin of the page text, the numbers end before it
+}
+
+// noteLines notes the lines of height h from startY on startPage to endY on
+// endPage, both included
+func (r *PdfRenderer) noteLines(startPage int, startY, h float64, endPage int, endY float64) {
+	_, top, _, _ := r.Pdf.GetMargins()
+	_, pageHeight := r.Pdf.GetPageSize()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	margin := r.cs.stack[0].leftMargin
+	for page := startPage; page <= endPage; page++ {
+		from, to := top, pageHeight-bottom-h
+		if page == startPage {
+			from = startY
+		}
+		if page == endPage {
+			to = endY
+		}
+		for y := from; y <= to+0.01; y += h {
+			lines := r.textLines[page]
+			if !slices.ContainsFunc(lines, func(l textLine) bool { return math.Abs(l.y-y) < 0.01 }) {
+				r.textLines[page] = append(lines, textLine{y: y, height: h, margin: margin})
+			}
+		}
+	}
+}
+
+// numberLines writes t with write and, with LineNumbers, notes the lines
+// it fills; the empty lines of leading and trailing newlines are left out
+func (r *PdfRenderer) numberLines(h float64, t string, write func(string)) {
+	if !r.LineNumbers || strings.TrimSpace(t) == "" {
+		write(t)
+		return
+	}
+	lead := len(t) - len(strings.TrimLeft(t, "\n"))
+	trail := len(t) - len(strings.TrimRight(t, "\n"))
+	if lead > 0 {
+		write(t[:lead])
+	}
+	page, y := r.Pdf.PageNo(), r.Pdf.GetY()
+	write(t[lead : len(t)-trail])
+	r.noteLines(page, y, h, r.Pdf.PageNo(), r.Pdf.GetY())
+	if trail > 0 {
+		write(t[len(t)-trail:])
+	}
+}
+
+// drawLineNumbers numbers the noted lines of every page, in small type
+// right aligned in the left margin
+func (r *PdfRenderer) drawLineNumbers() {
+	if !r.LineNumbers || len(r.textLines) == 0 {
+		return
+	}
+	page, x, y := r.Pdf.PageNo(), r.Pdf.GetX(), r.Pdf.GetY()
+	auto, bottom := r.Pdf.GetAutoPageBreak()
+	r.Pdf.SetAutoPageBreak(false, bottom)
+	style := r.Normal
+	style.Size *= 0.8
+	for p := 1; p <= r.Pdf.PageCount(); p++ {
+		lines := r.textLines[p]
+		if len(lines) == 0 {
+			continue
+		}
+		slices.SortFunc(lines, func(a, b textLine) int { return cmp.Compare(a.y, b.y) })
+		// fonts and colors are per page content stream
+		r.Pdf.SetPage(p)
+		r.setStyler(style)
+		dy := r.pageOffset(p)
+		for i, l := range lines {
+			n := strconv.Itoa(i + 1)
+			w := r.Pdf.GetStringWidth(n) + 2*r.Pdf.GetCellMargin()
+			r.Pdf.SetXY(l.margin-0.5*r.em-w, l.y+dy)
+			r.Pdf.CellFormat(w, l.height, n, "", 0, "R", false, 0, "")
+		}
+	}
+	r.Pdf.SetPage(page)
+	r.Pdf.SetAutoPageBreak(auto, bottom)
+	r.Pdf.SetXY(x, y)
+	r.setStyler(r.cs.peek().textStyle)
+}
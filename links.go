@@ -0,0 +1,86 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// usedLink is an internal link written to the PDF
+type usedLink struct {
+	dest string // as written in the document, e.g. #setup
+	link int
+}
+
+// setLink points link at the current position, for the element about to
+// be rendered
+func (r *PdfRenderer) setLink(link int) {
+	r.Pdf.SetLink(link, r.Pdf.GetY(), -1)
+	if r.linkTargets == nil {
+		r.linkTargets = map[int]bool{}
+	}
+	r.linkTargets[link] = true
+}
+
+// useLink records an internal link written for dest, whose target must be
+// rendered too
+func (r *PdfRenderer) useLink(dest string, link int) {
+	r.usedLinks = append(r.usedLinks, usedLink{dest, link})
+}
+
+// brokenLink records an internal link or reference without a target in
+// the document, see LinkError
+func (r *PdfRenderer) brokenLink(dest string) {
+	for _, d := range r.brokenLinks {
+		if d == dest {
+			return
+		}
+	}
+	r.tracer("Broken link", dest)
+	r.brokenLinks = append(r.brokenLinks, dest)
+}
+
+// checkLinks adds the internal links whose targets were never rendered,
+// e.g. headings left out of the layout, to the broken links and reports
+// them all
+func (r *PdfRenderer) checkLinks() {
+	for _, u := range r.usedLinks {
+		if !r.linkTargets[u.link] {
+			r.brokenLink(u.dest)
+		}
+	}
+	for _, dest := range r.brokenLinks {
+		r.logf("Warning: link %s: no such target in the document", dest)
+	}
+}
+
+// LinkError sums up the internal links and references of the last run
+// whose targets are not in the document, such as [setup](#setpu) or
+// @fig:missing, wrapping ErrLink, or returns nil if all have one
+func (r *PdfRenderer) LinkError() error {
+	switch len(r.brokenLinks) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w: %s", ErrLink, r.brokenLinks[0])
+	}
+	return fmt.Errorf("%w: %d links without a target: %s", ErrLink, len(r.brokenLinks), strings.Join(r.brokenLinks, ", "))
+}
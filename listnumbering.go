@@ -0,0 +1,118 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// listNumbering matches the label formats of ordered lists: a number
+// style, 1 (decimal), a or A (letters), i or I (roman numerals), ended
+// by "." or ")" or enclosed in parentheses, e.g. "1.", "a)", "(i)"
+var listNumbering = regexp.MustCompile(`^(\(?)([1aAiI])([.)])$`)
+
+// ValidListNumbering reports whether format is an ordered list label
+// format SetListNumbering accepts
+func ValidListNumbering(format string) bool {
+	m := listNumbering.FindStringSubmatch(format)
+	return m != nil && (m[1] == "" || m[3] == ")")
+}
+
+// SetListNumbering sets the label format of ordered lists, such as "1.",
+// "a)", "(1)", "i." or "A."; it can also be set with the ListNumbering
+// key of a theme. A list can have its own with a <!-- list a) -->
+// directive before it or, in the mmark dialect, a {numbering="a)"}
+// attribute. By default lists keep the "." or ")" of their markdown.
+func SetListNumbering(format string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.ListNumbering = format
+	}
+}
+
+// listFormat returns the label format of the ordered list node: its
+// numbering attribute, a list directive before it, the renderer's
+// ListNumbering or the delimiter of its markdown, in that order. It
+// consumes the directive.
+func (r *PdfRenderer) listFormat(node ast.List) string {
+	format := r.nextListNumbering
+	r.nextListNumbering = ""
+	if node.Attribute != nil {
+		if v, ok := node.Attribute.Attrs["numbering"]; ok {
+			format = string(v)
+		}
+	}
+	for _, f := range []string{format, r.ListNumbering} {
+		if f == "" {
+			continue
+		}
+		if ValidListNumbering(f) {
+			return f
+		}
+		r.logf("Warning: unknown list numbering %q, expected e.g. 1. a) (i) or A.", f)
+	}
+	if node.Delimiter == ')' {
+		return "1)"
+	}
+	return "1."
+}
+
+// listLabel formats the number n of an ordered list item as format says
+func listLabel(format string, n int) string {
+	m := listNumbering.FindStringSubmatch(format)
+	if m == nil {
+		return strconv.Itoa(n) + "."
+	}
+	var num string
+	switch m[2] {
+	case "a":
+		num = strings.ToLower(appendixLetter(n))
+	case "A":
+		num = appendixLetter(n)
+	case "i":
+		num = strings.ToLower(romanNumeral(n))
+	case "I":
+		num = romanNumeral(n)
+	default:
+		num = strconv.Itoa(n)
+	}
+	return m[1] + num + m[3]
+}
+
+// romanNumeral converts 1, 4, 1999 ... to I, IV, MCMXCIX; numbers
+// outside 1-3999 have no roman numeral and are written in digits
+func romanNumeral(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var s strings.Builder
+	for i, v := range values {
+		for n >= v {
+			s.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return s.String()
+}
@@ -23,12 +23,10 @@ package mdtopdf
 import (
 	"bufio"
 	"embed"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"codeberg.org/go-pdf/fpdf"
@@ -85,6 +83,8 @@ type PdfRenderer struct {
 
 	// trace/log file if present
 	pdfFile, tracerFile string
+	used                bool  // Run was called; the PDF holds its document
+	setupErr            error // theme or font that could not be loaded, returned by Run
 	w                   *bufio.Writer
 
 	// default font family
@@ -93,6 +93,9 @@ type PdfRenderer struct {
 	// default margins for safe keeping
 	mleft, mtop, mright, mbottom float64
 
+	// space reserved for the header and footer funcs, in points
+	headerHeight, footerHeight float64
+
 	// normal text
 	Normal Styler
 	em     float64
@@ -104,8 +107,13 @@ type PdfRenderer struct {
 	Backtick Styler
 
 	// blockquote text
-	Blockquote  Styler
-	IndentValue float64
+	Blockquote Styler
+
+	// indents of nested blocks, see SetIndents
+	IndentValue      float64 // lists, and the others unless set
+	BlockquoteIndent float64 // block quotes and asides
+	DefinitionIndent float64 // definition lists
+	IndentScale      float64 // factor each level of nesting scales indents by
 
 	// Headings
 	H1 Styler
@@ -129,28 +137,225 @@ type PdfRenderer struct {
 	NeedBlockquoteStyleUpdate bool
 	HorizontalRuleNewPage     bool // Default true unless --no-new-page specified
 	SyntaxHighlightBaseDir    string
+	TabWidth                  int    // see SetTabWidth
+	CodeWrapMarker            string // see SetCodeWrapMarker
+	ClipCode                  bool   // see SetClipCode
+	CollapseDetails           bool   // see SetCollapseDetails
 	InputBaseURL              string
+	InputBaseDir              string // relative image paths are resolved against it, see SetInputBaseDir
+	IncludeOutside            bool   // see SetIncludeOutside
 	Theme                     Theme
 	BackgroundColor           Color
+	MarkColor                 Color               // background of ==marked== text
 	documentMatter            ast.DocumentMatters // keep track of front/main/back matter.
 	Extensions                parser.Extensions
+	GFM                       bool // see SetGFM
+	EmojiShortcodes           bool // see SetEmojiShortcodes
 	ColumnWidths              map[ast.Node][]float64
 	KeepNumbering             bool
+	KeepTogetherRatio         float64 // see SetKeepTogetherRatio
+	ListNumbering             string  // label format of ordered lists, see SetListNumbering
 	orderedListCounter        int
+	nextListNumbering         string // set by a list directive for the next list
+
+	// table or code block currently being rendered, see beginBlock
+	openBlock  *splitBlock
+	blockCount int
+
+	tocLinks  map[string]*int
+	tocLinked map[string]bool // titles whose link is set, see setTOCLink
+
+	// links back to the table of contents, see SetBackToTOC and MarkTOC
+	BackToTOC string
+	tocLink   int
+	tocPage   int
+	inSection bool
+
+	// variables for <!-- if --> conditional content and templates, see
+	// SetDefines and ExpandTemplates
+	Defines map[string]string
+	Locale  string // of the template helpers, see SetLocale
+
+	// abbreviations expanded on first use, see SetGlossary
+	Glossary         Glossary
+	GlossaryAppendix bool
+	glossaryUsed     map[string]bool
+
+	// citation keys resolved against Bibliography, see SetBibliography
+	Bibliography Bibliography
+	cited        map[string]bool
+
+	// footnotes set in the margin, see SetSidenotes
+	Sidenotes    bool
+	sidenotes    map[ast.Node]bool // footnote items, true once set in the margin
+	sidenotePage int
+	sidenoteY    float64 // below the last sidenote on sidenotePage
+
+	// body text lines numbered in the margin, see SetLineNumbers
+	LineNumbers bool
+	textLines   map[int][]textLine // by page
+
+	// Bates numbers stamped on every page, see SetBates
+	Bates       bool
+	BatesPrefix string
+	BatesStart  int
+	BatesCorner string // see SetBatesCorner
+
+	// text in the page margins, see SetHeaderText
+	HeaderText string
+	FooterText string
+	TimeZone   string // of the date variables, see SetTimeZone
+
+	// numbered figures and tables, see numberCrossRefs
+	crossRefs       map[string]*crossRef
+	crossRefTargets map[ast.Node]int
+	headingAnchors  map[string]int    // by heading ID
+	fileAnchors     map[string]string // heading IDs by file#id, see collectFileLinks
+	fileStarts      map[string]int    // links to the files not starting with a heading
+	currentFile     string            // of a merged document, see startFile
+
+	// heading numbers and PDF outline, see SetHeadingNumbering and SetBookmarks
+	NumberHeadings bool
+	Bookmarks      bool
+	headingNumbers headingNumberer
+	bookmarkLevel  int
+	bookmarkDepth  int // level of the headings' bookmarks, 1 below a <!-- bookmark -->
+
+	// heading level changes, see SetHeadingShift and SetMaxHeadingLevel
+	HeadingShift    int
+	MaxHeadingLevel int
+
+	// revision bars for blocks changed since DiffBase, see SetDiffBase
+	DiffBase      []byte
+	RevisionText  bool
+	RevisionColor Color
+	revised       map[ast.Node]bool
+	revision      *revisionMark
+
+	// sticky notes and form fields, added to the PDF after fpdf output
+	annotations []*annotation
+	fieldCount  int
+
+	// how the PDF opens in a viewer, see SetViewerPreferences
+	ViewerPreferences ViewerPreferences
+	openAt            *openAt
+
+	// margins in effect before each open <!-- margins --> region
+	savedMargins []margins
+
+	// open <!-- place --> regions, see openPlacement
+	placements []*placement
+	float      *imageFloat // floated image the text flows beside
+
+	// open <!-- panel --> regions, see openPanel
+	PanelColor Color // border and label tab
+	panels     []*panel
+
+	// read the text back from the written PDF, see TextError
+	VerifyText bool
+	sourceText string
+	textErr    error
+
+	// internal links, see LinkError
+	brokenLinks []string
+	usedLinks   []usedLink
+	linkTargets map[int]bool // links set with setLink
+
+	// line heights and spacing are whole multiples of this height in
+	// points, if not 0; see SetBaseLineHeight
+	BaseLineHeight float64
+
+	// scale of the styles, one of Densities; see SetDensity
+	Density string
+
+	// contrast of the text colors, one of ContrastModes; see
+	// SetContrastCheck
+	ContrastCheck string
+	codeColors    map[string]Color // highlighting colors of the run
+
+	// tables wider than the page are shrunk down to this font size, and
+	// then split into parts if WideTables is "split"
+	TableMinFontSize float64
+	WideTables       string // see SetWideTables
+	CellWrapPrefix   string // see SetCellWrapPrefix
+	tableStyles      *[2]Styler
+
+	// wide tables and images on landscape pages, see SetAutoLandscape
+	AutoLandscape   bool
+	turned          bool                // some pages are landscape
+	landscapeTables map[*ast.Table]bool // of WideTables "auto"
+
+	// inside <kbd> and <mark>, see processInlineTag
+	kbd, mark bool
+
+	// masked text and code nodes, drawn as black bars, see redactions
+	redacted map[ast.Node]bool
+
+	// preset and TTF fonts loaded by style, see fontFamily
+	loadedFonts map[string]bool
+	CodeFont    string // see SetCodeFont
+	CodeTheme   string // see SetCodeTheme
+
+	// downsampling and re-encoding of images, see SetImageMaxDPI and
+	// SetJPEGQuality
+	ImageMaxDPI int
+	JPEGQuality int
+	compressed  map[string]compressedImage // by original file, per run
+	heifFiles   map[string]string          // PNG of each HEIC image, per run
+
+	// bound on the memory taken by images, in bytes; see SetMemoryLimit
+	MemoryLimit int64
+	imageMemory int64           // held by the images embedded so far
+	reserved    map[string]bool // images counted in imageMemory
+
+	// diagram fences, see DiagramCommands
+	PlantUMLServer  string
+	DiagramCacheDir string
+
+	// TeX engine of ```latex fences, see SetLaTeXEngine
+	LaTeXEngine string
+
+	// no diagnostics on stderr, see logf
+	Quiet bool
+
+	// markdown dropped for lack of support, by kind; see SetWarnUnsupported
+	WarnUnsupported bool
+	unsupported     map[string]int
+
+	// images that could not be loaded, see imageFailed
+	imageErrors []error
+
+	// per-run directory for downloaded images, see workDir and SetKeepTemp
+	tempDir  string
+	KeepTemp bool
+
+	// run between parsing and rendering, see WithASTTransformer
+	astTransformers []ASTTransformer
 
-	tocLinks map[string]*int
+	// maps links, wiki links and issue keys to destinations, see
+	// WithLinkResolver
+	linkResolver LinkResolver
+
+	// wiki links of a single document, see SetWikiLinks
+	WikiLinks bool
+
+	// source transforms run before parsing, in order; the built-in ones
+	// come first, see WithPreprocessor and WithoutPreprocessor
+	Preprocessors []Preprocessor
 }
 
 // TOCEntry represents a table of contents entry
 type TOCEntry struct {
-	Level int
-	Title string
-	ID    string
+	Level  int
+	Title  string
+	ID     string
+	Number string // hierarchical number, e.g. "2.1" or "A.1" in an appendix
 }
 
 // TOCVisitor implements ast.NodeVisitor to collect headers
 type TOCVisitor struct {
 	Entries []TOCEntry
+	numbers headingNumberer
 }
 
 // Visit implements the ast.NodeVisitor interface
@@ -159,23 +364,36 @@ func (v *TOCVisitor) Visit(node ast.Node, entering bool) ast.WalkStatus {
 		return ast.GoToNext
 	}
 
+	if block, ok := node.(*ast.HTMLBlock); ok {
+		d, _ := parseDirective(block.Literal)
+		switch d.name {
+		case "appendix":
+			v.numbers.startAppendix()
+		case "restartnumbering":
+			v.numbers.restart()
+		}
+		return ast.GoToNext
+	}
+
 	// Check if the node is a heading
 	if heading, ok := node.(*ast.Heading); ok {
+		if hasClass(heading, "notoc", "unlisted", "redact") {
+			// keep the numbers in step with the rendered headings
+			if !hasClass(heading, "unnumbered") {
+				v.numbers.next(heading.Level)
+			}
+			return ast.SkipChildren
+		}
 		// Extract the text content from the heading
 		title := ExtractTextFromNode(heading)
 		if title != "" {
-			// Create a simple ID from the title (lowercase, replace spaces with hyphens)
-			id := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(title), " ", "-"))
-			// Remove special characters for cleaner IDs
-			id = strings.ReplaceAll(id, ".", "")
-			id = strings.ReplaceAll(id, ",", "")
-			id = strings.ReplaceAll(id, "!", "")
-			id = strings.ReplaceAll(id, "?", "")
-
 			entry := TOCEntry{
 				Level: heading.Level,
 				Title: title,
-				ID:    id,
+				ID:    headingSlug(title),
+			}
+			if !hasClass(heading, "unnumbered") {
+				entry.Number = v.numbers.next(heading.Level)
 			}
 			v.Entries = append(v.Entries, entry)
 		}
@@ -184,6 +402,18 @@ func (v *TOCVisitor) Visit(node ast.Node, entering bool) ast.WalkStatus {
 	return ast.GoToNext
 }
 
+// headingSlug makes the TOC entry ID of a heading title: lowercase, with
+// hyphens for spaces and without punctuation
+func headingSlug(title string) string {
+	id := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(title), " ", "-"))
+	// Remove special characters for cleaner IDs
+	id = strings.ReplaceAll(id, ".", "")
+	id = strings.ReplaceAll(id, ",", "")
+	id = strings.ReplaceAll(id, "!", "")
+	id = strings.ReplaceAll(id, "?", "")
+	return id
+}
+
 // ExtractTextFromNode recursively extracts text content from AST nodes
 func ExtractTextFromNode(node ast.Node) string {
 	var text strings.Builder
@@ -203,18 +433,29 @@ func ExtractTextFromNode(node ast.Node) string {
 	return text.String()
 }
 
-// GetTOCEntries returns TOC entries
+// GetTOCEntries returns TOC entries, parsing content with the common
+// extensions; TOCEntries parses it as a renderer does
 func GetTOCEntries(content []byte) ([]TOCEntry, error) {
+	return tocEntries(content, parser.CommonExtensions|parser.AutoHeadingIDs|parser.OrderedListStart)
+}
 
-	// Create parser with extensions
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.OrderedListStart
+// TOCEntries returns the TOC entries of content parsed with the extensions
+// of the renderer, see SetDialect
+func (r *PdfRenderer) TOCEntries(content []byte) ([]TOCEntry, error) {
+	return tocEntries(content, r.parserExtensions())
+}
+
+// tocEntries returns the TOC entries of content parsed with extensions
+func tocEntries(content []byte, extensions parser.Extensions) ([]TOCEntry, error) {
 	p := parser.NewWithExtensions(extensions)
 
 	// Parse the markdown content
 	doc := markdown.Parse(content, p)
+	parseHeadingAttributes(doc)
+	redactions(doc, nil)
 
 	// Create visitor to collect TOC entries
-	visitor := &TOCVisitor{}
+	visitor := &TOCVisitor{numbers: headingNumberer{base: minHeadingLevel(doc)}}
 
 	// Walk the AST and collect headers
 	ast.Walk(doc, visitor)
@@ -222,12 +463,42 @@ func GetTOCEntries(content []byte) ([]TOCEntry, error) {
 	return visitor.Entries, nil
 }
 
-// SetTOCLinks these will be used in `nodeProcessing.go:processText()` if the header is encoutered
-// as we need to call `r.Pdf.SetLink()` if that's the case
+// DocumentTitle returns the text of the first level 1 heading of markdown
+// content, or "" if there is none: most READMEs start with their title
+func DocumentTitle(content []byte) string {
+	entries, _ := GetTOCEntries(content)
+	for _, entry := range entries {
+		if entry.Level == 1 {
+			return entry.Title
+		}
+	}
+	return ""
+}
+
+// SetTOCLinks sets the links of the table of contents entries, by heading
+// title; each is pointed at its heading when the heading is rendered
 func (r *PdfRenderer) SetTOCLinks(tocHeaders map[string]*int) {
 	r.tocLinks = tocHeaders
 }
 
+// setTOCLink points the table of contents link of a heading at the line
+// the heading starts on. A title shared by several headings links to the
+// first of them.
+func (r *PdfRenderer) setTOCLink(node *ast.Heading) {
+	title := ExtractTextFromNode(node)
+	linkPtr, ok := r.tocLinks[title]
+	if !ok || r.tocLinked[title] {
+		return
+	}
+	if r.tocLinked == nil {
+		r.tocLinked = map[string]bool{}
+	}
+	r.tocLinked[title] = true
+	page, y := r.Pdf.PageNo(), r.Pdf.GetY()
+	r.Pdf.SetLink(*linkPtr, y, page)
+	r.tracer("TOC link", fmt.Sprintf("%q -> page %d, y=%.2f", title, page, y))
+}
+
 // SetLightTheme sets theme to 'light'
 func (r *PdfRenderer) SetLightTheme() {
 	r.BackgroundColor = Colorlookup("white")
@@ -283,6 +554,8 @@ func (r *PdfRenderer) SetLightTheme() {
 func (r *PdfRenderer) SetDarkTheme() {
 	r.BackgroundColor = Colorlookup("black")
 	r.SetPageBackground("", r.BackgroundColor)
+	r.MarkColor = Color{110, 90, 0}
+	r.PanelColor = Color{120, 120, 120}
 	// Normal Text
 	r.Normal = Styler{Font: r.DefaultFont, Style: "", Size: 11, Spacing: 1.6,
 		FillColor: Colorlookup("black"), TextColor: Colorlookup("white")}
@@ -330,18 +603,21 @@ func (r *PdfRenderer) SetDarkTheme() {
 
 }
 
-// SetCustomTheme sets a custom theme based on JSON config
+// SetCustomTheme sets a custom theme based on JSON config; a file that
+// cannot be read or loaded makes Run and Process return an error wrapping
+// ErrIO or ErrParse.
 func (r *PdfRenderer) SetCustomTheme(themeJSONFile string) {
 
 	config, err := os.ReadFile(themeJSONFile)
 	if err != nil {
-		log.Fatal(err)
+		r.setupErr = fmt.Errorf("%w: %v", ErrIO, err)
+		return
 	}
 	// Fill the instance from the JSON file content
-	err = json.Unmarshal(config, &r)
+	err = r.loadTheme(config)
 	// Check if is there any error while filling the instance
 	if err != nil {
-		log.Fatal("Error parsing ", themeJSONFile, ":\n", err)
+		r.setupErr = fmt.Errorf("%w: %s: %v", ErrParse, themeJSONFile, err)
 	}
 }
 
@@ -353,6 +629,16 @@ type PdfRendererParams struct {
 	Theme                                                  Theme
 	CustomThemeFile                                        string
 	KeepNumbering                                          bool
+	// Extensions are the markdown parser extensions; DefaultExtensions if
+	// unset, SetExtensions(parser.NoExtensions) parses without any. See
+	// also SetDialect.
+	Extensions parser.Extensions
+	// HeaderHeight and FooterHeight reserve space (in points) at the top and
+	// bottom of every page for SetHeaderFunc/SetFooterFunc output; body
+	// content breaks to a new page before entering these zones.
+	HeaderHeight, FooterHeight float64
+
+	themeJSON []byte // CustomThemeFile as read by NewFactory
 }
 
 // loadFontSafely loads a font file with proper error handling
@@ -367,6 +653,19 @@ func loadFontSafely(pdf *fpdf.Fpdf, family, style, fontPath string) error {
 	return nil
 }
 
+// parserExtensions returns the extensions Run parses with: those of GFM
+// with SetGFM, and footnotes for the sidenotes
+func (r *PdfRenderer) parserExtensions() parser.Extensions {
+	extensions := r.Extensions
+	if r.GFM {
+		extensions = GFMExtensions
+	}
+	if r.Sidenotes {
+		extensions |= parser.Footnotes
+	}
+	return extensions
+}
+
 // NewPdfRenderer creates and configures an PdfRenderer object,
 // which satisfies the Renderer interface.
 func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
@@ -392,7 +691,20 @@ func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
 	r.fontdir = "."
 
 	r.Theme = params.Theme
+	r.MarkColor = Color{255, 236, 140}
+	r.PanelColor = Color{150, 150, 150}
 	r.KeepNumbering = params.KeepNumbering
+	r.Extensions = DefaultExtensions
+	if params.Extensions != 0 {
+		r.Extensions = params.Extensions
+	}
+	r.KeepTogetherRatio = 1
+	r.RevisionColor = Color{Red: 220, Green: 50, Blue: 47}
+	r.TableMinFontSize = 7
+	r.TabWidth = 4
+	r.CodeWrapMarker = DefaultCodeWrapMarker
+	r.EmojiShortcodes = true
+	r.Preprocessors = r.builtinPreprocessors()
 	r.orderedListCounter = 0
 
 	// Set default font (fallback to Times if not specified)
@@ -402,94 +714,26 @@ func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
 	}
 
 	r.Pdf = fpdf.New(r.orientation, r.units, r.papersize, r.fontdir)
+	r.reserveZones(params.HeaderHeight, params.FooterHeight)
 
 	r.Pdf.SetHeaderFunc(func() {
 		r.SetPageBackground("", r.BackgroundColor)
+		r.continueBlock()
 	})
 
 	// Load preset UTF-8 font if specified
 	if params.PresetFont != "" {
-		fontMap := map[string]struct {
-			dir      string
-			name     string
-			regular  string
-			bold     string
-			italic   string
-			boldItal string
-		}{
-			"dejavu_sans": {
-				dir:      "resources/fonts/dejavu_sans",
-				name:     "DejaVuSans",
-				regular:  "DejaVuSans.ttf",
-				bold:     "DejaVuSans-Bold.ttf",
-				italic:   "DejaVuSans-Oblique.ttf",
-				boldItal: "DejaVuSans-BoldOblique.ttf",
-			},
-			"dejavu_serif": {
-				dir:      "resources/fonts/dejavu_serif",
-				name:     "DejaVuSerif",
-				regular:  "DejaVuSerif.ttf",
-				bold:     "DejaVuSerif-Bold.ttf",
-				italic:   "DejaVuSerif-Italic.ttf",
-				boldItal: "DejaVuSerif-BoldItalic.ttf",
-			},
-			"noto_sans": {
-				dir:      "resources/fonts/noto_sans",
-				name:     "NotoSans",
-				regular:  "NotoSans-Regular.ttf",
-				bold:     "NotoSans-Bold.ttf",
-				italic:   "NotoSans-Italic.ttf",
-				boldItal: "NotoSans-BoldItalic.ttf",
-			},
-			"roboto": {
-				dir:      "resources/fonts/roboto",
-				name:     "Roboto",
-				regular:  "Roboto-Regular.ttf",
-				bold:     "Roboto-Bold.ttf",
-				italic:   "Roboto-Italic.ttf",
-				boldItal: "Roboto-BoldItalic.ttf",
-			},
-			"eb_garamond": {
-				dir:      "resources/fonts/eb_garamond",
-				name:     "EBGaramond",
-				regular:  "EBGaramond-Regular.ttf",
-				bold:     "EBGaramond-Bold.ttf",
-				italic:   "EBGaramond-Italic.ttf",
-				boldItal: "EBGaramond-BoldItalic.ttf",
-			},
-			"merriweather": {
-				dir:      "resources/fonts/merriweather",
-				name:     "Merriweather",
-				regular:  "Merriweather-Regular.ttf",
-				bold:     "Merriweather-Bold.ttf",
-				italic:   "Merriweather-Italic.ttf",
-				boldItal: "Merriweather-BoldItalic.ttf",
-			},
-			"source_serif": {
-				dir:      "resources/fonts/source_serif",
-				name:     "SourceSerif4",
-				regular:  "SourceSerif4-Regular.ttf",
-				bold:     "SourceSerif4-Bold.ttf",
-				italic:   "SourceSerif4-It.ttf",
-				boldItal: "SourceSerif4-BoldIt.ttf",
-			},
-		}
-
-		if fontInfo, exists := fontMap[params.PresetFont]; exists {
-			fonts := map[string]string{
-				"":   fontInfo.regular,
-				"B":  fontInfo.bold,
-				"I":  fontInfo.italic,
-				"BI": fontInfo.boldItal,
-			}
-
-			for style, filename := range fonts {
-				fullPath := filepath.Join(fontInfo.dir, filename)
+		if fontInfo, exists := presetFonts[params.PresetFont]; exists {
+			for _, style := range []string{"", "B", "I", "BI"} {
+				fullPath := fontInfo.file(style)
 				if err := loadFontSafely(r.Pdf, fontInfo.name, style, fullPath); err != nil {
-					log.Fatalf("Failed to load %s font: %v\nEnsure font files are installed in %s/", params.PresetFont, err, fontInfo.dir)
+					r.setupErr = fmt.Errorf("%w: failed to load %s font: %v; ensure font files are installed in %s/", ErrFont, params.PresetFont, err, fontInfo.dir)
+					break
 				}
 			}
-			r.DefaultFont = fontInfo.name
+			if r.setupErr == nil {
+				r.DefaultFont = fontInfo.name
+			}
 		}
 	}
 
@@ -499,7 +743,10 @@ func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
 	case LIGHT:
 		r.SetLightTheme()
 	case CUSTOM:
-		if params.CustomThemeFile != "" {
+		if params.themeJSON != nil {
+			// checked by NewFactory
+			_ = r.loadTheme(params.themeJSON)
+		} else if params.CustomThemeFile != "" {
 			r.SetCustomTheme(params.CustomThemeFile)
 		}
 	}
@@ -508,7 +755,9 @@ func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
 	r.setStyler(r.Normal)
 	r.mleft, r.mtop, r.mright, r.mbottom = r.Pdf.GetMargins()
 	r.em = r.Pdf.GetStringWidth("m")
-	r.IndentValue = 1.5 * r.em
+	if r.IndentValue == 0 {
+		r.IndentValue = 1.5 * r.em
+	}
 
 	r.cs = states{stack: make([]*containerState, 0)}
 	initcurrent := &containerState{
@@ -521,6 +770,11 @@ func NewPdfRenderer(params PdfRendererParams) *PdfRenderer {
 	for _, o := range params.Opts {
 		o(r)
 	}
+	r.applyDensity()
+	// options may have changed the normal text style
+	r.cs.stack[0].textStyle = r.Normal
+	r.setStyler(r.Normal)
+	r.em = r.Pdf.GetStringWidth("m")
 
 	return r
 }
@@ -544,47 +798,149 @@ func NewPdfRendererWithDefaultStyler(orient, papersz, pdfFile, tracerFile string
 	return NewPdfRenderer(params)
 }
 
-// Process takes the markdown content, parses it to generate the PDF
+// Process takes the markdown content, parses it to generate the PDF. A
+// renderer writes one PDF: calling Process again returns an error wrapping
+// ErrReused; use a new renderer, e.g. from a Factory, for each document.
 func (r *PdfRenderer) Process(content []byte) error {
+	if r.used {
+		return fmt.Errorf("error on %v: %w", r.pdfFile, ErrReused)
+	}
 	// try to open tracer
 	var f *os.File
 	var err error
 	if r.tracerFile != "" {
 		f, err = os.Create(r.tracerFile)
 		if err != nil {
-			return fmt.Errorf("os.Create() on tracefile error:%v", err)
+			return fmt.Errorf("%w: os.Create() on tracefile error:%v", ErrIO, err)
 		}
 		defer f.Close()
 		r.w = bufio.NewWriter(f)
 		defer r.w.Flush()
 	}
 
-	content = ensureCheckboxListSpacing(content)
-
 	err = r.Run(content)
 	if err != nil {
-		return fmt.Errorf("error on %v:%v", r.pdfFile, err)
+		return fmt.Errorf("error on %v:%w", r.pdfFile, err)
 	}
 
-	err = r.Pdf.OutputFileAndClose(r.pdfFile)
+	err = r.outputFile(r.pdfFile)
 	if err != nil {
-		return fmt.Errorf("error on %v:%v", r.pdfFile, err)
+		return fmt.Errorf("error on %v:%w: %v", r.pdfFile, ErrIO, err)
+	}
+
+	if r.VerifyText {
+		if err := r.verifyText(r.pdfFile); err != nil {
+			return fmt.Errorf("error verifying the text of %v: %w", r.pdfFile, err)
+		}
 	}
 
 	return nil
 }
 
 // Run takes the markdown content, parses it but don't generate the PDF. you can access the PDF with youRenderer.Pdf
+// It too may only be called once on a renderer, see Process. Write the PDF
+// with Output rather than r.Pdf.Output, which leaves out sticky notes, form
+// fields and viewer preferences.
+//
+// In earlier versions Process and Run could be called again, and drew the
+// next document onto the same PDF with state left over from the first; they
+// now return ErrReused instead.
 func (r *PdfRenderer) Run(content []byte) error {
-	s := content
-	s = markdown.NormalizeNewlines(s)
+	if r.used {
+		return ErrReused
+	}
+	r.used = true
+	if r.setupErr != nil {
+		return r.setupErr
+	}
+	defer r.removeWorkDir()
+	r.checkContrast()
+	r.sidenotes = map[ast.Node]bool{}
+	r.textLines = map[int][]textLine{}
+	r.Extensions = r.parserExtensions()
+	s, err := r.preprocess(markdown.NormalizeNewlines(content))
+	if err != nil {
+		return err
+	}
+	s, details := extractDetails(s)
+	s, abbrs := extractAbbreviations(s)
+	s, tags := extractAbbrTags(s)
+	for term, expansion := range tags {
+		if _, defined := abbrs[term]; !defined {
+			abbrs[term] = expansion
+		}
+	}
+	if len(abbrs) > 0 {
+		g := Glossary{}
+		for term, expansion := range r.Glossary {
+			g[term] = expansion
+		}
+		for term, expansion := range abbrs {
+			g[term] = expansion
+		}
+		r.Glossary = g
+	}
 
 	p := parser.NewWithExtensions(r.Extensions)
 	doc := markdown.Parse(s, p)
 
+	r.detailsBlocks(doc, details)
+	r.callouts(doc)
+	r.codeIncludes(doc)
+	parseHeadingAttributes(doc)
+	parseImageAttributes(doc)
+	r.shiftHeadings(doc)
+	r.csvTables(doc)
+	if r.GFM {
+		gfmAutolinks(doc)
+	}
+	if r.EmojiShortcodes {
+		emojiShortcodes(doc, fontGlyphs(r.Normal.Font))
+	}
+	iconShortcodes(doc)
+	if r.Extensions&parser.Mmark != 0 {
+		codeCallouts(doc)
+	}
+	r.resolveLinks(doc)
+	r.wikiLinks(doc)
+	r.markRevisions(doc)
+	r.redacted = redactions(doc, redactedNotes(s))
+	if err := r.transform(&doc); err != nil {
+		return err
+	}
+	r.collectFileLinks(doc)
+	r.numberCrossRefs(doc)
+	r.currentFile = ""
+	r.headingNumbers = headingNumberer{base: minHeadingLevel(doc)}
+	r.bookmarkLevel = -1
+	r.bookmarkDepth = 0
+	if r.VerifyText {
+		r.sourceText = r.plainText(doc)
+	}
 	addListTransitionSpacing(doc, r) // Must be before setColumnWidths to have tracer available
 	setColumnWidths(doc, r)
+	r.splitWideTables(doc)
 	_ = markdown.Render(doc, r)
+	r.endFloat(true)
+	if len(r.savedMargins) > 0 {
+		r.logf("Warning: <!-- margins --> without <!-- /margins -->")
+		r.setMargins(r.savedMargins[0])
+		r.savedMargins = nil
+	}
+	r.closePlacements()
+	r.closePanels()
+
+	r.renderReferences()
+	if r.GlossaryAppendix {
+		r.renderGlossary()
+	}
+	r.endBackToTOC()
+	r.drawLineNumbers()
+	r.stampBates()
+	r.stampPageText()
+	r.checkLinks()
+	r.warnUnsupported()
+	r.resolveOpenAt()
 
 	return nil
 }
@@ -653,11 +1009,14 @@ func setColumnWidths(doc ast.Node, r *PdfRenderer) {
 	cellnum := 0
 	lengths := []float64{}
 	textlength := float64(0)
+	linelength := float64(0)
 	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
 		switch n := node.(type) {
 		case *ast.Table:
 			if entering {
 				intable = true
+				inheader = false
+				lengths = []float64{}
 			} else {
 				intable = false
 				columnWidths[node] = lengths
@@ -674,23 +1033,50 @@ func setColumnWidths(doc ast.Node, r *PdfRenderer) {
 			}
 		case *ast.TableCell:
 			if entering {
-				if inheader {
+				// headerless tables (e.g. from CSV) size columns from the body
+				if inheader || cellnum >= len(lengths) {
 					lengths = append(lengths, 0)
 				}
 			} else {
+				textlength = max(textlength, linelength)
+				linelength = 0
 				textlength += textlength * 0.2
 
-				currentMax := lengths[cellnum]
-				if textlength > currentMax {
-					lengths[cellnum] = textlength
+				span := max(n.ColSpan, 1)
+				for len(lengths) < cellnum+span {
+					lengths = append(lengths, 0)
+				}
+				// a spanning cell widens its columns evenly if they are
+				// too narrow together
+				total := 0.0
+				for _, l := range lengths[cellnum : cellnum+span] {
+					total += l
+				}
+				if textlength > total {
+					extra := (textlength - total) / float64(span)
+					for i := cellnum; i < cellnum+span; i++ {
+						lengths[i] += extra
+					}
 				}
 				textlength = 0
-				cellnum++
+				cellnum += span
 			}
 		case *ast.Text:
 			if entering && intable {
-				l := r.Pdf.GetStringWidth(string(n.Literal))
-				textlength += l
+				t := string(n.Literal)
+				if m := cellListItem.FindStringSubmatch(t); m != nil {
+					t = "• " + m[1]
+				}
+				textlength += r.textWidth(t)
+			}
+		case *ast.HTMLSpan:
+			// a cell with <br> is as wide as its longest line
+			if intable && lineBreakTag.Match(n.Literal) {
+				linelength = max(linelength, textlength)
+				textlength = 0
+			}
+			if symbol, name, _ := iconSymbol(n.Literal); intable && name != "" {
+				textlength += r.textWidth(string(symbol))
 			}
 		}
 		return ast.GoToNext
@@ -722,12 +1108,20 @@ func (r *PdfRenderer) setStyler(s Styler) {
 	// see https://github.com/solworktech/md2pdf/issues/18#issuecomment-2179694815
 	// This does not address the root cause
 	// (https://github.com/solworktech/md2pdf/issues/18#issuecomment-2179694815)
-	// but it will correct all cases and is safer.
-	if s.Style == "bb" {
-		s.Style = "b"
+	// but it will correct all cases and is safer. The same goes for "ii",
+	// from emphasis in italic text such as a blockquote.
+	var style strings.Builder
+	for _, c := range strings.ToLower(s.Style) {
+		if !strings.ContainsRune(style.String(), c) {
+			style.WriteRune(c)
+		}
 	}
+	s.Style = style.String()
 	r.tracerStyle("setStyler", s)
-	r.Pdf.SetFont(s.Font, s.Style, s.Size)
+	r.Pdf.SetFont(r.fontFamily(s), s.Style, s.Size)
+	if r.revision != nil && r.RevisionText {
+		s.TextColor = r.RevisionColor
+	}
 	r.Pdf.SetTextColor(s.TextColor.Red, s.TextColor.Green, s.TextColor.Blue)
 	r.Pdf.SetFillColor(s.FillColor.Red, s.FillColor.Green, s.FillColor.Blue)
 }
@@ -735,19 +1129,38 @@ func (r *PdfRenderer) setStyler(s Styler) {
 func (r *PdfRenderer) write(s Styler, t string) {
 	// fmt.Printf("%s, %#v\n",t, s)
 	if r.tracerFile != "" && t != "\n" {
-		lineHeight := s.Size + s.Spacing
+		lineHeight := r.lineHeight(s)
 		r.tracer("write", fmt.Sprintf("text=\"%s\" | lineHeight=%.2f (size=%.1f + spacing=%.1f)",
 			strings.ReplaceAll(t, "\n", "\\n"), lineHeight, s.Size, s.Spacing))
 	}
-	r.Pdf.Write(s.Size+s.Spacing, t)
+	h := r.lineHeight(s)
+	r.numberLines(h, t, func(t string) { r.Pdf.Write(h, t) })
 }
 
 func (r *PdfRenderer) multiCell(s Styler, t string) {
-	r.Pdf.MultiCell(0, s.Size+s.Spacing, t, "", "", true)
+	r.Pdf.MultiCell(0, r.lineHeight(s), t, "", "", true)
 }
 
 func (r *PdfRenderer) writeLink(s Styler, display, url string) {
-	r.Pdf.WriteLinkString(s.Size+s.Spacing, display, url)
+	h := r.lineHeight(s)
+	if strings.HasPrefix(url, "#") {
+		if link, ok := r.headingAnchors[strings.TrimPrefix(url, "#")]; ok {
+			r.useLink(url, link)
+			r.numberLines(h, display, func(t string) { r.Pdf.WriteLinkID(h, t, link) })
+			return
+		}
+		r.brokenLink(url)
+	}
+	if link, ok := r.fileLink(url); ok {
+		if link == 0 {
+			r.brokenLink(url)
+		} else {
+			r.useLink(url, link)
+			r.numberLines(h, display, func(t string) { r.Pdf.WriteLinkID(h, t, link) })
+			return
+		}
+	}
+	r.numberLines(h, display, func(t string) { r.Pdf.WriteLinkString(h, t, url) })
 }
 
 // RenderNode is a default renderer of a single node of a syntax tree. For
@@ -782,6 +1195,20 @@ func (r *PdfRenderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.
 		r.tracerContext(nodeType, action, content)
 	}
 
+	switch node.(type) {
+	case *ast.Footnotes, *ast.ListItem:
+		if r.sidenoted(node) {
+			return ast.SkipChildren
+		}
+	}
+
+	if entering {
+		r.clearFloat(node)
+		r.turnPages(node)
+	}
+	r.revisionBar(node, entering, false)
+	defer r.revisionBar(node, entering, true)
+
 	switch node := node.(type) {
 	case *ast.Text:
 		r.processText(node)
@@ -807,13 +1234,13 @@ func (r *PdfRenderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.
 		inList := r.cs.peek().listkind != notlist
 
 		if !inList {
-			extraSpacing = 3.0 // Additional points between lines in regular paragraphs
+			extraSpacing = r.spacing(3.0, 0) // Additional points between lines in regular paragraphs
 		}
 
-		LH := style.Size + style.Spacing + extraSpacing
+		LH := r.lineHeight(style) + extraSpacing
 		if extraSpacing > 0 {
 			r.tracer("Hardbreak", fmt.Sprintf("Output newline with extra spacing (not in list)"))
-			r.tracer("cr()", fmt.Sprintf("LH=%.2f (normal=%.2f + extra=%.2f)", LH, style.Size+style.Spacing, extraSpacing))
+			r.tracer("cr()", fmt.Sprintf("LH=%.2f (normal=%.2f + extra=%.2f)", LH, r.lineHeight(style), extraSpacing))
 		} else {
 			r.tracer("Hardbreak", fmt.Sprintf("Output newline (in list, no extra spacing)"))
 			r.tracer("cr()", fmt.Sprintf("LH=%.2f", LH))
@@ -824,27 +1251,72 @@ func (r *PdfRenderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.
 	case *ast.Strong:
 		r.processStrong(node, entering)
 	case *ast.Del:
+		r.processDel(node, entering)
+	case *ast.NonBlockingSpace:
+		r.processNonBlockingSpace()
+	case *ast.Superscript:
+		r.processScript(node.Literal, true)
+	case *ast.Subscript:
+		r.processScript(node.Literal, false)
+	case *ast.Math:
+		r.processMath(node)
+	case *ast.Citation:
+		r.processCitation(node)
+	case *ast.CrossReference:
 		if entering {
-			r.tracer("DEL (entering)", "Not handled")
-		} else {
-			r.tracer("DEL (leaving)", "Not handled")
+			r.processCrossReference(node)
 		}
+	case *ast.Index:
+		// mmark index entries mark a place for an index, which is not made
+		r.dropped("index entry", node)
 	case *ast.HTMLSpan:
-		r.tracer("HTMLSpan", "Not handled")
+		if incell && lineBreakTag.Match(node.Literal) {
+			r.cs.peek().cellInnerString += "\n"
+			break
+		}
+		if r.processComment(node.Literal, false) || r.processInlineTag(node.Literal) || r.processIcon(node.Literal) {
+			break
+		}
+		if d, ok := parseDirective(node.Literal); ok {
+			r.processDirective(d)
+			break
+		}
+		r.dropped("inline HTML "+htmlTagName(node.Literal), node)
 	case *ast.Link:
+		if node.NoteID != 0 {
+			if entering {
+				r.processFootnoteRef(node)
+			}
+			break
+		}
 		r.processLink(*node, entering)
 	case *ast.Image:
-		r.processImage(*node, entering)
+		r.processImage(node, entering)
 	case *ast.Code:
 		r.processCode(node)
 	case *ast.Document:
 		r.tracer("Document", "Not Handled")
 	case *ast.Paragraph:
+		if entering && r.startFloat(node) || !entering && r.floated(node) {
+			return ast.SkipChildren
+		}
 		r.processParagraph(node, entering)
 	case *ast.BlockQuote:
 		r.processBlockQuote(node, entering)
+	case *ast.Aside:
+		r.processAside(entering)
+	case *ast.CaptionFigure:
+		r.processCaptionFigure(node, entering)
+	case *ast.Caption:
+		r.processCaption(entering)
+	case *ast.Callout:
+		r.processCallout(node)
+	case *ast.DocumentMatter:
+		r.tracer("DocumentMatter", "Not Handled")
 	case *ast.HTMLBlock:
 		r.processHTMLBlock(node)
+	case *detailsSummary:
+		r.processDetailsSummary(node)
 	case *ast.Heading:
 		r.processHeading(*node, entering)
 	case *ast.HorizontalRule:
@@ -859,16 +1331,21 @@ func (r *PdfRenderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.
 		r.processTable(node, entering)
 	case *ast.TableHeader:
 		r.processTableHead(node, entering)
-	case *ast.TableBody:
+	case *ast.TableBody, *ast.TableFooter:
 		r.processTableBody(node, entering)
 	case *ast.TableRow:
 		r.processTableRow(node, entering)
 	case *ast.TableCell:
 		r.processTableCell(*node, entering)
-	/*case *ast.Math:
-	r.processMath(node)*/
+	case *ast.MathBlock:
+		if entering {
+			r.processMathBlock(node)
+		}
+	case *ast.Footnotes:
+		r.processFootnotes(entering)
 	default:
-		fmt.Printf("Unknown node type: %T. Skipping\n", node)
+		r.logf("Unknown node type: %T. Skipping", node)
+		r.dropped(fmt.Sprintf("%T", node), node)
 	}
 
 	return ast.GoToNext
@@ -884,7 +1361,7 @@ func (r *PdfRenderer) RenderFooter(w io.Writer, _ ast.Node) {
 }
 
 func (r *PdfRenderer) cr() {
-	LH := r.cs.peek().textStyle.Size + r.cs.peek().textStyle.Spacing
+	LH := r.lineHeight(r.cs.peek().textStyle)
 	r.tracer("cr()", fmt.Sprintf("LH=%v", LH))
 	r.write(r.cs.peek().textStyle, "\n")
 }
@@ -897,6 +1374,25 @@ func (r *PdfRenderer) tracer(source, msg string) {
 	}
 }
 
+// logf reports a diagnostic (a warning or a note such as a downloaded
+// image) on stderr, through the log package, unless Quiet is set. The
+// renderer never writes to stdout, which may be a pipe.
+func (r *PdfRenderer) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	r.tracer("Diagnostic", msg)
+	if !r.Quiet {
+		log.Output(2, msg)
+	}
+}
+
+// SetQuiet silences the diagnostics the renderer prints on stderr; they
+// are still written to the trace file
+func SetQuiet(quiet bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Quiet = quiet
+	}
+}
+
 // tracerContext logs detailed context information for debugging
 func (r *PdfRenderer) tracerContext(nodeType, action, content string) {
 	if r.tracerFile != "" && r.w != nil && len(r.cs.stack) > 0 {
@@ -1013,6 +1509,23 @@ func isListLikeLine(line string) bool {
 	return false
 }
 
+// SetTabWidth sets the tab stops in code blocks, every width columns; tabs
+// are expanded to spaces before wrapping and highlighting. 0 keeps the tabs.
+func SetTabWidth(width int) RenderOption {
+	return func(r *PdfRenderer) {
+		r.TabWidth = width
+	}
+}
+
+// SetInputBaseDir sets the directory relative image paths are resolved
+// against, usually that of the input file. A <!-- basedir "dir" --> directive
+// changes it for the rest of the document, as for concatenated files.
+func SetInputBaseDir(dir string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.InputBaseDir = dir
+	}
+}
+
 // SetSyntaxHighlightBaseDir path to https://github.com/jessp01/gohighlight/tree/master/syntax_files
 func SetSyntaxHighlightBaseDir(path string) RenderOption {
 	return func(r *PdfRenderer) {
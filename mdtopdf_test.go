@@ -20,11 +20,29 @@
 package mdtopdf
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/parser"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"math/rand"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func testit(inputf string, gohighlight bool, t *testing.T) {
@@ -99,6 +117,10 @@ func TestLists(t *testing.T) {
 	testit("Ordered and unordered lists.md", false, t)
 }
 
+func TestNestedLists(t *testing.T) {
+	testit("Nested lists.md", false, t)
+}
+
 func TestStringEmph(t *testing.T) {
 	testit("Strong and em together.text", false, t)
 }
@@ -166,3 +188,2605 @@ func TestLinksShortcut(t *testing.T) {
 func TestTidyness(t *testing.T) {
 	testit("Tidyness.text", false, t)
 }
+
+func TestReservedZones(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	_, top, _, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+
+	z := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, HeaderHeight: 30, FooterHeight: 20})
+	_, ztop, _, _ := z.Pdf.GetMargins()
+	_, zbottom := z.Pdf.GetAutoPageBreak()
+	if ztop != top+30 {
+		t.Fatalf("expected top margin %v got %v", top+30, ztop)
+	}
+	if zbottom != bottom+20 {
+		t.Fatalf("expected page break margin %v got %v", bottom+20, zbottom)
+	}
+	if _, y := z.Pdf.GetXY(); y < ztop {
+		t.Fatalf("content starts inside header zone: y=%v", y)
+	}
+}
+
+func TestContinuedMarker(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("| Key | Value |\n|-----|-------|\n")
+	for i := 0; i < 120; i++ {
+		src.WriteString("| k | v |\n")
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	r.Extensions = parser.Tables
+	if err := r.Run([]byte(src.String())); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if r.Pdf.PageCount() < 2 {
+		t.Fatalf("expected table to span pages, got %d", r.Pdf.PageCount())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("(\\(continued\\))")) {
+		t.Fatalf("continued marker not found in output")
+	}
+}
+
+func TestCommentAnnotations(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	src := "# Review\n\n<!-- comment(alice): needs a second example -->\n\nText <!-- comment: inline --> here.\n\n<!-- plain comment -->\n"
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.annotations) != 2 {
+		t.Fatalf("expected 2 notes, got %d", len(r.annotations))
+	}
+	if !strings.Contains(r.annotations[0].entries, pdfTextString("needs a second example")) {
+		t.Fatalf("unexpected note %+v", r.annotations[0])
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := addAnnotations(buf.Bytes(), r.annotations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/Subtype /Text", "/Annots [", "/Prev ", pdfTextString("alice")} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Fatalf("%q not found in annotated output", want)
+		}
+	}
+}
+
+func TestFormFields(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	src := "Name: <!-- field text name=fullname -->\n\n<!-- field checkbox name=agree checked=true -->\n\n" +
+		"<!-- field dropdown name=colour options=\"Red, Green\" -->\n\n<!-- field signature -->\n\n<!-- field bogus -->\n"
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.annotations) != 4 {
+		t.Fatalf("expected 4 fields, got %d", len(r.annotations))
+	}
+	var buf bytes.Buffer
+	if err := r.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	for _, want := range []string{"/FT /Tx", "/FT /Btn /V /Yes", "/FT /Ch", "/FT /Sig", "/AcroForm <</Fields [",
+		pdfTextString("fullname"), pdfTextString("field4"), pdfTextString("Green")} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Fatalf("%q not found in output", want)
+		}
+	}
+}
+
+func TestFitTable(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	_, _, right, _ := r.Pdf.GetMargins()
+	pageWidth, _ := r.Pdf.GetPageSize()
+	avail := pageWidth - right - r.Pdf.GetX()
+	size := r.TBody.Size
+
+	// slightly too wide: shrink fonts and columns together
+	widths := r.fitTable([]float64{avail * 0.6, avail * 0.6})
+	if r.TBody.Size >= size || widths[0]+widths[1] > avail+0.01 {
+		t.Fatalf("table not shrunk: font %v, widths %v", r.TBody.Size, widths)
+	}
+	r.restoreTableStyles()
+	if r.TBody.Size != size {
+		t.Fatalf("table styles not restored: %v", r.TBody.Size)
+	}
+
+	// far too wide: stop at the minimum font size and narrow the columns
+	r.TableMinFontSize = size * 0.8
+	widths = r.fitTable([]float64{avail * 2, avail * 2})
+	if r.TBody.Size != size*0.8 || widths[0]+widths[1] > avail+0.01 {
+		t.Fatalf("expected minimum font and fitted columns: font %v, widths %v", r.TBody.Size, widths)
+	}
+	r.restoreTableStyles()
+
+	if w := r.fitTable([]float64{10, 10}); w[0] != 10 || r.tableStyles != nil {
+		t.Fatalf("narrow table should be left alone")
+	}
+}
+
+func TestEmojiMeasurement(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	r.setStyler(r.Normal)
+	if r.textWidth("a 🚀 [x]") != r.Pdf.GetStringWidth("a   ☑") {
+		t.Fatalf("emoji and task markers not measured as drawn")
+	}
+	src := "| A 🚀 | B |\n|---|---|\n| x 🚀 | [x] done |\n\nCode `x 🚀`\n\n```\nfn 🚀\n```\n"
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetStyle(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{
+		SetStyle("H1", WithFont("Helvetica", "b"), WithSize(24), WithTextColor(Color{0, 0, 139})),
+		SetStyle("Normal", WithSize(9), WithSpacing(2), WithFillColor(Color{250, 250, 240})),
+		SetStyle("Bogus", WithSize(1)),
+	}})
+	if r.H1.Font != "Helvetica" || r.H1.Size != 24 || r.H1.TextColor.Blue != 139 || r.H1.Spacing != 5 {
+		t.Fatalf("unexpected H1 style %+v", r.H1)
+	}
+	if r.cs.peek().textStyle != r.Normal || r.Normal.Size != 9 || r.Normal.FillColor.Blue != 240 {
+		t.Fatalf("normal style not applied: %+v", r.cs.peek().textStyle)
+	}
+}
+
+func TestFontFamily(t *testing.T) {
+	dir := t.TempDir()
+	data, err := fontFS.ReadFile("resources/fonts/roboto/Roboto-Regular.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, "Mono-Regular.ttf"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{
+		SetStyle("H1", WithFont("dejavu_sans", "b")),
+		SetStyle("Code", WithFont(path.Join(dir, "Mono-Regular.ttf"), "")),
+		SetStyle("Backtick", WithFont(path.Join(dir, "Missing.ttf"), "")),
+	}})
+	if f := r.fontFamily(r.H1); f != "DejaVuSans" {
+		t.Fatalf("preset font not resolved: %q", f)
+	}
+	if f := r.fontFamily(Styler{Font: r.Code.Font, Style: "bi"}); f != "Mono" {
+		t.Fatalf("TTF font not resolved: %q", f)
+	}
+	if f := r.fontFamily(r.Backtick); f != r.DefaultFont {
+		t.Fatalf("missing font should fall back to the default, got %q", f)
+	}
+	r.Extensions = parser.CommonExtensions
+	if err := r.Run([]byte("# Title\n\nText `code`\n\n    block\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCodeFont(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{
+		SetCodeFont("go_mono"), SetSyntaxHighlightBaseDir("./highlight/syntax_files")}})
+	r.Extensions = parser.CommonExtensions
+	if r.Backtick.Font != "go_mono" || r.Code.Font != "go_mono" {
+		t.Fatalf("code font not set: %q %q", r.Backtick.Font, r.Code.Font)
+	}
+	if err := r.Run([]byte("Text `code`\n\n```go\nfunc main() {}\n```\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !r.loadedFonts["GoMono"] {
+		t.Fatalf("code font not loaded: %v", r.loadedFonts)
+	}
+}
+
+func TestBoxDrawingCode(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	if s := codeStyle(r.Backtick, "main.go"); s.Font != r.Backtick.Font {
+		t.Fatalf("plain code should keep its font, got %q", s.Font)
+	}
+	if s := codeStyle(Styler{Font: "fonts/Mono.ttf"}, "├── a"); s.Font != "fonts/Mono.ttf" {
+		t.Fatalf("a TTF code font should be kept, got %q", s.Font)
+	}
+	if err := r.Run([]byte("```\n.\n├── cmd\n│   └── main.go\n└── go.mod\n```\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !r.loadedFonts["DejaVuSansMono"] {
+		t.Fatalf("box-drawing font not used: %v", r.loadedFonts)
+	}
+	r.setStyler(codeStyle(r.Backtick, "│"))
+	if r.Pdf.GetStringWidth("├──│") != 4*r.Pdf.GetStringWidth("a") {
+		t.Fatalf("box-drawing characters are not monospaced")
+	}
+}
+
+func TestDetailsBlocks(t *testing.T) {
+	src := "<details>\n<summary>More <b>info</b></summary>\n\nHidden **content**.\n\n<details><summary>Inner</summary>Deep</details>\n\n</details>\n\n" +
+		"```html\n<details><summary>Code</summary></details>\n```\n\n- item\n  <details><summary>Listed</summary>Body</details>\n\nAfter\n"
+	for _, collapse := range []bool{false, true} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetCollapseDetails(collapse)}})
+		r.Extensions = parser.CommonExtensions
+		s, blocks := extractDetails([]byte(src))
+		doc := markdown.Parse(s, parser.NewWithExtensions(r.Extensions))
+		r.detailsBlocks(doc, blocks)
+		var summaries []string
+		text := ""
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			switch n := node.(type) {
+			case *detailsSummary:
+				summaries = append(summaries, string(n.Literal))
+			case *ast.Text:
+				if entering {
+					text += string(n.Literal)
+				}
+			}
+			return ast.GoToNext
+		})
+		want := []string{"More info", "Inner", "Listed"}
+		if collapse {
+			want = []string{"More info", "Listed"}
+		}
+		if strings.Join(summaries, "|") != strings.Join(want, "|") {
+			t.Fatalf("collapse=%v: unexpected summaries %q", collapse, summaries)
+		}
+		if strings.Contains(text, "content") == collapse || !strings.Contains(text, "After") {
+			t.Fatalf("collapse=%v: unexpected text %q", collapse, text)
+		}
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKeyCaps(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	if !r.processInlineTag([]byte("<kbd>")) || !r.kbd || !r.processInlineTag([]byte("</KBD>")) || r.kbd {
+		t.Fatalf("kbd tags not tracked")
+	}
+	if r.processInlineTag([]byte("<span>")) {
+		t.Fatalf("unexpected inline tag handled")
+	}
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte("<kbd>Ctrl</kbd>+<kbd>C</kbd>\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// two key caps: bordered boxes filled in light grey
+	if r.kbd || bytes.Count(buf.Bytes(), []byte("0.961 g\n0.60 w")) < 2 {
+		t.Fatalf("key caps not drawn")
+	}
+}
+
+func TestMarkedText(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Extensions = parser.CommonExtensions
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte("Some ==" + strings.Repeat("highlighted words ", 30) + "end== and <mark>more</mark>.\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// the background follows the text over several lines
+	if r.mark || !bytes.Contains(buf.Bytes(), []byte("1.000 0.925 0.549 rg")) || bytes.Count(buf.Bytes(), []byte(" re f q")) < 3 {
+		t.Fatalf("marked text not drawn on its background")
+	}
+}
+
+func TestHeadingAttributes(t *testing.T) {
+	src := "# Preface {.unnumbered .notoc}\n\nSee [intro](#intro).\n\n# Intro {#intro .pagebreak level=1}\n\n## Sub\n\n# Other {.unnumbered}\n\n# Last\n"
+	entries, err := GetTOCEntries([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, strings.TrimSpace(e.Number+" "+e.Title))
+	}
+	if strings.Join(got, "|") != "1 Intro|1.1 Sub|Other|2 Last" {
+		t.Fatalf("unexpected TOC %q", got)
+	}
+
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetHeadingNumbering(true)}})
+	r.Extensions = parser.CommonExtensions
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Pdf.PageCount() != 2 {
+		t.Fatalf("expected a page break before Intro, got %d pages", r.Pdf.PageCount())
+	}
+	if _, ok := r.headingAnchors["intro"]; !ok {
+		t.Fatalf("heading ID not recorded: %v", r.headingAnchors)
+	}
+}
+
+func TestASTTransformer(t *testing.T) {
+	var headings []string
+	dropSecret := func(doc *ast.Node) error {
+		ast.WalkFunc(*doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if h, ok := node.(*ast.Heading); ok && entering {
+				headings = append(headings, string(h.Children[0].(*ast.Text).Literal))
+			}
+			if p, ok := node.(*ast.Paragraph); ok && entering {
+				if text, ok := p.Children[0].(*ast.Text); ok && strings.HasPrefix(string(text.Literal), "SECRET") {
+					ast.RemoveFromTree(p)
+				}
+			}
+			return ast.GoToNext
+		})
+		return nil
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{WithASTTransformer(dropSecret)}})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte("# Title {.unnumbered}\n\nSECRET plans\n\nPublic text\n")); err != nil {
+		t.Fatal(err)
+	}
+	if len(headings) != 1 || headings[0] != "Title" {
+		t.Fatalf("transformer did not see the parsed heading: %q", headings)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("SECRET")) || !bytes.Contains(buf.Bytes(), []byte("Public")) {
+		t.Fatal("transformer changes were not rendered")
+	}
+
+	failing := func(doc *ast.Node) error { return os.ErrInvalid }
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{WithASTTransformer(failing)}})
+	if err := r.Run([]byte("text\n")); err == nil || !strings.Contains(err.Error(), "AST transformer 1") {
+		t.Fatalf("expected the transformer error, got %v", err)
+	}
+}
+
+func TestPreprocessors(t *testing.T) {
+	var names []string
+	for _, p := range NewPdfRenderer(PdfRendererParams{Theme: LIGHT}).Preprocessors {
+		names = append(names, p.Name)
+	}
+	want := []string{FrontMatterPreprocessor, CheckboxSpacingPreprocessor, ConditionsPreprocessor, TemplatesPreprocessor, ShortcodesPreprocessor, MarksPreprocessor}
+	if !slices.Equal(names, want) {
+		t.Fatalf("built-in preprocessors %q, want %q", names, want)
+	}
+
+	var seen string
+	finalize := func(content []byte) ([]byte, error) {
+		seen = string(content)
+		return bytes.ReplaceAll(content, []byte("draft"), []byte("final")), nil
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{
+		WithoutPreprocessor(MarksPreprocessor),
+		WithPreprocessor("final", finalize),
+	}})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte("A ==draft== text\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if seen != "A ==draft== text\n" {
+		t.Fatalf("preprocessor got %q", seen)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("==final==")) {
+		t.Fatal("preprocessed source was not rendered")
+	}
+
+	failing := func(content []byte) ([]byte, error) { return nil, os.ErrInvalid }
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{WithPreprocessor("failing", failing)}})
+	if err := r.Run([]byte("text\n")); !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), "preprocessor failing") {
+		t.Fatalf("expected the preprocessor error, got %v", err)
+	}
+}
+
+func TestValidateTheme(t *testing.T) {
+	for _, file := range []string{"custom_themes/light_theme.json", "custom_themes/dark_theme.json"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems, err := ValidateTheme(data); err != nil || len(problems) > 0 {
+			t.Fatalf("%s: %v %q", file, err, problems)
+		}
+	}
+	theme := `{"normal": {"Font": "Comic", "Style": "bx", "Size": 0, "Colour": 1,
+		"TextColor": {"Red": 300}}, "Bogus": 1, "IndentValue": "wide"}`
+	problems, err := ValidateTheme([]byte(theme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"H1: missing", "Bogus: unknown key", "IndentValue: json", "normal.Colour: unknown attribute",
+		`normal.Font: "Comic"`, `normal.Style: "bx"`, "normal.Size: 0", "normal.TextColor: {300, 0, 0}"} {
+		if !slices.ContainsFunc(problems, func(p string) bool { return strings.HasPrefix(p, want) }) {
+			t.Errorf("no problem %q in %q", want, problems)
+		}
+	}
+	if slices.ContainsFunc(problems, func(p string) bool { return strings.HasPrefix(p, "Normal: missing") }) {
+		t.Error("keys are matched without regard to case, as by encoding/json")
+	}
+	if _, err := ValidateTheme([]byte("[]")); !errors.Is(err, ErrParse) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+}
+
+func TestThemeColors(t *testing.T) {
+	theme := `{"BackgroundColor": "#000", "MarkColor": "rgb(1, 2, 3)",
+		"Normal": {"TextColor": "#1a2b3c", "FillColor": "RebeccaPurple"},
+		"H1": {"TextColor": "rgba(255, 255, 255, 0.5)", "FillColor": {"Red": 4, "Green": 5, "Blue": 6}}}`
+	var r PdfRenderer
+	if err := r.loadTheme([]byte(theme)); err != nil {
+		t.Fatal(err)
+	}
+	for name, got := range map[string][2]Color{
+		"BackgroundColor":  {r.BackgroundColor, {0, 0, 0}},
+		"MarkColor":        {r.MarkColor, {1, 2, 3}},
+		"Normal.TextColor": {r.Normal.TextColor, {0x1a, 0x2b, 0x3c}},
+		"Normal.FillColor": {r.Normal.FillColor, {102, 51, 153}},
+		"H1.TextColor":     {r.H1.TextColor, {128, 128, 128}}, // tinted over the black background
+		"H1.FillColor":     {r.H1.FillColor, {4, 5, 6}},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("%s: %v, want %v", name, got[0], got[1])
+		}
+	}
+	if c := Colorlookup("rgba(0, 0, 0, 0.25)"); c != (Color{191, 191, 191}) {
+		t.Errorf("rgba over white: %v", c)
+	}
+	problems, err := ValidateTheme([]byte(`{"Normal": {"TextColor": "#12345"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(problems, func(p string) bool { return strings.Contains(p, `invalid color "#12345"`) }) {
+		t.Errorf("no invalid color problem in %q", problems)
+	}
+}
+
+func TestFontCoverage(t *testing.T) {
+	names := PresetFontNames()
+	if !slices.IsSorted(names) || !slices.Contains(names, "roboto") {
+		t.Fatalf("preset fonts %q", names)
+	}
+	coverage := map[string]string{}
+	for _, name := range names {
+		scripts, err := FontCoverage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, script := range scripts {
+			s = append(s, script.Name)
+		}
+		coverage[name] = strings.Join(s, " ")
+	}
+	if coverage["dejavu_sans"] != "Latin Cyrillic Greek" || coverage["merriweather"] != "Latin Cyrillic" {
+		t.Fatalf("coverage %v", coverage)
+	}
+	if _, err := FontCoverage("bogus"); !errors.Is(err, ErrFont) {
+		t.Fatalf("expected a font error, got %v", err)
+	}
+}
+
+// widePNG writes a PNG wider than any page, 3000 by 100 pixels, and
+// returns its path
+func widePNG(t *testing.T) string {
+	wide := filepath.Join(t.TempDir(), "wide.png")
+	f, err := os.Create(wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 3000, 100))); err != nil {
+		t.Fatal(err)
+	}
+	return wide
+}
+
+func TestLandscapeLayout(t *testing.T) {
+	wide := widePNG(t)
+	placed := regexp.MustCompile(`q ([\d.]+) 0 0 [\d.]+ [\d.]+ [\d.]+ cm /I`)
+	for _, orientation := range []string{"portrait", "landscape"} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Orientation: orientation, Papersz: "A4"})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte("![wide](" + wide + ")\n")); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		m := placed.FindSubmatch(buf.Bytes())
+		if m == nil {
+			t.Fatalf("%s: image not drawn", orientation)
+		}
+		pageWidth, _ := r.Pdf.GetPageSize()
+		left, _, right, _ := r.Pdf.GetMargins()
+		if w, _ := strconv.ParseFloat(string(m[1]), 64); math.Abs(w-(pageWidth-left-right)) > 0.5 {
+			t.Fatalf("%s: image %.1f wide, want the content width %.1f", orientation, w, pageWidth-left-right)
+		}
+	}
+}
+
+func TestMarginsDirective(t *testing.T) {
+	wide := widePNG(t)
+	src := "![a](" + wide + ")\n\n<!-- margins left=5mm right=5mm -->\n\n![b](" + wide + ")\n\n" +
+		"<!-- /margins -->\n\n![c](" + wide + ")\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4"})
+	r.Pdf.SetCompression(false)
+	left, top, right, _ := r.Pdf.GetMargins()
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pageWidth, _ := r.Pdf.GetPageSize()
+	mm := 72 / 25.4
+	want := []float64{pageWidth - left - right, pageWidth - 10*mm, pageWidth - left - right}
+	placed := regexp.MustCompile(`q ([\d.]+) 0 0 [\d.]+ ([\d.]+) [\d.]+ cm /I`).FindAllSubmatch(buf.Bytes(), -1)
+	if len(placed) != len(want) {
+		t.Fatalf("%d images drawn, want %d", len(placed), len(want))
+	}
+	for i, m := range placed {
+		if w, _ := strconv.ParseFloat(string(m[1]), 64); math.Abs(w-want[i]) > 0.5 {
+			t.Errorf("image %d is %.1f wide, want %.1f", i, w, want[i])
+		}
+	}
+	if x, _ := strconv.ParseFloat(string(placed[1][2]), 64); math.Abs(x-5*mm) > 0.5 {
+		t.Errorf("image in the region starts at %.1f, want %.1f", x, 5*mm)
+	}
+	if l, tp, rt, _ := r.Pdf.GetMargins(); l != left || tp != top || rt != right {
+		t.Errorf("margins %v %v %v after the region, want %v %v %v", l, tp, rt, left, top, right)
+	}
+}
+
+func TestPanels(t *testing.T) {
+	long := strings.Repeat("Output line.\n\n", 60)
+	src := "Intro\n\n<!-- panel Example -->\n\n```go\nfmt.Println(1)\n```\n\n<!-- /panel -->\n\n" +
+		"<!-- panel Output -->\n\n" + long + "<!-- /panel -->\n\nAfter\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	left, _, right, _ := r.Pdf.GetMargins()
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{"(Example)Tj", "(Output)Tj"} {
+		if !bytes.Contains(buf.Bytes(), []byte(label)) {
+			t.Errorf("label %s not drawn", label)
+		}
+	}
+	// sides on each page a panel is on, top and bottom where it starts and ends
+	pageWidth, _ := r.Pdf.GetPageSize()
+	sides := regexp.MustCompile(`([\d.]+) [\d.]+ m ([\d.]+) [\d.]+ l S`).FindAllSubmatch(buf.Bytes(), -1)
+	var vertical, horizontal int
+	for _, m := range sides {
+		x0, _ := strconv.ParseFloat(string(m[1]), 64)
+		x1, _ := strconv.ParseFloat(string(m[2]), 64)
+		switch {
+		case x0 == x1 && (math.Abs(x0-left) < 0.01 || math.Abs(x0-(pageWidth-right)) < 0.01):
+			vertical++
+		case math.Abs(x0-left) < 0.01 && math.Abs(x1-(pageWidth-right)) < 0.01:
+			horizontal++
+		}
+	}
+	// the second panel runs from the first page to the last
+	if pages := r.Pdf.PageCount(); pages < 2 || vertical != 2+2*pages || horizontal != 4 {
+		t.Errorf("%d sides and %d tops and bottoms drawn on %d pages", vertical, horizontal, pages)
+	}
+	inside := regexp.MustCompile(`BT ([\d.]+) [\d.]+ Td \((fmt|Output line|After)`).FindAllSubmatch(buf.Bytes(), -1)
+	for _, m := range inside {
+		x, _ := strconv.ParseFloat(string(m[1]), 64)
+		if in := string(m[2]) != "After"; in != (x > left+r.panelPadding()) {
+			t.Errorf("%s at %.2f, inside a panel: %v", m[2], x, in)
+		}
+	}
+	if l, _, rt, _ := r.Pdf.GetMargins(); l != left || rt != right || len(r.cs.stack) != 1 {
+		t.Errorf("margins %v %v and %d states after the panels", l, rt, len(r.cs.stack))
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	src := "<!-- place top right width=70mm -->\nACME Ltd\\\nMain Street 1\n<!-- /place -->\n\n# Invoice\n\nBody text.\n\n" +
+		"<!-- place bottom height=30mm -->\n\n| Bank | IBAN |\n|---|---|\n| First | DE00 |\n\n<!-- /place -->\n\nMore text.\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4"})
+	r.Pdf.SetCompression(false)
+	left, top, right, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// PDF coordinates grow upwards from the bottom of the page
+	pos := map[string][2]float64{}
+	for _, m := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \(([\w. ]+)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+		x, _ := strconv.ParseFloat(string(m[1]), 64)
+		y, _ := strconv.ParseFloat(string(m[2]), 64)
+		pos[string(m[3])] = [2]float64{x, y}
+	}
+	pageWidth, pageHeight := r.Pdf.GetPageSize()
+	mm := 72 / 25.4
+	if x := pos["ACME Ltd"][0]; math.Abs(x-(pageWidth-right-70*mm)) > 5 {
+		t.Errorf("address at x %.2f, want the right margin less 70mm", x)
+	}
+	if y := pos["ACME Ltd"][1]; y < pageHeight-top-30 || y > pageHeight-top {
+		t.Errorf("address at y %.2f, not at the top margin", y)
+	}
+	if y := pos["First"][1]; y < bottom || y > bottom+30*mm {
+		t.Errorf("table at y %.2f, not in the 30mm above the bottom margin", y)
+	}
+	if pos["Invoice"][0] > left+5 || pos["More text."][1] >= pos["Body text."][1] || pos["More text."][1] < pageHeight/2 {
+		t.Errorf("text flow moved by the regions: %v", pos)
+	}
+	if l, tp, rt, _ := r.Pdf.GetMargins(); l != left || tp != top || rt != right || len(r.cs.stack) != 1 {
+		t.Errorf("margins %v %v %v and %d states after the regions", l, tp, rt, len(r.cs.stack))
+	}
+}
+
+func TestSidenotes(t *testing.T) {
+	src := "Some text with a note[^a] and another[^b].\n\n[^a]: First note, long enough to wrap onto more than one line in the margin.\n[^b]: Second note.\n"
+	render := func(src string) (map[string][2]float64, float64) {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{SetSidenotes(true)}})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		pos := map[string][2]float64{}
+		for _, m := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \(([^)]*)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+			x, _ := strconv.ParseFloat(string(m[1]), 64)
+			y, _ := strconv.ParseFloat(string(m[2]), 64)
+			pos[string(m[3])] = [2]float64{x, y}
+		}
+		pageWidth, _ := r.Pdf.GetPageSize()
+		return pos, pageWidth
+	}
+
+	pos, pageWidth := render("<!-- margins right=60mm -->\n\n" + src + "<!-- /margins -->\n")
+	first, second := pos["1 First note, long enough to wrap onto"], pos["2 Second note."]
+	if first[0] < pageWidth-60*72/25.4 || second[0] != first[0] {
+		t.Errorf("sidenotes at x %.2f and %.2f, not in the right margin", first[0], second[0])
+	}
+	if line := pos["Some text with a note"][1]; math.Abs(first[1]-line) > 5 {
+		t.Errorf("first sidenote at y %.2f, not level with its reference at %.2f", first[1], line)
+	}
+	if second[1] >= pos["more than one line in the margin."][1] {
+		t.Errorf("second sidenote at y %.2f overlaps the first", second[1])
+	}
+	if _, ok := pos["First note, long enough to wrap onto more than one line in the margin."]; ok {
+		t.Error("sidenote also set as a footnote")
+	}
+
+	// the default margin is too narrow: the notes stay footnotes
+	pos, _ = render(src)
+	if note, ok := pos["Second note."]; !ok || note[0] > pageWidth/2 {
+		t.Errorf("narrow margin: footnote not in the text, got %v", pos)
+	}
+}
+
+func TestLineNumbers(t *testing.T) {
+	src := "# Agreement\n\nThis agreement is made between the parties named below, who agree to the terms that follow, " +
+		"which are long enough to wrap over more than one line of body text.\n\n- First item\n- Second item\n\n" +
+		strings.Repeat("Clause.\n\n", 40) + "```\ncode is not numbered\n```\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{SetLineNumbers(true)}})
+	r.Pdf.SetCompression(false)
+	left, _, _, _ := r.Pdf.GetMargins()
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if r.Pdf.PageCount() != 2 {
+		t.Fatalf("%d pages, want 2", r.Pdf.PageCount())
+	}
+	var numbers []int
+	var textY []float64
+	for _, m := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \(([^)]*)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+		x, _ := strconv.ParseFloat(string(m[1]), 64)
+		y, _ := strconv.ParseFloat(string(m[2]), 64)
+		n, err := strconv.Atoi(string(m[3]))
+		if err != nil || x >= left {
+			textY = append(textY, y)
+			continue
+		}
+		numbers = append(numbers, n)
+		if !slices.ContainsFunc(textY, func(ty float64) bool { return math.Abs(ty-y) < 4 }) {
+			t.Errorf("line number %d at y %.2f is not beside a line of text", n, y)
+		}
+	}
+	// page 1: heading, two lines of the paragraph, two items and clauses;
+	// page 2 starts again from 1 and leaves out the code block
+	var want []int
+	for _, count := range []int{len(r.textLines[1]), len(r.textLines[2])} {
+		for n := 1; n <= count; n++ {
+			want = append(want, n)
+		}
+	}
+	if len(r.textLines[1]) < 6 || !slices.Equal(numbers, want) {
+		t.Errorf("line numbers %v, want %v", numbers, want)
+	}
+	// the bullets and the code block line are not numbered
+	if len(textY) != len(numbers)+3 {
+		t.Errorf("%d pieces of text for %d numbers", len(textY), len(numbers))
+	}
+}
+
+func TestBates(t *testing.T) {
+	src := "First page\n\n---\n\nSecond page\n\n---\n\nThird page\n"
+	for _, corner := range []string{"bottom-right", "top-left"} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{IsHorizontalRuleNewPage(true), SetBates("ABC", 1000), SetBatesCorner(corner)}})
+		r.Pdf.SetCompression(false)
+		m := r.currentMargins()
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		pageWidth, pageHeight := r.Pdf.GetPageSize()
+		var numbers []string
+		for _, s := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \((ABC\d+)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+			x, _ := strconv.ParseFloat(string(s[1]), 64)
+			y, _ := strconv.ParseFloat(string(s[2]), 64)
+			numbers = append(numbers, string(s[3]))
+			// PDF coordinates grow upwards from the bottom of the page
+			inCorner := x > pageWidth/2 && y < m.bottom
+			if corner == "top-left" {
+				inCorner = x < m.left+10 && y > pageHeight-m.top
+			}
+			if !inCorner {
+				t.Errorf("%s: %s at %.2f, %.2f", corner, s[3], x, y)
+			}
+		}
+		if want := []string{"ABC001000", "ABC001001", "ABC001002"}; !slices.Equal(numbers, want) {
+			t.Errorf("%s: Bates numbers %v, want %v", corner, numbers, want)
+		}
+	}
+}
+
+func TestPageText(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000") // 2023-11-14 22:13 UTC
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{IsHorizontalRuleNewPage(true),
+		SetHeaderText("Report | {datetime:2 January 2006} | {page}/{pages}"), SetFooterText("built {date} {time}"),
+		SetTimeZone("Asia/Tokyo"), SetLocale("fr")}})
+	r.Pdf.SetCompression(false)
+	m := r.currentMargins()
+	if err := r.Run([]byte("First page\n\n---\n\nSecond page\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pageWidth, pageHeight := r.Pdf.GetPageSize()
+	var texts []string
+	for _, s := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \(([^)]*)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+		x, _ := strconv.ParseFloat(string(s[1]), 64)
+		y, _ := strconv.ParseFloat(string(s[2]), 64)
+		text := string(s[3])
+		// PDF coordinates grow upwards from the bottom of the page
+		where := "body"
+		switch {
+		case y > pageHeight-m.top:
+			where = "header"
+		case y < m.bottom:
+			where = "footer"
+		}
+		switch {
+		case x < pageWidth/3:
+			where += " left"
+		case x > pageWidth*2/3:
+			where += " right"
+		}
+		texts = append(texts, where+": "+text)
+	}
+	want := []string{"body left: First page", "header left: Report", "header: 15 novembre 2023", "header right: 1/2", "footer: built 2023-11-15 07:13",
+		"body left: Second page", "header left: Report", "header: 15 novembre 2023", "header right: 2/2", "footer: built 2023-11-15 07:13"}
+	if !slices.Equal(texts, want) {
+		t.Errorf("got %q, want %q", texts, want)
+	}
+}
+
+func TestWideTables(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("| Key |")
+	for i := 1; i <= 9; i++ {
+		fmt.Fprintf(&src, " Column number %d heading |", i)
+	}
+	src.WriteString("\n|---|" + strings.Repeat("---|", 9) + "\n")
+	for row := 1; row <= 2; row++ {
+		fmt.Fprintf(&src, "| k%d |", row)
+		for i := 1; i <= 9; i++ {
+			fmt.Fprintf(&src, " value %d.%d of the row |", row, i)
+		}
+		src.WriteString("\n")
+	}
+	for _, mode := range WideTableModes {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{SetWideTables(mode)}})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte(src.String())); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		keys, values := 0, map[string]int{}
+		for _, m := range regexp.MustCompile(`\((k1|value [\d.]+ of the row)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+			if string(m[1]) == "k1" {
+				keys++
+			} else {
+				values[string(m[1])]++
+			}
+		}
+		switch mode {
+		case "shrink":
+			// the narrowed cells wrap
+			if len(values) != 0 {
+				t.Errorf("shrink: values not wrapped: %v", values)
+			}
+		case "auto":
+			// too wide even in landscape: split as above, with a warning
+			if keys != 3 || len(values) != 18 || r.landscapeTables != nil {
+				t.Errorf("auto: key column drawn %d times, %d whole values, landscape %v", keys, len(values), r.landscapeTables)
+			}
+		case "split":
+			if keys != 3 || len(values) != 18 {
+				t.Errorf("split: key column drawn %d times, %d whole values: %v", keys, len(values), values)
+			}
+			for v, n := range values {
+				if n != 1 {
+					t.Errorf("split: %q drawn %d times", v, n)
+				}
+			}
+		}
+	}
+}
+
+func TestWideTablesLandscape(t *testing.T) {
+	var table strings.Builder
+	table.WriteString("|")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&table, " Column number %d heading |", i)
+	}
+	table.WriteString("\n|" + strings.Repeat("---|", 5) + "\n|")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&table, " value %d of the row |", i)
+	}
+	src := "Intro\n\n" + table.String() + "\n\nOutro\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{SetWideTables("auto"), SetTableMinFontSize(11)}})
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var orientations string
+	for page := 1; page <= r.Pdf.PageCount(); page++ {
+		if w, h, _ := r.Pdf.PageSize(page); w > h {
+			orientations += "L"
+		} else {
+			orientations += "P"
+		}
+	}
+	if orientations != "PLP" {
+		t.Errorf("pages %s, want the table on a landscape page of its own", orientations)
+	}
+}
+
+func TestFactory(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFactory(PdfRendererParams{Theme: CUSTOM, CustomThemeFile: "custom_themes/dark_theme.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, src := range []string{"First document\n", "Second document\n"} {
+		pdf := filepath.Join(dir, fmt.Sprintf("doc%d.pdf", i))
+		r := f.New(pdf, SetVerifyText(true))
+		if r.Normal.TextColor.Red != 255 {
+			t.Errorf("document %d: Normal text color %v, want the dark theme's white", i, r.Normal.TextColor)
+		}
+		if err := r.Process([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.TextError(); err != nil {
+			t.Error(err)
+		}
+		if err := r.Process([]byte(src)); !errors.Is(err, ErrReused) {
+			t.Errorf("document %d: second Process returned %v, want ErrReused", i, err)
+		}
+		if err := r.Run([]byte(src)); !errors.Is(err, ErrReused) {
+			t.Errorf("document %d: Run after Process returned %v, want ErrReused", i, err)
+		}
+	}
+
+	if _, err := NewFactory(PdfRendererParams{PresetFont: "no_such_font"}); !errors.Is(err, ErrFont) {
+		t.Errorf("unknown preset font: got %v, want ErrFont", err)
+	}
+	if _, err := NewFactory(PdfRendererParams{Theme: CUSTOM, CustomThemeFile: filepath.Join(dir, "missing.json")}); !errors.Is(err, ErrIO) {
+		t.Errorf("missing theme: got %v, want ErrIO", err)
+	}
+	theme := filepath.Join(dir, "theme.json")
+	if err := os.WriteFile(theme, []byte(`{"Normal": {"Size": "big"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFactory(PdfRendererParams{Theme: CUSTOM, CustomThemeFile: theme}); !errors.Is(err, ErrParse) {
+		t.Errorf("invalid theme: got %v, want ErrParse", err)
+	}
+}
+
+func TestAutoLandscape(t *testing.T) {
+	var table strings.Builder
+	table.WriteString("|")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&table, " Column number %d heading |", i)
+	}
+	table.WriteString("\n|" + strings.Repeat("---|", 5) + "\n|")
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(&table, " value %d of the row |", i)
+	}
+	src := "Intro\n\n" + table.String() + "\n\n" + table.String() + "\n\nOutro\n"
+	for _, auto := range []bool{false, true} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Papersz: "A4", Opts: []RenderOption{SetAutoLandscape(auto)}})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var orientations string
+		for page := 1; page <= r.Pdf.PageCount(); page++ {
+			if w, h, _ := r.Pdf.PageSize(page); w > h {
+				orientations += "L"
+			} else {
+				orientations += "P"
+			}
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		// the last column is beyond the width of a portrait page in landscape
+		var right []float64
+		for _, m := range regexp.MustCompile(`BT ([\d.]+) [\d.]+ Td \(value 5 of the row\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+			x, _ := strconv.ParseFloat(string(m[1]), 64)
+			right = append(right, x)
+		}
+		portrait, _, _ := r.Pdf.PageSize(1)
+		switch {
+		case len(right) != 2:
+			t.Errorf("auto %v: last column drawn at %v, want 2 tables", auto, right)
+		case !auto && (orientations != "P" || right[0] > portrait || right[1] > portrait):
+			t.Errorf("off: pages %s, last column at %v, want P and the tables shrunk", orientations, right)
+		case auto && (orientations != "PLP" || right[0] < portrait || right[1] < portrait):
+			t.Errorf("on: pages %s, last column at %v, want PLP and full size tables", orientations, right)
+		}
+	}
+}
+
+func TestDocumentTitle(t *testing.T) {
+	for src, want := range map[string]string{
+		"Intro\n\n## Setup\n\n# My *Project*\n\n# Other\n": "My Project",
+		"## Only a section\n":                              "",
+	} {
+		if got := DocumentTitle([]byte(src)); got != want {
+			t.Errorf("%q: title %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestTOCEntries(t *testing.T) {
+	// a block attribute only with the mmark dialect
+	src := []byte("{.redact}\n# Secret\n\n# Intro\n")
+	for dialect, want := range map[string][]string{
+		"default": {"Secret", "Intro"},
+		"mmark":   {"Intro"},
+	} {
+		r := NewPdfRenderer(PdfRendererParams{Opts: []RenderOption{SetDialect(dialect)}})
+		entries, err := r.TOCEntries(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Title)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: entries %q, want %q", dialect, got, want)
+		}
+	}
+}
+
+func TestPartBookmark(t *testing.T) {
+	src := "<!-- bookmark title=\"Part one\" -->\n\n# Intro\n\n## Setup\n\ntext\n\n" +
+		"<!-- bookmark title=\"Part two\" -->\n\n### Notes\n\ntext\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", Opts: []RenderOption{SetBookmarks(true)}})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// the object and the parent of each outline item
+	objs := map[string]string{}
+	parents := map[string]string{}
+	re := regexp.MustCompile(`(\d+) 0 obj\s*<</Title \(([^)]*)\)\s*/Parent (\d+) 0 R`)
+	for _, m := range re.FindAllStringSubmatch(buf.String(), -1) {
+		objs[m[2]] = m[1]
+		parents[m[2]] = m[3]
+	}
+	if len(objs) != 5 {
+		t.Fatalf("expected 5 bookmarks, got %v", objs)
+	}
+	for child, parent := range map[string]string{"Intro": "Part one", "Setup": "Intro", "Notes": "Part two"} {
+		if parents[child] != objs[parent] {
+			t.Errorf("%q is not below %q: %v %v", child, parent, objs, parents)
+		}
+	}
+	if parents["Part one"] != parents["Part two"] {
+		t.Errorf("parts are not both top-level: %v", parents)
+	}
+}
+
+func TestLinkError(t *testing.T) {
+	src := "<!-- file \"a.md\" -->\n\n# Intro {#intro}\n\n" +
+		"See [the intro](#intro), [setup](#setpu), @fig:missing, [b](b.md) and [b's setup](b.md#setpu).\n\n" +
+		"<!-- file \"b.md\" -->\n\n# Setup\n\ntext\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetQuiet(true)}})
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	err := r.LinkError()
+	if !errors.Is(err, ErrLink) {
+		t.Fatalf("expected %v, got %v", ErrLink, err)
+	}
+	want := "broken link: 3 links without a target: #setpu, @fig:missing, b.md#setpu"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	if err := r.Run([]byte("# Intro {#intro}\n\nSee [the intro](#intro).\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LinkError(); err != nil {
+		t.Errorf("expected no broken links, got %v", err)
+	}
+}
+
+func TestBreakHint(t *testing.T) {
+	target := "Target start " + strings.Repeat("of a paragraph that should stay on one page. ", 8) + "Target end."
+	render := func(filler int, hint string) []string {
+		src := strings.Repeat("Filler line.\n\n", filler) + hint + "\n\n" + target + "\n\n" + hint + "\n\nAfter.\n"
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		pages, err := ExtractText(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pages
+	}
+	split := func(pages []string) bool {
+		for _, p := range pages {
+			if strings.Contains(p, "Target start") {
+				return !strings.Contains(p, "Target end")
+			}
+		}
+		return true
+	}
+	splitWithout := false
+	for filler := 20; filler < 34; filler++ {
+		if split(render(filler, "<!-- break-hint -->")) {
+			t.Errorf("paragraph split after %d filler lines, despite the hint before it", filler)
+		}
+		if split(render(filler, "<!-- break-hint need=1mm -->")) {
+			splitWithout = true
+		}
+	}
+	if !splitWithout {
+		t.Error("expected the paragraph to be split without a hint asking for enough space")
+	}
+	if pages := render(0, "<!-- break-hint -->"); len(pages) != 1 {
+		t.Errorf("expected 1 page when everything fits, got %d", len(pages))
+	}
+}
+
+func TestFileLinks(t *testing.T) {
+	// two files of a directory input, each with a Setup heading
+	src := "<!-- file \"docs/a.md\" -->\n\n# Intro\n\n" +
+		"See [setup](guide/b.md#setup), [the guide](guide/b.md) and [elsewhere](https://example.com/b.md#setup).\n\n" +
+		"## Setup\n\ntext\n\n" +
+		"<!-- file \"docs/guide/b.md\" -->\n\n# Guide {.pagebreak}\n\n## Setup\n\nBack to [the intro](../a.md#intro).\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var pages []string
+	for _, m := range regexp.MustCompile(`/Dest \[(\d+) 0 R|/URI \(([^)]*)\)`).FindAllStringSubmatch(buf.String(), -1) {
+		if m[2] != "" {
+			pages = append(pages, m[2])
+		} else {
+			pages = append(pages, "page "+m[1])
+		}
+	}
+	// page 1 is object 3, page 2 object 5
+	want := []string{"page 5", "page 5", "https://example.com/b.md#setup", "page 3"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("links go to %v, want %v", pages, want)
+	}
+}
+func TestWikiLinks(t *testing.T) {
+	// the vault, with an image outside it
+	top := t.TempDir()
+	dir := filepath.Join(top, "vault")
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{filepath.Join(dir, "attachments", "Logo.png"), filepath.Join(top, "secret.png")} {
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a.md"), filepath.Join(dir, "notes", "Guide.md")
+	src := "<!-- file \"" + a + "\" -->\n\n# Intro\n\n" +
+		"See [[Guide#Setup|setup]], [[notes/guide]], [[Missing]] and ![[logo.png|30]].\n\n" +
+		"<!-- file \"" + b + "\" -->\n\n# Guide {.pagebreak}\n\n## Setup\n\nBack to [[a#Intro]] and [[#Setup]]. ![[../../secret.png]]\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ImageError(); err == nil || !strings.Contains(err.Error(), "secret.png: outside the input directory") || strings.Contains(err.Error(), "2 images") {
+		t.Fatalf("expected only the image outside the vault to be left out: %v", err)
+	}
+	if err := r.LinkError(); err == nil || !strings.Contains(err.Error(), "[[Missing]]") {
+		t.Fatalf("expected [[Missing]] to be reported, got %v", err)
+	}
+	buf.Reset()
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/Subtype /Image") {
+		t.Error("expected the embedded image in the PDF")
+	}
+	var pages []string
+	for _, m := range regexp.MustCompile(`/Dest \[(\d+) 0 R`).FindAllStringSubmatch(buf.String(), -1) {
+		pages = append(pages, "page "+m[1])
+	}
+	// page 1 is object 3, page 2 object 5
+	want := []string{"page 5", "page 5", "page 3", "page 5"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("links go to %v, want %v", pages, want)
+	}
+	text, err := ExtractText(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(strings.Join(text, "\n"), "\n", "")
+	if !strings.Contains(got, "See setup, notes/guide, Missing and") || !strings.Contains(got, "Back to a > Intro and Setup.") {
+		t.Errorf("unexpected link text %q", text)
+	}
+
+	// a single document keeps them unless asked
+	single := "# Setup\n\nRun it if [[ -f x ]] holds, see [[#Setup]] and [[1]].\n"
+	for _, tt := range []struct {
+		wiki   bool
+		text   string
+		broken bool
+	}{
+		{false, "Run it if [[ -f x ]] holds, see [[#Setup]] and [[1]].", false},
+		{true, "Run it if -f x holds, see Setup and 1.", true},
+	} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetWikiLinks(tt.wiki)}})
+		if err := r.Run([]byte(single)); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		text, err := ExtractText(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.ReplaceAll(strings.Join(text, "\n"), "\n", ""); !strings.Contains(got, tt.text) {
+			t.Errorf("wiki links %v: text %q, want %q", tt.wiki, got, tt.text)
+		}
+		if err := r.LinkError(); (err != nil) != tt.broken {
+			t.Errorf("wiki links %v: link error %v", tt.wiki, err)
+		}
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		src    string
+		fields map[string]string
+		body   string
+	}{
+		{"---\ntitle: Guide\ntags: [a, b]\ndraft: false\nparams:\n  x: 1\n---\n# Intro\n",
+			map[string]string{"title": "Guide", "tags": "a, b", "draft": "false"}, "# Intro\n"},
+		{"+++\ntitle = \"Notes\" # comment\nweight = 3\nkeywords = [\"x\", 'y']\n[params]\nz = 1\n+++\ntext\n",
+			map[string]string{"title": "Notes", "weight": "3", "keywords": "x, y"}, "text\n"},
+		{"---\n\nNot front matter.\n\n---\n", nil, "---\n\nNot front matter.\n\n---\n"},
+		{"---\ntitle: unclosed\n", nil, "---\ntitle: unclosed\n"},
+		{"# Title\n\n---\na: b\n---\n", nil, "# Title\n\n---\na: b\n---\n"},
+	}
+	for _, tt := range tests {
+		fields, body := SplitFrontMatter([]byte(tt.src))
+		if !reflect.DeepEqual(fields, tt.fields) || string(body) != tt.body {
+			t.Errorf("SplitFrontMatter(%q) = %v, %q, want %v, %q", tt.src, fields, body, tt.fields, tt.body)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	light := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetDensity("compact")}})
+	if r.Normal.Size != 9 {
+		t.Fatalf("expected 9pt body text, got %v", r.Normal.Size)
+	}
+	if got, want := r.H1.Size/r.Normal.Size, light.H1.Size/light.Normal.Size; math.Abs(got-want) > 1e-9 {
+		t.Errorf("H1 to body text ratio %v, want %v", got, want)
+	}
+	if r.Normal.Spacing >= light.Normal.Spacing*9/11 || r.IndentValue >= light.IndentValue {
+		t.Errorf("expected tighter spacing and indents, got %v and %v", r.Normal.Spacing, r.IndentValue)
+	}
+	if r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetDensity("dense")}}); r.Normal != light.Normal {
+		t.Errorf("unknown density changed the styles: %v", r.Normal)
+	}
+
+	src := []byte(strings.Repeat("## Section\n\nSome paragraph text that runs on for a while to fill the line.\n\n- one\n- two\n\n", 40))
+	pages := map[string]int{}
+	for _, density := range Densities {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetDensity(density)}})
+		if err := r.Run(src); err != nil {
+			t.Fatal(err)
+		}
+		pages[density] = r.Pdf.PageCount()
+	}
+	if !(pages["compact"] < pages["normal"] && pages["normal"] < pages["relaxed"]) {
+		t.Errorf("expected fewer pages with denser text, got %v", pages)
+	}
+}
+
+func TestContrastCheck(t *testing.T) {
+	black, white := Color{0, 0, 0}, Color{255, 255, 255}
+	if got := ContrastRatio(black, white); math.Abs(got-21) > 1e-9 {
+		t.Fatalf("black on white contrast %v, want 21", got)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	grey := Color{170, 170, 170}
+	for _, mode := range []string{"warn", "fix"} {
+		logged.Reset()
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{
+			SetStyle("Link", WithTextColor(grey)), SetContrastCheck(mode)}})
+		if err := r.Run([]byte("[link](https://example.com)\n")); err != nil {
+			t.Fatal(err)
+		}
+		warned := strings.Contains(logged.String(), "Link: contrast of #aaaaaa on #ffffff is 2.3:1, below 4.5:1")
+		fixed := ContrastRatio(r.Link.TextColor, white) >= 4.5 && ContrastRatio(r.codeColors["blue"], white) >= 4.5
+		if mode == "warn" && (!warned || fixed) || mode == "fix" && (warned || !fixed) {
+			t.Errorf("%s: warned %v, fixed %v: %q", mode, warned, fixed, logged.String())
+		}
+		if r.H1.TextColor != black {
+			t.Errorf("%s: changed a color with enough contrast to %v", mode, r.H1.TextColor)
+		}
+	}
+
+	problems, err := ThemeContrast([]byte(`{"BackgroundColor": "white", "Normal": {"TextColor": "#777"}, "H1": {"Size": 20, "TextColor": "#777"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) == 0 || !strings.HasPrefix(problems[0], "Normal: contrast of #777777") || strings.HasPrefix(problems[1], "H1") {
+		t.Errorf("unexpected contrast problems %q", problems)
+	}
+}
+
+func TestCodeTheme(t *testing.T) {
+	dir := t.TempDir()
+	syntax := "filetype: mini\n\ndetect:\n    filename: \"\\\\.mini$\"\n\nrules:\n    - statement: \"\\\\bfunc\\\\b\"\n    - comment: \"//.*$\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "mini.yaml"), []byte(syntax), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("```mini\nfunc main // entry\n```\n")
+	for theme, want := range map[string][]string{
+		"default":   {"0.165 0.667 0.541 rg", "0.322 0.800 0.000 rg"},
+		"okabe-ito": {"0.000 0.447 0.698 rg", "0.502 g"},
+	} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetSyntaxHighlightBaseDir(dir), SetCodeTheme(theme)}})
+		r.Pdf.SetCompression(false)
+		if err := r.Run(src); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, color := range want {
+			if !strings.Contains(buf.String(), color) {
+				t.Errorf("%s: no %q in the PDF", theme, color)
+			}
+		}
+	}
+	if r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetCodeTheme("sepia")}}); r.CodeTheme != "" {
+		t.Errorf("unknown code theme set: %q", r.CodeTheme)
+	}
+}
+
+func TestImageCompression(t *testing.T) {
+	// a noisy screenshot-sized image, which compresses badly as PNG
+	img := image.NewRGBA(image.Rect(0, 0, 1600, 800))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rnd.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	file := filepath.Join(t.TempDir(), "shot.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	placed := regexp.MustCompile(`q ([\d.]+) 0 0 ([\d.]+) [\d.]+ [\d.]+ cm /I\w+ Do Q`)
+	render := func(opts ...RenderOption) (int, []string) {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: opts})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte("![shot](" + file + ")\n")); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := r.Pdf.Output(&out); err != nil {
+			t.Fatal(err)
+		}
+		m := placed.FindStringSubmatch(out.String())
+		if m == nil {
+			t.Fatal("image not placed")
+		}
+		return out.Len(), m[1:]
+	}
+	full, fullSize := render()
+	for _, tt := range []struct {
+		opts  []RenderOption
+		ratio float64
+	}{
+		// 1157 of 1600 pixels wide at 150 dpi
+		{[]RenderOption{SetImageMaxDPI(150)}, 0.6},
+		{[]RenderOption{SetImageMaxDPI(150), SetJPEGQuality(75)}, 0.3},
+		{[]RenderOption{SetJPEGQuality(75)}, 0.5},
+		// 5 MB of pixels, downsampled as they are read
+		{[]RenderOption{SetImageMaxDPI(150), SetMemoryLimit(4 << 20)}, 0.6},
+	} {
+		small, size := render(tt.opts...)
+		if float64(small) > tt.ratio*float64(full) {
+			t.Errorf("expected a PDF of at most %g of %d bytes, got %d", tt.ratio, full, small)
+		}
+		for i := range size {
+			got, _ := strconv.ParseFloat(size[i], 64)
+			want, _ := strconv.ParseFloat(fullSize[i], 64)
+			if math.Abs(got-want) > 0.5 {
+				t.Errorf("image shown at %v, want %v", size, fullSize)
+			}
+		}
+	}
+}
+
+func TestImageAttributes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "logo.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 400, 200))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	para := strings.Repeat("Lorem ipsum dolor sit amet. ", 20)
+	src := "![Logo](" + file + "){#fig:logo width=50% align=center}\n\n" +
+		"See @fig:logo.\n\n" +
+		"![Float](" + file + "){width=30% float=right}\n\n" + para + "\n\n# After\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := r.Pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	pdf := out.String()
+	if strings.Contains(pdf, "width=") || !strings.Contains(pdf, "Figure 1: Logo") {
+		t.Error("expected the attributes removed and the figure label kept")
+	}
+
+	pageWidth, _ := r.Pdf.GetPageSize()
+	left, _, right, _ := r.Pdf.GetMargins()
+	textWidth := pageWidth - left - right
+	images := regexp.MustCompile(`q ([\d.]+) 0 0 ([\d.]+) ([\d.]+) ([\d.]+) cm /I\w+ Do Q`).FindAllStringSubmatch(pdf, -1)
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(images))
+	}
+	num := func(m []string, i int) float64 {
+		v, _ := strconv.ParseFloat(m[i], 64)
+		return v
+	}
+	if w, x := num(images[0], 1), num(images[0], 3); math.Abs(w-textWidth/2) > 0.5 || math.Abs(x-(left+textWidth/4)) > 0.5 {
+		t.Errorf("centered image %.2f wide at %.2f, want %.2f at %.2f", w, x, textWidth/2, left+textWidth/4)
+	}
+	w, x, bottom := num(images[1], 1), num(images[1], 3), num(images[1], 4)
+	if math.Abs(w-textWidth*0.3) > 0.5 || math.Abs(x+w-(pageWidth-right)) > 0.5 {
+		t.Errorf("floated image %.2f wide at %.2f, want %.2f at the right margin", w, x, textWidth*0.3)
+	}
+
+	// the lines beside the floated image end before it, the heading
+	// starts below it
+	r.setStyler(r.Normal)
+	beside := 0
+	for _, m := range regexp.MustCompile(`BT ([\d.]+) ([\d.]+) Td \((.*)\)Tj`).FindAllStringSubmatch(pdf, -1) {
+		tx, ty := num(m, 1), num(m, 2)
+		if m[3] == "After" && ty > bottom {
+			t.Errorf("heading at %.2f, want it below the floated image at %.2f", ty, bottom)
+		}
+		if ty > bottom && strings.HasPrefix(m[3], "Lorem") {
+			beside++
+			if end := tx + r.Pdf.GetStringWidth(m[3]); end > x {
+				t.Errorf("line beside the floated image ends at %.2f, past %.2f", end, x)
+			}
+		}
+	}
+	if beside == 0 {
+		t.Error("no text beside the floated image")
+	}
+}
+
+func TestHEIFImage(t *testing.T) {
+	dir := t.TempDir()
+	// the header of a HEIC file, enough to be detected as one
+	file := filepath.Join(dir, "photo.heic")
+	heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	if err := os.WriteFile(file, heic, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	render := func() *PdfRenderer {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte("![photo](" + file + ")\n")); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	t.Setenv("PATH", dir)
+	if err := render().ImageError(); err == nil || !strings.Contains(err.Error(), ErrNoHEIFConverter.Error()) {
+		t.Errorf("expected %v without a converter, got %v", ErrNoHEIFConverter, err)
+	}
+
+	// a converter that writes a 144x72 PNG
+	converted := filepath.Join(dir, "converted.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 144, 72))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(converted, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\nexec /bin/cp " + converted + " \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "heif-convert"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r := render()
+	if err := r.ImageError(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := r.Pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`q 144\.0+ 0 0 72\.0+ [\d.]+ [\d.]+ cm /I\w+ Do Q`).Match(out.Bytes()) {
+		t.Error("converted image not placed at 144x72pt")
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := t.TempDir()
+	write := func(name string, img image.Image) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	// 2000x1000 pixels take 8 MB decoded, beyond a 1 MiB limit: the left
+	// half red, the right half half transparent blue
+	big := image.NewNRGBA(image.Rect(0, 0, 2000, 1000))
+	for y := 0; y < 1000; y++ {
+		for x := 0; x < 2000; x++ {
+			if x < 1000 {
+				big.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				big.SetNRGBA(x, y, color.NRGBA{0, 0, 255, 128})
+			}
+		}
+	}
+	file := write("big.png", big)
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetMemoryLimit(1 << 20)}})
+	defer r.removeWorkDir()
+	c := r.compressImage(file)
+	if c.path == file {
+		t.Fatal("image beyond the memory limit embedded as it is")
+	}
+	f, err := os.Open(c.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	small, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := small.Bounds(); b.Dx()*b.Dy()*8 > 1<<20 || b.Dx() != 2*b.Dy() {
+		t.Errorf("downsampled to %v, beyond the memory limit", b)
+	}
+	if got := color.NRGBAModel.Convert(small.At(0, 0)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("left pixel %v, want red", got)
+	}
+	if got := color.NRGBAModel.Convert(small.At(small.Bounds().Dx()-1, 0)); got != (color.NRGBA{0, 0, 255, 128}) {
+		t.Errorf("right pixel %v, want half transparent blue", got)
+	}
+
+	// 600x400 noisy pixels, about 700 kB as PNG
+	noise := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	rnd := rand.New(rand.NewSource(1))
+	for i := range noise.Pix {
+		noise.Pix[i] = byte(rnd.Intn(256))
+		if i%4 == 3 {
+			noise.Pix[i] = 255
+		}
+	}
+	first, second := write("first.png", noise), write("second.png", noise)
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetMemoryLimit(1 << 20)}})
+	for _, path := range []string{first, first} {
+		if err := r.reserveImage(path); err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	if err := r.reserveImage(second); err == nil {
+		t.Error("two images beyond the memory limit embedded")
+	}
+
+	// rendered, the second is downsampled to what the first leaves
+	doc := fmt.Sprintf("![first](%s)\n\n![second](%s)\n", first, second)
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetMemoryLimit(1 << 20)}})
+	if err := r.Run([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ImageError(); err != nil {
+		t.Error(err)
+	}
+	if r.imageMemory > 1<<20 || len(r.reserved) != 2 {
+		t.Errorf("%d images taking %d bytes, beyond the memory limit", len(r.reserved), r.imageMemory)
+	}
+}
+
+func TestPNGScale(t *testing.T) {
+	const w, h = 37, 23
+	palette := func(n int) color.Palette {
+		p := color.Palette{color.NRGBA{}}
+		for i := 1; i < n; i++ {
+			p = append(p, color.NRGBA{uint8(i * 70), uint8(255 - i*15), uint8(i * 9), 255})
+		}
+		return p
+	}
+	images := map[string]draw.Image{
+		"gray":      image.NewGray(image.Rect(0, 0, w, h)),
+		"gray16":    image.NewGray16(image.Rect(0, 0, w, h)),
+		"rgb":       image.NewRGBA(image.Rect(0, 0, w, h)),
+		"rgba":      image.NewNRGBA(image.Rect(0, 0, w, h)),
+		"rgba64":    image.NewNRGBA64(image.Rect(0, 0, w, h)),
+		"palette 1": image.NewPaletted(image.Rect(0, 0, w, h), palette(2)),
+		"palette 2": image.NewPaletted(image.Rect(0, 0, w, h), palette(4)),
+		"palette 4": image.NewPaletted(image.Rect(0, 0, w, h), palette(16)),
+		"palette 8": image.NewPaletted(image.Rect(0, 0, w, h), palette(200)),
+	}
+	for name, img := range images {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint16(x*x*911 + y*7919 + x*y*31)
+				img.Set(x, y, color.NRGBA64{v, v * 3, v * 7, 0xffff - v%3*0x4000})
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		p, err := readPNGHeader(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := p.scale(w, h)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				want := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				c := got.NRGBAAt(x, y)
+				for i, d := range []int{int(c.R) - int(want.R), int(c.G) - int(want.G), int(c.B) - int(want.B), int(c.A) - int(want.A)} {
+					if d < -1 || d > 1 {
+						t.Fatalf("%s: pixel %d,%d channel %d is %v, want %v", name, x, y, i, c, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBaseLineHeight(t *testing.T) {
+	src := "Para one\nline two  \nhard break\n\n- a\n- b\n  - c\n\n1. d\n2. e\n\nLast paragraph.\n"
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", Opts: []RenderOption{SetBaseLineHeight(14)}})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := regexp.MustCompile(`BT [\d.]+ ([\d.]+) Td`).FindAllSubmatch(buf.Bytes(), -1)
+	if len(lines) < 10 {
+		t.Fatalf("%d pieces of text drawn, want at least 10", len(lines))
+	}
+	first, _ := strconv.ParseFloat(string(lines[0][1]), 64)
+	for _, m := range lines[1:] {
+		y, _ := strconv.ParseFloat(string(m[1]), 64)
+		if off := math.Mod(first-y, 14); off > 0.01 && off < 13.99 {
+			t.Errorf("text at y=%.2f is off the 14pt grid starting at %.2f", y, first)
+		}
+	}
+}
+
+func TestVerifyText(t *testing.T) {
+	pdf := filepath.Join(t.TempDir(), "verify.pdf")
+	for _, font := range []string{"", "dejavu_sans"} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PresetFont: font, PdfFile: pdf, Opts: []RenderOption{SetVerifyText(true)}})
+		src := "# Héllo (x) \\\\ y\n\n| a | b |\n|---|---|\n| ^^ | [x] |\n\n```go\nfunc() {}\n```\n"
+		if err := r.Process([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.TextError(); err != nil {
+			t.Errorf("%s: %v", font, err)
+		}
+		data, err := os.ReadFile(pdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, err := ExtractText(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "Héllo (x) \n\\\n y\na\nb\n☑\nfunc() {}"; len(pages) != 1 || pages[0] != want {
+			t.Errorf("%s: extracted %q, want %q", font, pages, want)
+		}
+
+		r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PresetFont: font, PdfFile: pdf, Opts: []RenderOption{SetVerifyText(true)}})
+		if err := r.Process([]byte("Deploy 😀 done, :smile:\n")); err != nil {
+			t.Fatal(err)
+		}
+		// :smile: is left as written, as no font draws it
+		want := `text missing from the PDF: '😀' in "Deploy 😀 done,"`
+		if err := r.TextError(); err == nil || err.Error() != want {
+			t.Errorf("%s: got %v, want %s", font, err, want)
+		}
+
+		r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PresetFont: font, PdfFile: pdf, Opts: []RenderOption{SetVerifyText(true)}})
+		redacted := "Budget: <!-- redact -->4.2M from Acme<!-- /redact --> in total.\n\n" +
+			"| Name | Salary |\n|------|--------|\n| Bob | <!-- redact -->100k<!-- /redact --> a year |\n"
+		if err := r.Process([]byte(redacted)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.TextError(); err != nil {
+			t.Errorf("%s: redacted text reported: %v", font, err)
+		}
+	}
+}
+
+func TestMmark(t *testing.T) {
+	src := "{mainmatter}\n\nA> An aside.\n\n```go\nx := 1 // <<1>>\n```\nFigure: A listing.\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\nTable: Results. {#tbl:results}\n\nSee callout <<1>> and @tbl:results.\n"
+	pdf := filepath.Join(t.TempDir(), "mmark.pdf")
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", PdfFile: pdf, Opts: []RenderOption{SetDialect("mmark"), SetVerifyText(true)}})
+	if err := r.Process([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.TextError(); err != nil {
+		t.Error(err)
+	}
+	data, err := os.ReadFile(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := ExtractText(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Join(strings.Fields(pages[0]), " ")
+	for _, want := range []string{"An aside.", "x := 1 // (1)", "Figure 1: A listing.", "Table 1: Results.", "See callout (1) and Table 1 ."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("%q not in %q", want, text)
+		}
+	}
+}
+
+func TestSpecialNodes(t *testing.T) {
+	tests := []struct {
+		src         string
+		opts        []RenderOption
+		extensions  parser.Extensions
+		want        []string
+		unsupported []string
+	}{
+		{
+			src:         "# Intro\n\nSee (#intro) and [@RFC2119] (!index entry) <span>here</span>.\n\n$$\na = b\n$$\n",
+			opts:        []RenderOption{SetDialect("mmark"), SetWarnUnsupported(true)},
+			want:        []string{"See Intro and [RFC2119] here", "a = b"},
+			unsupported: []string{"index entry (1)", "inline HTML </span> (1)", "inline HTML <span> (1)"},
+		},
+		{
+			src:        "H~2~O is 2^10^ ~~old~~ a\\ b.[^1]\n\n[^1]: The note.\n",
+			extensions: DefaultExtensions | parser.SuperSubscript | parser.NonBlockingSpace | parser.Footnotes,
+			want:       []string{"H 2 O is 2 10 old a b. 1", "The note."},
+		},
+	}
+	for _, tt := range tests {
+		pdf := filepath.Join(t.TempDir(), "special.pdf")
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", PdfFile: pdf, Extensions: tt.extensions,
+			Opts: append(tt.opts, SetQuiet(true))})
+		if err := r.Process([]byte(tt.src)); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Unsupported(); strings.Join(got, ", ") != strings.Join(tt.unsupported, ", ") {
+			t.Errorf("unsupported %q, want %q", got, tt.unsupported)
+		}
+		data, err := os.ReadFile(pdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, err := ExtractText(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := strings.Join(strings.Fields(pages[0]), " ")
+		for _, want := range tt.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("%q not in %q", want, text)
+			}
+		}
+	}
+}
+
+func TestTOCLinkPositions(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{IsHorizontalRuleNewPage(true)}})
+	r.Pdf.SetCompression(false)
+	link := r.Pdf.AddLink()
+	r.SetTOCLinks(map[string]*int{"Usage run": &link})
+	r.Pdf.WriteLinkID(8, "Usage", link)
+	r.Pdf.Ln(10)
+	src := "# Intro\n\n" + strings.Repeat("Some text.\n\n", 10) + "## Usage `run`\n\nText.\n\n---\n\n## Usage `run`\n\nAgain.\n"
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`/Dest \[(\d+) 0 R /XYZ 0 ([\d.]+) null\]`).FindSubmatch(buf.Bytes())
+	if m == nil {
+		t.Fatal("no link destination in the PDF")
+	}
+	_, pageHeight := r.Pdf.GetPageSize()
+	y, _ := strconv.ParseFloat(string(m[2]), 64)
+	// the first of the two headings, well down the first page
+	if string(m[1]) != "3" || y > pageHeight*r.Pdf.GetConversionRatio()-200 {
+		t.Errorf("TOC link to object %s at %s, not to the heading", m[1], m[2])
+	}
+}
+
+func TestBackToTOC(t *testing.T) {
+	src := "# One\n\nText.\n\n## Sub\n\nMore.\n\n---\n\n# Two\n\nLast.\n"
+	for where, want := range map[string][]int{"sections": {0, 0, 2}, "footer": {0, 1, 1}} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{IsHorizontalRuleNewPage(true), SetBackToTOC(where)}})
+		r.MarkTOC()
+		r.Pdf.Cell(40, 10, "TOC")
+		r.Pdf.AddPage()
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		pages, err := ExtractText(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, page := range pages {
+			got = append(got, strings.Count(page, BackToTOCLabel))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: links on each page %v, want %v", where, got, want)
+		}
+	}
+}
+
+func TestListNumbering(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		n      int
+		want   string
+	}{
+		{"1.", 7, "7."}, {"a)", 7, "g)"}, {"(i)", 7, "(vii)"}, {"A.", 28, "AB."}, {"I)", 1999, "MCMXCIX)"},
+	} {
+		if got := listLabel(tt.format, tt.n); !ValidListNumbering(tt.format) || got != tt.want {
+			t.Errorf("listLabel(%q, %d) = %q, want %q", tt.format, tt.n, got, tt.want)
+		}
+	}
+	for _, format := range []string{"(1.", "b)", "1", "(a"} {
+		if ValidListNumbering(format) {
+			t.Errorf("%q accepted", format)
+		}
+	}
+
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", Opts: []RenderOption{SetListNumbering("a)")}})
+	r.Pdf.SetCompression(false)
+	src := "1. One\n2. Two\n\nText.\n\n<!-- list (i) -->\n\n1. Three\n2. Four\n\nText.\n\n999. Nine\n1. Thou\n"
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`(a\))`, `(b\))`, `(\(i\))`, `(\(ii\))`, `(alk\))`, `(all\))`} {
+		if !bytes.Contains(buf.Bytes(), []byte(" Td "+want+"Tj")) {
+			t.Errorf("label %s not drawn", want)
+		}
+	}
+	// the items of a list start at the same x, however wide their labels
+	item := regexp.MustCompile(`BT ([0-9.]+) [0-9.]+ Td \((Nine|Thou)\)Tj`)
+	if m := item.FindAllSubmatch(buf.Bytes(), -1); len(m) != 2 || !bytes.Equal(m[0][1], m[1][1]) {
+		t.Errorf("items not aligned: %q", m)
+	}
+}
+
+func TestListHangingIndent(t *testing.T) {
+	content, err := os.ReadFile("testdata/Nested lists.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.Pdf.SetCompression(false)
+	if err := r.Run(content); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	type piece struct {
+		x, y float64
+		text string
+	}
+	var pieces []piece
+	for _, m := range regexp.MustCompile(`BT ([0-9.]+) ([0-9.]+) Td \(([^)]*)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+		x, _ := strconv.ParseFloat(string(m[1]), 64)
+		y, _ := strconv.ParseFloat(string(m[2]), 64)
+		pieces = append(pieces, piece{x, y, string(m[3])})
+	}
+	// the text of the items at depth n starts with Ln; every line that
+	// follows it, wrapped or in a later paragraph, starts at the same x,
+	// and the items of a list all start at the same x whatever their label
+	itemX := map[string]float64{}
+	labelX, current := -1.0, -1.0
+	lines := 0
+	for i, p := range pieces {
+		if i > 0 && pieces[i-1].y == p.y {
+			if level := regexp.MustCompile(`^L[0-9]`).FindString(p.text); level != "" {
+				if x, ok := itemX[level]; ok && x != p.x {
+					t.Errorf("%s items start at %v and %v", level, x, p.x)
+				}
+				itemX[level], current = p.x, p.x
+				if labelX < 0 {
+					labelX = pieces[i-1].x
+				}
+			}
+			continue
+		}
+		if i+1 < len(pieces) && pieces[i+1].y == p.y {
+			continue // a label, or a line with several styles
+		}
+		switch {
+		case labelX < 0 || p.x < labelX:
+			current = -1 // outside the lists
+		case current >= 0 && p.x != current:
+			t.Errorf("line %q at x %v, not under its item text at %v", p.text, p.x, current)
+		default:
+			lines++
+		}
+	}
+	if len(itemX) != 7 || lines < 20 {
+		t.Fatalf("item depths found: %v, lines checked: %d", itemX, lines)
+	}
+	for d := 2; d <= 6; d++ {
+		if itemX[fmt.Sprint("L", d)] <= itemX[fmt.Sprint("L", d-1)] {
+			t.Errorf("L%d not indented from L%d: %v", d, d-1, itemX)
+		}
+	}
+}
+
+func TestIndents(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetIndents(20, 30, 10), SetIndentScale(0.5)}})
+	r.Pdf.SetCompression(false)
+	if err := r.Run([]byte("Para\n\n> Quote\n\n- A\n    - B\n        - C\n\nTerm\n: Def\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := r.Pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	x := map[string]float64{}
+	for _, m := range regexp.MustCompile(`BT ([0-9.]+) [0-9.]+ Td \((\w+)\)Tj`).FindAllSubmatch(buf.Bytes(), -1) {
+		x[string(m[2])], _ = strconv.ParseFloat(string(m[1]), 64)
+	}
+	// items hang from their label box, the same for all these lists
+	box := x["A"] - (x["Para"] + 20)
+	for text, want := range map[string]float64{
+		"Quote": x["Para"] + 30,
+		"B":     x["A"] + 10 + box,
+		"C":     x["B"] + 5 + box,
+		"Term":  x["Para"] + 10 + box,
+	} {
+		if math.Abs(x[text]-want) > 0.01 {
+			t.Errorf("%s at %.2f, want %.2f", text, x[text], want)
+		}
+	}
+}
+
+func TestViewerPreferences(t *testing.T) {
+	pdf := filepath.Join(t.TempDir(), "viewer.pdf")
+	prefs := ViewerPreferences{Layout: "two", Zoom: "width", HideToolbar: true, ShowBookmarks: true}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PdfFile: pdf, Opts: []RenderOption{SetViewerPreferences(prefs)}})
+	if err := r.Process([]byte("# Manual\n\nText.\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/PageLayout /TwoPageRight", "/OpenAction [3 0 R /FitH null]", "/PageMode /UseOutlines", "/ViewerPreferences <</HideToolbar true>>"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("%q not in the PDF", want)
+		}
+	}
+	if _, err := ExtractText(data); err != nil {
+		t.Errorf("updated PDF not readable: %v", err)
+	}
+
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetQuiet(true), SetViewerPreferences(ViewerPreferences{Layout: "spread"})}})
+	if r.ViewerPreferences.Layout != "" || r.Pdf.Err() {
+		t.Errorf("unknown layout kept: %+v, %v", r.ViewerPreferences, r.Pdf.Error())
+	}
+
+	src := "# Intro\n\nText.\n\n---\n\n## Installation Steps\n\nRun it.\n\n## Usage {#use}\n\nMore.\n"
+	for openAt, want := range map[string]string{
+		"2":                   "/OpenAction [5 0 R /Fit]",
+		"#installation-steps": "/OpenAction [5 0 R /Fit]",
+		"#use":                "/OpenAction [5 0 R /Fit]",
+		"#missing":            "/OpenAction [3 0 R /Fit]",
+		"9":                   "/OpenAction [3 0 R /Fit]",
+	} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PdfFile: pdf, Opts: []RenderOption{SetQuiet(true), IsHorizontalRuleNewPage(true),
+			SetViewerPreferences(ViewerPreferences{Zoom: "page", OpenAt: openAt})}})
+		if err := r.Process([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(pdf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.Count(data, []byte("/OpenAction")); got != 1 || !bytes.Contains(data, []byte(want)) {
+			t.Errorf("open at %s: %d open actions, want %q", openAt, got, want)
+		}
+		root, _ := strconv.Atoi(string(rootRe.FindSubmatch(data)[1]))
+		pages, err := pageObjects(data, root)
+		if err != nil || len(pages) != r.Pdf.PageCount() {
+			t.Fatalf("page objects %v, %v; want %d", pages, err, r.Pdf.PageCount())
+		}
+		for _, num := range pages {
+			if dict, err := objectDict(data, num); err != nil || !bytes.Contains(dict, []byte("/Type /Page\n")) {
+				t.Errorf("object %d is not a page: %s", num, dict)
+			}
+		}
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	d, ok := parseDirective([]byte(`<!-- basedir "a=b/c d" -->`))
+	if !ok || len(d.args) != 1 || d.args[0] != "a=b/c d" || len(d.attrs) != 0 {
+		t.Fatalf("basedir: %+v", d)
+	}
+	title := `Say "hi" --> <b>`
+	d, ok = parseDirective([]byte("<!-- bookmark title=" + QuoteDirectiveValue(title) + " -->"))
+	if !ok || d.attrs["title"] != title {
+		t.Fatalf("bookmark: %+v", d)
+	}
+}
+
+func TestRedactions(t *testing.T) {
+	src := "# Project <!-- redact -->Falcon<!-- /redact -->\n\n" +
+		"Budget: <!-- redact -->4.2M from Acme<!-- /redact --> in total.\n\n" +
+		"<!-- redact -->\n*[FALCON]: Fast Aerial Loitering Craft\n<!-- /redact -->\n\n" +
+		"<!-- redact -->\n## Plans\n\nSee [the plan](https://internal.example.com) and `codeword`.\n\n" +
+		"```\ndeploy --token hunter2\n```\n\n| Name | Salary |\n|------|--------|\n| Bob  | 100k   |\n<!-- /redact -->\n\n" +
+		"## Team {.redact}\n\nPublic text[^1].\n\n" +
+		"<!-- redact -->\n[^1]: Ask Zebulon.\n<!-- /redact -->\n"
+	entries, err := GetTOCEntries([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("redacted headings listed in the TOC: %v", entries)
+	}
+
+	for _, sidenotes := range []bool{false, true} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, DefaultFont: "Helvetica", Opts: []RenderOption{SetBookmarks(true), SetSidenotes(sidenotes), SetGlossary(Glossary{"API": "Interface"}, true)}})
+		r.Extensions = parser.CommonExtensions | parser.Footnotes
+		r.Pdf.SetCompression(false)
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := r.Pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		for _, secret := range []string{"Falcon", "Acme", "Plans", "internal.example", "codeword", "hunter2", "Bob", "100k", "Team", "Zebulon", "Loitering", "xxx"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("sidenotes %v: %q is in the PDF", sidenotes, secret)
+			}
+		}
+		if !strings.Contains(out, "Public text") || !strings.Contains(out, "Budget: ") {
+			t.Errorf("sidenotes %v: text outside the redactions is missing", sidenotes)
+		}
+		if n := strings.Count(out, " re f"); n < 9 {
+			t.Errorf("sidenotes %v: expected black bars for the redacted content, got %d rectangles", sidenotes, n)
+		}
+	}
+}
+
+func TestApplyConditions(t *testing.T) {
+	src := "Intro\n\n<!-- if audience=internal -->\n## Internal\n\n```\n<!-- endif -->\n```\n<!-- else -->\n## Public\n" +
+		"<!-- if draft -->\nDraft note\n<!-- endif -->\n<!-- endif -->\n\n" +
+		"Contact <!-- if audience=internal,partner -->the team<!-- else -->support<!-- endif -->, `<!-- if x -->` kept.\n"
+	tests := []struct {
+		defines map[string]string
+		want    string
+	}{
+		{map[string]string{"audience": "internal"},
+			"Intro\n\n## Internal\n\n```\n<!-- endif -->\n```\n\nContact the team, `<!-- if x -->` kept.\n"},
+		{map[string]string{"audience": "external", "draft": "true"},
+			"Intro\n\n## Public\nDraft note\n\nContact support, `<!-- if x -->` kept.\n"},
+		{nil,
+			"Intro\n\n## Public\n\nContact support, `<!-- if x -->` kept.\n"},
+	}
+	for _, tt := range tests {
+		if got := string(ApplyConditions([]byte(src), tt.defines)); got != tt.want {
+			t.Errorf("ApplyConditions(%v) = %q, want %q", tt.defines, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	src := "Invoice for {{.Client}}: {{money .Total \"EUR\"}}, {{number .Hours 1}} h, due {{date .Due \"Monday 2 January 2006\"}}.\n\n" +
+		"`{{.Client}}` and {{qr https://example.com}} are kept.\n\n```\n{{.Total}}\n```\n\n" +
+		"    tag: {{.Values.tag}}\n    client: {{.Client}}\n\nHelm writes {{.Values.tag}}.\n\n" +
+		"- item\n\n    of {{.Client}}\n"
+	vars := map[string]string{"Client": "ACME", "Total": "1234.5", "Hours": "12.25", "Due": "2026-11-30"}
+	for locale, want := range map[string]string{
+		"":      "Invoice for ACME: €1,234.50, 12.3 h, due Monday 30 November 2026.",
+		"de-DE": "Invoice for ACME: 1.234,50\u00a0€, 12,3 h, due Montag 30 November 2026.",
+		"fr-FR": "Invoice for ACME: 1\u00a0234,50\u00a0€, 12,3 h, due lundi 30 novembre 2026.",
+		"de-CH": "Invoice for ACME: EUR\u00a01’234.50, 12.3 h, due Montag 30 November 2026.",
+	} {
+		got, err := ExpandTemplates([]byte(src), vars, locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, rest, _ := strings.Cut(string(got), "\n")
+		wantRest := strings.Replace(strings.SplitN(src, "\n", 2)[1], "of {{.Client}}", "of ACME", 1)
+		if first != want || rest != wantRest {
+			t.Errorf("%s: %q", locale, got)
+		}
+	}
+	undefined := "{{money .Missing \"EUR\"}}, {{number (.Missing) 1}} and {{.Total | printf \"%s\" | len}}"
+	if got, err := ExpandTemplates([]byte(undefined), vars, "en"); err != nil || string(got) != "{{money .Missing \"EUR\"}}, {{number (.Missing) 1}} and 6" {
+		t.Errorf("undefined variables: %q, %v", got, err)
+	}
+	for _, src := range []string{"{{money .Client \"EUR\"}}", "{{money .Total \"XYZ1\"}}", "{{date .Client \"2 Jan\"}}"} {
+		if _, err := ExpandTemplates([]byte(src), vars, "en"); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
+
+func TestRunTempDir(t *testing.T) {
+	// the run makes its temp directory here, not among those of other processes
+	t.Setenv("TMPDIR", t.TempDir())
+	svg := path.Join(t.TempDir(), "pic.svg")
+	if err := os.WriteFile(svg, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20"><rect width="40" height="20" fill="red"/></svg>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, keep := range []bool{false, true} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetKeepTemp(keep)}})
+		var dir string
+		r.Extensions = parser.CommonExtensions
+		if err := r.Run([]byte("![pic](" + svg + ")\n")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(svg); err != nil {
+			t.Fatalf("source image was moved: %v", err)
+		}
+		if r.tempDir != "" {
+			t.Fatalf("temp dir still set: %s", r.tempDir)
+		}
+		dirs, _ := filepath.Glob(filepath.Join(os.Getenv("TMPDIR"), "*"))
+		for _, d := range dirs {
+			if entries, _ := os.ReadDir(d); len(entries) > 0 {
+				dir = d
+			}
+		}
+		if keep != (dir != "") {
+			t.Fatalf("KeepTemp=%v, kept directory %q", keep, dir)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	if err := r.Run([]byte("![missing](no/such/image.png)\n\ntext\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ImageError(); !errors.Is(err, ErrImage) || !strings.Contains(err.Error(), "no/such/image.png") {
+		t.Fatalf("expected an image error, got %v", err)
+	}
+
+	failing := func(doc *ast.Node) error { return os.ErrInvalid }
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PdfFile: path.Join(t.TempDir(), "out.pdf"), Opts: []RenderOption{WithASTTransformer(failing)}})
+	if err := r.Process([]byte("text\n")); !errors.Is(err, ErrParse) || !errors.Is(err, os.ErrInvalid) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	r = NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PdfFile: path.Join(t.TempDir(), "missing", "out.pdf")})
+	if err := r.Process([]byte("text\n")); !errors.Is(err, ErrIO) {
+		t.Fatalf("expected an I/O error, got %v", err)
+	}
+	if err := r.ImageError(); err != nil {
+		t.Fatalf("unexpected image error %v", err)
+	}
+
+	theme := path.Join(t.TempDir(), "theme.json")
+	r = NewPdfRenderer(PdfRendererParams{Theme: CUSTOM, CustomThemeFile: theme})
+	if err := r.Run([]byte("text\n")); !errors.Is(err, ErrIO) {
+		t.Fatalf("expected an I/O error for a missing theme, got %v", err)
+	}
+	if err := os.WriteFile(theme, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r = NewPdfRenderer(PdfRendererParams{Theme: CUSTOM, CustomThemeFile: theme, PdfFile: path.Join(t.TempDir(), "out.pdf")})
+	if err := r.Process([]byte("text\n")); !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), theme) {
+		t.Fatalf("expected a parse error for a broken theme, got %v", err)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	for _, quiet := range []bool{false, true} {
+		logged.Reset()
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetQuiet(quiet)}})
+		if err := r.Run([]byte("![missing](no/such/image.png)\n")); err != nil {
+			t.Fatal(err)
+		}
+		if quiet == (logged.Len() > 0) {
+			t.Fatalf("Quiet=%v, logged %q", quiet, logged.String())
+		}
+	}
+}
+
+func TestCodeWrap(t *testing.T) {
+	line := "echo " + strings.Repeat("x", 200) + " done"
+	for _, clip := range []bool{false, true} {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetClipCode(clip)}})
+		width := 100.0
+		pieces, clipped := r.wrapCode(r.Backtick, line, width)
+		if clipped != clip {
+			t.Fatalf("ClipCode=%v, clipped=%v", clip, clipped)
+		}
+		if clip && len(pieces) != 1 || !clip && strings.Join(pieces, "") != line {
+			t.Fatalf("ClipCode=%v, pieces %q", clip, pieces)
+		}
+		for _, p := range pieces {
+			if w := r.Pdf.GetStringWidth(p); w > width {
+				t.Fatalf("piece %q is %.2f wide, over %.2f", p, w, width)
+			}
+		}
+	}
+
+	// wide characters are measured as drawn, and combining marks and emoji
+	// sequences stay with the character before them
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, PresetFont: "dejavu_sans"})
+	for _, line := range []string{strings.Repeat("漢字", 40), strings.Repeat("e\u0301", 100), strings.Repeat("a\u200db", 60)} {
+		for _, style := range []Styler{r.Normal, r.Backtick} {
+			pieces, _ := r.wrapCode(style, line, 100)
+			if len(pieces) < 2 || strings.Join(pieces, "") != line {
+				t.Fatalf("%q wrapped as %q", line, pieces)
+			}
+			for _, p := range pieces {
+				first, _ := utf8.DecodeRuneInString(p)
+				if w := r.Pdf.GetStringWidth(p); w > 100.01 || zeroWidth(first) || strings.HasSuffix(p, "\u200d") {
+					t.Fatalf("%s: %q wrapped as %q", style.Font, line, pieces)
+				}
+			}
+		}
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	for _, clip := range []bool{false, true} {
+		logged.Reset()
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetClipCode(clip)}})
+		if err := r.Run([]byte("```\n" + line + "\n```\n")); err != nil {
+			t.Fatal(err)
+		}
+		if warned := strings.Contains(logged.String(), "clipped"); warned != clip {
+			t.Fatalf("ClipCode=%v, logged %q", clip, logged.String())
+		}
+	}
+}
+
+func TestCodeInclude(t *testing.T) {
+	dir := t.TempDir()
+	src := "package main\n\nfunc main() {\n\tif true {\n\t\tprintln(1)\n\t}\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	marked := "func main() {\n\t// [docs:start:connect]\n\tconn := dial()\n\t// [docs:start:close]\n\tconn.Close()\n\t// [docs:end:close]\n\t// [docs:end:connect]\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "marked.go"), []byte(marked), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		directive, lang, code string
+	}{
+		{`<!-- code: main.go -->`, "go", src},
+		{`<!-- code: main.go lines=4-6 -->`, "go", "if true {\n\tprintln(1)\n}\n"},
+		{`<!-- code: main.go lines=5 dedent=false lang=text -->`, "text", "\t\tprintln(1)\n"},
+		{`<!-- code: main.go lines=6- -->`, "go", "\t}\n}\n"},
+		{`<!-- code: marked.go snippet=connect -->`, "go", "conn := dial()\nconn.Close()\n"},
+		{`<!-- code: marked.go snippet=close -->`, "go", "conn.Close()\n"},
+		{`<!-- code: marked.go -->`, "go", "func main() {\n\tconn := dial()\n\tconn.Close()\n}\n"},
+	}
+	for _, tt := range tests {
+		doc := markdown.Parse([]byte(tt.directive+"\n"), parser.NewWithExtensions(parser.CommonExtensions))
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetInputBaseDir(dir)}})
+		r.codeIncludes(doc)
+		cb, ok := doc.GetChildren()[0].(*ast.CodeBlock)
+		if !ok {
+			t.Fatalf("%s: not replaced by a code block", tt.directive)
+		}
+		if string(cb.Info) != tt.lang || string(cb.Literal) != tt.code {
+			t.Errorf("%s: got %s %q, want %s %q", tt.directive, cb.Info, cb.Literal, tt.lang, tt.code)
+		}
+	}
+	outside := filepath.Join(t.TempDir(), "outside.go")
+	if err := os.WriteFile(outside, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(dir, outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, allow := range []bool{false, true} {
+		for _, target := range []string{outside, filepath.ToSlash(rel)} {
+			doc := markdown.Parse([]byte("<!-- code: "+target+" -->\n"), parser.NewWithExtensions(parser.CommonExtensions))
+			r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetInputBaseDir(dir), SetIncludeOutside(allow), SetQuiet(true)}})
+			r.codeIncludes(doc)
+			if _, included := doc.GetChildren()[0].(*ast.CodeBlock); included != allow {
+				t.Errorf("IncludeOutside=%v: %s included %v", allow, target, included)
+			}
+		}
+	}
+	for _, name := range []string{"missing", "close"} {
+		lines := strings.Split(marked, "\n")
+		if name == "close" {
+			lines = lines[:5]
+		}
+		if _, err := snippet(lines, name); err == nil {
+			t.Errorf("snippet %q accepted", name)
+		}
+	}
+	for _, v := range []string{"0-3", "5-2", "x"} {
+		if _, _, err := parseLineRange(v); err == nil {
+			t.Errorf("parseLineRange(%q) accepted", v)
+		}
+	}
+}
+
+func TestShiftHeadings(t *testing.T) {
+	tests := []struct {
+		shift, max int
+		want       []int
+	}{
+		{0, 0, []int{1, 2, 3, 6}},
+		{1, 0, []int{2, 3, 4, 6}},
+		{-1, 0, []int{1, 1, 2, 5}},
+		{1, 3, []int{2, 3, 3, 3}},
+	}
+	for _, tt := range tests {
+		doc := markdown.Parse([]byte("# a\n\n## b\n\n### c\n\n###### d\n"), parser.NewWithExtensions(parser.CommonExtensions))
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetHeadingShift(tt.shift), SetMaxHeadingLevel(tt.max)}})
+		r.shiftHeadings(doc)
+		var got []int
+		for _, n := range doc.GetChildren() {
+			got = append(got, n.(*ast.Heading).Level)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("shift %d, max %d: levels %v, want %v", tt.shift, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestGFMAutolinks(t *testing.T) {
+	src := "Visit www.example.com/a_(b)). Mail foo.bar+x@example.co.uk! " +
+		"Not xwww.example.com, `www.code.com` or [www.linked.com](https://linked.com).\n"
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(GFMExtensions))
+	gfmAutolinks(doc)
+	var links []string
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if l, ok := node.(*ast.Link); ok && entering {
+			links = append(links, string(l.Destination)+" "+ExtractTextFromNode(l))
+		}
+		return ast.GoToNext
+	})
+	want := []string{
+		"http://www.example.com/a_(b) www.example.com/a_(b)",
+		"mailto:foo.bar+x@example.co.uk foo.bar+x@example.co.uk",
+		"https://linked.com www.linked.com",
+	}
+	if strings.Join(links, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("links:\n%s\nwant:\n%s", strings.Join(links, "\n"), strings.Join(want, "\n"))
+	}
+	if got := ExtractTextFromNode(doc); !strings.Contains(got, "www.example.com/a_(b)). Mail") {
+		t.Fatalf("text around the links changed: %q", got)
+	}
+}
+
+func TestLinkResolver(t *testing.T) {
+	src := "See [[Page Name]], [[Setup Guide|the guide]], [[Unknown]] and JIRA-123, " +
+		"not `JIRA-7` or [JIRA-8](https://x.org). [Ticket](JIRA-9) is open.\n"
+	resolve := func(dest string) (string, LinkKind) {
+		switch {
+		case strings.HasPrefix(dest, "JIRA-"):
+			return "https://jira.example.com/browse/" + dest, LinkURL
+		case dest == "Page Name" || dest == "Setup Guide":
+			return strings.ToLower(strings.ReplaceAll(dest, " ", "-")), LinkAnchor
+		}
+		return "", LinkUnresolved
+	}
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{WithLinkResolver(resolve)}})
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(parser.CommonExtensions))
+	r.resolveLinks(doc)
+	var links []string
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if l, ok := node.(*ast.Link); ok && entering {
+			links = append(links, string(l.Destination)+" "+ExtractTextFromNode(l))
+		}
+		return ast.GoToNext
+	})
+	want := []string{
+		"#page-name Page Name",
+		"#setup-guide the guide",
+		"https://jira.example.com/browse/JIRA-123 JIRA-123",
+		"https://x.org JIRA-8",
+		"https://jira.example.com/browse/JIRA-9 Ticket",
+	}
+	if strings.Join(links, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("links:\n%s\nwant:\n%s", strings.Join(links, "\n"), strings.Join(want, "\n"))
+	}
+	if got := ExtractTextFromNode(doc); !strings.Contains(got, "[[Unknown]] and JIRA-123") {
+		t.Fatalf("unresolved wiki link changed: %q", got)
+	}
+}
+
+func TestCallouts(t *testing.T) {
+	src := "> [!info]- My *title*\n> body **text**\n>\n> > [!NOTE]\n> > inner\n\nBetween.\n\n> [!tip]\n\nAfter.\n\n> plain quote\n\n" +
+		"> [!tip] T\n> tip body\n\n> [!note]\n> note body\n"
+	blocks := func(collapse bool) []string {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetCollapseDetails(collapse)}})
+		doc := markdown.Parse([]byte(src), parser.NewWithExtensions(r.Extensions))
+		r.callouts(doc)
+		var got []string
+		for _, b := range doc.GetChildren() {
+			switch b := b.(type) {
+			case *ast.HTMLBlock:
+				got = append(got, string(b.Literal))
+			default:
+				got = append(got, fmt.Sprintf("%T %s", b, strings.TrimSpace(ExtractTextFromNode(b))))
+			}
+		}
+		return got
+	}
+	want := []string{
+		"<!-- panel My title -->",
+		"*ast.Paragraph body text",
+		"<!-- panel Note -->",
+		"*ast.Paragraph inner",
+		"<!-- /panel -->",
+		"<!-- /panel -->",
+		"*ast.Paragraph Between.",
+		"<!-- panel Tip -->",
+		"<!-- /panel -->",
+		"*ast.Paragraph After.",
+		"*ast.BlockQuote plain quote",
+		"<!-- panel T -->",
+		"*ast.Paragraph tip body",
+		"<!-- /panel -->",
+		"<!-- panel Note -->",
+		"*ast.Paragraph note body",
+		"<!-- /panel -->",
+	}
+	if got := blocks(false); !reflect.DeepEqual(got, want) {
+		t.Fatalf("blocks:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	want = append([]string{want[0], "*ast.Paragraph (" + CollapsedLabel + ")"}, want[5:]...)
+	if got := blocks(true); !reflect.DeepEqual(got, want) {
+		t.Fatalf("collapsed blocks:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEmojiShortcodes(t *testing.T) {
+	src := "Ship it :rocket: :+1:, :warning: :not_an_emoji: at 10:30:00 `:rocket:`\n"
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(DefaultExtensions))
+	emojiShortcodes(doc, func(rune) bool { return true })
+	want := "Ship it \U0001f680 \U0001f44d, \u26a0 :not_an_emoji: at 10:30:00 :rocket:"
+	if got := ExtractTextFromNode(doc); got != want {
+		t.Fatalf("text %q, want %q", got, want)
+	}
+
+	// only the emoji the font can draw are expanded
+	for font, want := range map[string]string{
+		"Helvetica":   "Ship it :rocket: :+1:, :warning: :not_an_emoji: at 10:30:00 :rocket:",
+		"dejavu_sans": "Ship it :rocket: :+1:, \u26a0 :not_an_emoji: at 10:30:00 :rocket:",
+		"DejaVuSans":  "Ship it :rocket: :+1:, \u26a0 :not_an_emoji: at 10:30:00 :rocket:",
+	} {
+		doc := markdown.Parse([]byte(src), parser.NewWithExtensions(DefaultExtensions))
+		emojiShortcodes(doc, fontGlyphs(font))
+		if got := ExtractTextFromNode(doc); got != want {
+			t.Errorf("%s: text %q, want %q", font, got, want)
+		}
+	}
+}
+
+func TestIcons(t *testing.T) {
+	src := "Done :fa-check:, :fa-nope: `:fa-check:` <i class=\"fa-solid fa-star\"></i>\n"
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(DefaultExtensions))
+	iconShortcodes(doc)
+	var icons []string
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if span, ok := node.(*ast.HTMLSpan); ok {
+			if symbol, name, ok := iconSymbol(span.Literal); ok {
+				icons = append(icons, fmt.Sprintf("%s %c", name, symbol))
+			}
+		}
+		return ast.GoToNext
+	})
+	if want := []string{"check ✓", "star ★"}; !slices.Equal(icons, want) {
+		t.Fatalf("icons %q, want %q", icons, want)
+	}
+	if got := ExtractTextFromNode(doc); got != "Done , :fa-nope: :fa-check: " {
+		t.Fatalf("text %q", got)
+	}
+	for tag, known := range map[string]bool{
+		`<i class="fa fa-unknown">`: false,
+		`<i class="fas fa-gear">`:   true,
+	} {
+		_, name, ok := iconSymbol([]byte(tag))
+		if !ok || (name != "") != known {
+			t.Fatalf("%s: icon %q, ok %v", tag, name, ok)
+		}
+	}
+	if _, _, ok := iconSymbol([]byte(`<i class="note">`)); ok {
+		t.Fatal("<i> without Font Awesome classes taken for an icon")
+	}
+}
+
+func TestDialects(t *testing.T) {
+	if r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT}); r.Extensions != DefaultExtensions {
+		t.Fatalf("default extensions %b, want %b", r.Extensions, DefaultExtensions)
+	}
+	if r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Extensions: parser.Tables}); r.Extensions != parser.Tables {
+		t.Fatalf("extensions %b not taken from the params", r.Extensions)
+	}
+	if r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetExtensions(parser.NoExtensions)}}); r.Extensions != parser.NoExtensions {
+		t.Fatalf("extensions %b, want none", r.Extensions)
+	}
+	table := "| a | b |\n|---|---|\n| 1 | 2 |\n"
+	for _, name := range DialectNames() {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT, Opts: []RenderOption{SetDialect(name)}})
+		if r.Extensions != Dialects[name] || r.GFM != (name == "gfm") {
+			t.Fatalf("dialect %s: extensions %b, GFM %v", name, r.Extensions, r.GFM)
+		}
+		doc := markdown.Parse([]byte(table), parser.NewWithExtensions(r.Extensions))
+		_, isTable := doc.GetChildren()[0].(*ast.Table)
+		if isTable == (name == "commonmark") {
+			t.Errorf("dialect %s: table parsed %v", name, isTable)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+)
+
+// SetMemoryLimit bounds, in bytes, the memory the renderer takes for
+// images. The PDF holds the data of every image it embeds until it is
+// written, about the size of the file, and an image is decoded in memory
+// to be downsampled or, for PNG images with transparency and GIF images,
+// to be embedded; both count against the limit. Images are read from disk
+// one at a time and their decoded pixels are dropped once they are
+// encoded. A PNG image whose pixels do not fit is downsampled row by row
+// as it is read, to ImageMaxDPI or else to a size that fits, with a
+// warning; JPEG images, which are embedded without being decoded, are
+// embedded as they are. An image that does not fit even so is left out
+// and reported by ImageError. Fonts and the text of the pages are not
+// counted; 0, the default, sets no limit.
+func SetMemoryLimit(limit int64) RenderOption {
+	return func(r *PdfRenderer) {
+		r.MemoryLimit = limit
+	}
+}
+
+// memoryLeft returns the memory MemoryLimit leaves beyond the images
+// embedded so far
+func (r *PdfRenderer) memoryLeft() int64 {
+	if r.MemoryLimit <= 0 {
+		return math.MaxInt64
+	}
+	return r.MemoryLimit - r.imageMemory
+}
+
+// fitsMemory reports whether size bytes more fit in MemoryLimit
+func (r *PdfRenderer) fitsMemory(size int64) bool {
+	return size <= r.memoryLeft()
+}
+
+// decodedSize returns the size of the pixels of a width x height image,
+// at 4 bytes each
+func decodedSize(width, height int) int64 {
+	return int64(math.Min(float64(width)*float64(height)*4, math.MaxInt64/4))
+}
+
+// embedSize returns the memory fpdf takes to embed an image file of size
+// bytes: about its size, held until the PDF is written, and while it is
+// embedded the pixels of GIF images, which it converts to PNG, and of PNG
+// images with an alpha channel, which it splits off
+func embedSize(size int64, config image.Config, format string) int64 {
+	if format == "gif" || config.ColorModel == color.NRGBAModel || config.ColorModel == color.NRGBA64Model {
+		return size + decodedSize(config.Width, config.Height)
+	}
+	return size
+}
+
+// reserveImage counts the image file at path, about to be embedded,
+// against MemoryLimit, or returns an error if it does not fit in what the
+// images embedded so far leave
+func (r *PdfRenderer) reserveImage(path string) error {
+	if r.MemoryLimit <= 0 || r.reserved[path] {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		// left to fpdf to report
+		return nil
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil
+	}
+	if size := embedSize(stat.Size(), config, format); !r.fitsMemory(size) {
+		return fmt.Errorf("embedding it takes %d bytes, more than the %d the memory limit leaves", size, max(r.memoryLeft(), 0))
+	}
+	if r.reserved == nil {
+		r.reserved = map[string]bool{}
+	}
+	r.reserved[path] = true
+	r.imageMemory += stat.Size()
+	return nil
+}
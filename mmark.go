@@ -0,0 +1,115 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// codeCallout matches an mmark callout in a code block, <<1>>
+var codeCallout = regexp.MustCompile(`<<(\d+)>>`)
+
+// codeCallouts rewrites the callouts of code blocks as (1), the way
+// callouts in the text are printed. Only used with the mmark extensions,
+// where <<1>> is callout syntax.
+func codeCallouts(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if c, ok := node.(*ast.CodeBlock); ok && entering {
+			c.Literal = codeCallout.ReplaceAll(c.Literal, []byte("($1)"))
+		}
+		return ast.GoToNext
+	})
+}
+
+// processAside renders an mmark aside (A> lines) like a block quote, in
+// slightly smaller type
+func (r *PdfRenderer) processAside(entering bool) {
+	if entering {
+		r.resetListCounter()
+		r.tracer("Aside (entering)", "")
+		style := r.Blockquote
+		style.Size *= 0.9
+		left, _, _, _ := r.Pdf.GetMargins()
+		indent := r.blockIndent(notlist)
+		r.cs.push(&containerState{
+			textStyle:         style,
+			listkind:          notlist,
+			leftMargin:        left + indent,
+			contentLeftMargin: left + indent,
+			indent:            indent})
+		r.Pdf.SetLeftMargin(left + indent)
+	} else {
+		r.tracer("Aside (leaving)", "")
+		left, _, _, _ := r.Pdf.GetMargins()
+		r.Pdf.SetLeftMargin(left - r.cs.peek().indent)
+		r.cs.pop()
+		r.cr()
+	}
+}
+
+// processCaptionFigure renders an mmark figure: a table, code block, quote
+// or images followed by their caption
+func (r *PdfRenderer) processCaptionFigure(node *ast.CaptionFigure, entering bool) {
+	if entering {
+		r.tracer("CaptionFigure (entering)", node.HeadingID)
+		r.setCrossRefTarget(node)
+	} else {
+		r.tracer("CaptionFigure (leaving)", "")
+	}
+}
+
+// processCaption renders the caption of an mmark figure on a line of its
+// own, in italics
+func (r *PdfRenderer) processCaption(entering bool) {
+	if entering {
+		r.tracer("Caption (entering)", "")
+		r.cr()
+		style := r.Normal
+		style.Style += "i"
+		r.cs.push(&containerState{
+			textStyle:         style,
+			listkind:          notlist,
+			leftMargin:        r.cs.peek().leftMargin,
+			contentLeftMargin: r.cs.peek().leftMargin})
+		r.setStyler(style)
+	} else {
+		r.tracer("Caption (leaving)", "")
+		r.cs.pop()
+		r.setStyler(r.cs.peek().textStyle)
+		r.cr()
+	}
+}
+
+// processCallout renders an mmark callout, <<1>>, as (1) in bold
+func (r *PdfRenderer) processCallout(node *ast.Callout) {
+	r.tracer("Callout", string(node.ID))
+	style := r.cs.peek().textStyle
+	if incell {
+		r.cs.peek().cellInnerString += "(" + string(node.ID) + ")"
+		return
+	}
+	bold := style
+	bold.Style += "b"
+	r.setStyler(bold)
+	r.write(bold, "("+string(node.ID)+")")
+	r.setStyler(style)
+}
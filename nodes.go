@@ -0,0 +1,210 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// SetWarnUnsupported makes Run warn, once at the end, about the markdown
+// it could not render and dropped, such as unknown inline HTML tags or
+// mmark index entries; see Unsupported
+func SetWarnUnsupported(warn bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.WarnUnsupported = warn
+	}
+}
+
+// Unsupported lists what the last Run dropped, by kind and with the number
+// of occurrences, e.g. "index entry (2)"
+func (r *PdfRenderer) Unsupported() []string {
+	var kinds []string
+	for kind, n := range r.unsupported {
+		kinds = append(kinds, fmt.Sprintf("%s (%d)", kind, n))
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// dropped records that node, described by kind, was not rendered
+func (r *PdfRenderer) dropped(kind string, node ast.Node) {
+	r.tracer("Dropped", fmt.Sprintf("%s: %T", kind, node))
+	if r.unsupported == nil {
+		r.unsupported = map[string]int{}
+	}
+	r.unsupported[kind]++
+}
+
+// warnUnsupported reports what Run dropped, if WarnUnsupported is set
+func (r *PdfRenderer) warnUnsupported() {
+	if r.WarnUnsupported && len(r.unsupported) > 0 {
+		r.logf("Warning: unsupported markdown not rendered: %s", strings.Join(r.Unsupported(), ", "))
+	}
+}
+
+// htmlTagName returns the tag of inline HTML, e.g. <span> or </span>
+func htmlTagName(literal []byte) string {
+	m := inlineTag.FindSubmatch(literal)
+	if m == nil {
+		return string(literal)
+	}
+	return "<" + string(m[1]) + strings.ToLower(string(m[2])) + ">"
+}
+
+// writeInline writes s in the current text style, or adds it to the table
+// cell being rendered
+func (r *PdfRenderer) writeInline(s string) {
+	style := r.cs.peek().textStyle
+	if incell {
+		r.cs.peek().cellInnerString += s
+		r.cs.peek().cellInnerStringStyle = &style
+		return
+	}
+	r.setStyler(style)
+	r.write(style, s)
+}
+
+// processNonBlockingSpace writes the space of a "\ " escape. A no-break
+// space would come out garbled in the core fonts, so it is a plain one.
+func (r *PdfRenderer) processNonBlockingSpace() {
+	r.tracer("NonBlockingSpace", "")
+	r.writeInline(" ")
+}
+
+// processScript writes the text of 2^10^ or H~2~O raised or lowered, in a
+// smaller size
+func (r *PdfRenderer) processScript(literal []byte, super bool) {
+	s := displayText(string(literal))
+	r.tracer("Script", fmt.Sprintf("%q super=%v", s, super))
+	style := r.cs.peek().textStyle
+	if incell {
+		r.cs.peek().cellInnerString += s
+		return
+	}
+	r.setStyler(style)
+	offset := -style.Size * 0.15
+	if super {
+		offset = style.Size * 0.45
+	}
+	r.Pdf.SubWrite(r.lineHeight(style), s, style.Size*0.7, offset, 0, "")
+}
+
+// processFootnoteRef writes the number of a [^note] reference as a
+// superscript; the notes themselves follow in the Footnotes list, unless
+// they are set as sidenotes
+func (r *PdfRenderer) processFootnoteRef(node *ast.Link) {
+	r.processScript([]byte(fmt.Sprint(node.NoteID)), true)
+	if r.Sidenotes {
+		r.sidenote(node)
+	}
+}
+
+// processFootnotes separates the footnotes from the text before them
+func (r *PdfRenderer) processFootnotes(entering bool) {
+	if entering {
+		r.tracer("Footnotes (entering)", "")
+		r.cr()
+		return
+	}
+	r.tracer("Footnotes (leaving)", "")
+}
+
+// processCitation writes an mmark citation, [@RFC2119]; the keys are
+// looked up in the Bibliography if there is one, as [@key] in text is
+func (r *PdfRenderer) processCitation(node *ast.Citation) {
+	var keys, suffixes []string
+	for i, dest := range node.Destination {
+		keys = append(keys, string(dest))
+		if i < len(node.Suffix) && len(node.Suffix[i]) > 0 {
+			suffixes = append(suffixes, string(node.Suffix[i]))
+		}
+	}
+	suffix := ""
+	if len(suffixes) > 0 {
+		suffix = ", " + strings.Join(suffixes, ", ")
+	}
+	s := "[" + strings.Join(keys, "; ") + suffix + "]"
+	if r.Bibliography != nil {
+		s = r.resolveCitations("[@" + strings.Join(keys, "; @") + suffix + "]")
+	}
+	r.tracer("Citation", s)
+	r.writeInline(displayText(s))
+}
+
+// processCrossReference writes an mmark reference, (#id), as a link: to a
+// numbered figure or table by its label, or to a heading by its title
+func (r *PdfRenderer) processCrossReference(node *ast.CrossReference) {
+	id := string(node.Destination)
+	r.tracer("CrossReference", id)
+	style := r.cs.peek().textStyle
+	label, link, ok := "", 0, false
+	if ref, found := r.crossRefs[id]; found {
+		label, link, ok = ref.label, ref.link, true
+	} else if anchor, found := r.headingAnchors[id]; found {
+		label, link, ok = headingTitle(node, id), anchor, true
+	}
+	switch {
+	case !ok:
+		r.writeInline(r.crossRefLabel(id))
+	case incell:
+		r.writeInline(label)
+	default:
+		r.setStyler(style)
+		r.Pdf.SetTextColor(r.Link.TextColor.Red, r.Link.TextColor.Green, r.Link.TextColor.Blue)
+		r.useLink("#"+id, link)
+		r.Pdf.WriteLinkID(r.lineHeight(style), displayText(label), link)
+		r.setStyler(style)
+	}
+}
+
+// headingTitle returns the text of the heading with the given ID in the
+// document of node
+func headingTitle(node ast.Node, id string) string {
+	root := node
+	for root.GetParent() != nil {
+		root = root.GetParent()
+	}
+	var title strings.Builder
+	ast.WalkFunc(root, func(n ast.Node, entering bool) ast.WalkStatus {
+		h, ok := n.(*ast.Heading)
+		if !ok || !entering || h.HeadingID != id {
+			return ast.GoToNext
+		}
+		ast.WalkFunc(h, func(n ast.Node, entering bool) ast.WalkStatus {
+			if t, ok := n.(*ast.Text); ok && entering {
+				title.Write(t.Literal)
+			}
+			return ast.GoToNext
+		})
+		return ast.Terminate
+	})
+	return title.String()
+}
+
+// processMathBlock writes $$ display math $$ as it is, in a code block
+func (r *PdfRenderer) processMathBlock(node *ast.MathBlock) {
+	r.tracer("MathBlock", string(node.Literal))
+	r.resetListCounter()
+	r.outputUnhighlightedCodeBlock(sanitizeText(strings.TrimSpace(string(node.Literal))))
+}
@@ -0,0 +1,282 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// headingNumberer produces hierarchical heading numbers (1, 1.1, 1.2, 2 ...)
+// and, once startAppendix is called, appendix style numbers (A, A.1, B ...).
+type headingNumberer struct {
+	base     int // shallowest heading level in the document
+	counters [7]int
+	appendix bool
+}
+
+// startAppendix switches to appendix lettering; the next top level heading
+// is numbered A.
+func (n *headingNumberer) startAppendix() {
+	n.appendix = true
+	n.counters = [7]int{}
+}
+
+// restart numbers the following headings from 1 again, as at the start
+// of the document
+func (n *headingNumberer) restart() {
+	n.appendix = false
+	n.counters = [7]int{}
+}
+
+// next returns the number of the next heading at the given level
+func (n *headingNumberer) next(level int) string {
+	if n.base == 0 || level < n.base {
+		n.base = level
+	}
+	// a level skipped, as for an H3 right below an H1, counts from 1
+	// rather than showing as 0
+	for l := n.base; l < level; l++ {
+		n.counters[l] = max(n.counters[l], 1)
+	}
+	n.counters[level]++
+	for l := level + 1; l < len(n.counters); l++ {
+		n.counters[l] = 0
+	}
+	parts := make([]string, 0, level-n.base+1)
+	for l := n.base; l <= level; l++ {
+		if l == n.base && n.appendix {
+			parts = append(parts, appendixLetter(n.counters[l]))
+		} else {
+			parts = append(parts, strconv.Itoa(n.counters[l]))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// appendixLetter converts 1, 2 ... 26, 27 to A, B ... Z, AA
+func appendixLetter(n int) string {
+	if n <= 0 {
+		return "0"
+	}
+	s := ""
+	for n > 0 {
+		n--
+		s = string(rune('A'+n%26)) + s
+		n /= 26
+	}
+	return s
+}
+
+// minHeadingLevel returns the shallowest heading level in the document,
+// or 0 if there are no headings
+func minHeadingLevel(doc ast.Node) int {
+	level := 0
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if h, ok := node.(*ast.Heading); ok && entering && !hasClass(h, "unnumbered") && (level == 0 || h.Level < level) {
+			level = h.Level
+		}
+		return ast.GoToNext
+	})
+	return level
+}
+
+// headingAttrs matches the attribute block ending a heading, as in
+// "# Intro {.unnumbered .notoc #intro}"
+var headingAttrs = regexp.MustCompile(`\s*\{((?:\s*(?:[#.][\w:-]+|[\w-]+=[^\s{}]+))+)\s*\}\s*$`)
+
+// parseHeadingAttributes moves the attribute blocks ending heading texts
+// into the headings' Attribute (classes and key=value pairs) and HeadingID.
+// The parser only understands a lone {#id}: with HeadingIDs enabled it
+// takes a whole {#id .class} block for the ID, which is split here too.
+func parseHeadingAttributes(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		h, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		if strings.ContainsAny(h.HeadingID, " \t") {
+			setHeadingAttributes(h, "#"+h.HeadingID)
+		}
+		if len(h.Children) == 0 {
+			return ast.SkipChildren
+		}
+		text, ok := h.Children[len(h.Children)-1].(*ast.Text)
+		if !ok {
+			return ast.SkipChildren
+		}
+		if m := headingAttrs.FindSubmatchIndex(text.Literal); m != nil {
+			setHeadingAttributes(h, string(text.Literal[m[2]:m[3]]))
+			text.Literal = text.Literal[:m[0]]
+		}
+		return ast.SkipChildren
+	})
+}
+
+// setHeadingAttributes applies an attribute list such as
+// "#id .class key=value" to heading h
+func setHeadingAttributes(h *ast.Heading, attrs string) {
+	if h.Attribute == nil {
+		h.Attribute = &ast.Attribute{}
+	}
+	for _, attr := range strings.Fields(attrs) {
+		switch {
+		case attr[0] == '#':
+			h.HeadingID = attr[1:]
+			h.Attribute.ID = []byte(attr[1:])
+		case attr[0] == '.':
+			h.Attribute.Classes = append(h.Attribute.Classes, []byte(attr[1:]))
+		default:
+			key, value, _ := strings.Cut(attr, "=")
+			if h.Attribute.Attrs == nil {
+				h.Attribute.Attrs = map[string][]byte{}
+			}
+			h.Attribute.Attrs[key] = []byte(strings.Trim(value, `"'`))
+		}
+	}
+}
+
+// headingClasses returns the classes given to a heading
+func headingClasses(h *ast.Heading) []string {
+	if h.Attribute == nil {
+		return nil
+	}
+	classes := make([]string, len(h.Attribute.Classes))
+	for i, c := range h.Attribute.Classes {
+		classes[i] = string(c)
+	}
+	return classes
+}
+
+// hasClass reports whether heading h has one of the classes
+func hasClass(h *ast.Heading, classes ...string) bool {
+	for _, c := range headingClasses(h) {
+		for _, class := range classes {
+			if c == class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headingPrefix writes the heading number, if numbering is enabled, and adds
+// the heading to the PDF outline, if bookmarks are enabled
+func (r *PdfRenderer) headingPrefix(node *ast.Heading) {
+	number := ""
+	if r.NumberHeadings && !hasClass(node, "unnumbered") {
+		number = r.headingNumbers.next(node.Level)
+		style := r.cs.peek().textStyle
+		r.setStyler(style)
+		r.write(style, number+" ")
+	}
+	if r.Bookmarks {
+		text := ExtractTextFromNode(node)
+		if hasClass(node, "redact") {
+			text = RedactedLabel
+		}
+		title := strings.TrimSpace(number + " " + text)
+		// outline levels may not skip, e.g. H1 followed directly by H3
+		level := node.Level - r.headingNumbers.base + r.bookmarkDepth
+		if level > r.bookmarkLevel+1 {
+			level = r.bookmarkLevel + 1
+		}
+		if level < r.bookmarkDepth {
+			level = r.bookmarkDepth
+		}
+		r.bookmarkLevel = level
+		r.Pdf.Bookmark(title, level, -1)
+	}
+}
+
+// partBookmark adds a top level PDF outline entry at the current position,
+// titled by the title= of a <!-- bookmark --> directive, under which the
+// bookmarks of the following headings are nested; md2pdf starts every file
+// of a directory input with one
+func (r *PdfRenderer) partBookmark(d directive) {
+	if !r.Bookmarks {
+		return
+	}
+	title := d.attrs["title"]
+	if title == "" && len(d.args) > 0 {
+		title = d.args[0]
+	}
+	r.Pdf.Bookmark(title, 0, -1)
+	r.bookmarkLevel = 0
+	r.bookmarkDepth = 1
+}
+
+// SetHeadingNumbering prefixes headings with hierarchical numbers (1, 1.1 ...).
+// An <!-- appendix --> directive switches to appendix lettering (A, A.1 ...).
+func SetHeadingNumbering(value bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.NumberHeadings = value
+	}
+}
+
+// SetBookmarks adds a PDF outline entry (bookmark) for every heading
+func SetBookmarks(value bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Bookmarks = value
+	}
+}
+
+// ShiftHeadingLevel demotes a heading level by shift levels (promotes it
+// for a negative shift) and clamps the result to 1 .. maxLevel, or to 1 .. 6
+// if maxLevel is 0
+func ShiftHeadingLevel(level, shift, maxLevel int) int {
+	if maxLevel <= 0 || maxLevel > 6 {
+		maxLevel = 6
+	}
+	return min(max(level+shift, 1), maxLevel)
+}
+
+// shiftHeadings applies HeadingShift and MaxHeadingLevel to the headings
+// of doc
+func (r *PdfRenderer) shiftHeadings(doc ast.Node) {
+	if r.HeadingShift == 0 && r.MaxHeadingLevel == 0 {
+		return
+	}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if h, ok := node.(*ast.Heading); ok && entering {
+			h.Level = ShiftHeadingLevel(h.Level, r.HeadingShift, r.MaxHeadingLevel)
+		}
+		return ast.GoToNext
+	})
+}
+
+// SetHeadingShift demotes all headings by n levels, e.g. to embed a
+// document as a chapter of a larger one: with n=1 "#" is rendered as "##"
+func SetHeadingShift(n int) RenderOption {
+	return func(r *PdfRenderer) {
+		r.HeadingShift = n
+	}
+}
+
+// SetMaxHeadingLevel renders headings deeper than level (after
+// SetHeadingShift) at that level; 0 leaves them alone
+func SetMaxHeadingLevel(level int) RenderOption {
+	return func(r *PdfRenderer) {
+		r.MaxHeadingLevel = level
+	}
+}
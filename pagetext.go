@@ -0,0 +1,164 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// pageVariable matches the variables of header and footer text
+var pageVariable = regexp.MustCompile(`\{(page|pages|date|time|datetime:[^{}]*)\}`)
+
+// SetHeaderText prints text in the top margin of every page, and
+// SetFooterText in the bottom margin. "|" divides it into parts: one part
+// is centered, two are aligned left and right, three left, center and
+// right. It may contain the variables
+//
+//	{page}              the page number
+//	{pages}             the number of pages
+//	{date}              the date of generation, as 2006-01-02
+//	{time}              the time of generation, as 15:04
+//	{datetime:layout}   the time of generation in a Go layout, e.g.
+//	                    {datetime:2 January 2006}, with month and day
+//	                    names in the locale of SetLocale
+//
+// The time of generation is taken from SOURCE_DATE_EPOCH if set, for
+// reproducible builds, and shown in the zone of SetTimeZone.
+func SetHeaderText(text string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.HeaderText = text
+	}
+}
+
+// SetFooterText prints text in the bottom margin of every page, see
+// SetHeaderText
+func SetFooterText(text string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.FooterText = text
+	}
+}
+
+// SetTimeZone sets the IANA time zone, e.g. "Europe/Berlin" or "UTC", the
+// date variables of the header and footer text are shown in, so that the
+// date does not depend on the machine building the document; the local
+// zone by default. An unknown zone is ignored with a warning.
+func SetTimeZone(name string) RenderOption {
+	return func(r *PdfRenderer) {
+		if _, err := time.LoadLocation(name); err != nil {
+			r.logf("Warning: unknown time zone %q", name)
+			return
+		}
+		r.TimeZone = name
+	}
+}
+
+// generationTime returns the time the document is generated at, in
+// TimeZone
+func (r *PdfRenderer) generationTime() time.Time {
+	now := time.Now()
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if s, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			now = time.Unix(s, 0)
+		} else {
+			r.logf("Warning: invalid SOURCE_DATE_EPOCH %q", epoch)
+		}
+	}
+	if loc, err := time.LoadLocation(r.TimeZone); r.TimeZone != "" && err == nil {
+		return now.In(loc)
+	}
+	return now.Local()
+}
+
+// expandPageText replaces the variables of header or footer text for page
+func (r *PdfRenderer) expandPageText(text string, page int, generated time.Time, tag language.Tag) string {
+	return pageVariable.ReplaceAllStringFunc(text, func(v string) string {
+		name := v[1 : len(v)-1]
+		switch {
+		case name == "page":
+			return strconv.Itoa(page)
+		case name == "pages":
+			return strconv.Itoa(r.Pdf.PageCount())
+		case name == "date":
+			return generated.Format("2006-01-02")
+		case name == "time":
+			return generated.Format("15:04")
+		}
+		return localDate(tag, generated, strings.TrimPrefix(name, "datetime:"))
+	})
+}
+
+// stampPageText prints HeaderText and FooterText on every page, vertically
+// centered in the top and bottom margins
+func (r *PdfRenderer) stampPageText() {
+	if r.HeaderText == "" && r.FooterText == "" {
+		return
+	}
+	tag, err := language.Parse(r.Locale)
+	if err != nil {
+		tag = language.English
+	}
+	generated := r.generationTime()
+	m := r.currentMargins()
+	style := r.Normal
+	style.Size = 0.8 * r.Normal.Size
+	height := r.lineHeight(style)
+	page, x, y := r.Pdf.PageNo(), r.Pdf.GetX(), r.Pdf.GetY()
+	r.Pdf.SetAutoPageBreak(false, m.bottom)
+	for p := 1; p <= r.Pdf.PageCount(); p++ {
+		// fonts and colors are per page content stream
+		r.Pdf.SetPage(p)
+		r.setStyler(style)
+		pageWidth, pageHeight := r.pageSize(p)
+		dy := r.pageOffset(p)
+		if r.HeaderText != "" {
+			r.drawPageText(r.expandPageText(r.HeaderText, p, generated, tag), m, pageWidth, (m.top-height)/2+dy, height)
+		}
+		if r.FooterText != "" {
+			r.drawPageText(r.expandPageText(r.FooterText, p, generated, tag), m, pageWidth, pageHeight-(m.bottom+height)/2+dy, height)
+		}
+	}
+	r.tracer("PageText", fmt.Sprintf("header %q, footer %q on %d pages", r.HeaderText, r.FooterText, r.Pdf.PageCount()))
+	r.Pdf.SetAutoPageBreak(true, m.bottom)
+	r.Pdf.SetPage(page)
+	r.Pdf.SetXY(x, y)
+	r.setStyler(r.cs.peek().textStyle)
+}
+
+// drawPageText draws the "|" separated parts of text on a line at y
+// between the side margins
+func (r *PdfRenderer) drawPageText(text string, m margins, pageWidth, y, height float64) {
+	parts := strings.Split(text, "|")
+	aligns := map[int][]string{1: {"C"}, 2: {"L", "R"}, 3: {"L", "C", "R"}}[len(parts)]
+	if aligns == nil {
+		// more bars are text
+		parts, aligns = []string{text}, []string{"C"}
+	}
+	for i, part := range parts {
+		r.Pdf.SetXY(m.left, y)
+		r.Pdf.CellFormat(pageWidth-m.left-m.right, height, strings.TrimSpace(part), "", 0, aligns[i], false, 0, "")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// panel is an open <!-- panel --> region: where it starts, the margins it
+// narrows and the container state it pushed
+type panel struct {
+	page        int
+	y           float64
+	left, right float64
+	state       *containerState
+}
+
+// panelPadding returns the space between the border of a panel and its
+// content, in document units
+func (r *PdfRenderer) panelPadding() float64 {
+	return 0.6 * r.em
+}
+
+// openPanel starts a region drawn in a bordered panel, e.g. the sample
+// input and output of a tutorial, between <!-- panel Example --> and
+// <!-- /panel --> comments. The words after panel are the label shown in
+// a tab at its top left corner. Panels nest and may span pages.
+func (r *PdfRenderer) openPanel(d directive) {
+	pad := r.panelPadding()
+	lineHeight := r.lineHeight(r.Normal)
+	r.cr()
+	r.ensureSpace(3 * lineHeight)
+	left, _, right, _ := r.Pdf.GetMargins()
+	p := &panel{page: r.Pdf.PageNo(), y: r.Pdf.GetY(), left: left, right: right}
+	r.Pdf.SetX(left)
+	if label := strings.Join(d.args, " "); label != "" {
+		style := r.Normal
+		style.Style, style.Size = "b", 0.8*r.Normal.Size
+		style.TextColor, style.FillColor = r.BackgroundColor, r.PanelColor
+		if r.BackgroundColor == (Color{}) {
+			style.TextColor = Colorlookup("white")
+		}
+		r.setStyler(style)
+		r.Pdf.CellFormat(r.Pdf.GetStringWidth(label)+2*pad, r.lineHeight(style), label, "", 0, "L", true, 0, "")
+		r.setStyler(r.Normal)
+	}
+	r.Pdf.SetLeftMargin(left + pad)
+	r.Pdf.SetRightMargin(right + pad)
+	r.Pdf.SetY(r.Pdf.GetY() + pad)
+	p.state = &containerState{
+		textStyle:         r.cs.peek().textStyle,
+		listkind:          notlist,
+		leftMargin:        left + pad,
+		contentLeftMargin: left + pad}
+	r.cs.push(p.state)
+	r.panels = append(r.panels, p)
+	r.tracer("Panel", fmt.Sprintf("opened on page %d at %.2f", p.page, p.y))
+}
+
+// closePanel ends the innermost open panel and draws its border, on every
+// page it spans
+func (r *PdfRenderer) closePanel() {
+	if len(r.panels) == 0 {
+		r.logf("Warning: <!-- /panel --> without <!-- panel -->")
+		return
+	}
+	p := r.panels[len(r.panels)-1]
+	r.panels = r.panels[:len(r.panels)-1]
+	if r.cs.peek() == p.state {
+		r.cs.pop()
+	} else {
+		r.logf("Warning: <!-- /panel --> in another block than its <!-- panel -->")
+		for i, s := range r.cs.stack {
+			if s == p.state {
+				r.cs.stack = append(r.cs.stack[:i], r.cs.stack[i+1:]...)
+				break
+			}
+		}
+	}
+	endPage, endY := r.Pdf.PageNo(), r.Pdf.GetY()
+	left, top, _, _ := r.Pdf.GetMargins()
+	if r.Pdf.GetX() > left {
+		// still on the last line of the panel
+		endY += r.lineHeight(r.Normal)
+	}
+	endY += r.panelPadding()
+	r.Pdf.SetLeftMargin(p.left)
+	r.Pdf.SetRightMargin(p.right)
+	pageWidth, pageHeight := r.Pdf.GetPageSize()
+	_, breakMargin := r.Pdf.GetAutoPageBreak()
+	x0, x1 := p.left, pageWidth-p.right
+
+	// drawing state is per page content stream, so set and restore it on
+	// every page
+	dr, dg, db := r.Pdf.GetDrawColor()
+	lineWidth := r.Pdf.GetLineWidth()
+	for page := p.page; page <= endPage; page++ {
+		y0, y1 := top, pageHeight-breakMargin
+		if page == p.page {
+			y0 = p.y
+		}
+		if page == endPage {
+			y1 = min(endY, y1)
+		}
+		r.Pdf.SetPage(page)
+		r.Pdf.SetDrawColor(r.PanelColor.Red, r.PanelColor.Green, r.PanelColor.Blue)
+		r.Pdf.SetLineWidth(0.8)
+		r.Pdf.Line(x0, y0, x0, y1)
+		r.Pdf.Line(x1, y0, x1, y1)
+		if page == p.page {
+			r.Pdf.Line(x0, y0, x1, y0)
+		}
+		if page == endPage {
+			r.Pdf.Line(x0, y1, x1, y1)
+		}
+		r.Pdf.SetLineWidth(lineWidth)
+		r.Pdf.SetDrawColor(dr, dg, db)
+	}
+	r.Pdf.SetPage(endPage)
+	r.Pdf.SetY(endY)
+	r.tracer("Panel", fmt.Sprintf("closed on page %d at %.2f", endPage, endY))
+}
+
+// closePanels closes the panels left open at the end of the document
+func (r *PdfRenderer) closePanels() {
+	if len(r.panels) > 0 {
+		r.logf("Warning: <!-- panel --> without <!-- /panel -->")
+	}
+	for len(r.panels) > 0 {
+		r.closePanel()
+	}
+}
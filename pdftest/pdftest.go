@@ -0,0 +1,236 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+// Package pdftest checks that markdown renders as before: it rasterizes the
+// pages of the PDF and compares them with golden images, allowing for a
+// small fraction of differing pixels such as anti-aliasing noise.
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+//	func TestManual(t *testing.T) {
+//		pdftest.CompareFile(t, "testdata/manual.md", pdftest.Options{Update: *update})
+//	}
+//
+// Pages are rasterized with one of mdtopdf.Rasterizers; tests are skipped
+// if none is installed.
+package pdftest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mdtopdf "github.com/solworktech/md2pdf/v2"
+)
+
+// Options for Check and Compare; the zero value uses the defaults
+type Options struct {
+	// GoldenDir holds the golden images NAME-1.png, NAME-2.png, ...;
+	// default testdata/golden
+	GoldenDir string
+	// DPI is the resolution pages are rasterized at; default 72
+	DPI int
+	// Tolerance is the fraction of pixels that may differ; default 0.001
+	Tolerance float64
+	// Update writes the rendered pages as the new golden images
+	Update bool
+	// Params configure the renderer; PdfFile is ignored and Theme defaults
+	// to mdtopdf.LIGHT
+	Params mdtopdf.PdfRendererParams
+}
+
+// channelThreshold is the difference in a colour channel, out of 0xffff,
+// below which pixels count as equal
+const channelThreshold = 0x1000
+
+func (o Options) withDefaults() Options {
+	if o.GoldenDir == "" {
+		o.GoldenDir = filepath.Join("testdata", "golden")
+	}
+	if o.DPI == 0 {
+		o.DPI = 72
+	}
+	if o.Tolerance == 0 {
+		o.Tolerance = 0.001
+	}
+	if o.Params.Theme == 0 {
+		o.Params.Theme = mdtopdf.LIGHT
+	}
+	return o
+}
+
+// Render converts markdown to PDF and returns its pages as PNG images
+func Render(markdown []byte, opts Options) ([][]byte, error) {
+	opts = opts.withDefaults()
+	rz, err := mdtopdf.FindRasterizer()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "pdftest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	params := opts.Params
+	params.PdfFile = filepath.Join(dir, "render.pdf")
+	if err := mdtopdf.NewPdfRenderer(params).Process(markdown); err != nil {
+		return nil, err
+	}
+	return rz.Rasterize(params.PdfFile, opts.DPI)
+}
+
+// Check renders markdown and compares its pages with the golden images
+// named after name, or writes them with opts.Update. The error lists the
+// pages that differ; their renderings are kept in a temporary directory
+// for inspection.
+func Check(name string, markdown []byte, opts Options) error {
+	opts = opts.withDefaults()
+	pages, err := Render(markdown, opts)
+	if err != nil {
+		return err
+	}
+	golden := func(n int) string {
+		return filepath.Join(opts.GoldenDir, fmt.Sprintf("%s-%d.png", name, n))
+	}
+	if opts.Update {
+		if err := os.MkdirAll(opts.GoldenDir, 0755); err != nil {
+			return err
+		}
+		for i, page := range pages {
+			if err := os.WriteFile(golden(i+1), page, 0644); err != nil {
+				return err
+			}
+		}
+		// pages beyond the new end are stale
+		for n := len(pages) + 1; ; n++ {
+			if err := os.Remove(golden(n)); err != nil {
+				break
+			}
+		}
+		return nil
+	}
+	var problems []string
+	for i, page := range pages {
+		want, err := os.ReadFile(golden(i + 1))
+		if errors.Is(err, os.ErrNotExist) {
+			problems = append(problems, fmt.Sprintf("page %d: no golden image %s", i+1, golden(i+1)))
+			continue
+		} else if err != nil {
+			return err
+		}
+		if bytes.Equal(page, want) {
+			continue
+		}
+		diff, err := DiffPNG(page, want)
+		if err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+		if diff > opts.Tolerance {
+			problems = append(problems, fmt.Sprintf("page %d: %.2f%% of the pixels differ from %s", i+1, diff*100, golden(i+1)))
+		}
+	}
+	if _, err := os.Stat(golden(len(pages) + 1)); err == nil {
+		problems = append(problems, fmt.Sprintf("%d pages rendered, but there is a golden image %s", len(pages), golden(len(pages)+1)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if dir, err := os.MkdirTemp("", "pdftest-"+name+"-*"); err == nil {
+		for i, page := range pages {
+			os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s-%d.png", name, i+1)), page, 0644)
+		}
+		problems = append(problems, "rendered pages are in "+dir)
+	}
+	return fmt.Errorf("%s: %s", name, strings.Join(problems, "; "))
+}
+
+// Compare is Check for tests: it reports differences with t.Error, and
+// skips the test if no rasterizer is installed
+func Compare(t testing.TB, name string, markdown []byte, opts Options) {
+	t.Helper()
+	err := Check(name, markdown, opts)
+	if errors.Is(err, mdtopdf.ErrNoRasterizer) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CompareFile is Compare for a markdown file, with golden images named
+// after the file
+func CompareFile(t testing.TB, path string, opts Options) {
+	t.Helper()
+	markdown, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Params.Opts == nil {
+		opts.Params.Opts = []mdtopdf.RenderOption{mdtopdf.SetInputBaseDir(filepath.Dir(path))}
+	}
+	Compare(t, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), markdown, opts)
+}
+
+// DiffPNG returns the fraction of pixels that differ between two PNG
+// images, 1 if their sizes differ
+func DiffPNG(a, b []byte) (float64, error) {
+	ia, err := png.Decode(bytes.NewReader(a))
+	if err != nil {
+		return 0, err
+	}
+	ib, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	return Diff(ia, ib), nil
+}
+
+// Diff returns the fraction of pixels that differ between a and b, 1 if
+// their sizes differ. Colour channels within channelThreshold count as
+// equal.
+func Diff(a, b image.Image) float64 {
+	ra, rb := a.Bounds(), b.Bounds()
+	if ra.Dx() != rb.Dx() || ra.Dy() != rb.Dy() {
+		return 1
+	}
+	if ra.Empty() {
+		return 0
+	}
+	differ := 0
+	for y := 0; y < ra.Dy(); y++ {
+		for x := 0; x < ra.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ra.Min.X+x, ra.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(rb.Min.X+x, rb.Min.Y+y).RGBA()
+			if far(r1, r2) || far(g1, g2) || far(b1, b2) || far(a1, a2) {
+				differ++
+			}
+		}
+	}
+	return float64(differ) / float64(ra.Dx()*ra.Dy())
+}
+
+func far(a, b uint32) bool {
+	return max(a, b)-min(a, b) > channelThreshold
+}
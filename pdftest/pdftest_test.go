@@ -0,0 +1,94 @@
+package pdftest
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mdtopdf "github.com/solworktech/md2pdf/v2"
+)
+
+// writePNG writes a white w×h image with n black pixels
+func writePNG(t *testing.T, path string, w, h, n int) {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for i := 0; i < n; i++ {
+		img.Set(i%w, i/w, color.Black)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if _, err := exec.LookPath("cp"); err != nil {
+		t.Skip("the fake rasterizer copies a page image with cp")
+	}
+	dir := t.TempDir()
+	// for the renderings Check keeps
+	t.Setenv("TMPDIR", dir)
+	page := filepath.Join(dir, "page.png")
+	defer func(saved []mdtopdf.Rasterizer) { mdtopdf.Rasterizers = saved }(mdtopdf.Rasterizers)
+	mdtopdf.Rasterizers = []mdtopdf.Rasterizer{{Command: "cp", Args: func(pdf, out string, dpi int) []string {
+		return []string{page, filepath.Join(out, "page-1.png")}
+	}}}
+	opts := Options{GoldenDir: filepath.Join(dir, "golden"), Params: mdtopdf.PdfRendererParams{DefaultFont: "Helvetica"}}
+	src := []byte("# Golden\n")
+
+	writePNG(t, page, 100, 100, 0)
+	if err := Check("doc", src, opts); err == nil || !strings.Contains(err.Error(), "no golden image") {
+		t.Fatalf("expected a missing golden image, got %v", err)
+	}
+	update := opts
+	update.Update = true
+	if err := Check("doc", src, update); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check("doc", src, opts); err != nil {
+		t.Fatalf("unchanged rendering: %v", err)
+	}
+
+	// 5 pixels of 10000 are within the default tolerance, 50 are not
+	writePNG(t, page, 100, 100, 5)
+	if err := Check("doc", src, opts); err != nil {
+		t.Fatalf("change within the tolerance: %v", err)
+	}
+	writePNG(t, page, 100, 100, 50)
+	if err := Check("doc", src, opts); err == nil || !strings.Contains(err.Error(), "0.50% of the pixels differ") {
+		t.Fatalf("expected the page to differ, got %v", err)
+	}
+
+	mdtopdf.Rasterizers = nil
+	if err := Check("doc", src, opts); !errors.Is(err, mdtopdf.ErrNoRasterizer) {
+		t.Fatalf("expected ErrNoRasterizer, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := image.NewGray(image.Rect(0, 0, 10, 10))
+	b := image.NewGray(image.Rect(5, 5, 15, 15))
+	if d := Diff(a, b); d != 0 {
+		t.Errorf("equal images at other origins differ by %v", d)
+	}
+	b.SetGray(5, 5, color.Gray{Y: 8})
+	b.SetGray(6, 5, color.Gray{Y: 255})
+	if d := Diff(a, b); d != 0.01 {
+		t.Errorf("one pixel of 100 beyond the threshold: got %v", d)
+	}
+	if d := Diff(a, image.NewGray(image.Rect(0, 0, 10, 11))); d != 1 {
+		t.Errorf("images of different sizes differ by %v", d)
+	}
+}
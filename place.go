@@ -0,0 +1,126 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// placement is an open <!-- place --> region, with the position in the
+// text flow to come back to
+type placement struct {
+	page   int
+	x, y   float64
+	margin margins
+	state  *containerState
+}
+
+// openPlacement starts a region laid out at a fixed place on the page,
+// out of the text flow, e.g. the address block of a letter:
+//
+//	<!-- place top right width=80mm -->
+//	...
+//	<!-- /place -->
+//
+// top puts it at the top margin and bottom at the bottom margin (which
+// needs its height=); left, right and center align it between the side
+// margins. x= and y= give its top left corner from the page edges
+// instead, and width= its width: by default half the text width beside
+// the margins and all of it otherwise. Nothing is moved out of its way,
+// and what does not fit the page is cut off.
+func (r *PdfRenderer) openPlacement(d directive) {
+	pageWidth, pageHeight := r.Pdf.GetPageSize()
+	m := r.currentMargins()
+	textWidth := pageWidth - m.left - m.right
+	has := func(word string) bool { return slices.Contains(d.args, word) }
+
+	width := textWidth
+	if has("left") || has("right") {
+		width = textWidth / 2
+	}
+	width = min(r.directiveLength(d, "width", width), pageWidth)
+	x := m.left
+	switch {
+	case has("right"):
+		x = pageWidth - m.right - width
+	case has("center"):
+		x = (pageWidth - width) / 2
+	}
+	x = r.directiveLength(d, "x", x)
+	y := r.Pdf.GetY()
+	switch {
+	case has("top"):
+		y = m.top
+	case has("bottom"):
+		height := r.directiveLength(d, "height", 0)
+		if height == 0 {
+			r.logf("Warning: <!-- place bottom --> needs a height=; placed at the current line")
+			break
+		}
+		y = pageHeight - m.bottom - height
+	}
+	y = r.directiveLength(d, "y", y)
+
+	p := &placement{page: r.Pdf.PageNo(), x: r.Pdf.GetX(), y: r.Pdf.GetY(), margin: m}
+	r.Pdf.SetAutoPageBreak(false, m.bottom)
+	r.Pdf.SetLeftMargin(x)
+	r.Pdf.SetRightMargin(max(pageWidth-x-width, 0))
+	r.Pdf.SetXY(x, y)
+	p.state = &containerState{
+		textStyle:         r.cs.peek().textStyle,
+		listkind:          notlist,
+		leftMargin:        x,
+		contentLeftMargin: x}
+	r.cs.push(p.state)
+	r.placements = append(r.placements, p)
+	r.tracer("Place", fmt.Sprintf("%.2f wide at %.2f, %.2f", width, x, y))
+}
+
+// closePlacement ends the innermost <!-- place --> region and goes back to
+// where the text flow was
+func (r *PdfRenderer) closePlacement() {
+	if len(r.placements) == 0 {
+		r.logf("Warning: <!-- /place --> without <!-- place -->")
+		return
+	}
+	p := r.placements[len(r.placements)-1]
+	r.placements = r.placements[:len(r.placements)-1]
+	if i := slices.Index(r.cs.stack, p.state); i >= 0 {
+		if i != len(r.cs.stack)-1 {
+			r.logf("Warning: <!-- /place --> in another block than its <!-- place -->")
+		}
+		r.cs.stack = slices.Delete(r.cs.stack, i, i+1)
+	}
+	r.Pdf.SetMargins(p.margin.left, p.margin.top, p.margin.right)
+	r.Pdf.SetAutoPageBreak(true, p.margin.bottom)
+	r.Pdf.SetPage(p.page)
+	r.Pdf.SetXY(p.x, p.y)
+}
+
+// closePlacements closes the regions left open at the end of the document
+func (r *PdfRenderer) closePlacements() {
+	if len(r.placements) > 0 {
+		r.logf("Warning: <!-- place --> without <!-- /place -->")
+	}
+	for len(r.placements) > 0 {
+		r.closePlacement()
+	}
+}
@@ -0,0 +1,316 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// pngReader reads a PNG file a row of pixels at a time, so that an image
+// too large to decode as a whole can be downsampled as it is read; see
+// readPNGHeader and scale
+type pngReader struct {
+	r             *bufio.Reader
+	width, height int
+	depth         int
+	colorType     byte
+	palette       []color.NRGBA
+	transparent   []uint16 // the samples of the transparent gray or RGB color
+	dpi           float64  // as fpdf reads it, 72 without a pHYs chunk
+	left          uint32   // bytes left of the IDAT chunk being read
+}
+
+// readPNGHeader reads the chunks of a PNG file up to its image data
+func readPNGHeader(r io.Reader) (*pngReader, error) {
+	p := &pngReader{r: bufio.NewReader(r), dpi: 72}
+	signature := make([]byte, 8)
+	if _, err := io.ReadFull(p.r, signature); err != nil || string(signature) != "\x89PNG\r\n\x1a\n" {
+		return nil, errors.New("not a PNG file")
+	}
+	for {
+		length, kind, err := p.chunk()
+		if err != nil {
+			return nil, err
+		}
+		if kind == "IDAT" {
+			p.left = length
+			break
+		}
+		if kind != "IHDR" && kind != "PLTE" && kind != "tRNS" && kind != "pHYs" {
+			if kind == "IEND" {
+				return nil, errors.New("PNG without image data")
+			}
+			if _, err := p.r.Discard(int(length) + 4); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data := make([]byte, int(length)+4) // and the CRC
+		if _, err := io.ReadFull(p.r, data); err != nil {
+			return nil, err
+		}
+		data = data[:length]
+		switch kind {
+		case "IHDR":
+			if length < 13 {
+				return nil, errors.New("short PNG header")
+			}
+			p.width, p.height = int(binary.BigEndian.Uint32(data)), int(binary.BigEndian.Uint32(data[4:]))
+			p.depth, p.colorType = int(data[8]), data[9]
+			if data[12] != 0 {
+				return nil, errors.New("interlaced PNG")
+			}
+		case "PLTE":
+			for i := 0; i+2 < len(data); i += 3 {
+				p.palette = append(p.palette, color.NRGBA{data[i], data[i+1], data[i+2], 255})
+			}
+		case "tRNS":
+			if p.colorType == 3 {
+				for i := 0; i < len(data) && i < len(p.palette); i++ {
+					p.palette[i].A = data[i]
+				}
+			}
+			for i := 0; i+1 < len(data) && (p.colorType == 0 || p.colorType == 2); i += 2 {
+				p.transparent = append(p.transparent, binary.BigEndian.Uint16(data[i:]))
+			}
+		case "pHYs":
+			// as fpdf reads it, in pixels per meter or, without a unit,
+			// per inch
+			if length < 9 {
+				break
+			}
+			if x, y := binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:]); x == y && x > 0 {
+				p.dpi = float64(x)
+				if data[8] == 1 {
+					p.dpi /= 39.3701
+				}
+			}
+		}
+	}
+	if p.width <= 0 || p.height <= 0 {
+		return nil, errors.New("PNG without a header")
+	}
+	if _, err := p.channels(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// chunk reads the length and type of the next chunk
+func (p *pngReader) chunk() (uint32, string, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		return 0, "", err
+	}
+	return binary.BigEndian.Uint32(header), string(header[4:]), nil
+}
+
+// Read reads the compressed image data, from one IDAT chunk to the next
+func (p *pngReader) Read(b []byte) (int, error) {
+	for p.left == 0 {
+		// the CRC of the chunk read, then the next one
+		if _, err := p.r.Discard(4); err != nil {
+			return 0, err
+		}
+		length, kind, err := p.chunk()
+		if err != nil {
+			return 0, err
+		}
+		if kind != "IDAT" {
+			return 0, io.EOF
+		}
+		p.left = length
+	}
+	n, err := p.r.Read(b[:min(len(b), int(p.left))])
+	p.left -= uint32(n)
+	return n, err
+}
+
+// channels returns the number of samples of a pixel
+func (p *pngReader) channels() (int, error) {
+	depths := map[byte][]int{0: {1, 2, 4, 8, 16}, 2: {8, 16}, 3: {1, 2, 4, 8}, 4: {8, 16}, 6: {8, 16}}
+	for _, depth := range depths[p.colorType] {
+		if depth == p.depth {
+			return map[byte]int{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[p.colorType], nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported PNG of color type %d and bit depth %d", p.colorType, p.depth)
+}
+
+// scale reads the image data into a width x height image, no larger than
+// the image, each pixel of which is the average of the pixels it covers.
+// Besides the result it keeps two rows of the image in memory.
+func (p *pngReader) scale(width, height int) (*image.NRGBA, error) {
+	channels, _ := p.channels()
+	stride := (p.width*channels*p.depth + 7) / 8
+	bpp := max(1, channels*p.depth/8) // bytes per pixel, for the filters
+	z, err := zlib.NewReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	// alpha weighted red, green and blue, alpha and count of each pixel of
+	// the destination row
+	sums := make([]uint64, width*5)
+	flush := func(y int) {
+		for x := 0; x < width; x++ {
+			s := sums[x*5 : x*5+5]
+			if s[3] > 0 {
+				dst.SetNRGBA(x, y, color.NRGBA{uint8(s[0] / s[3]), uint8(s[1] / s[3]), uint8(s[2] / s[3]), uint8(s[3] / s[4])})
+			}
+			clear(s)
+		}
+	}
+	row, prev := make([]byte, 1+stride), make([]byte, 1+stride)
+	dy := 0
+	for y := 0; y < p.height; y++ {
+		if _, err := io.ReadFull(z, row); err != nil {
+			return nil, err
+		}
+		if err := unfilter(row[0], row[1:], prev[1:], bpp); err != nil {
+			return nil, err
+		}
+		if ty := y * height / p.height; ty != dy {
+			flush(dy)
+			dy = ty
+		}
+		for x := 0; x < p.width; x++ {
+			c := p.pixel(row[1:], x)
+			s := sums[x*width/p.width*5:]
+			a := uint64(c.A)
+			s[0] += uint64(c.R) * a
+			s[1] += uint64(c.G) * a
+			s[2] += uint64(c.B) * a
+			s[3] += a
+			s[4]++
+		}
+		row, prev = prev, row
+	}
+	flush(dy)
+	return dst, nil
+}
+
+// pixel returns pixel x of an unfiltered row
+func (p *pngReader) pixel(row []byte, x int) color.NRGBA {
+	switch p.colorType {
+	case 0:
+		v, raw := p.sample(row, x)
+		if len(p.transparent) > 0 && raw == p.transparent[0] {
+			return color.NRGBA{}
+		}
+		return color.NRGBA{v, v, v, 255}
+	case 2:
+		r, rr := p.sample(row, 3*x)
+		g, rg := p.sample(row, 3*x+1)
+		b, rb := p.sample(row, 3*x+2)
+		if len(p.transparent) > 2 && rr == p.transparent[0] && rg == p.transparent[1] && rb == p.transparent[2] {
+			return color.NRGBA{}
+		}
+		return color.NRGBA{r, g, b, 255}
+	case 3:
+		if _, i := p.sample(row, x); int(i) < len(p.palette) {
+			return p.palette[i]
+		}
+		return color.NRGBA{A: 255}
+	case 4:
+		v, _ := p.sample(row, 2*x)
+		a, _ := p.sample(row, 2*x+1)
+		return color.NRGBA{v, v, v, a}
+	}
+	r, _ := p.sample(row, 4*x)
+	g, _ := p.sample(row, 4*x+1)
+	b, _ := p.sample(row, 4*x+2)
+	a, _ := p.sample(row, 4*x+3)
+	return color.NRGBA{r, g, b, a}
+}
+
+// sample returns sample i of an unfiltered row, scaled to 8 bits, and as
+// it is stored
+func (p *pngReader) sample(row []byte, i int) (uint8, uint16) {
+	switch p.depth {
+	case 16:
+		return row[2*i], binary.BigEndian.Uint16(row[2*i:])
+	case 8:
+		return row[i], uint16(row[i])
+	}
+	// 1, 2 or 4 bits, the most significant first
+	bit, mask := i*p.depth, uint16(1)<<p.depth-1
+	raw := uint16(row[bit/8]>>(8-p.depth-bit%8)) & mask
+	return uint8(raw * 255 / mask), raw
+}
+
+// unfilter reverses the filter of a row of bpp bytes per pixel, given the
+// previous row unfiltered
+func unfilter(filter byte, cur, prev []byte, bpp int) error {
+	switch filter {
+	case 0:
+	case 1:
+		for i := bpp; i < len(cur); i++ {
+			cur[i] += cur[i-bpp]
+		}
+	case 2:
+		for i := range cur {
+			cur[i] += prev[i]
+		}
+	case 3:
+		for i := range cur {
+			left := 0
+			if i >= bpp {
+				left = int(cur[i-bpp])
+			}
+			cur[i] += uint8((left + int(prev[i])) / 2)
+		}
+	case 4:
+		for i := range cur {
+			var a, c int
+			if i >= bpp {
+				a, c = int(cur[i-bpp]), int(prev[i-bpp])
+			}
+			b := int(prev[i])
+			pa, pb, pc := abs(b-c), abs(a-c), abs(a+b-2*c)
+			switch {
+			case pa <= pb && pa <= pc:
+				cur[i] += uint8(a)
+			case pb <= pc:
+				cur[i] += uint8(b)
+			default:
+				cur[i] += uint8(c)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown PNG filter %d", filter)
+	}
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
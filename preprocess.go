@@ -0,0 +1,97 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Preprocessor rewrites the markdown source before it is parsed. Returning
+// an error stops the run.
+type Preprocessor struct {
+	Name      string
+	Transform func(content []byte) ([]byte, error)
+}
+
+// Names of the built-in preprocessors, in the order they run by default
+const (
+	FrontMatterPreprocessor     = "front-matter"     // YAML or TOML front matter is removed, see SplitFrontMatter
+	CheckboxSpacingPreprocessor = "checkbox-spacing" // blank line before lists following a paragraph line
+	ConditionsPreprocessor      = "conditions"       // <!-- if --> conditional content, see SetDefines
+	TemplatesPreprocessor       = "templates"        // {{.Variable}} and {{money ...}} actions, see ExpandTemplates
+	ShortcodesPreprocessor      = "shortcodes"       // {{qr ...}} and {{barcode ...}} shortcodes
+	MarksPreprocessor           = "marks"            // ==highlighted== text
+)
+
+// builtinPreprocessors returns the preprocessors a renderer starts with
+func (r *PdfRenderer) builtinPreprocessors() []Preprocessor {
+	return []Preprocessor{
+		{FrontMatterPreprocessor, func(content []byte) ([]byte, error) {
+			_, content = SplitFrontMatter(content)
+			return content, nil
+		}},
+		{CheckboxSpacingPreprocessor, func(content []byte) ([]byte, error) {
+			return ensureCheckboxListSpacing(content), nil
+		}},
+		{ConditionsPreprocessor, func(content []byte) ([]byte, error) {
+			return ApplyConditions(content, r.Defines), nil
+		}},
+		{TemplatesPreprocessor, func(content []byte) ([]byte, error) {
+			return ExpandTemplates(content, r.Defines, r.Locale)
+		}},
+		{ShortcodesPreprocessor, func(content []byte) ([]byte, error) {
+			return expandShortcodes(content), nil
+		}},
+		{MarksPreprocessor, func(content []byte) ([]byte, error) {
+			return expandMarks(content), nil
+		}},
+	}
+}
+
+// WithPreprocessor registers a source transform named name to run after
+// the preprocessors registered before it, the built-in ones first. To run
+// it earlier, or to reorder the built-in ones, edit Preprocessors instead.
+func WithPreprocessor(name string, transform func(content []byte) ([]byte, error)) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Preprocessors = append(r.Preprocessors, Preprocessor{name, transform})
+	}
+}
+
+// WithoutPreprocessor disables the preprocessors named name, such as
+// MarksPreprocessor, e.g. for sources where == has no special meaning
+func WithoutPreprocessor(name string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Preprocessors = slices.DeleteFunc(slices.Clone(r.Preprocessors), func(p Preprocessor) bool {
+			return p.Name == name
+		})
+	}
+}
+
+// preprocess runs the preprocessors on content, in order
+func (r *PdfRenderer) preprocess(content []byte) ([]byte, error) {
+	for _, p := range r.Preprocessors {
+		var err error
+		if content, err = p.Transform(content); err != nil {
+			return nil, fmt.Errorf("%w: preprocessor %s: %w", ErrParse, p.Name, err)
+		}
+	}
+	return content, nil
+}
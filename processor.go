@@ -20,14 +20,15 @@
 package mdtopdf
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
 	"image/png"
 	"io"
-	"log"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 
@@ -41,7 +42,6 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gomarkdown/markdown/ast"
 	highlight "github.com/jessp01/gohighlight"
-	"github.com/mitchellh/go-wordwrap"
 	"github.com/srwiley/oksvg"
 	"github.com/srwiley/rasterx"
 )
@@ -59,6 +59,55 @@ func sanitizeText(s string) string {
 	return string(runes)
 }
 
+// checkboxSymbols are the symbols task list markers are drawn as
+var checkboxSymbols = map[string]string{"[ ]": "☐", "[x]": "☑", "[X]": "☑"}
+
+// checkboxMarker matches a task list marker; it is only taken for one
+// between white space or at the ends of the text, see checkboxes
+var checkboxMarker = regexp.MustCompile(`\[[ xX]\]`)
+
+// checkboxes replaces the task list markers of s that stand alone, as in
+// table cells, with checkbox symbols; index expressions such as a[x] are
+// left alone
+func checkboxes(s string) string {
+	var b strings.Builder
+	start := 0
+	for _, m := range checkboxMarker.FindAllStringIndex(s, -1) {
+		before := m[0] == 0 || strings.IndexByte(" \t\n", s[m[0]-1]) >= 0
+		after := m[1] == len(s) || strings.IndexByte(" \t\n", s[m[1]]) >= 0
+		if !before || !after {
+			continue
+		}
+		b.WriteString(s[start:m[0]])
+		b.WriteString(checkboxSymbols[s[m[0]:m[1]]])
+		start = m[1]
+	}
+	if start == 0 {
+		return s
+	}
+	b.WriteString(s[start:])
+	return b.String()
+}
+
+// displayText returns s as it is drawn, through each of the passes on text
+// in turn: task list markers become checkbox symbols, then characters fpdf
+// can't render are sanitized. Text must be measured in this form, or
+// widths won't match what ends up on the page. Icons are drawn from their
+// own nodes and don't go through it, see processIcon.
+func displayText(s string) string {
+	return sanitizeText(checkboxes(s))
+}
+
+// textWidth returns the width of s as drawn in the current font
+func (r *PdfRenderer) textWidth(s string) float64 {
+	return r.Pdf.GetStringWidth(displayText(s))
+}
+
+// splitText wraps s as drawn in the current font into lines no wider than w
+func (r *PdfRenderer) splitText(s string, w float64) []string {
+	return r.Pdf.SplitText(displayText(s), w)
+}
+
 func (r *PdfRenderer) processText(node *ast.Text) {
 	currentStyle := r.cs.peek().textStyle
 	r.setStyler(currentStyle)
@@ -66,36 +115,48 @@ func (r *PdfRenderer) processText(node *ast.Text) {
 	if !r.NeedBlockquoteStyleUpdate {
 		s = strings.ReplaceAll(s, "\n", " ")
 	}
-	s = strings.ReplaceAll(s, "[ ]", "☐")
-	s = strings.ReplaceAll(s, "[x]", "☑")
-	s = strings.ReplaceAll(s, "[X]", "☑")
+	// fpdf's character width array only supports Unicode BMP (0-65535);
+	// characters outside this range (like emojis U+1F680) cause an index out
+	// of bounds panic, in table cells too
+	s = displayText(s)
+	s = r.resolveCitations(s)
+	switch node.Parent.(type) {
+	case *ast.Heading, *ast.Link:
+	default:
+		s = r.expandAbbreviations(s)
+	}
 	r.tracer("Text", s)
 
 	if incell {
+		s = r.resolveCrossRefs(s)
 		r.cs.peek().cellInnerString += s
 		r.cs.peek().cellInnerStringStyle = &currentStyle
+		r.cs.peek().cellRedacted = r.cs.peek().cellRedacted || r.redacted[node]
+		return
+	}
+
+	if r.redacted[node] {
+		r.writeRedacted(currentStyle, s)
+		r.setStyler(currentStyle)
 		return
 	}
 
-	// Sanitize text: fpdf's character width array only supports Unicode BMP (0-65535)
-	// Characters outside this range (like emojis U+1F680) cause index out of bounds panic
-	s = sanitizeText(s)
+	if r.kbd {
+		r.writeKey(currentStyle, s)
+		r.setStyler(currentStyle)
+		return
+	}
+	if r.mark {
+		r.writeMarked(currentStyle, s)
+		r.setStyler(currentStyle)
+		return
+	}
 
 	switch node.Parent.(type) {
 
 	case *ast.Link:
 		r.writeLink(currentStyle, s, r.cs.peek().destination)
 	case *ast.Heading:
-		if len(r.tocLinks) > 0 {
-			if linkPtr, exists := r.tocLinks[s]; exists {
-				// Dereference the pointer to get the actual link ID
-				link := *linkPtr
-				r.Pdf.SetLink(link, -1, -1)
-				r.tracer("Text Heading", fmt.Sprintf("Set link for header '%s' with link ID: %d\n", s, link))
-			} else {
-				r.tracer("Text Heading", fmt.Sprintf("Header '%s' not found in links map\n", s))
-			}
-		}
 		r.write(currentStyle, s)
 	case *ast.BlockQuote:
 		if r.NeedBlockquoteStyleUpdate {
@@ -103,27 +164,91 @@ func (r *PdfRenderer) processText(node *ast.Text) {
 			r.multiCell(currentStyle, s)
 		}
 	default:
-		r.write(currentStyle, s)
+		r.writeCrossRefs(currentStyle, s)
 	}
 }
 
-// This is a stub implementation. For now, the MathAjax extension is disabled.
+// processMath writes $$inline math$$ as it is; the MathJax extension is on
+// in the mmark dialect
 func (r *PdfRenderer) processMath(node *ast.Math) {
-	currentStyle := r.cs.peek().textStyle
-	s := string(node.Literal)
-	r.write(currentStyle, s)
+	r.tracer("Math", string(node.Literal))
+	r.writeInline(sanitizeText(string(node.Literal)))
+}
+
+// expandTabs replaces the tabs in s with spaces up to the next tab stop,
+// every width columns, counting wide characters as two columns as a
+// terminal does (see displayWidth); width 0 leaves s unchanged
+func expandTabs(s string, width int) string {
+	if width <= 0 || !strings.Contains(s, "\t") {
+		return s
+	}
+	var b strings.Builder
+	col := 0
+	for _, c := range s {
+		switch c {
+		case '\t':
+			n := width - col%width
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case '\n':
+			b.WriteRune(c)
+			col = 0
+		default:
+			b.WriteRune(c)
+			col += displayWidth(c)
+		}
+	}
+	return b.String()
 }
 
 func (r *PdfRenderer) outputUnhighlightedCodeBlock(codeBlock string) {
 	r.cr() // start on next line!
-	r.setStyler(r.Backtick)
-	r.multiCell(r.Backtick, codeBlock)
+	codeBlock = sanitizeText(codeBlock)
+	style := codeStyle(r.Backtick, codeBlock)
+	r.setStyler(style)
+	lineHeight := r.lineHeight(style)
+	width := r.codeWidth(style, r.Pdf.GetCellMargin())
+	var lines [][]string
+	clipped, firstClipped := 0, ""
+	for _, l := range strings.Split(strings.TrimSuffix(codeBlock, "\n"), "\n") {
+		pieces, clip := r.wrapCode(style, l, width)
+		if clip {
+			if clipped == 0 {
+				firstClipped = l
+			}
+			clipped++
+		}
+		lines = append(lines, pieces)
+	}
+	n := 0
+	for _, pieces := range lines {
+		n += len(pieces)
+	}
+	r.keepTogether(float64(n) * lineHeight)
+	r.beginBlock("Code").started = true
+	r.setStyler(style)
+	for _, pieces := range lines {
+		for i, piece := range pieces {
+			r.Pdf.CellFormat(0, lineHeight, piece, "", 0, "L", true, 0, "")
+			if i < len(pieces)-1 {
+				r.writeWrapMarker(style, lineHeight)
+			}
+			r.Pdf.Ln(lineHeight)
+		}
+	}
+	r.endBlock()
+	r.warnClipped(clipped, firstClipped)
 }
 
 func (r *PdfRenderer) processCodeblock(node ast.CodeBlock) {
 	r.resetListCounter()
 	r.tracer("Codeblock", fmt.Sprintf("%v", ast.ToString(node.AsLeaf())))
 
+	if r.processFence(node) || r.processDiagram(node) || r.processLaTeX(node) || r.processANSI(node) {
+		return
+	}
+	node.Literal = []byte(expandTabs(string(node.Literal), r.TabWidth))
+
 	currentStyle := r.cs.peek().textStyle
 	r.setStyler(currentStyle)
 
@@ -140,89 +265,63 @@ func (r *PdfRenderer) processCodeblock(node ast.CodeBlock) {
 	if strings.HasPrefix(string(node.Literal), "<script") && string(node.Info) == "html" {
 		node.Info = []byte("javascript")
 	}
-	syntaxFile, lerr := os.ReadFile(r.SyntaxHighlightBaseDir + "/" + string(node.Info) + ".yaml")
+	syntaxFile, lerr := os.ReadFile(filepath.Join(r.SyntaxHighlightBaseDir, string(node.Info)+".yaml"))
 	if lerr != nil {
 		r.outputUnhighlightedCodeBlock(string(node.Literal))
 		return
 	}
 	syntaxDef, _ := highlight.ParseDef(syntaxFile)
 	h := highlight.NewHighlighter(syntaxDef)
-	linesWrapped := wordwrap.WrapString(string(node.Literal), 90)
-	matches := h.HighlightString(linesWrapped)
+	code := sanitizeText(string(node.Literal))
+	matches := h.HighlightString(code)
 	r.cr()
-	lines := strings.Split(linesWrapped, "\n")
-	for lineN, l := range lines {
+	style := r.Normal
+	if r.CodeFont != "" {
+		style.Font = r.CodeFont
+	}
+	style = codeStyle(style, code)
+	lineHeight := 5.0
+	width := r.codeWidth(style, 0)
+	var lines [][]string
+	clipped, firstClipped := 0, ""
+	n := 0
+	for _, l := range strings.Split(code, "\n") {
+		pieces, clip := r.wrapCode(style, l, width)
+		if clip {
+			if clipped == 0 {
+				firstClipped = l
+			}
+			clipped++
+		}
+		lines = append(lines, pieces)
+		n += len(pieces)
+	}
+	r.keepTogether(float64(n) * r.lineHeight(currentStyle))
+	r.beginBlock("Code").started = true
+	defer r.warnClipped(clipped, firstClipped)
+	defer r.endBlock()
+	colors := r.groupColors()
+	cur := style
+	r.setStyler(cur)
+	for lineN, pieces := range lines {
 		colN := 0
-		for _, c := range l {
-			if group, ok := matches[lineN][colN]; ok {
-				switch group {
-				case highlight.Groups["default"]:
-					fallthrough
-				case highlight.Groups[""]:
-					r.setStyler(r.Normal)
-				case highlight.Groups["statement"]:
-					fallthrough
-				case highlight.Groups["green"]:
-					r.Pdf.SetTextColor(42, 170, 138)
-				case highlight.Groups["identifier"]:
-					fallthrough
-				case highlight.Groups["blue"]:
-					r.Pdf.SetTextColor(137, 207, 240)
-
-				case highlight.Groups["preproc"]:
-					r.Pdf.SetTextColor(255, 80, 80)
-
-				case highlight.Groups["special"]:
-					fallthrough
-				case highlight.Groups["type.keyword"]:
-					fallthrough
-				case highlight.Groups["red"]:
-					r.Pdf.SetTextColor(255, 80, 80)
-
-				case highlight.Groups["constant"]:
-					fallthrough
-				case highlight.Groups["constant.number"]:
-					fallthrough
-				case highlight.Groups["constant.bool"]:
-					fallthrough
-				case highlight.Groups["symbol.brackets"]:
-					fallthrough
-				case highlight.Groups["identifier.var"]:
-					fallthrough
-				case highlight.Groups["cyan"]:
-					r.Pdf.SetTextColor(0, 136, 163)
-
-				case highlight.Groups["constant.specialChar"]:
-					fallthrough
-				case highlight.Groups["constant.string.url"]:
-					fallthrough
-				case highlight.Groups["constant.string"]:
-					fallthrough
-				case highlight.Groups["magenta"]:
-					r.Pdf.SetTextColor(255, 0, 255)
-
-				case highlight.Groups["type"]:
-					fallthrough
-				case highlight.Groups["symbol.operator"]:
-					fallthrough
-				case highlight.Groups["symbol.tag.extended"]:
-					fallthrough
-				case highlight.Groups["yellow"]:
-					r.Pdf.SetTextColor(255, 165, 0)
-
-				case highlight.Groups["comment"]:
-					fallthrough
-				case highlight.Groups["high.green"]:
-					r.Pdf.SetTextColor(82, 204, 0)
-				default:
-					r.setStyler(r.Normal)
+		for i, piece := range pieces {
+			for _, c := range piece {
+				if group, ok := matches[lineN][colN]; ok {
+					cur = style
+					if c, ok := colors[group]; ok {
+						cur.TextColor = c
+					}
+					r.setStyler(cur)
 				}
+				r.Pdf.Write(lineHeight, string(c))
+				colN++
+			}
+			if i < len(pieces)-1 {
+				r.writeWrapMarker(cur, lineHeight)
 			}
-			r.Pdf.Write(5, string(c))
-			colN++
+			r.cr()
 		}
-
-		r.cr()
 	}
 }
 
@@ -255,10 +354,11 @@ func (r *PdfRenderer) processList(node ast.List, entering bool) {
 		}
 
 		// Add reduced spacing before nested lists (when inside another list item)
-		// Use 40% of normal spacing (ensureCheckboxListSpacing now skips indented lines)
+		// Use 40% of normal spacing (ensureCheckboxListSpacing now skips indented lines),
+		// none on a baseline grid
 		if parent.listkind != notlist && len(r.cs.stack) >= 2 {
 			style := r.cs.peek().textStyle
-			reducedLH := (style.Size + style.Spacing) * 0.4
+			reducedLH := r.spacing(r.lineHeight(style)*0.4, 0)
 			r.tracer("Nested list spacing", fmt.Sprintf("Adding reduced spacing (LH=%.2f) before nested list", reducedLH))
 			r.Pdf.Write(reducedLH, "\n")
 		}
@@ -267,7 +367,8 @@ func (r *PdfRenderer) processList(node ast.List, entering bool) {
 		if baseMargin == 0 {
 			baseMargin = parent.leftMargin
 		}
-		newLeftMargin := baseMargin + r.IndentValue
+		indent := r.blockIndent(kind)
+		newLeftMargin := baseMargin + indent
 		r.Pdf.SetLeftMargin(newLeftMargin)
 		r.tracer("... List Left Margin",
 			fmt.Sprintf("set to %v", newLeftMargin))
@@ -277,22 +378,25 @@ func (r *PdfRenderer) processList(node ast.List, entering bool) {
 			listkind:             kind,
 			leftMargin:           newLeftMargin,
 			contentLeftMargin:    newLeftMargin,
+			indent:               indent,
 			orderedCounterBackup: r.orderedListCounter}
+		format, start := "", 1
 		if kind == ordered {
-			start := node.Start
-			if start <= 0 {
-				start = 1
+			if node.Start > 0 {
+				start = node.Start
 			}
 			r.orderedListCounter = start - 1
 			x.itemNumber = start - 1
+			format = r.listFormat(node)
 		}
+		x.labels, x.labelWidth = r.listLabels(&node, kind, format, start)
 		r.cs.push(x)
 	} else {
 		r.tracer(fmt.Sprintf("%v List (leaving)", kind),
 			fmt.Sprintf("%v", ast.ToString(node.AsContainer())))
-		r.Pdf.SetLeftMargin(r.cs.peek().leftMargin - r.IndentValue)
+		r.Pdf.SetLeftMargin(r.cs.peek().leftMargin - r.cs.peek().indent)
 		r.tracer("... Reset List Left Margin",
-			fmt.Sprintf("re-set to %v", r.cs.peek().leftMargin-r.IndentValue))
+			fmt.Sprintf("re-set to %v", r.cs.peek().leftMargin-r.cs.peek().indent))
 		if r.cs.peek().listkind == ordered {
 			r.orderedListCounter = r.cs.peek().orderedCounterBackup
 		}
@@ -303,6 +407,45 @@ func (r *PdfRenderer) processList(node ast.List, entering bool) {
 	}
 }
 
+// listLabels returns the label of each item of the list node, a bullet,
+// a checkbox (whose marker is taken out of the item text) or the number
+// in format counting from start, and the width of the widest in the
+// current font
+func (r *PdfRenderer) listLabels(node *ast.List, kind listType, format string, start int) (map[ast.Node]string, float64) {
+	labels := map[ast.Node]string{}
+	width := 0.0
+	n := start
+	for _, child := range node.Children {
+		item, ok := child.(*ast.ListItem)
+		if !ok {
+			continue
+		}
+		label := "•"
+		switch kind {
+		case ordered:
+			label = listLabel(format, n)
+			n++
+		case unordered:
+			if sym, ok := stripCheckboxMarker(item); ok {
+				label = sym
+				if r.Pdf.GetStringWidth(label) == 0 {
+					// Fallback to ASCII checkbox markers when glyphs are unavailable
+					label = "[ ]"
+					if sym == "☑" {
+						label = "[x]"
+					}
+				}
+			}
+		}
+		if r.Pdf.GetStringWidth(label) == 0 {
+			label = "-"
+		}
+		labels[item] = label
+		width = math.Max(width, r.Pdf.GetStringWidth(label))
+	}
+	return labels, width
+}
+
 func isListItem(node ast.Node) bool {
 	_, ok := node.(*ast.ListItem)
 	return ok
@@ -330,13 +473,8 @@ func stripCheckboxMarker(item *ast.ListItem) (string, bool) {
 			return ast.GoToNext
 		}
 
-		marker := trimmed[:3]
-		switch marker {
-		case "[ ]":
-			symbol = "☐"
-		case "[x]", "[X]":
-			symbol = "☑"
-		default:
+		var isMarker bool
+		if symbol, isMarker = checkboxSymbols[trimmed[:3]]; !isMarker {
 			return ast.GoToNext
 		}
 
@@ -372,9 +510,10 @@ func (r *PdfRenderer) processItem(node *ast.ListItem, entering bool) {
 		listStyle := r.Normal
 		listStyle.Spacing = 1.2 // For multi-line text INSIDE list items (sweet spot between tight and readable)
 
-		// Use NEGATIVE spacing for newline between items (compact but not overlapping)
-		LH := listStyle.Size - 2.0 // size=11.0 - 2.0 = 9.0pt (tight but readable)
-		r.tracer("cr() with listStyle", fmt.Sprintf("LH=%.2f (size=%.1f - 2.0)", LH, listStyle.Size))
+		// Use NEGATIVE spacing for newline between items (compact but not overlapping),
+		// one line on a baseline grid
+		LH := r.spacing(listStyle.Size-2.0, 1) // size=11.0 - 2.0 = 9.0pt (tight but readable)
+		r.tracer("cr() with listStyle", fmt.Sprintf("LH=%.2f (size=%.1f)", LH, listStyle.Size))
 		r.Pdf.Write(LH, "\n")
 		x := &containerState{
 			textStyle:         listStyle,
@@ -386,62 +525,26 @@ func (r *PdfRenderer) processItem(node *ast.ListItem, entering bool) {
 		// add bullet or itemnumber; then set left margin for the
 		// text/paragraphs in the item
 		r.cs.push(x)
-		// Set cursor X position to leftMargin before rendering bullet/number
-		r.setStyler(r.cs.peek().textStyle)
-		r.Pdf.SetX(r.cs.peek().leftMargin)
-		var checkboxSymbol string
-		if r.cs.peek().listkind == unordered {
-			if sym, ok := stripCheckboxMarker(node); ok {
-				checkboxSymbol = sym
-			}
-		}
-
-		bulletLabel := ""
-		switch r.cs.peek().listkind {
-		case unordered:
-			bulletLabel = "•"
-			if checkboxSymbol != "" {
-				bulletLabel = checkboxSymbol
-			}
-		case ordered:
-			bulletLabel = fmt.Sprintf("%v.", r.cs.peek().itemNumber)
-		}
-		if bulletLabel == "" {
-			bulletLabel = "•"
+		r.setStyler(x.textStyle)
+		label, ok := parent.labels[node]
+		if !ok {
+			label = "•"
 		}
-
-		labelWidth := r.Pdf.GetStringWidth(bulletLabel)
-		if labelWidth == 0 && checkboxSymbol != "" {
-			// Fallback to ASCII checkbox markers when glyphs are unavailable
-			if strings.EqualFold(checkboxSymbol, "☑") {
-				bulletLabel = "[x]"
-			} else {
-				bulletLabel = "[ ]"
-			}
-			labelWidth = r.Pdf.GetStringWidth(bulletLabel)
-		}
-		if labelWidth == 0 {
-			bulletLabel = "-"
-			labelWidth = r.Pdf.GetStringWidth(bulletLabel)
-		}
-		lineHeight := x.textStyle.Size + x.textStyle.Spacing
-		gapWidth := 0.35 * r.em
-		minWidth := 1.2 * r.em
-		desiredWidth := math.Max(labelWidth+gapWidth, minWidth)
-		r.Pdf.Write(lineHeight, bulletLabel)
-		// ensure consistent indentation even if glyph width is narrower than desired box
-		currentX := r.Pdf.GetX()
-		newContentLeft := r.cs.peek().leftMargin + desiredWidth
-		if currentX < newContentLeft {
-			r.Pdf.SetX(newContentLeft)
-		} else {
-			newContentLeft = currentX
+		// the label sits in a box as wide as the widest of the list and a
+		// gap, bullets on its left and numbers on its right, and the text of
+		// the item, wrapped lines and following blocks included, hangs from
+		// its end whatever the nesting depth
+		box := math.Max(parent.labelWidth+0.35*r.em, 1.2*r.em)
+		labelX := x.leftMargin
+		if x.listkind == ordered {
+			labelX += parent.labelWidth - r.Pdf.GetStringWidth(label)
 		}
-		r.cs.peek().contentLeftMargin = newContentLeft
-		// with the bullet done, now set the left margin for the text
-		r.Pdf.SetLeftMargin(newContentLeft)
-		// set the cursor to this point
-		r.Pdf.SetX(newContentLeft)
+		r.Pdf.SetX(labelX)
+		r.Pdf.Write(r.lineHeight(x.textStyle), label)
+		contentLeft := x.leftMargin + box
+		x.contentLeftMargin = contentLeft
+		r.Pdf.SetLeftMargin(contentLeft)
+		r.Pdf.SetX(contentLeft)
 	} else {
 		r.tracer(fmt.Sprintf("%v Item (leaving)",
 			r.cs.peek().listkind),
@@ -463,6 +566,17 @@ func (r *PdfRenderer) processEmph(node ast.Node, entering bool) {
 	}
 }
 
+func (r *PdfRenderer) processDel(node ast.Node, entering bool) {
+	if entering {
+		r.tracer("DEL (entering)", "")
+		r.cs.peek().textStyle.Style += "s"
+	} else {
+		r.tracer("DEL (leaving)", "")
+		r.cs.peek().textStyle.Style = strings.ReplaceAll(
+			r.cs.peek().textStyle.Style, "s", "")
+	}
+}
+
 func (r *PdfRenderer) processStrong(node ast.Node, entering bool) {
 	if entering {
 		r.cs.peek().textStyle.Style += "b"
@@ -477,7 +591,7 @@ func (r *PdfRenderer) processStrong(node ast.Node, entering bool) {
 func (r *PdfRenderer) processLink(node ast.Link, entering bool) {
 	destination := string(node.Destination)
 	if entering {
-		if r.InputBaseURL != "" && !strings.HasPrefix(destination, "http") {
+		if r.InputBaseURL != "" && !strings.HasPrefix(destination, "http") && !strings.HasPrefix(destination, "#") {
 			destination = r.InputBaseURL + "/" + strings.Replace(destination, "./", "", 1)
 		}
 		x := &containerState{
@@ -497,11 +611,11 @@ func (r *PdfRenderer) processLink(node ast.Link, entering bool) {
 	}
 }
 
-func downloadFile(url, fileName string) error {
+func (r *PdfRenderer) downloadFile(url, fileName string) error {
 	client := http.Client{
 		Timeout: 30 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			fmt.Println("Redirected to:", req.URL)
+			r.logf("Redirected to: %s", req.URL)
 			return nil
 		},
 	}
@@ -538,112 +652,181 @@ func downloadFile(url, fileName string) error {
 	return nil
 }
 
-func (r *PdfRenderer) processImage(node ast.Image, entering bool) {
-	// while this has entering and leaving states, it doesn't appear
-	// to be useful except for other markup languages to close the tag
-	if entering {
-		r.cr() // newline before getting started
-		destination := string(node.Destination)
-		tempDir := os.TempDir() + "/" + filepath.Base(os.Args[0])
-		_, err := os.Stat(destination)
-		if errors.Is(err, os.ErrNotExist) {
-			// download the image so we can use it
-			var source string = destination
-			if !strings.HasPrefix(destination, "http") {
-				if r.InputBaseURL != "" {
-					source = r.InputBaseURL + "/" + destination
+// localPath returns the file an image destination refers to. Markdown
+// paths use "/" separators and may be URL escaped; relative paths are
+// looked up in InputBaseDir first, then in the working directory. If no
+// file is found, dest is returned as is, to be downloaded.
+func (r *PdfRenderer) localPath(dest string) string {
+	return localPathIn(dest, r.InputBaseDir)
+}
+
+// localPathIn is localPath with baseDir in place of InputBaseDir
+func localPathIn(dest, baseDir string) string {
+	if strings.Contains(dest, "://") {
+		return dest
+	}
+	candidates := []string{filepath.FromSlash(dest)}
+	if unescaped, err := url.PathUnescape(dest); err == nil && unescaped != dest {
+		candidates = append(candidates, filepath.FromSlash(unescaped))
+	}
+	for _, base := range []string{baseDir, ""} {
+		for _, p := range candidates {
+			if base != "" {
+				if filepath.IsAbs(p) {
+					continue
 				}
+				p = filepath.Join(base, p)
 			}
-			os.MkdirAll(tempDir, 755)
-			err := downloadFile(source, tempDir+"/"+filepath.Base(destination))
-			if err != nil {
-				fmt.Println(err.Error())
-			} else {
-				destination = tempDir + "/" + filepath.Base(destination)
-				fmt.Println("Downloaded image to: " + destination)
+			if _, err := os.Stat(p); err == nil {
+				return p
 			}
 		}
-		mtype, err := mimetype.DetectFile(destination)
-		if mtype.Is("image/svg+xml") {
-			re := regexp.MustCompile(`<svg\s*.*\s*width="([0-9\.]+)"\sheight="([0-9\.]+)".*>`)
-			contents, _ := os.ReadFile(destination)
-			matches := re.FindStringSubmatch(string(contents))
-			tf, err := os.CreateTemp(tempDir, "*.svg")
-			if err != nil {
-				log.Println(err)
-				return
-			}
+	}
+	return dest
+}
 
-			if _, err := tf.Write(contents); err != nil {
-				tf.Close()
-				log.Println(err)
-				return
-			}
-			if err := tf.Close(); err != nil {
-				log.Println(err)
-				return
-			}
-			os.Rename(destination, tf.Name())
-			destination = tf.Name()
-			width, _ := strconv.ParseFloat(matches[1], 64)
-			height, _ := strconv.ParseFloat(matches[2], 64)
-
-			icon, err := oksvg.ReadIconStream(tf)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			icon.SetTarget(0, 0, float64(width), float64(height))
-			rgba := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-			icon.Draw(rasterx.NewDasher(int(width), int(height), rasterx.NewScannerGV(int(width), int(height), rgba, rgba.Bounds())), 1)
-
-			outputFileName := destination + ".png"
-			outputFile, err := os.Create(outputFileName)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			defer outputFile.Close()
+func (r *PdfRenderer) processImage(node *ast.Image, entering bool) {
+	// while this has entering and leaving states, it doesn't appear
+	// to be useful except for other markup languages to close the tag
+	if entering {
+		r.cr() // newline before getting started
+		destination, err := r.imageFile(node)
+		if err != nil {
+			r.imageFailed(string(node.Destination), err)
+			return
+		}
+		imgOpts := fpdf.ImageOptions{ImageType: "", ReadDpi: true}
+		name, info := r.registerImage(destination)
+		if info == nil || r.Pdf.Err() {
+			r.imageFailed(string(node.Destination), r.Pdf.Error())
+			r.Pdf.ClearError()
+			return
+		}
+		w, h := r.figureSize(node, info)
+		r.keepTogether(h)
+		r.setCrossRefTarget(node)
+		r.Pdf.ImageOptions(name,
+			r.alignedX(node, w), 0, w, h, true,
+			imgOpts, 0, "")
+	} else {
+		r.tracer("Image (leaving)", "")
+	}
+}
 
-			if err := png.Encode(outputFile, rgba); err != nil {
-				log.Println(err)
-				return
+// imageFile returns the local file of an image: the file itself, a
+// download of it, or a PNG rendering of an SVG
+func (r *PdfRenderer) imageFile(node *ast.Image) (string, error) {
+	destination := r.localPath(string(node.Destination))
+	_, err := os.Stat(destination)
+	var downloadErr error
+	if errors.Is(err, os.ErrNotExist) {
+		// download the image so we can use it
+		var source string = destination
+		if !strings.HasPrefix(destination, "http") {
+			if r.InputBaseURL != "" {
+				source = r.InputBaseURL + "/" + destination
 			}
-			destination = outputFileName
 		}
-		r.tracer("Image (entering)",
-			fmt.Sprintf("Destination[%v] Title[%v]",
-				destination,
-				string(node.Title)))
-		// following changes suggested by @sirnewton01, issue #6
-		// does file exist?
-		var imgPath = destination
-		_, err = os.Stat(imgPath)
+		tempDir, err := r.workDir()
 		if err == nil {
-			r.Pdf.ImageOptions(destination,
-				-1, 0, 0, 0, true,
-				fpdf.ImageOptions{ImageType: "", ReadDpi: true}, 0, "")
+			err = r.downloadFile(source, filepath.Join(tempDir, filepath.Base(destination)))
+		}
+		if err != nil {
+			downloadErr = err
 		} else {
-			r.tracer("Image (file error)", err.Error())
+			destination = filepath.Join(tempDir, filepath.Base(destination))
+			r.logf("Downloaded image to: %s", destination)
 		}
-	} else {
-		r.tracer("Image (leaving)", "")
 	}
+	mtype, err := mimetype.DetectFile(destination)
+	if mtype.Is("image/svg+xml") {
+		re := regexp.MustCompile(`<svg\s*.*\s*width="([0-9\.]+)"\sheight="([0-9\.]+)".*>`)
+		contents, _ := os.ReadFile(destination)
+		matches := re.FindStringSubmatch(string(contents))
+		if matches == nil {
+			return "", errors.New("SVG without width and height")
+		}
+		tempDir, err := r.workDir()
+		if err != nil {
+			return "", err
+		}
+		tf, err := os.CreateTemp(tempDir, "*.svg")
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := tf.Write(contents); err != nil {
+			tf.Close()
+			return "", err
+		}
+		if err := tf.Close(); err != nil {
+			return "", err
+		}
+		destination = tf.Name()
+		width, _ := strconv.ParseFloat(matches[1], 64)
+		height, _ := strconv.ParseFloat(matches[2], 64)
+
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(contents))
+		if err != nil {
+			return "", err
+		}
+		icon.SetTarget(0, 0, float64(width), float64(height))
+		rgba := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+		icon.Draw(rasterx.NewDasher(int(width), int(height), rasterx.NewScannerGV(int(width), int(height), rgba, rgba.Bounds())), 1)
+
+		outputFileName := destination + ".png"
+		outputFile, err := os.Create(outputFileName)
+		if err != nil {
+			return "", err
+		}
+		defer outputFile.Close()
+
+		if err := png.Encode(outputFile, rgba); err != nil {
+			return "", err
+		}
+		destination = outputFileName
+	}
+	r.tracer("Image (entering)",
+		fmt.Sprintf("Destination[%v] Title[%v]",
+			destination,
+			string(node.Title)))
+	// following changes suggested by @sirnewton01, issue #6
+	// does file exist?
+	if _, err = os.Stat(destination); err != nil {
+		r.tracer("Image (file error)", err.Error())
+		if downloadErr != nil {
+			err = downloadErr
+		}
+		return "", err
+	}
+	return destination, nil
 }
 
 func (r *PdfRenderer) processCode(node ast.Node) {
 	r.tracer("processCode", fmt.Sprintf("%s", string(node.AsLeaf().Literal)))
+	if r.redacted[node] {
+		if incell {
+			r.cs.peek().cellInnerString += string(node.AsLeaf().Literal)
+			r.cs.peek().cellRedacted = true
+			return
+		}
+		r.writeRedacted(r.cs.peek().textStyle, string(node.AsLeaf().Literal))
+		return
+	}
 	if r.NeedCodeStyleUpdate {
 		r.tracer("Code (entering)", "")
-		r.setStyler(r.Code)
-		s := string(node.AsLeaf().Literal)
+		s := sanitizeText(string(node.AsLeaf().Literal))
+		style := codeStyle(r.Code, s)
+		r.setStyler(style)
 		hw := r.Pdf.GetStringWidth(s) + (1 * r.em)
-		h := r.Code.Size
+		h := style.Size
 		r.Pdf.CellFormat(hw, h, s, "", 0, "C", true, 0, "")
 	} else {
 		r.tracer("Backtick (entering)", "")
-		r.setStyler(r.Backtick)
-		r.write(r.Backtick, string(node.AsLeaf().Literal))
+		s := sanitizeText(string(node.AsLeaf().Literal))
+		style := codeStyle(r.Backtick, s)
+		r.setStyler(style)
+		r.write(style, s)
 	}
 }
 
@@ -668,6 +851,7 @@ func (r *PdfRenderer) processParagraph(node *ast.Paragraph, entering bool) {
 		}
 		r.resetListCounter()
 		r.cr()
+		r.setCrossRefTarget(node)
 	} else {
 		r.tracer("Paragraph (leaving)", "")
 		lm, tm, rm, bm := r.Pdf.GetMargins()
@@ -694,26 +878,51 @@ func (r *PdfRenderer) processBlockQuote(node ast.Node, entering bool) {
 		r.resetListCounter()
 		r.tracer("BlockQuote (entering)", "")
 		curleftmargin, _, _, _ := r.Pdf.GetMargins()
+		indent := r.blockIndent(notlist)
 		x := &containerState{
 			textStyle:         r.Blockquote,
 			listkind:          notlist,
-			leftMargin:        curleftmargin + r.IndentValue,
-			contentLeftMargin: curleftmargin + r.IndentValue}
+			leftMargin:        curleftmargin + indent,
+			contentLeftMargin: curleftmargin + indent,
+			indent:            indent}
 		r.cs.push(x)
-		r.Pdf.SetLeftMargin(curleftmargin + r.IndentValue)
+		r.Pdf.SetLeftMargin(curleftmargin + indent)
 	} else {
 		r.tracer("BlockQuote (leaving)", "")
 		curleftmargin, _, _, _ := r.Pdf.GetMargins()
-		r.Pdf.SetLeftMargin(curleftmargin - r.IndentValue)
+		r.Pdf.SetLeftMargin(curleftmargin - r.cs.peek().indent)
 		r.cs.pop()
 		r.cr()
 	}
 }
 
+// headingStyle returns the Styler for the given heading level
+func (r *PdfRenderer) headingStyle(level int) Styler {
+	switch level {
+	case 1:
+		return r.H1
+	case 2:
+		return r.H2
+	case 3:
+		return r.H3
+	case 4:
+		return r.H4
+	case 5:
+		return r.H5
+	}
+	return r.H6
+}
+
 func (r *PdfRenderer) processHeading(node ast.Heading, entering bool) {
 	if entering {
 		r.resetListCounter()
+		r.sectionBackToTOC(&node)
+		if hasClass(&node, "pagebreak", "newpage") && r.Pdf.GetY() > r.mtop {
+			r.Pdf.AddPage()
+		}
 		r.cr()
+		// keep the heading together with at least one line of body text
+		r.ensureSpace(r.headingStyle(node.Level).Size*2 + r.lineHeight(r.Normal))
 		switch node.Level {
 		case 1:
 			r.tracer("Heading (1, entering)", fmt.Sprintf("%v", ast.ToString(node.AsContainer())))
@@ -764,6 +973,13 @@ func (r *PdfRenderer) processHeading(node ast.Heading, entering bool) {
 				contentLeftMargin: r.cs.peek().leftMargin}
 			r.cs.push(x)
 		}
+		r.cs.peek().classes = headingClasses(&node)
+		if link, ok := r.headingAnchors[node.HeadingID]; ok {
+			r.setLink(link)
+		}
+		r.setTOCLink(&node)
+		r.markOpenAt(&node)
+		r.headingPrefix(&node)
 	} else {
 		r.tracer("Heading (leaving)", "")
 		r.cr()
@@ -781,12 +997,8 @@ func (r *PdfRenderer) processHorizontalRule(node ast.Node) {
 		r.cr()
 		// get the current x and y (assume left margin in ok)
 		x, y := r.Pdf.GetXY()
-		// get the page margins
-		lm, _, _, _ := r.Pdf.GetMargins()
-		// get the page size
-		w, _ := r.Pdf.GetPageSize()
-		// now compute the x value of the right side of page
-		newx := w - lm
+		// the right side of the page, within its margin
+		newx := r.rightEdge()
 		r.tracer("... From X,Y", fmt.Sprintf("%v,%v", x, y))
 		r.Pdf.MoveTo(x, y)
 		r.tracer("...   To X,Y", fmt.Sprintf("%v,%v", newx, y))
@@ -801,6 +1013,17 @@ func (r *PdfRenderer) processHorizontalRule(node ast.Node) {
 
 func (r *PdfRenderer) processHTMLBlock(node ast.Node) {
 	r.tracer("HTMLBlock", string(node.AsLeaf().Literal))
+	if r.processComment(node.AsLeaf().Literal, true) {
+		return
+	}
+	if d, ok := parseDirective(node.AsLeaf().Literal); ok {
+		if d.name == "break-hint" {
+			r.processBreakHint(node, d)
+			return
+		}
+		r.processDirective(d)
+		return
+	}
 	r.cr()
 	r.setStyler(r.Backtick)
 	r.Pdf.CellFormat(0, r.Backtick.Size,
@@ -817,9 +1040,11 @@ func (r *PdfRenderer) processTable(node ast.Node, entering bool) {
 			leftMargin:        r.cs.peek().leftMargin,
 			contentLeftMargin: r.cs.peek().leftMargin}
 		r.cr()
-		r.cs.push(x)
 		fill = false
-		cellwidths = r.ColumnWidths[node]
+		cellwidths = r.fitTable(r.ColumnWidths[node])
+		x.textStyle = r.THeader
+		r.cs.push(x)
+		r.beginBlock("Table").widths = cellwidths
 		r.Pdf.SetLineWidth(1)
 	} else {
 		wSum := 0.0
@@ -827,6 +1052,8 @@ func (r *PdfRenderer) processTable(node ast.Node, entering bool) {
 			wSum += w
 		}
 		r.Pdf.CellFormat(wSum, 0, "", "T", 0, "", false, 0, "")
+		r.endBlock()
+		r.restoreTableStyles()
 
 		r.cs.pop()
 		r.tracer("Table (leaving)", "")
@@ -877,17 +1104,96 @@ func (r *PdfRenderer) processTableRow(node ast.Node, entering bool) {
 			x.textStyle = r.THeader
 		}
 		r.Pdf.Ln(-1)
+		// move the whole row to the next page rather than letting the
+		// cells break one at a time into the footer zone
+		r.ensureSpace(r.lineHeight(x.textStyle))
 
 		// initialize cell widths slice; only one table at a time!
 		curdatacell = 0
+		rowcells = nil
 		r.cs.push(x)
 	} else {
 		r.cs.pop()
+		r.outputTableRow()
+		if r.openBlock != nil {
+			r.openBlock.started = true
+		}
 		r.tracer("TableRow (leaving)", "")
 		// No alternating fill for cleaner table style
 	}
 }
 
+// cellListItem matches a bullet list item written on its own line in a
+// table cell, e.g. "- first<br>- second"
+var cellListItem = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+
+// cellLines splits the text of a table cell into the lines that fit its
+// width. Lines come from <br> tags and wrapping; bullet items are rendered
+// with a bullet and a hanging indent, and lines that wrap continue after
+// CellWrapPrefix.
+func (r *PdfRenderer) cellLines(s string, w float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		indent := r.CellWrapPrefix
+		if m := cellListItem.FindStringSubmatch(para); m != nil {
+			para = "• " + m[1]
+			indent = "   " + indent
+		}
+		wrapped := r.splitText(para, w)
+		if len(wrapped) == 0 {
+			wrapped = []string{""}
+		}
+		// the continuation lines wrap again, in the width the indent leaves
+		rest := strings.TrimLeft(strings.TrimPrefix(displayText(para), wrapped[0]), " ")
+		if len(wrapped) > 1 && indent != "" && rest != displayText(para) {
+			wrapped = append(wrapped[:1], r.splitText(rest, w-r.textWidth(indent))...)
+		}
+		for i, l := range wrapped {
+			if i > 0 {
+				l = indent + l
+			}
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// outputTableRow draws the buffered cells of a table row. The row is as
+// tall as its tallest cell, and moves to the next page as a whole.
+func (r *PdfRenderer) outputTableRow() {
+	if len(rowcells) == 0 {
+		return
+	}
+	rowHeight := 0.0
+	for _, c := range rowcells {
+		rowHeight = max(rowHeight, float64(len(c.lines))*c.height)
+	}
+	r.ensureSpace(rowHeight)
+	x, y := r.Pdf.GetXY()
+	for _, c := range rowcells {
+		r.setStyler(c.style)
+		for i, line := range c.lines {
+			r.Pdf.SetXY(x, y+float64(i)*c.height)
+			if c.redacted {
+				// the whole cell is blacked out, line by line
+				r.Pdf.SetFillColor(0, 0, 0)
+				r.Pdf.Rect(x+r.Pdf.GetCellMargin(), y+float64(i)*c.height, r.Pdf.GetStringWidth(strings.TrimSpace(line)), c.height-c.style.Spacing, "F")
+				continue
+			}
+			r.Pdf.CellFormat(c.width, c.height, line, "", 0, "L", false, 0, "")
+		}
+		if c.header {
+			r.Pdf.Line(x, y+rowHeight, x+c.width, y+rowHeight)
+		}
+		x += c.width
+	}
+	// leave the cursor on the row's last line, so that the Ln(-1) of the
+	// next row moves below the whole row
+	last := rowcells[len(rowcells)-1]
+	r.Pdf.SetXY(x, y+rowHeight-last.height)
+	rowcells = nil
+}
+
 func (r *PdfRenderer) processTableCell(node ast.TableCell, entering bool) {
 	if entering {
 
@@ -916,19 +1222,38 @@ func (r *PdfRenderer) processTableCell(node ast.TableCell, entering bool) {
 			currentStyle = *cs.cellInnerStringStyle
 		}
 		s := cs.cellInnerString
-		w := cellwidths[curdatacell]
+		// "wide ||" spans two columns; "^^" continues the cell above
+		span := max(node.ColSpan, 1)
+		w := 0.0
+		for i := curdatacell; i < curdatacell+span && i < len(cellwidths); i++ {
+			w += cellwidths[i]
+		}
+		if strings.TrimSpace(s) == rowSpanMarker {
+			s = ""
+		}
+		r.setStyler(currentStyle)
+		c := tableCell{
+			lines:    r.cellLines(s, w),
+			width:    w,
+			height:   r.lineHeight(currentStyle),
+			style:    currentStyle,
+			header:   cs.isHeader,
+			redacted: cs.cellRedacted,
+		}
 		if cs.isHeader {
 			h, _ := r.Pdf.GetFontSize()
-			h += currentStyle.Spacing
+			c.height = h + currentStyle.Spacing
 			r.tracer("... table header cell",
-				fmt.Sprintf("Width=%v, height=%v", w, h))
-
-			r.Pdf.CellFormat(w, h, s, "B", 0, "L", false, 0, "")
-		} else {
-			h := currentStyle.Size + currentStyle.Spacing
-			r.Pdf.CellFormat(w, h, s, "", 0, "L", false, 0, "")
+				fmt.Sprintf("Width=%v, height=%v", w, c.height))
+			if r.openBlock != nil {
+				r.openBlock.header = append(r.openBlock.header, strings.ReplaceAll(s, "\n", " "))
+				for i := 1; i < span; i++ {
+					r.openBlock.header = append(r.openBlock.header, "")
+				}
+			}
 		}
+		rowcells = append(rowcells, c)
 		r.tracer("TableCell (leaving)", "")
-		curdatacell++
+		curdatacell += span
 	}
 }
@@ -1,6 +1,16 @@
 package mdtopdf
 
 import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/gomarkdown/markdown"
@@ -100,6 +110,24 @@ func TestStripCheckboxMarker(t *testing.T) {
 	}
 }
 
+func TestDisplayText(t *testing.T) {
+	cases := map[string]string{
+		"[ ] todo":           "☐ todo",
+		"done [x]":           "done ☑",
+		"[X]":                "☑",
+		"[ ] one [x] two":    "☐ one ☑ two",
+		"a[x] and b[ ]":      "a[x] and b[ ]",
+		"see [x](y)":         "see [x](y)",
+		"ship it 🚀 [x]":      "ship it   ☑",
+		"keep ☐ and ✓ as is": "keep ☐ and ✓ as is",
+	}
+	for in, want := range cases {
+		if got := displayText(in); got != want {
+			t.Errorf("displayText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
 func TestEnsureCheckboxListSpacing(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -130,3 +158,452 @@ func TestEnsureCheckboxListSpacing(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandAbbreviations(t *testing.T) {
+	r := &PdfRenderer{Glossary: Glossary{
+		"HTTP":  "Hypertext Transfer Protocol",
+		"HTTPS": "HTTP Secure",
+	}}
+	got := r.expandAbbreviations("HTTPS wraps HTTP.")
+	expected := "HTTPS (HTTP Secure) wraps HTTP (Hypertext Transfer Protocol)."
+	if got != expected {
+		t.Fatalf("expected %q got %q", expected, got)
+	}
+	if got := r.expandAbbreviations("HTTP again"); got != "HTTP again" {
+		t.Fatalf("expected only the first use to be expanded, got %q", got)
+	}
+}
+
+func TestExtractAbbreviations(t *testing.T) {
+	src := "Intro\n*[API]: Application Programming Interface\nText\n"
+	out, g := extractAbbreviations([]byte(src))
+	if string(out) != "Intro\nText\n" {
+		t.Fatalf("definition not stripped: %q", string(out))
+	}
+	if g["API"] != "Application Programming Interface" {
+		t.Fatalf("unexpected glossary %v", g)
+	}
+	// those of redacted regions are left out of the glossary
+	src = "<!-- redact -->\n*[FALCON]: Fast Aerial Loitering Craft\n<!-- /redact -->\n*[API]: Interface\n"
+	out, g = extractAbbreviations([]byte(src))
+	if string(out) != "<!-- redact -->\n<!-- /redact -->\n" || len(g) != 1 || g["API"] != "Interface" {
+		t.Fatalf("redacted definition kept: %q, %v", out, g)
+	}
+	// definitions in code blocks are code
+	src = "```\n*[CLI]: Command Line Interface\n```\n\n    *[GUI]: Graphical User Interface\n"
+	if out, g := extractAbbreviations([]byte(src)); string(out) != src || len(g) != 0 {
+		t.Fatalf("definition in code stripped: %q, %v", out, g)
+	}
+}
+
+func TestExtractAbbrTags(t *testing.T) {
+	src := "The <abbr title=\"World Health Organization\">WHO</abbr> and <ABBR title='R &amp; D'>R&D</abbr>.\n`<abbr title=\"x\">y</abbr>`"
+	out, g := extractAbbrTags([]byte(src))
+	if string(out) != "The WHO and R&D.\n`<abbr title=\"x\">y</abbr>`" {
+		t.Fatalf("tags not replaced: %q", string(out))
+	}
+	if len(g) != 2 || g["WHO"] != "World Health Organization" || g["R&D"] != "R & D" {
+		t.Fatalf("unexpected glossary %v", g)
+	}
+
+	src = "<!-- redact -->The <abbr title=\"Fast Aerial Loitering Craft\">FALCON</abbr><!-- /redact -->\n"
+	if out, g := extractAbbrTags([]byte(src)); string(out) != "<!-- redact -->The FALCON<!-- /redact -->\n" || len(g) != 0 {
+		t.Fatalf("redacted expansion kept: %q, %v", out, g)
+	}
+	src = "Code:\n\n    <abbr title=\"World Health Organization\">WHO</abbr>\n"
+	if out, g := extractAbbrTags([]byte(src)); string(out) != src || len(g) != 0 {
+		t.Fatalf("tag in indented code replaced: %q, %v", out, g)
+	}
+}
+
+func TestHeadingNumberer(t *testing.T) {
+	n := headingNumberer{base: 1}
+	var got []string
+	for _, level := range []int{1, 2, 2, 3, 1} {
+		got = append(got, n.next(level))
+	}
+	n.startAppendix()
+	for _, level := range []int{1, 2, 1} {
+		got = append(got, n.next(level))
+	}
+	expected := []string{"1", "1.1", "1.2", "1.2.1", "2", "A", "A.1", "B"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+	n = headingNumberer{base: 1}
+	got = nil
+	for _, level := range []int{1, 3, 2, 3} {
+		got = append(got, n.next(level))
+	}
+	expected = []string{"1", "1.1.1", "1.2", "1.2.1"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("skipped level: expected %v got %v", expected, got)
+	}
+	if appendixLetter(27) != "AA" {
+		t.Fatalf("expected AA got %s", appendixLetter(27))
+	}
+}
+
+func TestTOCEntriesAppendix(t *testing.T) {
+	entries, err := GetTOCEntries([]byte("## Intro\n\n## Usage\n\n<!-- appendix -->\n\n## Extra\n\n### Detail\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []string
+	for _, e := range entries {
+		numbers = append(numbers, e.Number)
+	}
+	if strings.Join(numbers, " ") != "1 2 A A.1" {
+		t.Fatalf("unexpected TOC numbers %v", numbers)
+	}
+}
+
+func TestRevisedBlocks(t *testing.T) {
+	p := func(s string) ast.Node {
+		return markdown.Parse([]byte(s), parser.NewWithExtensions(parser.CommonExtensions))
+	}
+	base := p("# Title\n\nFirst paragraph.\n\nSecond   paragraph.\n")
+	doc := p("# Title\n\nSecond paragraph.\n\nFirst paragraph, edited.\n\nNew paragraph.\n")
+	var changed []string
+	for node := range revisedBlocks(base, doc) {
+		changed = append(changed, ExtractTextFromNode(node))
+	}
+	sort.Strings(changed)
+	expected := []string{"First paragraph, edited.", "New paragraph."}
+	if strings.Join(changed, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %v got %v", expected, changed)
+	}
+}
+
+func TestExpandShortcodes(t *testing.T) {
+	src := "Scan {{qr \"https://example.com\" size=30mm}} here {{unknown x}} {{code main.go}}\n\n`{{qr \"a\"}}`\n\n```\n{{qr \"b\"}}\n```\n\n    {{barcode ean8 \"c\"}}\n"
+	expected := "Scan <!-- qr \"https://example.com\" size=30mm --> here {{unknown x}} {{code main.go}}\n\n`{{qr \"a\"}}`\n\n```\n{{qr \"b\"}}\n```\n\n    {{barcode ean8 \"c\"}}\n"
+	if got := string(expandShortcodes([]byte(src))); got != expected {
+		t.Fatalf("expected %q got %q", expected, got)
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	for in, pt := range map[string]float64{"72": 72, "1in": 72, "25.4mm": 72, "2.54cm": 72, "96px": 72} {
+		got, err := parseLength(in)
+		if err != nil || got < pt-0.001 || got > pt+0.001 {
+			t.Errorf("parseLength(%q) = %v, %v; expected %v", in, got, err, pt)
+		}
+	}
+	if _, err := parseLength("big"); err == nil {
+		t.Errorf("expected error for invalid length")
+	}
+}
+
+func TestEncodeBarcode(t *testing.T) {
+	code, err := encodeBarcode("ean13", "400638133393")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Content() != "4006381333931" {
+		t.Fatalf("expected check digit to be appended, got %s", code.Content())
+	}
+	if _, err := encodeBarcode("code128", "ABC-123"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][2]string{{"ean13", "123"}, {"ean8", "abcdefg"}, {"upc", "1"}} {
+		if _, err := encodeBarcode(bad[0], bad[1]); err == nil {
+			t.Errorf("expected error for %s %q", bad[0], bad[1])
+		}
+	}
+}
+
+func TestCSVTables(t *testing.T) {
+	src := "```csv\nName,Qty\nApple,3\n\"Pear, green\"\n```\n\n```tsv header=false\na\tb\n```\n\n```go\nx := 1\n```\n"
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(parser.CommonExtensions))
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.csvTables(doc)
+	var tables, headers, cells, code int
+	ast.WalkFunc(doc, func(n ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n.(type) {
+		case *ast.Table:
+			tables++
+		case *ast.TableHeader:
+			headers++
+		case *ast.TableCell:
+			cells++
+		case *ast.CodeBlock:
+			code++
+		}
+		return ast.GoToNext
+	})
+	if tables != 2 || headers != 1 || cells != 8 || code != 1 {
+		t.Fatalf("unexpected tree: %d tables, %d headers, %d cells, %d code blocks", tables, headers, cells, code)
+	}
+	setColumnWidths(doc, r)
+	for table, widths := range r.ColumnWidths {
+		if len(widths) != 2 {
+			t.Fatalf("expected 2 column widths for %T, got %v", table, widths)
+		}
+	}
+}
+
+func TestProcessDiagram(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	img := image.NewGray(image.Rect(0, 0, 288, 144))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	// cat echoes the "diagram source", which is already a PNG
+	DiagramCommands["echo-png"] = []string{"cat"}
+	DiagramCommands["missing"] = []string{"no-such-diagram-tool"}
+	defer delete(DiagramCommands, "echo-png")
+	defer delete(DiagramCommands, "missing")
+
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.DiagramCacheDir = t.TempDir()
+	y := r.Pdf.GetY()
+	if !r.processDiagram(ast.CodeBlock{Leaf: ast.Leaf{Literal: buf.Bytes()}, Info: []byte("echo-png")}) {
+		t.Fatal("expected diagram to be rendered")
+	}
+	// 144 pixels at 144 dpi is one inch
+	if dy := r.Pdf.GetY() - y; dy < 72 {
+		t.Fatalf("expected image of 72pt height, advanced %v", dy)
+	}
+	for _, info := range []string{"missing", "echo-png", "go"} {
+		if r.processDiagram(ast.CodeBlock{Leaf: ast.Leaf{Literal: []byte("x")}, Info: []byte(info)}) {
+			t.Fatalf("expected %s block to fall back to code", info)
+		}
+	}
+	for _, want := range []string{"missing block printed as code: ", "echo-png block printed as code: invalid output: "} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("no warning %q in %q", want, logged.String())
+		}
+	}
+	// rendering again uses the cache, even when the command is unavailable
+	t.Setenv("PATH", "")
+	if _, err := r.renderDiagram("echo-png", buf.Bytes()); err != nil {
+		t.Fatalf("expected cached diagram: %v", err)
+	}
+}
+
+func TestProcessLaTeX(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	src := []byte(`\[ e^{i\pi} + 1 = 0 \]`)
+	block := ast.CodeBlock{Leaf: ast.Leaf{Literal: src}, Info: []byte("latex")}
+
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	if r.processLaTeX(block) {
+		t.Fatal("expected verbatim LaTeX without an engine")
+	}
+	r.LaTeXEngine = "no-such-latex"
+	r.DiagramCacheDir = t.TempDir()
+	if r.processLaTeX(block) {
+		t.Fatal("expected verbatim LaTeX with a missing engine")
+	}
+	if n := strings.Count(logged.String(), "LaTeX block printed verbatim"); n != 2 {
+		t.Fatalf("expected 2 warnings, got %q", logged.String())
+	}
+
+	// a block rendered before is drawn from the cache
+	img := image.NewGray(image.Rect(0, 0, 288, 144))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.cachedImage(r.LaTeXEngine, src, func() ([]byte, error) { return buf.Bytes(), nil }); err != nil {
+		t.Fatal(err)
+	}
+	y := r.Pdf.GetY()
+	if !r.processLaTeX(block) {
+		t.Fatal("expected the cached LaTeX image to be drawn")
+	}
+	if dy := r.Pdf.GetY() - y; dy < 72 {
+		t.Fatalf("expected image of 72pt height, advanced %v", dy)
+	}
+}
+
+func TestProcessFence(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	img := image.NewGray(image.Rect(0, 0, 288, 144))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	var gotInfo string
+	RegisterFenceHandler("Chart", func(info string, body []byte, r *PdfRenderer) error {
+		gotInfo = info
+		if string(body) == "bad" {
+			return errors.New("no chart")
+		}
+		return r.DrawPNG(buf.Bytes(), 144)
+	})
+	defer RegisterFenceHandler("chart", nil)
+
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	y := r.Pdf.GetY()
+	if !r.processFence(ast.CodeBlock{Leaf: ast.Leaf{Literal: []byte("data")}, Info: []byte("chart width=50%")}) {
+		t.Fatal("expected the chart handler to render the block")
+	}
+	if gotInfo != "chart width=50%" {
+		t.Fatalf("unexpected info string %q", gotInfo)
+	}
+	// 144 pixels at 144 dpi is one inch
+	if dy := r.Pdf.GetY() - y; dy < 72 {
+		t.Fatalf("expected image of 72pt height, advanced %v", dy)
+	}
+	if r.processFence(ast.CodeBlock{Leaf: ast.Leaf{Literal: []byte("bad")}, Info: []byte("chart")}) {
+		t.Fatal("expected a failing handler to fall back to code")
+	}
+	if !strings.Contains(logged.String(), "chart block printed as code: no chart") {
+		t.Fatalf("expected a warning, got %q", logged.String())
+	}
+	if r.processFence(ast.CodeBlock{Leaf: ast.Leaf{Literal: []byte("x")}, Info: []byte("go")}) {
+		t.Fatal("expected a go block without a handler to render as code")
+	}
+	RegisterFenceHandler("chart", nil)
+	if r.processFence(ast.CodeBlock{Leaf: ast.Leaf{Literal: []byte("data")}, Info: []byte("chart")}) {
+		t.Fatal("expected the removed handler not to be used")
+	}
+}
+
+func TestPlantUMLEncode(t *testing.T) {
+	src := []byte("@startuml\nBob -> Alice : hello\n@enduml\n")
+	encoded := plantUMLEncode(src)
+	var data []byte
+	for i := 0; i+3 < len(encoded); i += 4 {
+		var v [4]byte
+		for j := range v {
+			v[j] = byte(strings.IndexByte(plantUMLAlphabet, encoded[i+j]))
+		}
+		data = append(data, v[0]<<2|v[1]>>4, v[1]<<4|v[2]>>2, v[2]<<6|v[3])
+	}
+	decoded, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(decoded, src) {
+		t.Fatalf("round trip failed: %q", decoded)
+	}
+}
+
+func TestTableColSpanWidths(t *testing.T) {
+	src := "| A | B | C |\n|---|---|---|\n| a much wider cell spanning two columns || c |\n| ^^ | x | y |\n"
+	doc := markdown.Parse([]byte(src), parser.NewWithExtensions(parser.Tables))
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	setColumnWidths(doc, r)
+	for _, widths := range r.ColumnWidths {
+		if len(widths) != 3 {
+			t.Fatalf("expected 3 columns, got %v", widths)
+		}
+		span := r.Pdf.GetStringWidth("a much wider cell spanning two columns")
+		if widths[0]+widths[1] < span || widths[2] >= widths[0] {
+			t.Fatalf("spanning cell not accounted for: %v", widths)
+		}
+	}
+	r.Extensions = parser.Tables
+	if err := r.Run([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTableCellBlocks(t *testing.T) {
+	r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+	r.setStyler(r.TBody)
+	lines := r.cellLines("Intro\n- one\n- two", 200)
+	if strings.Join(lines, "|") != "Intro|• one|• two" {
+		t.Fatalf("unexpected cell lines %q", lines)
+	}
+	if wrapped := r.cellLines("- a long item that has to wrap", 60); len(wrapped) < 2 || !strings.HasPrefix(wrapped[1], "   ") {
+		t.Fatalf("expected wrapped item with hanging indent, got %q", wrapped)
+	}
+	r.CellWrapPrefix = "» "
+	text := "a long cell text that has to wrap over several lines"
+	wrapped := r.cellLines(text+"\n- and an item that wraps too", 80)
+	var words []string
+	for i, l := range wrapped {
+		if w := r.Pdf.GetStringWidth(l); w > 80-2*r.Pdf.GetCellMargin() {
+			t.Errorf("line %q is %.2f wide", l, w)
+		}
+		if i > 0 && !strings.HasPrefix(l, "» ") && !strings.HasPrefix(l, "• ") && !strings.HasPrefix(l, "   » ") {
+			t.Errorf("continuation line %q without the prefix", l)
+		}
+		words = append(words, strings.Fields(strings.NewReplacer("» ", "", "• ", "").Replace(l))...)
+	}
+	if strings.Join(words, " ") != text+" and an item that wraps too" || len(wrapped) < 5 {
+		t.Errorf("wrapped with prefix: %q", wrapped)
+	}
+	r.CellWrapPrefix = ""
+
+	height := func(src string) float64 {
+		r := NewPdfRenderer(PdfRendererParams{Theme: LIGHT})
+		r.Extensions = parser.Tables
+		y := r.Pdf.GetY()
+		if err := r.Run([]byte(src)); err != nil {
+			t.Fatal(err)
+		}
+		return r.Pdf.GetY() - y
+	}
+	single := height("| A | B |\n|---|---|\n| x | - one |\n")
+	multi := height("| A | B |\n|---|---|\n| x | - one<br>- two<br>- three |\n")
+	if multi < single+2*r.TBody.Size {
+		t.Fatalf("row did not grow: single %v, multi %v", single, multi)
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	cases := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"\tx", 4, "    x"},
+		{"ab\tc", 4, "ab  c"},
+		{"abcd\te", 4, "abcd    e"},
+		{"a\tb\n\tc", 8, "a       b\n        c"},
+		{"é\tx", 4, "é   x"},
+		{"e\u0301\tx", 4, "e\u0301   x"},
+		{"漢字\tx", 8, "漢字    x"},
+		{"ｘ\tx", 4, "ｘ  x"},
+		{"\tx", 0, "\tx"},
+	}
+	for _, c := range cases {
+		if got := expandTabs(c.in, c.width); got != c.want {
+			t.Errorf("expandTabs(%q, %d) = %q, want %q", c.in, c.width, got, c.want)
+		}
+	}
+}
+
+func TestParseANSI(t *testing.T) {
+	lines := parseANSI("\x1b]0;title\x07ok \x1b[1;31mFAIL\x1b[0m\tdone\n\x1b[38;5;21mblue\x1b[39m \x1b[38;2;1;2;3mrgb\x1b[K\n", 8)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %+v", len(lines), lines)
+	}
+	first := lines[0]
+	if len(first) != 3 || first[0].text != "ok " || first[0].color != nil {
+		t.Fatalf("unexpected first line %+v", first)
+	}
+	if first[1].text != "FAIL" || !first[1].bold || *first[1].color != ansiPalette[1] {
+		t.Fatalf("unexpected colored span %+v", first[1])
+	}
+	if first[2].text != " done" || first[2].bold || first[2].color != nil {
+		t.Fatalf("reset or tab expansion failed: %+v", first[2])
+	}
+	second := lines[1]
+	if *second[0].color != (Color{0, 0, 255}) || second[1].color != nil || *second[2].color != (Color{1, 2, 3}) {
+		t.Fatalf("unexpected extended colors %+v", second)
+	}
+}
+
+func TestExpandMarks(t *testing.T) {
+	src := "A ==marked text== and `a==b==c`, x == y == z.\n```\n==code==\n```\n\n    if a ==b== {}\n\n==end=="
+	want := "A <mark>marked text</mark> and `a==b==c`, x == y == z.\n```\n==code==\n```\n\n    if a ==b== {}\n\n<mark>end</mark>"
+	if got := string(expandMarks([]byte(src))); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
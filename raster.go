@@ -0,0 +1,126 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Rasterizer is an external command that renders the pages of a PDF file as
+// page-N.png images in a directory
+type Rasterizer struct {
+	Command string
+	Args    func(pdf, dir string, dpi int) []string
+}
+
+// Rasterizers are the commands RasterizePages can use, in order of
+// preference
+var Rasterizers = []Rasterizer{
+	{"pdftoppm", func(pdf, dir string, dpi int) []string {
+		return []string{"-png", "-r", strconv.Itoa(dpi), pdf, filepath.Join(dir, "page")}
+	}},
+	{"mutool", func(pdf, dir string, dpi int) []string {
+		return []string{"draw", "-q", "-r", strconv.Itoa(dpi), "-o", filepath.Join(dir, "page-%d.png"), pdf}
+	}},
+	{"gs", func(pdf, dir string, dpi int) []string {
+		return []string{"-dSAFER", "-dBATCH", "-dNOPAUSE", "-dQUIET", "-sDEVICE=png16m",
+			"-r" + strconv.Itoa(dpi), "-sOutputFile=" + filepath.Join(dir, "page-%d.png"), pdf}
+	}},
+}
+
+// ErrNoRasterizer is returned when none of the Rasterizers is installed
+var ErrNoRasterizer = errors.New("no PDF rasterizer installed")
+
+// pageImage matches the images written by a rasterizer; pdftoppm pads the
+// page numbers with zeros
+var pageImage = regexp.MustCompile(`^page-0*(\d+)\.png$`)
+
+// FindRasterizer returns the first of the Rasterizers that is installed
+func FindRasterizer() (Rasterizer, error) {
+	var names []string
+	for _, rz := range Rasterizers {
+		if _, err := exec.LookPath(rz.Command); err == nil {
+			return rz, nil
+		}
+		names = append(names, rz.Command)
+	}
+	return Rasterizer{}, fmt.Errorf("%w (need one of %s)", ErrNoRasterizer, strings.Join(names, ", "))
+}
+
+// RasterizePages renders each page of the PDF file pdf with the first
+// installed rasterizer and returns the PNG images, in page order
+func RasterizePages(pdf string, dpi int) ([][]byte, error) {
+	rz, err := FindRasterizer()
+	if err != nil {
+		return nil, err
+	}
+	return rz.Rasterize(pdf, dpi)
+}
+
+// Rasterize renders each page of the PDF file pdf at dpi and returns the
+// PNG images, in page order
+func (rz Rasterizer) Rasterize(pdf string, dpi int) ([][]byte, error) {
+	dir, err := os.MkdirTemp("", "md2pdf-pages-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.Command(rz.Command, rz.Args(pdf, dir, dpi)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", rz.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pages := map[int]string{}
+	for _, e := range entries {
+		if m := pageImage.FindStringSubmatch(e.Name()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			pages[n] = e.Name()
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%s wrote no page images", rz.Command)
+	}
+	numbers := make([]int, 0, len(pages))
+	for n := range pages {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	images := make([][]byte, len(numbers))
+	for i, n := range numbers {
+		if images[i], err = os.ReadFile(filepath.Join(dir, pages[n])); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// redactMarker matches the <!-- redact --> and <!-- /redact --> comments
+// around redacted content
+var redactMarker = regexp.MustCompile(`^\s*<!--\s*(/?)redact\s*-->\s*$`)
+
+// redactSpan matches the redact comments within a line of the source
+var redactSpan = regexp.MustCompile(`<!--\s*(/?)redact\s*-->`)
+
+// footnoteDefinition matches the label of a footnote definition
+var footnoteDefinition = regexp.MustCompile(`^ {0,3}\[\^([^\]]+)\]:`)
+
+// RedactedLabel stands for redacted headings in the PDF outline
+var RedactedLabel = "[redacted]"
+
+// maskText replaces every character of s but white space with an x, so
+// that redacted text keeps its shape but none of its content
+func maskText(s []byte) []byte {
+	return []byte(strings.Map(func(c rune) rune {
+		if c == ' ' || c == '\t' || c == '\n' {
+			return c
+		}
+		return 'x'
+	}, string(s)))
+}
+
+// redactedNotes returns the labels of the footnotes defined between
+// <!-- redact --> and <!-- /redact --> comments of content: the parser moves
+// their definitions to the list of footnotes, out of the redacted region.
+func redactedNotes(content []byte) map[string]bool {
+	notes := map[string]bool{}
+	mapRedactedLines(content, func(line string, redacted bool) string {
+		if m := footnoteDefinition.FindStringSubmatch(line); m != nil && redacted {
+			notes[m[1]] = true
+		}
+		return line
+	})
+	return notes
+}
+
+// mapRedactedLines is mapProseLines that also tells fn whether the line is
+// in a region between <!-- redact --> and <!-- /redact --> comments,
+// including the lines of the comments
+func mapRedactedLines(content []byte, fn func(line string, redacted bool) string) []byte {
+	open := false
+	return mapProseLines(content, func(line string) string {
+		was := open
+		for _, m := range redactSpan.FindAllStringSubmatch(line, -1) {
+			open = m[1] == ""
+			was = was || open
+		}
+		return fn(line, was)
+	})
+}
+
+// redactions removes the content between <!-- redact --> and
+// <!-- /redact --> comments, and of {.redact} headings, from doc before it
+// is rendered: texts and code spans are masked, code blocks become masked
+// paragraphs, links lose their targets and images and raw HTML are dropped.
+// Headings with redacted text get the redact class, and the footnotes
+// labelled in notes, see redactedNotes, are redacted as a whole. It returns
+// the masked text and code nodes, which are drawn as black bars.
+func redactions(doc ast.Node, notes map[string]bool) map[ast.Node]bool {
+	redacted := map[ast.Node]bool{}
+	var markers, dropped, unwrapped []ast.Node
+	var blocks []*ast.CodeBlock
+	var heading *ast.Heading
+	var note ast.Node
+	open := false
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if item, ok := node.(*ast.ListItem); ok && item.RefLink != nil && notes[string(item.RefLink)] {
+			note = nil
+			if entering {
+				note = item
+			}
+			return ast.GoToNext
+		}
+		if h, ok := node.(*ast.Heading); ok {
+			heading = nil
+			if entering {
+				heading = h
+			}
+			if entering && open && !hasClass(h, "redact") {
+				setHeadingAttributes(h, ".redact")
+			}
+			return ast.GoToNext
+		}
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.HTMLBlock, *ast.HTMLSpan:
+			if m := redactMarker.FindSubmatch(n.AsLeaf().Literal); m != nil {
+				open = len(m[1]) == 0
+				markers = append(markers, n)
+				return ast.GoToNext
+			}
+		}
+		if !open && note == nil && (heading == nil || !hasClass(heading, "redact")) {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Text, *ast.Code:
+			n.AsLeaf().Literal = maskText(n.AsLeaf().Literal)
+			redacted[n] = true
+			if heading != nil && !hasClass(heading, "redact") {
+				setHeadingAttributes(heading, ".redact")
+			}
+		case *ast.CodeBlock:
+			blocks = append(blocks, n)
+			return ast.SkipChildren
+		case *ast.Link, *ast.Image:
+			unwrapped = append(unwrapped, n)
+		case *ast.HTMLBlock, *ast.HTMLSpan:
+			dropped = append(dropped, n)
+		default:
+			if leaf := node.AsLeaf(); leaf != nil {
+				leaf.Literal = maskText(leaf.Literal)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, cb := range blocks {
+		p := &ast.Paragraph{}
+		text := &ast.Text{}
+		text.Literal = maskText([]byte(strings.TrimRight(string(cb.Literal), "\n")))
+		ast.AppendChild(p, text)
+		redacted[text] = true
+		replaceNode(cb, p)
+	}
+	// links and images keep their (masked) text, without the target
+	for _, n := range unwrapped {
+		replaceNode(n, n.GetChildren()...)
+	}
+	for _, n := range append(dropped, markers...) {
+		parent := n.GetParent()
+		ast.RemoveFromTree(n)
+		// an indented marker is a paragraph of its own
+		if p, ok := parent.(*ast.Paragraph); ok && len(p.Children) == 0 {
+			ast.RemoveFromTree(p)
+		}
+	}
+	return redacted
+}
+
+// hasRedacted tells whether node has redacted text, such as a footnote,
+// which is then not set as a sidenote, or a table cell, which is blacked out
+// as a whole
+func (r *PdfRenderer) hasRedacted(node ast.Node) bool {
+	found := false
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if r.redacted[n] {
+			found = true
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return found
+}
+
+// writeRedacted draws a black bar in place of each piece of text, which
+// has been masked already, so that no glyphs are written
+func (r *PdfRenderer) writeRedacted(s Styler, text string) {
+	r.setStyler(s)
+	r.Pdf.SetFillColor(0, 0, 0)
+	r.writePieces(text, func(part string) {
+		x, y := r.Pdf.GetXY()
+		w := r.Pdf.GetStringWidth(part)
+		if bar := r.Pdf.GetStringWidth(strings.TrimRight(part, " ")); bar > 0 {
+			r.Pdf.Rect(x+r.Pdf.GetCellMargin(), y+s.Spacing/2, bar, s.Size, "F")
+		}
+		r.Pdf.SetX(x + w)
+	})
+	r.tracer("Redacted", fmt.Sprintf("%d characters", len(text)))
+}
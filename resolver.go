@@ -0,0 +1,148 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// LinkKind tells what a LinkResolver made of a link
+type LinkKind int
+
+const (
+	// LinkUnresolved leaves the link as it is written
+	LinkUnresolved LinkKind = iota
+	// LinkURL is a destination as in [text](dest), e.g. a URL or a file
+	LinkURL
+	// LinkAnchor is the id of a heading or other target in the document,
+	// with or without the leading #
+	LinkAnchor
+)
+
+// LinkResolver maps a link written in the document to a destination, see
+// WithLinkResolver
+type LinkResolver func(dest string) (string, LinkKind)
+
+// wikiLink is a [[target]] or [[target|text]] link
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|\n]+)(?:\|([^\[\]\n]+))?\]\]`)
+
+// ticketRef is an issue key, such as JIRA-123
+var ticketRef = regexp.MustCompile(`\b[A-Z][A-Z0-9_]+-[0-9]+\b`)
+
+// WithLinkResolver sets resolve to map links to destinations: those of
+// [text](dest) links, [[Page Name]] and [[Page Name|text]] wiki links, and
+// issue keys such as JIRA-123 in the text. Those it leaves unresolved stay
+// as they are written.
+func WithLinkResolver(resolve LinkResolver) RenderOption {
+	return func(r *PdfRenderer) {
+		r.linkResolver = resolve
+	}
+}
+
+// resolveLinks applies the link resolver to the links, wiki links and issue
+// keys of doc; wiki links and issue keys are left alone in links and code.
+func (r *PdfRenderer) resolveLinks(doc ast.Node) {
+	if r.linkResolver == nil {
+		return
+	}
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Link:
+			if entering {
+				if dest, ok := r.resolveLink(string(n.Destination)); ok {
+					n.Destination = []byte(dest)
+				}
+			}
+			return ast.SkipChildren
+		case *ast.Image, *ast.CodeBlock, *ast.Code:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, t := range texts {
+		var nodes []ast.Node
+		s, start := string(t.Literal), 0
+		for _, m := range resolvableLinks(s) {
+			target, text := s[m[2]:m[3]], s[m[2]:m[3]]
+			if m[4] >= 0 {
+				text = s[m[4]:m[5]]
+			}
+			dest, ok := r.resolveLink(strings.TrimSpace(target))
+			if !ok {
+				continue
+			}
+			if m[0] > start {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:m[0]])}})
+			}
+			a := &ast.Link{Destination: []byte(dest)}
+			ast.AppendChild(a, &ast.Text{Leaf: ast.Leaf{Literal: []byte(strings.TrimSpace(text))}})
+			nodes = append(nodes, a)
+			start = m[1]
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		if start < len(s) {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:])}})
+		}
+		replaceNode(t, nodes...)
+	}
+}
+
+// resolvableLinks returns the submatch indexes of the wiki links and the
+// issue keys outside them in s, in order, as for wikiLink
+func resolvableLinks(s string) [][]int {
+	var all [][]int
+	start := 0
+	keys := func(end int) {
+		for _, k := range ticketRef.FindAllStringIndex(s[start:end], -1) {
+			all = append(all, []int{start + k[0], start + k[1], start + k[0], start + k[1], -1, -1})
+		}
+	}
+	for _, l := range wikiLink.FindAllStringSubmatchIndex(s, -1) {
+		keys(l[0])
+		all = append(all, l)
+		start = l[1]
+	}
+	keys(len(s))
+	return all
+}
+
+// resolveLink returns the destination the resolver maps dest to, if any
+func (r *PdfRenderer) resolveLink(dest string) (string, bool) {
+	resolved, kind := r.linkResolver(dest)
+	switch kind {
+	case LinkURL:
+	case LinkAnchor:
+		resolved = "#" + strings.TrimPrefix(resolved, "#")
+	default:
+		return "", false
+	}
+	r.tracer("Link resolved", dest+" -> "+resolved)
+	return resolved, true
+}
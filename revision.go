@@ -0,0 +1,178 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// revisionMark is the start of a changed block that gets a revision bar
+type revisionMark struct {
+	page int
+	y    float64
+}
+
+// revisionKey identifies a block by its type and whitespace-normalized text
+func revisionKey(node ast.Node) (string, bool) {
+	var text string
+	switch n := node.(type) {
+	case *ast.Paragraph, *ast.Heading, *ast.Table:
+		text = ExtractTextFromNode(n)
+	case *ast.CodeBlock:
+		text = string(n.Literal)
+	case *ast.HTMLBlock:
+		text = string(n.Literal)
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("%T:%s", node, strings.Join(strings.Fields(text), " ")), true
+}
+
+// revisedBlocks compares the blocks of doc with those of the base document
+// and returns the ones that are new or changed. Blocks are matched by
+// content, so moved blocks are not marked.
+func revisedBlocks(base, doc ast.Node) map[ast.Node]bool {
+	old := map[string]int{}
+	ast.WalkFunc(base, func(node ast.Node, entering bool) ast.WalkStatus {
+		if key, ok := revisionKey(node); ok && entering {
+			old[key]++
+			return ast.SkipChildren
+		}
+		return ast.GoToNext
+	})
+	revised := map[ast.Node]bool{}
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		key, ok := revisionKey(node)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		if old[key] > 0 {
+			old[key]--
+		} else {
+			revised[node] = true
+		}
+		return ast.SkipChildren
+	})
+	return revised
+}
+
+// markRevisions parses the diff base and records the changed blocks of doc
+func (r *PdfRenderer) markRevisions(doc ast.Node) {
+	r.revised = nil
+	if r.DiffBase == nil {
+		return
+	}
+	s, err := r.preprocess(markdown.NormalizeNewlines(r.DiffBase))
+	if err != nil {
+		r.logf("Warning: diff base: %v", err)
+		return
+	}
+	s, _ = extractAbbreviations(s)
+	s, _ = extractAbbrTags(s)
+	s, details := extractDetails(s)
+	base := markdown.Parse(s, parser.NewWithExtensions(r.Extensions))
+	r.detailsBlocks(base, details)
+	r.codeIncludes(base)
+	parseHeadingAttributes(base)
+	r.shiftHeadings(base)
+	r.csvTables(base)
+	if r.GFM {
+		gfmAutolinks(base)
+	}
+	if r.EmojiShortcodes {
+		emojiShortcodes(base, fontGlyphs(r.Normal.Font))
+	}
+	iconShortcodes(base)
+	if r.Extensions&parser.Mmark != 0 {
+		codeCallouts(base)
+	}
+	r.revised = revisedBlocks(base, doc)
+	r.tracer("Revisions", fmt.Sprintf("%d changed blocks", len(r.revised)))
+}
+
+// revisionBar tracks changed blocks around RenderNode; rendered is false
+// before and true after the node was processed. The bar starts after a
+// container's leading spacing, and before a leaf block, and is drawn in the
+// left margin, on every page the block spans, once the block is finished.
+func (r *PdfRenderer) revisionBar(node ast.Node, entering, rendered bool) {
+	if !r.revised[node] {
+		return
+	}
+	leaf := node.AsContainer() == nil
+	if entering && leaf != rendered {
+		r.revision = &revisionMark{page: r.Pdf.PageNo(), y: r.Pdf.GetY()}
+		return
+	}
+	if r.revision == nil || !rendered || (entering && !leaf) {
+		return
+	}
+	start := r.revision
+	r.revision = nil
+	endPage, endY := r.Pdf.PageNo(), r.Pdf.GetY()
+	left, top, _, _ := r.Pdf.GetMargins()
+	if r.Pdf.GetX() > left {
+		// still on the last line of the block
+		_, lineHeight := r.Pdf.GetFontSize()
+		endY += lineHeight
+	}
+	if endY == start.y && endPage == start.page {
+		return
+	}
+	_, breakMargin := r.Pdf.GetAutoPageBreak()
+	x := left / 2
+
+	// drawing state is per page content stream, so set and restore it on
+	// every page
+	dr, dg, db := r.Pdf.GetDrawColor()
+	lineWidth := r.Pdf.GetLineWidth()
+	for page := start.page; page <= endPage; page++ {
+		_, pageHeight := r.pageSize(page)
+		y0, y1 := top, pageHeight-breakMargin
+		if page == start.page {
+			y0 = start.y
+		}
+		if page == endPage {
+			y1 = endY
+		}
+		r.Pdf.SetPage(page)
+		r.Pdf.SetDrawColor(r.RevisionColor.Red, r.RevisionColor.Green, r.RevisionColor.Blue)
+		r.Pdf.SetLineWidth(2)
+		dy := r.pageOffset(page)
+		r.Pdf.Line(x, y0+dy, x, y1+dy)
+		r.Pdf.SetLineWidth(lineWidth)
+		r.Pdf.SetDrawColor(dr, dg, db)
+	}
+	r.Pdf.SetPage(endPage)
+}
+
+// SetDiffBase sets the previous version of the document. Blocks that are new
+// or changed compared to it are marked with a revision bar in the left
+// margin and, if colorText is true, rendered in RevisionColor.
+func SetDiffBase(base []byte, colorText bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.DiffBase = base
+		r.RevisionText = colorText
+	}
+}
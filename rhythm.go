@@ -0,0 +1,100 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"math"
+	"slices"
+)
+
+// Densities are the typographic scales of SetDensity, from the tightest
+var Densities = []string{"compact", "normal", "relaxed"}
+
+// densityScales give the size of body text of each density, in points, and
+// the factor the spacing of lines is scaled by on top of the sizes
+var densityScales = map[string]struct{ size, leading float64 }{
+	"compact": {9, 0.6},
+	"normal":  {11, 1},
+	"relaxed": {12, 1.5},
+}
+
+// SetBaseLineHeight puts the text on a baseline grid of lines height points
+// apart: line heights are rounded up to whole grid lines and the spacing
+// between blocks and list items is given in grid lines, so that all of it
+// follows from one value. 0, the default, keeps the spacing of the styles.
+func SetBaseLineHeight(height float64) RenderOption {
+	return func(r *PdfRenderer) {
+		r.BaseLineHeight = height
+	}
+}
+
+// SetDensity scales the font sizes, line spacing and indents of the theme
+// and styles from the size of body text of a density, one of Densities:
+// "compact" fits more on a page, "relaxed" reads more easily, and "normal"
+// sets body text at 11 points. An unknown density is ignored with a
+// warning.
+func SetDensity(density string) RenderOption {
+	return func(r *PdfRenderer) {
+		if !slices.Contains(Densities, density) {
+			r.logf("Warning: unknown density %q", density)
+			return
+		}
+		r.Density = density
+	}
+}
+
+// applyDensity scales the styles to the density, once the theme and the
+// options have set them
+func (r *PdfRenderer) applyDensity() {
+	scale, ok := densityScales[r.Density]
+	if !ok || r.Normal.Size <= 0 {
+		return
+	}
+	f := scale.size / r.Normal.Size
+	for _, s := range []*Styler{&r.Normal, &r.Link, &r.Backtick, &r.Blockquote, &r.Code,
+		&r.H1, &r.H2, &r.H3, &r.H4, &r.H5, &r.H6, &r.THeader, &r.TBody} {
+		s.Size *= f
+		s.Spacing *= f * scale.leading
+	}
+	// indents given in points are kept; the default one follows the text
+	if r.IndentValue == 1.5*r.em {
+		r.IndentValue *= f
+	}
+}
+
+// lineHeight returns the height of a line of text in style s: its size plus
+// spacing, rounded up to whole lines of the baseline grid if there is one
+func (r *PdfRenderer) lineHeight(s Styler) float64 {
+	h := s.Size + s.Spacing
+	if r.BaseLineHeight <= 0 {
+		return h
+	}
+	// tolerate rounding errors, e.g. in sizes scaled down to fit tables
+	return max(1, math.Ceil(h/r.BaseLineHeight-1e-6)) * r.BaseLineHeight
+}
+
+// spacing returns def without a baseline grid, else the given number of
+// grid lines
+func (r *PdfRenderer) spacing(def, lines float64) float64 {
+	if r.BaseLineHeight <= 0 {
+		return def
+	}
+	return lines * r.BaseLineHeight
+}
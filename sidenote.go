@@ -0,0 +1,130 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// SetSidenotes sets footnotes as sidenotes: short notes in the right margin,
+// level with the line of their reference, as in Tufte's books. A note is
+// left among the footnotes at the end of the document if the margin is too
+// narrow for it or it does not fit the rest of the page. It turns on the
+// [^note] footnote syntax of the parser.
+func SetSidenotes(sidenotes bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Sidenotes = sidenotes
+	}
+}
+
+// sidenoteStyle is the style of sidenotes, the normal text made smaller
+func (r *PdfRenderer) sidenoteStyle() Styler {
+	s := r.Normal
+	s.Size *= 0.8
+	s.Spacing *= 0.8
+	return s
+}
+
+// sidenote sets the footnote of a reference in the margin beside the current
+// line, below the previous sidenote of the page; a note referenced again
+// is only set once.
+func (r *PdfRenderer) sidenote(ref *ast.Link) {
+	item := ref.Footnote
+	if _, seen := r.sidenotes[item]; seen || item == nil || incell {
+		return
+	}
+	r.sidenotes[item] = false
+	if r.hasRedacted(item) {
+		r.tracer("Sidenote", fmt.Sprintf("%d: redacted, kept as a footnote", ref.NoteID))
+		return
+	}
+	pageWidth, pageHeight := r.Pdf.GetPageSize()
+	_, _, right, _ := r.Pdf.GetMargins()
+	_, bottom := r.Pdf.GetAutoPageBreak()
+	gap := r.em
+	width := right - 2*gap
+	if width < 5*r.em {
+		r.tracer("Sidenote", fmt.Sprintf("%d: margin too narrow, kept as a footnote", ref.NoteID))
+		return
+	}
+	style := r.sidenoteStyle()
+	r.setStyler(style)
+	text := fmt.Sprintf("%d %s", ref.NoteID, footnoteText(item))
+	height := float64(len(r.Pdf.SplitText(text, width))) * r.lineHeight(style)
+	x, y := r.Pdf.GetXY()
+	top := y
+	if r.sidenotePage == r.Pdf.PageNo() {
+		top = max(top, r.sidenoteY)
+	}
+	if top+height <= pageHeight-bottom {
+		r.Pdf.SetXY(pageWidth-right+gap, top)
+		r.Pdf.MultiCell(width, r.lineHeight(style), text, "", "L", false)
+		r.sidenotePage, r.sidenoteY = r.Pdf.PageNo(), r.Pdf.GetY()+r.lineHeight(style)/2
+		r.sidenotes[item] = true
+		r.tracer("Sidenote", fmt.Sprintf("%d at %.2f, %.2f", ref.NoteID, pageWidth-right+gap, top))
+	} else {
+		r.tracer("Sidenote", fmt.Sprintf("%d: does not fit the page, kept as a footnote", ref.NoteID))
+	}
+	r.setStyler(r.cs.peek().textStyle)
+	r.Pdf.SetXY(x, y)
+}
+
+// footnoteText is the text of a footnote on one line
+func footnoteText(item ast.Node) string {
+	var b strings.Builder
+	ast.WalkFunc(item, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Text:
+			b.Write(n.Literal)
+		case *ast.Code:
+			b.Write(n.Literal)
+		case *ast.Softbreak, *ast.Hardbreak:
+			b.WriteString(" ")
+		case *ast.Paragraph:
+			if !entering {
+				b.WriteString(" ")
+			}
+		}
+		return ast.GoToNext
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// sidenoted tells whether the footnotes list, or one of its items, is
+// left out as all of its notes are set in the margin
+func (r *PdfRenderer) sidenoted(node ast.Node) bool {
+	if !r.Sidenotes {
+		return false
+	}
+	if item, ok := node.(*ast.ListItem); ok {
+		return r.sidenotes[item]
+	}
+	for _, list := range node.GetChildren() {
+		for _, item := range list.GetChildren() {
+			if !r.sidenotes[item] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+// StyleOption changes one attribute of a Styler, see SetStyle
+type StyleOption func(s *Styler)
+
+// WithFont sets the font family and style ("", "b", "i", "u" or a
+// combination) of a Styler. The family must be a core PDF font or one added
+// to the renderer's Pdf.
+func WithFont(family, style string) StyleOption {
+	return func(s *Styler) {
+		s.Font = family
+		s.Style = style
+	}
+}
+
+// WithSize sets the font size of a Styler, in points
+func WithSize(size float64) StyleOption {
+	return func(s *Styler) {
+		s.Size = size
+	}
+}
+
+// WithSpacing sets the space added to the font size to get the line height
+func WithSpacing(spacing float64) StyleOption {
+	return func(s *Styler) {
+		s.Spacing = spacing
+	}
+}
+
+// WithTextColor sets the text color of a Styler
+func WithTextColor(c Color) StyleOption {
+	return func(s *Styler) {
+		s.TextColor = c
+	}
+}
+
+// WithFillColor sets the background color of a Styler
+func WithFillColor(c Color) StyleOption {
+	return func(s *Styler) {
+		s.FillColor = c
+	}
+}
+
+// styler returns the Styler called name, as in the fields of PdfRenderer
+// and the keys of a custom theme file, or nil if there is none
+func (r *PdfRenderer) styler(name string) *Styler {
+	switch name {
+	case "Normal":
+		return &r.Normal
+	case "Link":
+		return &r.Link
+	case "Backtick":
+		return &r.Backtick
+	case "Code":
+		return &r.Code
+	case "Blockquote":
+		return &r.Blockquote
+	case "H1":
+		return &r.H1
+	case "H2":
+		return &r.H2
+	case "H3":
+		return &r.H3
+	case "H4":
+		return &r.H4
+	case "H5":
+		return &r.H5
+	case "H6":
+		return &r.H6
+	case "THeader":
+		return &r.THeader
+	case "TBody":
+		return &r.TBody
+	}
+	return nil
+}
+
+// SetStyle overrides attributes of the Styler for element, one of Normal,
+// Link, Backtick, Code, Blockquote, H1 to H6, THeader or TBody, on top of
+// the theme, e.g.
+//
+//	SetStyle("H1", WithFont("Helvetica", "b"), WithTextColor(Color{0, 0, 139}))
+func SetStyle(element string, opts ...StyleOption) RenderOption {
+	return func(r *PdfRenderer) {
+		s := r.styler(element)
+		if s == nil {
+			r.logf("SetStyle: unknown element %q", element)
+			return
+		}
+		for _, o := range opts {
+			o(s)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// workDir returns the temporary directory of the current run, creating it
+// on first use, for downloaded images and converted SVGs. Each run gets its
+// own directory, so concurrent runs don't clobber each other's files.
+func (r *PdfRenderer) workDir() (string, error) {
+	if r.tempDir == "" {
+		dir, err := os.MkdirTemp("", filepath.Base(os.Args[0])+"-*")
+		if err != nil {
+			return "", err
+		}
+		r.tempDir = dir
+	}
+	return r.tempDir, nil
+}
+
+// removeWorkDir deletes the temporary directory at the end of a run,
+// unless KeepTemp is set. The images in it have been read into the PDF by
+// then.
+func (r *PdfRenderer) removeWorkDir() {
+	if r.tempDir == "" {
+		return
+	}
+	if r.KeepTemp {
+		r.logf("Temporary files kept in: %s", r.tempDir)
+	} else if err := os.RemoveAll(r.tempDir); err != nil {
+		r.tracer("Temp", fmt.Sprintf("removing %s: %v", r.tempDir, err))
+	}
+	r.tempDir = ""
+}
+
+// SetKeepTemp keeps the temporary files of a run (downloaded images and
+// converted SVGs) instead of deleting them, for debugging
+func SetKeepTemp(keep bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.KeepTemp = keep
+	}
+}
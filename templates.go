@@ -0,0 +1,317 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// templateAction matches the template actions of markdown source:
+// variables such as {{.Total}} and calls of the formatting helpers, e.g.
+// {{money .Total "EUR"}}; or a code span to skip. Other {{...}} are left
+// to the shortcodes.
+var templateAction = regexp.MustCompile("`+[^`]*`+|\\{\\{-?\\s*(?:\\.|(?:money|date|number)\\s)[^{}]*\\}\\}")
+
+// SetLocale sets the locale, e.g. "de-DE", in which the money, date and
+// number template helpers format their values; by default "en"
+func SetLocale(locale string) RenderOption {
+	return func(r *PdfRenderer) {
+		r.Locale = locale
+	}
+}
+
+// listItem matches the first line of a list item, whose continuation lines
+// are indented like code
+var listItem = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s`)
+
+// mapProseLines is mapLines that also leaves the lines of indented code
+// blocks alone: lines indented by four spaces or a tab after a blank line,
+// outside lists
+func mapProseLines(content []byte, fn func(line string) string) []byte {
+	blank, code, list := true, false, false
+	return mapLines(content, func(line string) string {
+		trimmed := strings.TrimSpace(line)
+		indented := strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+		switch {
+		case trimmed == "":
+			blank = true
+			return line
+		case indented && (code || blank && !list):
+			code, blank = true, false
+			return line
+		case listItem.MatchString(line):
+			list = true
+		case !indented && blank:
+			list = false
+		}
+		code, blank = false, false
+		return fn(line)
+	})
+}
+
+// ExpandTemplates replaces the template actions of markdown source, outside
+// code, by their value, as text/template would with vars as data: {{.Name}}
+// is the variable Name, and
+//
+//	{{money .Total "EUR"}}      an amount in a currency, e.g. €1,234.50
+//	{{date .Due "2 Jan 2006"}}  a date given as 2006-01-02, in a Go layout
+//	{{number .Hours 1}}         a number, with the given decimals if any
+//
+// are formatted as usual in locale. Actions naming an undefined variable
+// are left as they are, as they may be meant literally, e.g. in a Helm
+// chart; a value that is not a number or date is an error.
+func ExpandTemplates(content []byte, vars map[string]string, locale string) ([]byte, error) {
+	if !templateAction.Match(content) {
+		return content, nil
+	}
+	if locale == "" {
+		locale = "en"
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, fmt.Errorf("locale %q: %w", locale, err)
+	}
+	funcs := templateFuncs(tag)
+	var firstErr error
+	content = mapProseLines(content, func(line string) string {
+		return templateAction.ReplaceAllStringFunc(line, func(action string) string {
+			if strings.HasPrefix(action, "`") || firstErr != nil {
+				return action
+			}
+			t, err := template.New("").Funcs(funcs).Option("missingkey=error").Parse(action)
+			if err == nil && !definedFields(t.Tree.Root, vars) {
+				return action
+			}
+			var b strings.Builder
+			if err == nil {
+				err = t.Execute(&b, vars)
+			}
+			if err != nil {
+				firstErr = fmt.Errorf("%s: %w", action, err)
+				return action
+			}
+			return b.String()
+		})
+	})
+	return content, firstErr
+}
+
+// definedFields reports whether vars defines each variable node refers to;
+// an action with undefined ones is left as written
+func definedFields(node parse.Node, vars map[string]string) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			if !definedFields(child, vars) {
+				return false
+			}
+		}
+	case *parse.ActionNode:
+		return definedFields(n.Pipe, vars)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			if !definedFields(cmd, vars) {
+				return false
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if !definedFields(arg, vars) {
+				return false
+			}
+		}
+	case *parse.ChainNode:
+		return definedFields(n.Node, vars)
+	case *parse.FieldNode:
+		_, ok := vars[n.Ident[0]]
+		return ok
+	}
+	return true
+}
+
+// templateFuncs returns the formatting helpers of the templates, for the
+// locale tag
+func templateFuncs(tag language.Tag) template.FuncMap {
+	p := message.NewPrinter(tag)
+	return template.FuncMap{
+		"money": func(v any, code string) (string, error) {
+			amount, err := templateNumber(v)
+			if err != nil {
+				return "", err
+			}
+			cur, err := currency.ParseISO(code)
+			if err != nil {
+				return "", fmt.Errorf("currency %q: %w", code, err)
+			}
+			scale, _ := currency.Standard.Rounding(cur)
+			num := p.Sprint(number.Decimal(roundHalfUp(amount, scale), number.Scale(scale)))
+			// the symbol as the locale writes it, e.g. € or EUR
+			symbol := strings.Fields(p.Sprint(currency.Symbol(cur.Amount(0))))[0]
+			return placeCurrency(tag, symbol, num), nil
+		},
+		"date": func(v any, layout string) (string, error) {
+			t, err := templateDate(v)
+			if err != nil {
+				return "", err
+			}
+			return localDate(tag, t, layout), nil
+		},
+		"number": func(v any, decimals ...int) (string, error) {
+			n, err := templateNumber(v)
+			if err != nil {
+				return "", err
+			}
+			if len(decimals) > 0 {
+				return p.Sprint(number.Decimal(roundHalfUp(n, decimals[0]), number.Scale(decimals[0]))), nil
+			}
+			return p.Sprint(number.Decimal(n)), nil
+		},
+	}
+}
+
+// templateNumber converts a variable, or a number given in a template, to
+// a float
+func templateNumber(v any) (float64, error) {
+	switch n := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", n)
+		}
+		return f, nil
+	case int:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// roundHalfUp rounds v to decimals places, halves away from zero as on
+// invoices rather than to even
+func roundHalfUp(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
+
+// templateDate converts a variable written as 2006-01-02, or with a time
+// as in RFC 3339, to a time
+func templateDate(v any) (time.Time, error) {
+	if t, ok := v.(time.Time); ok {
+		return t, nil
+	}
+	s := strings.TrimSpace(fmt.Sprint(v))
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date (expected e.g. 2006-01-02)", s)
+}
+
+// currencyAfter lists the languages that write the currency symbol after
+// the amount, as in 1.234,50 €
+var currencyAfter = map[string]bool{"de": true, "fr": true, "es": true, "it": true, "pl": true,
+	"cs": true, "sk": true, "sv": true, "da": true, "fi": true, "nb": true, "no": true,
+	"ru": true, "uk": true, "hu": true, "ro": true, "bg": true, "hr": true, "sl": true,
+	"el": true, "lt": true, "lv": true, "et": true, "pt": true}
+
+// placeCurrency puts the currency symbol before or after the formatted
+// amount num, as usual in the language of tag; a separating space is a
+// no-break space, so that a line is never broken between them
+func placeCurrency(tag language.Tag, symbol, num string) string {
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+	switch {
+	case currencyAfter[base.String()] && region.String() != "CH" && tag != language.BrazilianPortuguese:
+		return num + "\u00a0" + symbol
+	case strings.IndexFunc(symbol, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 || base.String() == "nl" || base.String() == "pt":
+		// codes such as CHF, and Dutch and Portuguese, keep a space
+		return symbol + "\u00a0" + num
+	}
+	return symbol + num
+}
+
+// monthNames and dayNames are the names of months and week days in the
+// languages dates are translated to, full then abbreviated as in Go
+// layouts
+var (
+	monthNames = map[string][]string{
+		"de": strings.Fields("Januar Februar März April Mai Juni Juli August September Oktober November Dezember Jan. Feb. März Apr. Mai Juni Juli Aug. Sept. Okt. Nov. Dez."),
+		"fr": strings.Fields("janvier février mars avril mai juin juillet août septembre octobre novembre décembre janv. févr. mars avr. mai juin juil. août sept. oct. nov. déc."),
+		"es": strings.Fields("enero febrero marzo abril mayo junio julio agosto septiembre octubre noviembre diciembre ene. feb. mar. abr. may. jun. jul. ago. sept. oct. nov. dic."),
+		"it": strings.Fields("gennaio febbraio marzo aprile maggio giugno luglio agosto settembre ottobre novembre dicembre gen feb mar apr mag giu lug ago set ott nov dic"),
+		"nl": strings.Fields("januari februari maart april mei juni juli augustus september oktober november december jan. feb. mrt. apr. mei jun. jul. aug. sep. okt. nov. dec."),
+		"pl": strings.Fields("stycznia lutego marca kwietnia maja czerwca lipca sierpnia września października listopada grudnia sty lut mar kwi maj cze lip sie wrz paź lis gru"),
+		"pt": strings.Fields("janeiro fevereiro março abril maio junho julho agosto setembro outubro novembro dezembro jan. fev. mar. abr. mai. jun. jul. ago. set. out. nov. dez."),
+	}
+	dayNames = map[string][]string{
+		"de": strings.Fields("Sonntag Montag Dienstag Mittwoch Donnerstag Freitag Samstag So. Mo. Di. Mi. Do. Fr. Sa."),
+		"fr": strings.Fields("dimanche lundi mardi mercredi jeudi vendredi samedi dim. lun. mar. mer. jeu. ven. sam."),
+		"es": strings.Fields("domingo lunes martes miércoles jueves viernes sábado dom. lun. mar. mié. jue. vie. sáb."),
+		"it": strings.Fields("domenica lunedì martedì mercoledì giovedì venerdì sabato dom lun mar mer gio ven sab"),
+		"nl": strings.Fields("zondag maandag dinsdag woensdag donderdag vrijdag zaterdag zo ma di wo do vr za"),
+		"pl": strings.Fields("niedziela poniedziałek wtorek środa czwartek piątek sobota niedz. pon. wt. śr. czw. pt. sob."),
+		"pt": strings.Fields("domingo segunda-feira terça-feira quarta-feira quinta-feira sexta-feira sábado dom. seg. ter. qua. qui. sex. sáb."),
+	}
+)
+
+// layoutNames matches the month and week day elements of a Go time layout
+var layoutNames = regexp.MustCompile(`January|Jan|Monday|Mon`)
+
+// localDate formats t with the Go layout, with the month and week day
+// names in the language of tag where known
+func localDate(tag language.Tag, t time.Time, layout string) string {
+	base, _ := tag.Base()
+	months, days := monthNames[base.String()], dayNames[base.String()]
+	if months == nil {
+		return t.Format(layout)
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range layoutNames.FindAllStringIndex(layout, -1) {
+		b.WriteString(t.Format(layout[last:m[0]]))
+		switch layout[m[0]:m[1]] {
+		case "January":
+			b.WriteString(months[t.Month()-1])
+		case "Jan":
+			b.WriteString(months[12+t.Month()-1])
+		case "Monday":
+			b.WriteString(days[t.Weekday()])
+		case "Mon":
+			b.WriteString(days[7+t.Weekday()])
+		}
+		last = m[1]
+	}
+	b.WriteString(t.Format(layout[last:]))
+	return b.String()
+}
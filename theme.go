@@ -0,0 +1,156 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ThemeElements are the styles of a theme, by their key in a custom theme
+// file; see SetStyle
+var ThemeElements = []string{"Normal", "Link", "Backtick", "Code", "Blockquote",
+	"H1", "H2", "H3", "H4", "H5", "H6", "THeader", "TBody"}
+
+// coreFonts are the fonts every PDF viewer has, which need no font file
+var coreFonts = []string{"arial", "courier", "helvetica", "symbol", "times", "zapfdingbats"}
+
+// loadTheme fills r from the content of a custom theme file
+func (r *PdfRenderer) loadTheme(data []byte) error {
+	data, err := blendThemeColors(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, r)
+}
+
+// ValidateTheme checks the content of a custom theme file, as passed to
+// SetCustomTheme: every element of ThemeElements must have a style with a
+// known font (a core font, a preset or an existing TTF file), a positive
+// size, a style made of b, i, u and s and colors in 0-255, and the other
+// keys must be renderer settings of the right type. It returns the
+// problems found, or an error wrapping ErrParse if data is not a JSON
+// object.
+func ValidateTheme(data []byte) ([]string, error) {
+	var theme map[string]json.RawMessage
+	data, err := blendThemeColors(data)
+	if err == nil {
+		err = json.Unmarshal(data, &theme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParse, err)
+	}
+	var problems []string
+	for _, element := range ThemeElements {
+		if _, ok := lookupKey(theme, element); !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing; its text would have size 0", element))
+		}
+	}
+	keys := make([]string, 0, len(theme))
+	for key := range theme {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	fields := reflect.TypeOf(PdfRenderer{})
+	for _, key := range keys {
+		field, ok := fields.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) })
+		if !ok || !field.IsExported() {
+			problems = append(problems, fmt.Sprintf("%s: unknown key", key))
+			continue
+		}
+		var r PdfRenderer
+		if err := json.Unmarshal([]byte(fmt.Sprintf("{%q: %s}", field.Name, theme[key])), &r); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		switch v := reflect.ValueOf(r).FieldByIndex(field.Index).Interface().(type) {
+		case Styler:
+			problems = append(problems, validateStyler(key, v, theme[key])...)
+		case Color:
+			problems = append(problems, validateColor(key, v)...)
+		}
+	}
+	return problems, nil
+}
+
+// lookupKey returns the value of key in theme, matched without regard to
+// case as encoding/json does
+func lookupKey(theme map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	for k, v := range theme {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// validateStyler checks the style s of the element called name, given in
+// the theme file as raw
+func validateStyler(name string, s Styler, raw json.RawMessage) []string {
+	var problems []string
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return []string{fmt.Sprintf("%s: %v", name, err)}
+	}
+	known := reflect.TypeOf(s)
+	for attr := range attrs {
+		if _, ok := known.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, attr) }); !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s: unknown attribute", name, attr))
+		}
+	}
+	_, isPreset := presetFonts[s.Font]
+	switch {
+	case s.Font == "":
+		problems = append(problems, fmt.Sprintf("%s.Font: missing", name))
+	case strings.EqualFold(filepath.Ext(s.Font), ".ttf"):
+		if _, err := os.Stat(s.Font); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.Font: %v", name, err))
+		}
+	case !isPreset && !slices.Contains(coreFonts, strings.ToLower(s.Font)):
+		problems = append(problems, fmt.Sprintf("%s.Font: %q is not a core font, a preset or a .ttf file", name, s.Font))
+	}
+	if strings.Trim(strings.ToLower(s.Style), "bius") != "" {
+		problems = append(problems, fmt.Sprintf("%s.Style: %q is not a combination of b, i, u and s", name, s.Style))
+	}
+	if s.Size <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.Size: %g is not positive", name, s.Size))
+	}
+	if s.Spacing < 0 {
+		problems = append(problems, fmt.Sprintf("%s.Spacing: %g is negative", name, s.Spacing))
+	}
+	problems = append(problems, validateColor(name+".TextColor", s.TextColor)...)
+	problems = append(problems, validateColor(name+".FillColor", s.FillColor)...)
+	return problems
+}
+
+// validateColor checks that the components of c, called name, are in 0-255
+func validateColor(name string, c Color) []string {
+	for _, v := range []int{c.Red, c.Green, c.Blue} {
+		if v < 0 || v > 255 {
+			return []string{fmt.Sprintf("%s: {%d, %d, %d} is out of the 0-255 range", name, c.Red, c.Green, c.Blue)}
+		}
+	}
+	return nil
+}
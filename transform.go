@@ -0,0 +1,54 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// ASTTransformer rewrites the parsed document before it is rendered. It
+// may change the tree in place or replace the root; returning an error
+// stops the run.
+type ASTTransformer func(doc *ast.Node) error
+
+// WithASTTransformer registers t to run between parsing and rendering, after
+// the built-in transformations (details, heading attributes, CSV tables,
+// revision marks) and before headings are numbered and cross-references
+// resolved. Transformers run in the order they are registered.
+func WithASTTransformer(t ASTTransformer) RenderOption {
+	return func(r *PdfRenderer) {
+		r.astTransformers = append(r.astTransformers, t)
+	}
+}
+
+// transform runs the registered AST transformers on doc
+func (r *PdfRenderer) transform(doc *ast.Node) error {
+	for i, t := range r.astTransformers {
+		if err := t(doc); err != nil {
+			return fmt.Errorf("%w: AST transformer %d: %w", ErrParse, i+1, err)
+		}
+		if *doc == nil {
+			return fmt.Errorf("%w: AST transformer %d removed the document", ErrParse, i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// maxMissingReported bounds the characters listed by TextError
+const maxMissingReported = 10
+
+// SetVerifyText makes Process read the text back from the PDF it wrote and
+// compare it with the text of the document, see TextError. Characters that
+// cannot be drawn, such as emoji outside the Basic Multilingual Plane, are
+// otherwise dropped without notice.
+func SetVerifyText(verify bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.VerifyText = verify
+	}
+}
+
+// TextError reports the characters of the document that are missing from
+// the PDF written by the last Process with VerifyText set, or returns nil
+// if there are none. Layout and white space are ignored, and so is text the
+// renderer adds, such as list numbers.
+func (r *PdfRenderer) TextError() error {
+	return r.textErr
+}
+
+// plainText returns the text of the document to be drawn: that of text,
+// with citations and cross-references resolved, code and code blocks, but
+// not the alt text of images, diagrams drawn as images, the markers of
+// spanned table cells or redacted text, drawn as black bars
+func (r *PdfRenderer) plainText(doc ast.Node) string {
+	var text strings.Builder
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		if r.redacted[node] {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Image:
+			return ast.SkipChildren
+		case *ast.TableCell:
+			if r.hasRedacted(n) {
+				return ast.SkipChildren
+			}
+		case *ast.Text:
+			if strings.TrimSpace(string(n.Literal)) != rowSpanMarker {
+				text.WriteString(r.resolveCrossRefs(r.resolveCitations(checkboxes(string(n.Literal)))))
+			}
+		case *ast.Code:
+			text.Write(n.Literal)
+		case *ast.CodeBlock:
+			lang := strings.Fields(strings.ToLower(string(n.Info)))
+			if len(lang) > 0 && DiagramCommands[lang[0]] != nil {
+				break
+			}
+			text.Write(n.Literal)
+		case *detailsSummary:
+			text.Write(n.Literal)
+		}
+		text.WriteByte(' ')
+		return ast.GoToNext
+	})
+	return text.String()
+}
+
+// verifyText compares the text of the document with that of the PDF file
+// written to path
+func (r *PdfRenderer) verifyText(path string) error {
+	pdf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pages, err := ExtractText(pdf)
+	if err != nil {
+		return err
+	}
+	if missing := missingText(r.sourceText, strings.Join(pages, "\n")); missing != "" {
+		r.textErr = fmt.Errorf("text missing from the PDF: %s", missing)
+	}
+	return nil
+}
+
+// missingText lists the characters of source that occur fewer times in
+// text, in the order they first occur in source, with a count and the
+// words around their first occurrence; white space and control characters are
+// ignored
+func missingText(source, text string) string {
+	drawn := map[rune]int{}
+	for _, c := range text {
+		drawn[c]++
+	}
+	var order []rune
+	needed := map[rune]int{}
+	for _, c := range source {
+		if unicode.IsSpace(c) || !unicode.IsGraphic(c) {
+			continue
+		}
+		if needed[c] == 0 {
+			order = append(order, c)
+		}
+		needed[c]++
+	}
+	var list []string
+	for _, c := range order {
+		n := needed[c] - drawn[c]
+		if n <= 0 {
+			continue
+		}
+		if len(list) == maxMissingReported {
+			list = append(list, "...")
+			break
+		}
+		entry := fmt.Sprintf("%q", c)
+		if n > 1 {
+			entry += fmt.Sprintf(" ×%d", n)
+		}
+		list = append(list, fmt.Sprintf("%s in %q", entry, wordsAround(source, c)))
+	}
+	return strings.Join(list, ", ")
+}
+
+// wordsAround returns the words of s before, at and after the first
+// occurrence of c
+func wordsAround(s string, c rune) string {
+	i := strings.IndexRune(s, c)
+	start := strings.LastIndexFunc(strings.TrimRightFunc(s[:i], unicode.IsSpace), unicode.IsSpace) + 1
+	rest := strings.TrimLeftFunc(s[i:], func(r rune) bool { return !unicode.IsSpace(r) })
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	rest = strings.TrimLeftFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+	return strings.Join(strings.Fields(s[start:len(s)-len(rest)]), " ")
+}
@@ -0,0 +1,167 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// PageLayouts are the page layouts of ViewerPreferences, with the fpdf
+// display modes they select: one page at a time, continuous scrolling,
+// two pages side by side as in a printed book (odd pages on the right),
+// or two pages side by side scrolling continuously
+var PageLayouts = map[string]string{
+	"single":         "SinglePage",
+	"continuous":     "OneColumn",
+	"two":            "TwoPageRight",
+	"two-continuous": "TwoColumnRight",
+}
+
+// Zooms are the initial zooms of ViewerPreferences, with the fpdf display
+// modes they select: the whole page, the page width, or actual size
+var Zooms = map[string]string{
+	"page":   "fullpage",
+	"width":  "fullwidth",
+	"actual": "real",
+}
+
+// ViewerPreferences set how a PDF viewer opens the document; empty values
+// leave the choice to the viewer
+type ViewerPreferences struct {
+	Layout        string // one of PageLayouts
+	Zoom          string // one of Zooms
+	HideToolbar   bool
+	ShowBookmarks bool // open with the bookmarks panel; turns on SetBookmarks
+
+	// page number, or "#id" of a heading, the PDF opens at; a heading
+	// matches by its {#id} or its TOC entry ID, e.g. #installation
+	OpenAt string
+}
+
+// openAtSpec matches the ViewerPreferences.OpenAt values
+var openAtSpec = regexp.MustCompile(`^(?:[1-9][0-9]*|#\S+)$`)
+
+// ValidOpenAt tells whether s is a ViewerPreferences.OpenAt value: a page
+// number or the #id of a heading
+func ValidOpenAt(s string) bool {
+	return openAtSpec.MatchString(s)
+}
+
+// openAt is the position the PDF opens at, see ViewerPreferences.OpenAt
+type openAt struct {
+	page int
+	y    float64 // in user units, from the top of the page
+}
+
+// SetViewerPreferences sets how the PDF opens in a viewer. An unknown
+// layout, zoom or OpenAt is ignored with a warning.
+func SetViewerPreferences(prefs ViewerPreferences) RenderOption {
+	return func(r *PdfRenderer) {
+		zoom, layout := "default", "default"
+		if prefs.Layout != "" {
+			if layout = PageLayouts[prefs.Layout]; layout == "" {
+				r.logf("Warning: unknown page layout %q", prefs.Layout)
+				layout, prefs.Layout = "default", ""
+			}
+		}
+		if prefs.Zoom != "" {
+			if zoom = Zooms[prefs.Zoom]; zoom == "" {
+				r.logf("Warning: unknown zoom %q", prefs.Zoom)
+				zoom, prefs.Zoom = "default", ""
+			}
+		}
+		if prefs.OpenAt != "" && !ValidOpenAt(prefs.OpenAt) {
+			r.logf("Warning: invalid place to open the PDF at %q (expected a page number or #heading-id)", prefs.OpenAt)
+			prefs.OpenAt = ""
+		}
+		if prefs.OpenAt != "" {
+			// the open action, with the zoom, is written by viewerCatalog
+			zoom = "default"
+		}
+		r.Pdf.SetDisplayMode(zoom, layout)
+		// the viewer shows the panel if the PDF has an outline
+		if prefs.ShowBookmarks {
+			r.Bookmarks = true
+		}
+		r.ViewerPreferences = prefs
+	}
+}
+
+// markOpenAt records the position of the heading OpenAt names, the first
+// one if several match
+func (r *PdfRenderer) markOpenAt(node *ast.Heading) {
+	id, ok := strings.CutPrefix(r.ViewerPreferences.OpenAt, "#")
+	if !ok || r.openAt != nil {
+		return
+	}
+	if node.HeadingID == id || headingSlug(ExtractTextFromNode(node)) == id {
+		r.openAt = &openAt{page: r.Pdf.PageNo(), y: r.Pdf.GetY()}
+	}
+}
+
+// resolveOpenAt sets the position of an OpenAt page once the document is
+// rendered; a missing page or heading opens the first page, with a warning
+func (r *PdfRenderer) resolveOpenAt() {
+	where := r.ViewerPreferences.OpenAt
+	if where == "" || r.openAt != nil {
+		return
+	}
+	page, err := strconv.Atoi(where)
+	switch {
+	case err != nil:
+		r.logf("Warning: no heading %s to open the PDF at", where)
+		page = 1
+	case page > r.Pdf.PageCount():
+		r.logf("Warning: no page %d to open the PDF at; the document has %d", page, r.Pdf.PageCount())
+		page = 1
+	}
+	r.openAt = &openAt{page: page}
+}
+
+// viewerCatalog returns the catalog entries for the preferences fpdf has
+// no API for, added to the PDF by addAnnotations; pages are the object
+// numbers of the pages
+func (r *PdfRenderer) viewerCatalog(pages []int) string {
+	var entries []string
+	if r.openAt != nil && r.openAt.page <= len(pages) {
+		k := r.Pdf.GetConversionRatio()
+		_, pageHeight := r.pageSize(r.openAt.page)
+		top := (pageHeight - r.openAt.y) * k
+		dest := fmt.Sprintf("/XYZ null %.2f null", top)
+		switch r.ViewerPreferences.Zoom {
+		case "page":
+			dest = "/Fit"
+		case "width":
+			dest = fmt.Sprintf("/FitH %.2f", top)
+		case "actual":
+			dest = fmt.Sprintf("/XYZ null %.2f 1", top)
+		}
+		entries = append(entries, fmt.Sprintf("/OpenAction [%d 0 R %s]", pages[r.openAt.page-1], dest))
+	}
+	if r.ViewerPreferences.HideToolbar {
+		entries = append(entries, "/ViewerPreferences <</HideToolbar true>>")
+	}
+	return strings.Join(entries, "\n")
+}
@@ -0,0 +1,283 @@
+/*
+ * Markdown to PDF Converter
+ * Available at http://github.com/solworktech/md2pdf
+ *
+ * Copyright © Cecil New <cecil.new@gmail.com>, Jesse Portnoy <jesse@packman.io>.
+ * Distributed under the MIT License.
+ * See README.md for details.
+ *
+ * Dependencies
+ * This package depends on two other packages:
+ *
+ * Go Markdown processor
+ *   Available at https://github.com/gomarkdown/markdown
+ *
+ * fpdf - a PDF document generator with high level support for
+ *   text, drawing and images.
+ *   Available at https://codeberg.org/go-pdf/fpdf
+ */
+
+package mdtopdf
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// SetWikiLinks resolves the wiki links and embeds of a single document as
+// those of a document merged from files, marked with <!-- file "path" -->
+// comments, always are; otherwise [[text]] is left as it is written, as in
+// [[ -f x ]] or a [[1]] citation. A single document has no other notes, so
+// only its headings and images are found.
+func SetWikiLinks(value bool) RenderOption {
+	return func(r *PdfRenderer) {
+		r.WikiLinks = value
+	}
+}
+
+// wikiFiles are the files of a merged document and the vault they are in,
+// for resolving wiki links and embeds, see wikiLinks
+type wikiFiles struct {
+	files  []string // as given by <!-- file "path" -->
+	root   string   // the directory the files are in
+	images map[string]string
+}
+
+// wikiLinks resolves the Obsidian style wiki links left by the link
+// resolver, if any, within the document:
+//
+//	[[Page]], [[Page|text]]   the start of the merged file Page.md, found by
+//	                          its name or the end of its path, e.g. notes/Page
+//	[[Page#Heading]]          a heading of that file, [[#Heading]] one of
+//	                          the file the link is in
+//	![[image.png]]            the image, next to the file or anywhere in the
+//	                          input directory; ![[image.png|300]] is 300px
+//	                          wide
+//	![[Page]]                 a link to the note, whose content is already
+//	                          in the document
+//
+// Links without a target are written as their text and reported, see
+// LinkError; images outside the input directory are left out. A single
+// document keeps its wiki links as written unless WikiLinks is set. Must be
+// called before collectFileLinks.
+func (r *PdfRenderer) wikiLinks(doc ast.Node) {
+	var texts []*ast.Text
+	files := map[*ast.Text]string{}
+	w := &wikiFiles{root: r.InputBaseDir}
+	var file string
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Link, *ast.Image, *ast.CodeBlock, *ast.Code:
+			return ast.SkipChildren
+		case *ast.HTMLBlock:
+			if d, ok := parseDirective(n.Literal); ok && d.name == "file" && len(d.args) > 0 {
+				file = d.args[0]
+				w.files = append(w.files, file)
+			}
+		case *ast.Text:
+			if entering && wikiLink.Match(n.Literal) {
+				texts = append(texts, n)
+				files[n] = file
+			}
+		}
+		return ast.GoToNext
+	})
+	if len(texts) == 0 || len(w.files) == 0 && !r.WikiLinks {
+		return
+	}
+	if len(w.files) > 0 {
+		w.root = commonDir(w.files)
+	}
+	for _, t := range texts {
+		var nodes []ast.Node
+		s, start := string(t.Literal), 0
+		for _, m := range wikiLink.FindAllStringSubmatchIndex(s, -1) {
+			target, text := strings.TrimSpace(s[m[2]:m[3]]), ""
+			if m[4] >= 0 {
+				text = strings.TrimSpace(s[m[4]:m[5]])
+			}
+			from := m[0]
+			embed := from > 0 && s[from-1] == '!'
+			if embed {
+				from--
+			}
+			if from > start {
+				nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:from])}})
+			}
+			start = m[1]
+			if embed && isImageFile(target) {
+				dest, ok := w.image(target, files[t])
+				if !ok {
+					r.imageFailed(target, fmt.Errorf("outside the input directory %s", w.root))
+					continue
+				}
+				img := &ast.Image{Destination: []byte(dest)}
+				ast.AppendChild(img, &ast.Text{Leaf: ast.Leaf{Literal: []byte(target)}})
+				if text != "" {
+					width, _, _ := strings.Cut(text, "x")
+					img.Attribute = &ast.Attribute{Attrs: map[string][]byte{"width": []byte(width + "px")}}
+				}
+				nodes = append(nodes, img)
+				continue
+			}
+			if text == "" {
+				text = strings.ReplaceAll(strings.TrimPrefix(target, "#"), "#", " > ")
+			}
+			if dest, ok := r.wikiDestination(doc, w, target, files[t]); ok {
+				a := &ast.Link{Destination: []byte(dest)}
+				ast.AppendChild(a, &ast.Text{Leaf: ast.Leaf{Literal: []byte(text)}})
+				nodes = append(nodes, a)
+				continue
+			}
+			r.brokenLink("[[" + target + "]]")
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(text)}})
+		}
+		if start < len(s) {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: []byte(s[start:])}})
+		}
+		replaceNode(t, nodes...)
+	}
+}
+
+// wikiDestination returns the destination of the wiki link to target from
+// file, as for a [text](dest) link
+func (r *PdfRenderer) wikiDestination(doc ast.Node, w *wikiFiles, target, file string) (string, bool) {
+	page, heading, _ := strings.Cut(target, "#")
+	if i := strings.LastIndex(heading, "#"); i >= 0 {
+		heading = heading[i+1:]
+	}
+	if strings.HasPrefix(heading, "^") {
+		// a block reference goes to the page
+		heading = ""
+	}
+	id := githubSlug(heading)
+	if len(w.files) == 0 {
+		if page != "" || id == "" {
+			return "", false
+		}
+		return headingID(doc, id)
+	}
+	to := file
+	if page != "" {
+		if to = w.page(page); to == "" {
+			return "", false
+		}
+	}
+	rel, err := filepath.Rel(filepath.Dir(file), to)
+	if err != nil {
+		return "", false
+	}
+	dest := filepath.ToSlash(rel)
+	if id != "" {
+		dest += "#" + id
+	}
+	return dest, true
+}
+
+// page returns the merged file a wiki link names, by its name or the end
+// of its path, without regard to case; the shortest path wins
+func (w *wikiFiles) page(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(filepath.ToSlash(name), ".md"))
+	var found string
+	for _, f := range w.files {
+		p := strings.ToLower(filepath.ToSlash(f))
+		p = strings.TrimSuffix(p, filepath.Ext(p))
+		if (p == name || strings.HasSuffix(p, "/"+name)) && (found == "" || len(f) < len(found)) {
+			found = f
+		}
+	}
+	return found
+}
+
+// image returns the path of an embedded image: next to file, or else the
+// first of that name in the input directory, skipping hidden directories
+// such as .obsidian. It reports false for an image outside the input
+// directory, the current one if it is not known, which is then not searched.
+func (w *wikiFiles) image(name, file string) (string, bool) {
+	dir, root := w.root, w.root
+	if file != "" {
+		dir = filepath.Dir(file)
+	}
+	if root == "" {
+		root = "."
+	}
+	if p := filepath.Join(dir, filepath.FromSlash(name)); fileExists(p) {
+		return p, insideDir(p, root)
+	}
+	if w.images == nil && w.root != "" {
+		w.images = map[string]string{}
+		_ = filepath.WalkDir(w.root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && p != w.root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, ok := w.images[strings.ToLower(d.Name())]; !ok && !d.IsDir() {
+				w.images[strings.ToLower(d.Name())] = p
+			}
+			return nil
+		})
+	}
+	if p, ok := w.images[strings.ToLower(filepath.Base(name))]; ok {
+		return p, true
+	}
+	return name, !filepath.IsAbs(name) && insideDir(filepath.Join(root, name), root)
+}
+
+// headingID returns the destination of the heading of a single document
+// whose ID, or title as GitHub makes an ID of it, is id, giving it that ID
+// if it has none
+func headingID(doc ast.Node, id string) (string, bool) {
+	var found *ast.Heading
+	taken := false
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if h, ok := node.(*ast.Heading); ok && entering {
+			if h.HeadingID == id {
+				taken = true
+			}
+			if found == nil && (h.HeadingID == id || githubSlug(ExtractTextFromNode(h)) == id) {
+				found = h
+			}
+		}
+		return ast.GoToNext
+	})
+	if found == nil || found.HeadingID == "" && taken {
+		return "", false
+	}
+	if found.HeadingID == "" {
+		found.HeadingID = id
+	}
+	return "#" + found.HeadingID, true
+}
+
+// commonDir returns the deepest directory all files are in
+func commonDir(files []string) string {
+	dir := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for !strings.HasPrefix(filepath.Dir(f)+string(filepath.Separator), dir+string(filepath.Separator)) && dir != "." && dir != filepath.Dir(dir) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// isImageFile reports whether an embed names an image, by its extension
+func isImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp", ".tif", ".tiff", ".heic", ".heif":
+		return true
+	}
+	return false
+}
+
+// fileExists reports whether p is an existing file
+func fileExists(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir()
+}